@@ -0,0 +1,31 @@
+package simpleblob
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// An AbsentStorer is an Interface providing a way to store a blob only if
+// it does not exist yet, as a single atomic operation.
+type AbsentStorer interface {
+	Interface
+	// StoreIfAbsent stores data under name, unless a blob with this name
+	// already exists. In that case it returns an error wrapping os.ErrExist
+	// and leaves the existing blob untouched.
+	StoreIfAbsent(ctx context.Context, name string, data []byte) error
+}
+
+// StoreIfAbsent stores data to the named blob in st, only if it does not
+// exist yet. It returns an error wrapping os.ErrExist if it does.
+// Of all concurrent callers using the same name, at most one succeeds, which
+// makes it suitable to claim a job or take a lock.
+//
+// As this cannot be emulated safely, it returns an error wrapping
+// errors.ErrUnsupported if st does not implement AbsentStorer.
+func StoreIfAbsent(ctx context.Context, st Interface, name string, data []byte) error {
+	if as, ok := st.(AbsentStorer); ok {
+		return as.StoreIfAbsent(ctx, name, data)
+	}
+	return fmt.Errorf("store if absent %q: %w", name, errors.ErrUnsupported)
+}
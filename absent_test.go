@@ -0,0 +1,99 @@
+package simpleblob_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/PowerDNS/simpleblob"
+	"github.com/PowerDNS/simpleblob/backends/memory"
+	"github.com/PowerDNS/simpleblob/backends/tiered"
+	"github.com/PowerDNS/simpleblob/wrappers/chaos"
+	"github.com/PowerDNS/simpleblob/wrappers/circuitbreaker"
+	"github.com/PowerDNS/simpleblob/wrappers/coalesce"
+	"github.com/PowerDNS/simpleblob/wrappers/hashprefix"
+	"github.com/PowerDNS/simpleblob/wrappers/latency"
+	"github.com/PowerDNS/simpleblob/wrappers/metrics"
+	"github.com/PowerDNS/simpleblob/wrappers/namepolicy"
+	"github.com/PowerDNS/simpleblob/wrappers/ratelimit"
+	"github.com/PowerDNS/simpleblob/wrappers/retry"
+)
+
+func TestStoreIfAbsent(t *testing.T) {
+	ctx := context.Background()
+	st := memory.New()
+
+	assert.NoError(t, simpleblob.StoreIfAbsent(ctx, st, "job", []byte("first")))
+	err := simpleblob.StoreIfAbsent(ctx, st, "job", []byte("second"))
+	assert.ErrorIs(t, err, os.ErrExist)
+	data, err := st.Load(ctx, "job")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("first"), data)
+
+	// Backends without support are not emulated
+	plain := struct{ simpleblob.Interface }{st}
+	err = simpleblob.StoreIfAbsent(ctx, plain, "other", nil)
+	assert.ErrorIs(t, err, errors.ErrUnsupported)
+}
+
+func TestStoreIfAbsent_wrappers(t *testing.T) {
+	ctx := context.Background()
+	for name, wrap := range map[string]func(st simpleblob.Interface) (simpleblob.Interface, error){
+		"retry": func(st simpleblob.Interface) (simpleblob.Interface, error) {
+			return retry.New(st, retry.Options{}), nil
+		},
+		"metrics": func(st simpleblob.Interface) (simpleblob.Interface, error) {
+			return metrics.New(st, metrics.Options{Registerer: prometheus.NewRegistry()})
+		},
+		"namepolicy": func(st simpleblob.Interface) (simpleblob.Interface, error) {
+			return namepolicy.New(st, namepolicy.Options{}), nil
+		},
+		"hashprefix": func(st simpleblob.Interface) (simpleblob.Interface, error) {
+			return hashprefix.New(st, hashprefix.Options{})
+		},
+		"ratelimit": func(st simpleblob.Interface) (simpleblob.Interface, error) {
+			return ratelimit.New(st, ratelimit.Options{}), nil
+		},
+		"latency": func(st simpleblob.Interface) (simpleblob.Interface, error) {
+			return latency.New(st, latency.Options{}), nil
+		},
+		"chaos": func(st simpleblob.Interface) (simpleblob.Interface, error) {
+			return chaos.New(st, chaos.Options{}), nil
+		},
+		"circuitbreaker": func(st simpleblob.Interface) (simpleblob.Interface, error) {
+			return circuitbreaker.New(st, circuitbreaker.Options{})
+		},
+		"coalesce": func(st simpleblob.Interface) (simpleblob.Interface, error) {
+			return coalesce.New(st), nil
+		},
+		"tiered through": func(st simpleblob.Interface) (simpleblob.Interface, error) {
+			return tiered.New(ctx, memory.New(), st, tiered.Options{WritePolicy: tiered.WriteThrough})
+		},
+		"tiered back": func(st simpleblob.Interface) (simpleblob.Interface, error) {
+			return tiered.New(ctx, memory.New(), st, tiered.Options{WritePolicy: tiered.WriteBack})
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			b, err := wrap(memory.New())
+			require.NoError(t, err)
+			require.NoError(t, b.Store(ctx, "stored", []byte("old")))
+
+			assert.NoError(t, simpleblob.StoreIfAbsent(ctx, b, "job", []byte("first")))
+			assert.ErrorIs(t, simpleblob.StoreIfAbsent(ctx, b, "job", []byte("second")), os.ErrExist)
+			assert.ErrorIs(t, simpleblob.StoreIfAbsent(ctx, b, "stored", []byte("new")), os.ErrExist)
+			data, err := b.Load(ctx, "job")
+			assert.NoError(t, err)
+			assert.Equal(t, []byte("first"), data)
+
+			// Not emulated either when wrapped
+			b, err = wrap(struct{ simpleblob.Interface }{memory.New()})
+			require.NoError(t, err)
+			assert.ErrorIs(t, simpleblob.StoreIfAbsent(ctx, b, "job", nil), errors.ErrUnsupported)
+		})
+	}
+}
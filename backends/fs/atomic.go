@@ -2,6 +2,7 @@ package fs
 
 import (
 	"fmt"
+	"hash/fnv"
 	"os"
 	"path/filepath"
 )
@@ -15,7 +16,19 @@ func createAtomic(fpath string) (*atomicFile, error) {
 	// Using the PID under the assumption that the same program will not be writing to
 	// the same path at the same time. An overwrite later on retry is desired, if
 	// not cleaned properly.
-	tmp := fmt.Sprintf("%s.%d%s", fpath, os.Getpid(), ignoreSuffix)
+	tmp := tempPath(fpath, os.Getpid())
+
+	// Where supported, the file has no name until Close, so nothing is left
+	// behind if the process crashes while writing.
+	if file, err := openUnnamed(filepath.Dir(fpath)); err == nil {
+		return &atomicFile{
+			file:    file,
+			path:    fpath,
+			tmp:     tmp,
+			unnamed: true,
+		}, nil
+	}
+
 	file, err := os.Create(tmp)
 	if err != nil {
 		return nil, fmt.Errorf("create atomic file %q: %w", fpath, err)
@@ -27,12 +40,39 @@ func createAtomic(fpath string) (*atomicFile, error) {
 	}, nil
 }
 
+// maxFileName is the usual limit of the length of file names, in bytes.
+const maxFileName = 255
+
+// tempPath returns the path of the temporary file for fpath. If the name
+// of the file would be too long, the base name of fpath is shortened and
+// a hash of it is added, to avoid collisions.
+func tempPath(fpath string, pid int) string {
+	dir, base := filepath.Split(fpath)
+	suffix := fmt.Sprintf(".%d%s", pid, ignoreSuffix)
+	if len(base)+len(suffix) > maxFileName {
+		h := fnv.New64a()
+		_, _ = h.Write([]byte(base))
+		hash := fmt.Sprintf(".%016x", h.Sum64())
+		base = base[:maxFileName-len(suffix)-len(hash)] + hash
+	}
+	return dir + base + suffix
+}
+
 // atomicFile implements an io.WriteCloser that writes to a temp file and moves it
 // atomically into place on Close.
 type atomicFile struct {
-	file *os.File // The underlying file being written to.
-	path string   // The final path of the file.
-	tmp  string   // The path of the file during write.
+	file    *os.File // The underlying file being written to.
+	path    string   // The final path of the file.
+	tmp     string   // The path of the file during write, or before the rename if unnamed.
+	unnamed bool     // Whether file was created without a name, see openUnnamed.
+	sync    string   // The Sync option, empty for SyncFull.
+
+	// reserve is called with the final size before moving the file into
+	// place, if set. The returned function undoes the reservation.
+	reserve func(size int64) (func(), error)
+	// committed is called with the final size once the file is in place,
+	// if set.
+	committed func(size int64)
 }
 
 // Write implements io.Writer
@@ -44,17 +84,21 @@ func (f *atomicFile) Write(data []byte) (int, error) {
 // after Close, it does nothing. This makes it useful in a defer.
 func (f *atomicFile) Clean() {
 	_ = f.file.Close()
-	_ = os.Remove(f.tmp)
+	if !f.unnamed {
+		_ = os.Remove(f.tmp)
+	}
 }
 
 // Close closes the temp file and moves it to the final destination.
 func (f *atomicFile) Close() error {
 	var err error
+	undo := func() {}
 	defer func() {
 		if err != nil {
 			// The rename did not happen and we're left with
 			// the temporary file hanging.
 			_ = os.Remove(f.tmp)
+			undo()
 		}
 	}()
 
@@ -63,9 +107,35 @@ func (f *atomicFile) Close() error {
 	// Behaviour is inconsistent across devices and C standard libraries.
 	// Syncing file AND its parent directory (here) ensure this.
 	// See fsync(2) and open(2).
-	if err = f.file.Sync(); err != nil {
-		_ = f.file.Close()
-		return err
+	if f.sync != SyncNone {
+		if err = f.file.Sync(); err != nil {
+			_ = f.file.Close()
+			return err
+		}
+	}
+	var size int64
+	if f.reserve != nil || f.committed != nil {
+		var info os.FileInfo
+		if info, err = f.file.Stat(); err != nil {
+			_ = f.file.Close()
+			return err
+		}
+		size = info.Size()
+	}
+	if f.reserve != nil {
+		if undo, err = f.reserve(size); err != nil {
+			_ = f.file.Close()
+			return err
+		}
+	}
+	if f.unnamed {
+		// A link cannot replace an existing file, so give it the
+		// temporary name first.
+		_ = os.Remove(f.tmp)
+		if err = linkUnnamed(f.file, f.tmp); err != nil {
+			_ = f.file.Close()
+			return err
+		}
 	}
 	if err = f.file.Close(); err != nil {
 		return err
@@ -75,6 +145,13 @@ func (f *atomicFile) Close() error {
 	if err = os.Rename(f.tmp, f.path); err != nil {
 		return err
 	}
+	undo = func() {} // the file is in place now
+	if f.committed != nil {
+		f.committed(size)
+	}
+	if f.sync == SyncNone || f.sync == SyncData {
+		return nil
+	}
 
 	var dir *os.File
 	dir, err = os.Open(filepath.Dir(f.path))
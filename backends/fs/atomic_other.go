@@ -0,0 +1,17 @@
+//go:build !linux
+
+package fs
+
+import (
+	"errors"
+	"os"
+)
+
+// openUnnamed is only supported on Linux.
+func openUnnamed(dir string) (*os.File, error) {
+	return nil, errors.ErrUnsupported
+}
+
+func linkUnnamed(f *os.File, path string) error {
+	return errors.ErrUnsupported
+}
@@ -0,0 +1,61 @@
+package fs
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultTempMaxAge is the default value for TempMaxAge.
+const DefaultTempMaxAge = 24 * time.Hour
+
+// cleanup tracks the periodic removal of stale temporary files.
+type cleanup struct {
+	mu      sync.Mutex
+	last    time.Time
+	running bool
+}
+
+// cleanTemp removes the temporary files older than TempMaxAge, which were
+// left behind by crashed writers. It is best effort, errors are ignored.
+func (b *Backend) cleanTemp() {
+	cutoff := time.Now().Add(-b.opt.TempMaxAge)
+	_ = filepath.WalkDir(b.rootPath, func(fpath string, e os.DirEntry, err error) error {
+		if err != nil {
+			return nil // skip what we cannot read
+		}
+		if !e.Type().IsRegular() || !strings.HasSuffix(e.Name(), ignoreSuffix) {
+			return nil
+		}
+		info, err := e.Info()
+		if err != nil || info.ModTime().After(cutoff) {
+			return nil
+		}
+		_ = os.Remove(fpath)
+		return nil
+	})
+}
+
+// maybeCleanTemp starts cleanTemp in the background if CleanupInterval has
+// elapsed since the last time.
+func (b *Backend) maybeCleanTemp() {
+	if b.opt.CleanupInterval <= 0 || b.opt.TempMaxAge < 0 {
+		return
+	}
+	c := &b.cleanup
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.running || time.Since(c.last) < b.opt.CleanupInterval {
+		return
+	}
+	c.running = true
+	go func() {
+		b.cleanTemp()
+		c.mu.Lock()
+		c.last = time.Now()
+		c.running = false
+		c.mu.Unlock()
+	}()
+}
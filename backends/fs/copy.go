@@ -0,0 +1,55 @@
+package fs
+
+import (
+	"context"
+	"io"
+	"os"
+)
+
+// Copy satisfies simpleblob.Copier. Where the filesystem supports it, like
+// btrfs or XFS on Linux and APFS on macOS, the copy is a reflink sharing the
+// data blocks of src until either file is modified, which makes it instant.
+func (b *Backend) Copy(ctx context.Context, src, dst string) (err error) {
+	defer observe("copy")(&err)
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if !allowedName(src) {
+		return os.ErrNotExist
+	}
+	if !allowedName(dst) {
+		return os.ErrPermission
+	}
+	srcPath, err := b.readPath(src)
+	if err != nil {
+		return err
+	}
+	in, err := os.Open(srcPath)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	dstPath, err := b.mkdirs(dst)
+	if err != nil {
+		return err
+	}
+	f, err := b.createBlob(dstPath)
+	if err != nil {
+		return err
+	}
+	if err := cloneFile(f, in); err != nil {
+		// Not supported, like ENOTSUP or EXDEV, fall back to copying the
+		// data. On Linux, this still avoids copying it through user space.
+		if _, err := io.Copy(f.file, in); err != nil {
+			f.Clean()
+			return err
+		}
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	b.deleteMetadata(dst)
+	return nil
+}
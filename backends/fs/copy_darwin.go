@@ -0,0 +1,40 @@
+package fs
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// cloneFile makes f a clone of src using clonefile(2), which is supported
+// by APFS. As clonefile creates the file, the temporary file of f is
+// replaced. If this fails, f is left as an empty file.
+func cloneFile(f *atomicFile, src *os.File) error {
+	info, err := f.file.Stat()
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(f.tmp); err != nil {
+		return err
+	}
+	cloneErr := unix.Clonefile(src.Name(), f.tmp, unix.CLONE_NOFOLLOW)
+	var file *os.File
+	if cloneErr == nil {
+		file, err = os.OpenFile(f.tmp, os.O_RDWR, 0)
+		if err == nil {
+			err = file.Chmod(info.Mode().Perm())
+		}
+	} else {
+		_ = os.Remove(f.tmp)
+		file, err = os.OpenFile(f.tmp, os.O_RDWR|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+	}
+	if err != nil {
+		if file != nil {
+			_ = file.Close()
+		}
+		return err
+	}
+	_ = f.file.Close()
+	f.file = file
+	return cloneErr
+}
@@ -0,0 +1,12 @@
+package fs
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// cloneFile makes f a reflink of src using the FICLONE ioctl.
+func cloneFile(f *atomicFile, src *os.File) error {
+	return unix.IoctlFileClone(int(f.file.Fd()), int(src.Fd()))
+}
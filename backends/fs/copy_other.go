@@ -0,0 +1,13 @@
+//go:build !linux && !darwin
+
+package fs
+
+import (
+	"errors"
+	"os"
+)
+
+// cloneFile is only supported on Linux and macOS.
+func cloneFile(f *atomicFile, src *os.File) error {
+	return errors.ErrUnsupported
+}
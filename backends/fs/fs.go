@@ -4,9 +4,11 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"path"
 	"path/filepath"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/PowerDNS/simpleblob"
 )
@@ -18,42 +20,140 @@ const ignoreSuffix = ".tmp"
 // Options describes the storage options for the fs backend
 type Options struct {
 	RootPath string `yaml:"root_path"`
+	// GlobalPrefix is a prefix applied to all operations, like the option
+	// of the s3 backend. It is mapped to a subdirectory of RootPath, so a
+	// trailing '/' is implied: "foo" and "foo/" are equivalent.
+	// It must be a valid prefix according to simpleblob.CheckPrefix.
+	GlobalPrefix string `yaml:"global_prefix"`
+	// FileMode sets the permissions of created files. By default, files
+	// are created with mode 0666 minus the umask.
+	FileMode os.FileMode `yaml:"file_mode"`
+	// DirMode sets the permissions of created directories. By default,
+	// directories are created with mode 0755 minus the umask.
+	DirMode os.FileMode `yaml:"dir_mode"`
+	// UID and GID set the owner of created files and directories. This
+	// usually requires root privileges. A value of 0 leaves it unchanged.
+	UID int `yaml:"uid"`
+	GID int `yaml:"gid"`
+	// MaxBytes and MaxObjects limit the total size and number of blobs.
+	// Storing a blob that would exceed them fails with ErrQuotaExceeded.
+	// The usage is computed at startup and then tracked by the backend, so
+	// changes made by other processes are not taken into account.
+	// A value of 0 means no limit.
+	MaxBytes   int64 `yaml:"max_bytes"`
+	MaxObjects int64 `yaml:"max_objects"`
+	// Symlinks sets how symlinks found under the root path are handled:
+	// SymlinksSkip (the default), SymlinksFollow or SymlinksReject.
+	// List never walks into symlinks to directories.
+	Symlinks string `yaml:"symlinks"`
+	// Sync sets how stored blobs are flushed to disk: SyncFull (the
+	// default) syncs the file and its directory, SyncData only the file,
+	// and SyncNone leaves it to the OS. Only use SyncNone for data that
+	// can be recreated, as a crash can leave blobs empty or missing.
+	Sync string `yaml:"sync"`
+	// TempMaxAge is the age after which temporary files left behind by
+	// crashed writers are removed, at startup and every CleanupInterval.
+	// It defaults to DefaultTempMaxAge, and a negative value disables the
+	// removal.
+	TempMaxAge time.Duration `yaml:"temp_max_age"`
+	// CleanupInterval enables the periodic removal of temporary files,
+	// started by a write operation when the interval has elapsed.
+	// By default, they are only removed at startup.
+	CleanupInterval time.Duration `yaml:"cleanup_interval"`
 }
 
+// Values for the Sync option
+const (
+	SyncFull = "full"
+	SyncData = "data"
+	SyncNone = "none"
+)
+
 type Backend struct {
 	rootPath string
+	opt      Options
+	quota    *quota // nil without limits
+	cleanup  cleanup
 }
 
-func (b *Backend) List(ctx context.Context, prefix string) (simpleblob.BlobList, error) {
+func (b *Backend) List(ctx context.Context, prefix string) (_ simpleblob.BlobList, err error) {
+	defer observe("list")(&err)
+
 	var blobs simpleblob.BlobList
 
-	entries, err := os.ReadDir(b.rootPath)
-	if err != nil {
-		return nil, err
+	// Only walk the deepest directory that contains all matching names
+	start := b.rootPath
+	if i := strings.LastIndex(prefix, "/"); i > 0 {
+		if simpleblob.CheckPrefix(prefix[:i+1]) != nil {
+			return nil, nil // no allowed name can match
+		}
+		start = b.path(prefix[:i])
 	}
 
-	for _, e := range entries {
-		if !e.Type().IsRegular() {
-			continue
+	err = filepath.WalkDir(start, func(fpath string, e os.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && fpath != b.rootPath {
+				return nil // not created yet, or removed in the meantime
+			}
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if fpath == b.rootPath {
+			return nil
+		}
+		rel, err := filepath.Rel(b.rootPath, fpath)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		if e.IsDir() {
+			if strings.HasPrefix(e.Name(), ".") {
+				return filepath.SkipDir
+			}
+			// Prune directories that cannot contain matching names
+			dir := name + "/"
+			if !strings.HasPrefix(dir, prefix) && !strings.HasPrefix(prefix, dir) {
+				return filepath.SkipDir
+			}
+			return nil
 		}
-		name := e.Name()
 		if !allowedName(name) {
-			continue
+			return nil
 		}
 		if !strings.HasPrefix(name, prefix) {
-			continue
+			return nil
 		}
 		info, err := e.Info()
+		if err == nil && e.Type()&os.ModeSymlink != 0 {
+			switch b.opt.Symlinks {
+			case SymlinksFollow:
+				info, err = os.Stat(fpath)
+			case SymlinksReject:
+				return b.symlinkError(fpath)
+			default:
+				return nil
+			}
+		}
 		if err != nil {
 			if os.IsNotExist(err) {
-				continue // could have been removed in the meantime
+				return nil // could have been removed in the meantime
 			}
-			return nil, err
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
 		}
 		blobs = append(blobs, simpleblob.Blob{
-			Name: name,
-			Size: info.Size(),
+			Name:    name,
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
 		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	sort.Slice(blobs, func(i, j int) bool {
@@ -62,47 +162,211 @@ func (b *Backend) List(ctx context.Context, prefix string) (simpleblob.BlobList,
 	return blobs, nil
 }
 
-func (b *Backend) Load(ctx context.Context, name string) ([]byte, error) {
+func (b *Backend) Load(ctx context.Context, name string) (_ []byte, err error) {
+	defer observe("load")(&err)
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	if !allowedName(name) {
 		return nil, os.ErrNotExist
 	}
-	fullPath := filepath.Join(b.rootPath, name)
-	return os.ReadFile(fullPath)
+	fullPath, err := b.readPath(name)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(fullPath)
+	if err != nil {
+		return nil, err
+	}
+	metricReadBytes.Add(float64(len(data)))
+	return data, nil
+}
+
+func (b *Backend) Store(ctx context.Context, name string, data []byte) (err error) {
+	defer observe("store")(&err)
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if !allowedName(name) {
+		return os.ErrPermission
+	}
+	fullPath, err := b.mkdirs(name)
+	if err != nil {
+		return err
+	}
+	f, err := b.createBlob(fullPath)
+	if err != nil {
+		return err
+	}
+	if err := writeAtomic(f, data); err != nil {
+		return err
+	}
+	b.deleteMetadata(name)
+	return nil
 }
 
-func (b *Backend) Store(ctx context.Context, name string, data []byte) error {
+// StoreIfAbsent satisfies simpleblob.AbsentStorer. The file is created with
+// O_EXCL, so unlike Store, the content is written in place and a concurrent
+// Load may see it partially written.
+func (b *Backend) StoreIfAbsent(ctx context.Context, name string, data []byte) (err error) {
+	defer observe("store")(&err)
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	if !allowedName(name) {
 		return os.ErrPermission
 	}
-	fullPath := filepath.Join(b.rootPath, name)
-	tmpPath := fullPath + ignoreSuffix // ignored by List()
-	if err := writeFile(tmpPath, data); err != nil {
+	fullPath, err := b.mkdirs(name)
+	if err != nil {
 		return err
 	}
-	if err := syncDir(b.rootPath); err != nil {
+	undo, err := b.reserve(fullPath, int64(len(data)))
+	if err != nil {
 		return err
 	}
-	return os.Rename(tmpPath, fullPath)
+	f, err := os.OpenFile(fullPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o666)
+	if err != nil {
+		undo()
+		return err
+	}
+	err = b.setPerms(f)
+	if err == nil {
+		_, err = f.Write(data)
+	}
+	if err == nil && b.opt.Sync != SyncNone {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(fullPath)
+		undo()
+		return err
+	}
+	metricWrittenBytes.Add(float64(len(data)))
+	b.deleteMetadata(name) // left behind by a crash
+	if b.opt.Sync == SyncNone || b.opt.Sync == SyncData {
+		return nil
+	}
+	return syncDir(filepath.Dir(fullPath))
+}
+
+// Stat satisfies simpleblob.Statter.
+func (b *Backend) Stat(ctx context.Context, name string) (_ simpleblob.BlobInfo, err error) {
+	defer observe("stat")(&err)
+
+	if err := ctx.Err(); err != nil {
+		return simpleblob.BlobInfo{}, err
+	}
+	if !allowedName(name) {
+		return simpleblob.BlobInfo{}, os.ErrNotExist
+	}
+	fullPath, err := b.readPath(name)
+	if err != nil {
+		return simpleblob.BlobInfo{}, err
+	}
+	info, err := os.Stat(fullPath)
+	if err != nil {
+		return simpleblob.BlobInfo{}, err
+	}
+	if !info.Mode().IsRegular() {
+		return simpleblob.BlobInfo{}, fmt.Errorf("stat %q: %w", name, os.ErrNotExist)
+	}
+	return simpleblob.BlobInfo{
+		Blob: simpleblob.Blob{Name: name, Size: info.Size(), ModTime: info.ModTime()},
+	}, nil
 }
 
-func (b *Backend) Delete(ctx context.Context, name string) error {
+func (b *Backend) Delete(ctx context.Context, name string) (err error) {
+	defer observe("delete")(&err)
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	if !allowedName(name) {
 		return os.ErrPermission
 	}
-	err := os.Remove(filepath.Join(b.rootPath, name))
+	fullPath, err := b.readPath(name)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var size int64
+	if b.quota != nil {
+		info, err := os.Stat(fullPath)
+		if err == nil {
+			size = info.Size()
+		}
+	}
+	err = os.Remove(fullPath)
 	if os.IsNotExist(err) {
 		return nil
 	}
-	return err
+	if err != nil {
+		return err
+	}
+	if b.quota != nil {
+		_ = b.quota.update(size, -1)
+	}
+	b.removeEmptyDirs(name)
+	b.deleteMetadata(name)
+	return nil
+}
+
+// path returns the path of the file for the named blob.
+func (b *Backend) path(name string) string {
+	return filepath.Join(b.rootPath, filepath.FromSlash(name))
+}
+
+// mkdirs creates the directories needed to store the named blob, and returns
+// the path of its file.
+func (b *Backend) mkdirs(name string) (string, error) {
+	fullPath, err := b.writePath(name)
+	if err != nil {
+		return "", err
+	}
+	if !strings.Contains(name, "/") {
+		return fullPath, nil
+	}
+	if err := b.mkdirAll(filepath.Dir(fullPath)); err != nil {
+		return "", err
+	}
+	return fullPath, nil
+}
+
+// removeEmptyDirs removes the parent directories of the named blob that
+// became empty, up to the root path. A concurrent Store in one of these
+// directories can fail if it gets removed in between, in which case the
+// Store must be retried. Symlinks to directories are never removed.
+func (b *Backend) removeEmptyDirs(name string) {
+	for dir := path.Dir(name); dir != "."; dir = path.Dir(dir) {
+		dirPath := b.path(dir)
+		if info, err := os.Lstat(dirPath); err != nil || !info.IsDir() {
+			return
+		}
+		// Fails if the directory is not empty
+		if err := os.Remove(dirPath); err != nil {
+			return
+		}
+	}
 }
 
+// allowedName returns whether name can be used as the name of a blob. Names
+// may contain '/' to store blobs in subdirectories.
 func allowedName(name string) bool {
-	// TODO: Make shared and test for rejection
-	if strings.Contains(name, "/") {
+	if simpleblob.CheckName(name) != nil {
 		return false
 	}
-	if strings.HasPrefix(name, ".") {
-		return false
+	for _, seg := range strings.Split(name, "/") {
+		if strings.HasPrefix(seg, ".") {
+			return false
+		}
 	}
 	if strings.HasSuffix(name, ignoreSuffix) {
 		return false // used for our temp files when writing
@@ -114,10 +378,50 @@ func New(opt Options) (*Backend, error) {
 	if opt.RootPath == "" {
 		return nil, fmt.Errorf("options.root_path must be set for the fs backend")
 	}
-	if err := os.MkdirAll(opt.RootPath, 0o755); err != nil {
+	if opt.UID < 0 || opt.GID < 0 {
+		return nil, fmt.Errorf("options.uid and options.gid must not be negative for the fs backend")
+	}
+	if err := checkSymlinks(opt.Symlinks); err != nil {
 		return nil, err
 	}
-	b := &Backend{rootPath: opt.RootPath}
+	switch opt.Sync {
+	case "", SyncFull, SyncData, SyncNone:
+	default:
+		return nil, fmt.Errorf("options.sync must be one of %q, %q or %q for the fs backend",
+			SyncFull, SyncData, SyncNone)
+	}
+	if opt.MaxBytes < 0 || opt.MaxObjects < 0 {
+		return nil, fmt.Errorf("options.max_bytes and options.max_objects must not be negative for the fs backend")
+	}
+	if opt.TempMaxAge == 0 {
+		opt.TempMaxAge = DefaultTempMaxAge
+	}
+	rootPath := opt.RootPath
+	if prefix := strings.TrimSuffix(opt.GlobalPrefix, "/"); prefix != "" {
+		if err := simpleblob.CheckPrefix(opt.GlobalPrefix); err != nil || !allowedName(prefix) {
+			return nil, fmt.Errorf("options.global_prefix %q is not valid for the fs backend", opt.GlobalPrefix)
+		}
+		rootPath = filepath.Join(rootPath, filepath.FromSlash(prefix))
+	}
+	b := &Backend{rootPath: rootPath, opt: opt}
+	if err := b.mkdirAll(rootPath); err != nil {
+		return nil, err
+	}
+	if opt.TempMaxAge > 0 {
+		b.cleanTemp()
+		b.cleanup.last = time.Now()
+	}
+	if opt.MaxBytes > 0 || opt.MaxObjects > 0 {
+		blobs, err := b.List(context.Background(), "")
+		if err != nil {
+			return nil, err
+		}
+		b.quota = &quota{maxBytes: opt.MaxBytes, maxObjects: opt.MaxObjects}
+		for _, blob := range blobs {
+			b.quota.bytes += blob.Size
+			b.quota.objects++
+		}
+	}
 	return b, nil
 }
 
@@ -131,19 +435,46 @@ func init() {
 	})
 }
 
-func writeFile(name string, data []byte) error {
-	f, err := os.Create(name)
+// createFile creates a file at fullPath that replaces any existing file
+// atomically on Close.
+func (b *Backend) createFile(fullPath string) (*atomicFile, error) {
+	f, err := createAtomic(fullPath)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	defer f.Close()
-	if _, err = f.Write(data); err != nil {
-		return err
+	f.sync = b.opt.Sync
+	if err := b.setPerms(f.file); err != nil {
+		f.Clean()
+		return nil, err
 	}
-	if err = f.Sync(); err != nil {
+	return f, nil
+}
+
+// createBlob is like createFile, but also enforces the quota on Close.
+func (b *Backend) createBlob(fullPath string) (*atomicFile, error) {
+	b.maybeCleanTemp()
+	f, err := b.createFile(fullPath)
+	if err != nil {
+		return nil, err
+	}
+	if b.quota != nil {
+		f.reserve = func(size int64) (func(), error) {
+			return b.reserve(fullPath, size)
+		}
+	}
+	f.committed = func(size int64) {
+		metricWrittenBytes.Add(float64(size))
+	}
+	return f, nil
+}
+
+// writeAtomic writes data to f and closes it.
+func writeAtomic(f *atomicFile, data []byte) error {
+	if _, err := f.Write(data); err != nil {
+		f.Clean()
 		return err
 	}
-	return nil
+	return f.Close()
 }
 
 func syncDir(name string) error {
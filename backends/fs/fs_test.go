@@ -1,12 +1,19 @@
 package fs
 
 import (
+	"context"
+	"io"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v2"
 
+	"github.com/PowerDNS/simpleblob"
+	"github.com/PowerDNS/simpleblob/backends/memory"
 	"github.com/PowerDNS/simpleblob/tester"
 )
 
@@ -33,4 +40,538 @@ func TestBackend(t *testing.T) {
 	b, err := New(Options{RootPath: tmpDir})
 	assert.NoError(t, err)
 	tester.DoBackendTests(t, b)
+	tester.DoStreamTests(t, b)
+	tester.DoContextTests(t, b)
+}
+
+func TestBackend_folders(t *testing.T) {
+	b, err := New(Options{RootPath: t.TempDir()})
+	assert.NoError(t, err)
+	tester.DoFolderTests(t, b, tester.FolderOptions{NoBlobAndFolder: true})
+}
+
+func TestBackend_migration(t *testing.T) {
+	b, err := New(Options{RootPath: t.TempDir()})
+	assert.NoError(t, err)
+	tester.DoMigrationTests(t, memory.New(), b, memory.New())
+}
+
+func TestBackend_names(t *testing.T) {
+	b, err := New(Options{RootPath: t.TempDir()})
+	assert.NoError(t, err)
+	tester.DoNameTests(t, b, tester.Capabilities{
+		RejectsName: func(name string) bool {
+			return !allowedName(name)
+		},
+	})
+}
+
+func FuzzBackend(f *testing.F) {
+	b, err := New(Options{RootPath: f.TempDir()})
+	if err != nil {
+		f.Fatal(err)
+	}
+	tester.FuzzBackend(f, func() simpleblob.Interface {
+		return b
+	})
+}
+
+func BenchmarkBackend(b *testing.B) {
+	st, err := New(Options{RootPath: b.TempDir(), Sync: SyncNone})
+	if err != nil {
+		b.Fatal(err)
+	}
+	tester.RunBenchmarks(b, st)
+}
+
+func TestBackend_StoreReader(t *testing.T) {
+	ctx := context.Background()
+	tmpDir := t.TempDir()
+	b, err := New(Options{RootPath: tmpDir})
+	assert.NoError(t, err)
+
+	assert.NoError(t, b.StoreReader(ctx, "foo", strings.NewReader("bar"), 3))
+	data, err := b.Load(ctx, "foo")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("bar"), data)
+
+	// No file nor temporary file is left after a short read
+	err = b.StoreReader(ctx, "short", strings.NewReader("bar"), 10)
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	entries, err := os.ReadDir(tmpDir)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
+
+func TestBackend_StoreIfAbsent(t *testing.T) {
+	ctx := context.Background()
+	b, err := New(Options{RootPath: t.TempDir()})
+	assert.NoError(t, err)
+
+	assert.NoError(t, b.StoreIfAbsent(ctx, "foo", []byte("first")))
+	err = b.StoreIfAbsent(ctx, "foo", []byte("second"))
+	assert.ErrorIs(t, err, os.ErrExist)
+	data, err := b.Load(ctx, "foo")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("first"), data)
+}
+
+func TestBackend_nested(t *testing.T) {
+	ctx := context.Background()
+	tmpDir := t.TempDir()
+	b, err := New(Options{RootPath: tmpDir})
+	assert.NoError(t, err)
+
+	assert.NoError(t, b.Store(ctx, "foo/bar-1", []byte("1")))
+	assert.NoError(t, b.Store(ctx, "foo/bar-2", []byte("2")))
+	assert.NoError(t, b.Store(ctx, "foo/baz/deep", []byte("3")))
+	assert.NoError(t, b.Store(ctx, "top", []byte("4")))
+
+	ls, err := b.List(ctx, "")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"foo/bar-1", "foo/bar-2", "foo/baz/deep", "top"}, ls.Names())
+	ls, err = b.List(ctx, "foo/b")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"foo/bar-1", "foo/bar-2", "foo/baz/deep"}, ls.Names())
+
+	data, err := b.Load(ctx, "foo/baz/deep")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("3"), data)
+
+	// Empty directories are removed
+	assert.NoError(t, b.Delete(ctx, "foo/baz/deep"))
+	_, err = os.Stat(filepath.Join(tmpDir, "foo", "baz"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	assert.NoError(t, b.Delete(ctx, "foo/bar-1"))
+	assert.NoError(t, b.Delete(ctx, "foo/bar-2"))
+	entries, err := os.ReadDir(tmpDir)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+
+	for _, name := range []string{"/abs", "foo//bar", "foo/../bar", "foo/.hidden", "foo/bar.tmp", ""} {
+		assert.ErrorIs(t, b.Store(ctx, name, nil), os.ErrPermission, name)
+	}
+}
+
+func TestBackend_listPrefix(t *testing.T) {
+	ctx := context.Background()
+	tmpDir := t.TempDir()
+	b, err := New(Options{RootPath: tmpDir})
+	assert.NoError(t, err)
+
+	for _, name := range []string{"a/b/c-1", "a/b/c-2", "a/bb/c", "a-1", "ab/c", "x/y"} {
+		assert.NoError(t, b.Store(ctx, name, []byte(name)))
+	}
+
+	for prefix, expected := range map[string][]string{
+		"a/b/":    {"a/b/c-1", "a/b/c-2"},
+		"a/b":     {"a/b/c-1", "a/b/c-2", "a/bb/c"},
+		"a":       {"a-1", "a/b/c-1", "a/b/c-2", "a/bb/c", "ab/c"},
+		"a/b/c-2": {"a/b/c-2"},
+		"a/z/":    nil,
+		"../":     nil,
+	} {
+		ls, err := b.List(ctx, prefix)
+		assert.NoError(t, err, prefix)
+		assert.Equal(t, expected, ls.Names(), prefix)
+	}
+}
+
+func TestBackend_Stat(t *testing.T) {
+	ctx := context.Background()
+	b, err := New(Options{RootPath: t.TempDir()})
+	assert.NoError(t, err)
+
+	before := time.Now().Add(-time.Second)
+	assert.NoError(t, b.Store(ctx, "dir/foo", []byte("bar")))
+
+	info, err := b.Stat(ctx, "dir/foo")
+	assert.NoError(t, err)
+	assert.Equal(t, "dir/foo", info.Name)
+	assert.EqualValues(t, 3, info.Size)
+	assert.True(t, info.ModTime.After(before))
+
+	ls, err := b.List(ctx, "")
+	assert.NoError(t, err)
+	assert.Equal(t, simpleblob.BlobList{info.Blob}, ls)
+
+	_, err = b.Stat(ctx, "missing")
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	_, err = b.Stat(ctx, "dir")
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	tester.DoMetadataTests(t, b)
+}
+
+func TestBackend_metadata(t *testing.T) {
+	ctx := context.Background()
+	b, err := New(Options{RootPath: t.TempDir()})
+	assert.NoError(t, err)
+
+	md := simpleblob.Metadata{
+		ContentType: "text/plain",
+		Checksum:    "sha256:fcde2b2edba56bf408601fb721fe9b5c338d10ee429ea04fae5511b68fbf8fb9",
+		User:        map[string]string{"owner": "alice"},
+	}
+	assert.NoError(t, b.StoreWithMetadata(ctx, "dir/foo", []byte("bar"), md))
+	got, err := b.LoadMetadata(ctx, "dir/foo")
+	assert.NoError(t, err)
+	assert.Equal(t, md, got)
+
+	// Sidecar files are not listed
+	ls, err := b.List(ctx, "")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"dir/foo"}, ls.Names())
+
+	// Storing without metadata invalidates it
+	assert.NoError(t, b.Store(ctx, "dir/foo", []byte("other")))
+	got, err = b.LoadMetadata(ctx, "dir/foo")
+	assert.NoError(t, err)
+	assert.Equal(t, simpleblob.Metadata{}, got)
+
+	// Overwrites of the same size within the granularity of the ModTime
+	// invalidate it as well
+	overwrites := map[string]func() error{
+		"Store": func() error { return b.Store(ctx, "dir/foo", []byte("baz")) },
+		"StoreReader": func() error {
+			return b.StoreReader(ctx, "dir/foo", strings.NewReader("baz"), 3)
+		},
+		"NewWriter": func() error {
+			w, err := b.NewWriter(ctx, "dir/foo")
+			if err != nil {
+				return err
+			}
+			_, _ = w.Write([]byte("baz"))
+			return w.Close()
+		},
+		"Copy": func() error {
+			if err := b.Store(ctx, "src", []byte("baz")); err != nil {
+				return err
+			}
+			return b.Copy(ctx, "src", "dir/foo")
+		},
+	}
+	for name, overwrite := range overwrites {
+		assert.NoError(t, b.StoreWithMetadata(ctx, "dir/foo", []byte("bar"), md))
+		info, err := os.Stat(b.path("dir/foo"))
+		assert.NoError(t, err)
+		assert.NoError(t, overwrite(), name)
+		assert.NoError(t, os.Chtimes(b.path("dir/foo"), info.ModTime(), info.ModTime()))
+		got, err = b.LoadMetadata(ctx, "dir/foo")
+		assert.NoError(t, err)
+		assert.Equal(t, simpleblob.Metadata{}, got, name)
+	}
+
+	assert.NoError(t, b.StoreWithMetadata(ctx, "dir/foo", []byte("bar"), md))
+	assert.NoError(t, b.Delete(ctx, "dir/foo"))
+	_, err = b.LoadMetadata(ctx, "dir/foo")
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	_, err = os.Stat(b.metaPath("dir/foo"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestBackend_perms(t *testing.T) {
+	ctx := context.Background()
+	tmpDir := t.TempDir()
+
+	var opt Options
+	assert.NoError(t, yaml.Unmarshal([]byte("file_mode: 0640\ndir_mode: 0750\n"), &opt))
+	assert.Equal(t, os.FileMode(0o640), opt.FileMode)
+	assert.Equal(t, os.FileMode(0o750), opt.DirMode)
+	opt.RootPath = filepath.Join(tmpDir, "root")
+	b, err := New(opt)
+	assert.NoError(t, err)
+
+	assert.NoError(t, b.Store(ctx, "dir/foo", []byte("bar")))
+	w, err := b.NewWriter(ctx, "dir/stream")
+	assert.NoError(t, err)
+	assert.NoError(t, w.Close())
+
+	for name, mode := range map[string]os.FileMode{
+		"root":            os.ModeDir | 0o750,
+		"root/dir":        os.ModeDir | 0o750,
+		"root/dir/foo":    0o640,
+		"root/dir/stream": 0o640,
+	} {
+		info, err := os.Stat(filepath.Join(tmpDir, name))
+		assert.NoError(t, err)
+		assert.Equal(t, mode, info.Mode(), name)
+	}
+}
+
+func TestBackend_NewWriter_unnamed(t *testing.T) {
+	ctx := context.Background()
+	tmpDir := t.TempDir()
+	b, err := New(Options{RootPath: tmpDir})
+	assert.NoError(t, err)
+
+	w, err := b.NewWriter(ctx, "foo")
+	assert.NoError(t, err)
+	_, err = w.Write([]byte("bar"))
+	assert.NoError(t, err)
+	if !w.(*writer).unnamed {
+		t.Skip("O_TMPFILE not supported")
+	}
+	entries, err := os.ReadDir(tmpDir)
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+
+	assert.NoError(t, w.Close())
+	entries, err = os.ReadDir(tmpDir)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+	data, err := b.Load(ctx, "foo")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("bar"), data)
+}
+
+func TestBackend_quota(t *testing.T) {
+	ctx := context.Background()
+	tmpDir := t.TempDir()
+	b, err := New(Options{RootPath: tmpDir})
+	assert.NoError(t, err)
+	assert.NoError(t, b.Store(ctx, "existing", []byte("12345")))
+
+	// Existing blobs are counted at startup
+	b, err = New(Options{RootPath: tmpDir, MaxBytes: 10, MaxObjects: 3})
+	assert.NoError(t, err)
+	assert.NoError(t, b.Store(ctx, "a", []byte("123")))
+	assert.ErrorIs(t, b.Store(ctx, "b", []byte("123")), ErrQuotaExceeded)
+	assert.ErrorIs(t, b.StoreIfAbsent(ctx, "b", []byte("123")), ErrQuotaExceeded)
+	assert.ErrorIs(t, b.StoreReader(ctx, "b", strings.NewReader("123"), 3), ErrQuotaExceeded)
+	w, err := b.NewWriter(ctx, "b")
+	assert.NoError(t, err)
+	_, err = w.Write([]byte("123"))
+	assert.NoError(t, err)
+	assert.ErrorIs(t, w.Close(), ErrQuotaExceeded)
+	_, err = b.Load(ctx, "b")
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	// Overwriting only counts the difference
+	assert.NoError(t, b.Store(ctx, "existing", []byte("1234567")))
+	assert.ErrorIs(t, b.Store(ctx, "existing", []byte("12345678")), ErrQuotaExceeded)
+
+	assert.NoError(t, b.Store(ctx, "c", nil))
+	assert.ErrorIs(t, b.Store(ctx, "d", nil), ErrQuotaExceeded)
+
+	// Deleting frees space
+	assert.NoError(t, b.Delete(ctx, "existing"))
+	assert.NoError(t, b.Store(ctx, "d", []byte("1234567")))
+
+	// No temporary files are left
+	ls, err := b.List(ctx, "")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "c", "d"}, ls.Names())
+	entries, err := os.ReadDir(tmpDir)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 3)
+}
+
+func TestBackend_symlinks(t *testing.T) {
+	ctx := context.Background()
+	outside := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(outside, "secret"), []byte("secret"), 0o644))
+	tmpDir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(tmpDir, "foo"), []byte("foo"), 0o644))
+	assert.NoError(t, os.Symlink(filepath.Join(outside, "secret"), filepath.Join(tmpDir, "link")))
+	assert.NoError(t, os.Symlink(outside, filepath.Join(tmpDir, "dir")))
+
+	_, err := New(Options{RootPath: tmpDir, Symlinks: "bogus"})
+	assert.Error(t, err)
+
+	// Skip by default
+	b, err := New(Options{RootPath: tmpDir})
+	assert.NoError(t, err)
+	ls, err := b.List(ctx, "")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"foo"}, ls.Names())
+	for _, name := range []string{"link", "dir/secret"} {
+		_, err = b.Load(ctx, name)
+		assert.ErrorIs(t, err, os.ErrNotExist, name)
+		_, err = b.NewReader(ctx, name)
+		assert.ErrorIs(t, err, os.ErrNotExist, name)
+		_, err = b.Stat(ctx, name)
+		assert.ErrorIs(t, err, os.ErrNotExist, name)
+	}
+
+	b, err = New(Options{RootPath: tmpDir, Symlinks: SymlinksFollow})
+	assert.NoError(t, err)
+	ls, err = b.List(ctx, "")
+	assert.NoError(t, err)
+	assert.Equal(t, simpleblob.BlobList{{Name: "foo", Size: 3}, {Name: "link", Size: 6}}, withoutModTime(ls))
+	data, err := b.Load(ctx, "dir/secret")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("secret"), data)
+
+	b, err = New(Options{RootPath: tmpDir, Symlinks: SymlinksReject})
+	assert.NoError(t, err)
+	_, err = b.List(ctx, "")
+	assert.ErrorIs(t, err, ErrSymlink)
+	_, err = b.Load(ctx, "link")
+	assert.ErrorIs(t, err, ErrSymlink)
+	data, err = b.Load(ctx, "foo")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("foo"), data)
+
+	// Writes and deletes never go through a symlink to a directory
+	for _, policy := range []string{SymlinksSkip, SymlinksReject} {
+		b, err = New(Options{RootPath: tmpDir, Symlinks: policy})
+		assert.NoError(t, err)
+		assert.ErrorIs(t, b.Store(ctx, "dir/escaped", []byte("x")), ErrSymlink, policy)
+		assert.ErrorIs(t, b.Store(ctx, "dir/sub/escaped", []byte("x")), ErrSymlink, policy)
+		_, err = b.NewWriter(ctx, "dir/escaped")
+		assert.ErrorIs(t, err, ErrSymlink, policy)
+		assert.ErrorIs(t, b.StoreReader(ctx, "dir/escaped", strings.NewReader("x"), 1), ErrSymlink, policy)
+		assert.ErrorIs(t, b.StoreIfAbsent(ctx, "dir/escaped", []byte("x")), ErrSymlink, policy)
+		assert.ErrorIs(t, b.Copy(ctx, "foo", "dir/escaped"), ErrSymlink, policy)
+		_, err = os.Stat(filepath.Join(outside, "escaped"))
+		assert.ErrorIs(t, err, os.ErrNotExist, policy)
+		_, err = os.Stat(filepath.Join(outside, "sub"))
+		assert.ErrorIs(t, err, os.ErrNotExist, policy)
+
+		err = b.Delete(ctx, "dir/secret")
+		if policy == SymlinksReject {
+			assert.ErrorIs(t, err, ErrSymlink)
+		} else {
+			assert.NoError(t, err)
+		}
+		_, err = os.Stat(filepath.Join(outside, "secret"))
+		assert.NoError(t, err, policy)
+		info, err := os.Lstat(filepath.Join(tmpDir, "dir"))
+		assert.NoError(t, err, policy)
+		assert.NotZero(t, info.Mode()&os.ModeSymlink, policy)
+	}
+
+	// Deleting through a followed symlink keeps the symlink itself
+	b, err = New(Options{RootPath: tmpDir, Symlinks: SymlinksFollow})
+	assert.NoError(t, err)
+	assert.NoError(t, b.Delete(ctx, "dir/secret"))
+	info, err := os.Lstat(filepath.Join(tmpDir, "dir"))
+	assert.NoError(t, err)
+	assert.NotZero(t, info.Mode()&os.ModeSymlink)
+}
+
+func withoutModTime(ls simpleblob.BlobList) simpleblob.BlobList {
+	for i := range ls {
+		ls[i].ModTime = time.Time{}
+	}
+	return ls
+}
+
+func TestBackend_sync(t *testing.T) {
+	_, err := New(Options{RootPath: t.TempDir(), Sync: "bogus"})
+	assert.Error(t, err)
+
+	for _, mode := range []string{SyncFull, SyncData, SyncNone} {
+		t.Run(mode, func(t *testing.T) {
+			ctx := context.Background()
+			b, err := New(Options{RootPath: t.TempDir(), Sync: mode})
+			assert.NoError(t, err)
+			tester.DoBackendTests(t, b)
+			assert.NoError(t, b.StoreIfAbsent(ctx, "new", []byte("new")))
+		})
+	}
+}
+
+func TestBackend_Copy(t *testing.T) {
+	ctx := context.Background()
+	b, err := New(Options{RootPath: t.TempDir()})
+	assert.NoError(t, err)
+
+	assert.NoError(t, b.Store(ctx, "foo", []byte("bar")))
+	assert.NoError(t, b.Store(ctx, "dir/copy", []byte("old")))
+	assert.NoError(t, b.Copy(ctx, "foo", "dir/copy"))
+	data, err := b.Load(ctx, "dir/copy")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("bar"), data)
+
+	// The copy is independent from the source
+	assert.NoError(t, b.Store(ctx, "foo", []byte("changed")))
+	data, err = b.Load(ctx, "dir/copy")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("bar"), data)
+
+	assert.ErrorIs(t, b.Copy(ctx, "missing", "other"), os.ErrNotExist)
+}
+
+func TestBackend_cleanTemp(t *testing.T) {
+	ctx := context.Background()
+	tmpDir := t.TempDir()
+	old := time.Now().Add(-2 * time.Hour)
+	for _, name := range []string{"stale.123.tmp", "dir/stale.tmp", "fresh.123.tmp"} {
+		p := filepath.Join(tmpDir, filepath.FromSlash(name))
+		assert.NoError(t, os.MkdirAll(filepath.Dir(p), 0o755))
+		assert.NoError(t, os.WriteFile(p, nil, 0o644))
+		if strings.HasPrefix(filepath.Base(p), "stale") {
+			assert.NoError(t, os.Chtimes(p, old, old))
+		}
+	}
+
+	b, err := New(Options{RootPath: tmpDir, TempMaxAge: time.Hour, CleanupInterval: time.Millisecond})
+	assert.NoError(t, err)
+	_, err = os.Stat(filepath.Join(tmpDir, "stale.123.tmp"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	_, err = os.Stat(filepath.Join(tmpDir, "dir", "stale.tmp"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	_, err = os.Stat(filepath.Join(tmpDir, "fresh.123.tmp"))
+	assert.NoError(t, err)
+
+	// Periodic cleanup is triggered by writes
+	p := filepath.Join(tmpDir, "fresh.123.tmp")
+	assert.NoError(t, os.Chtimes(p, old, old))
+	time.Sleep(2 * time.Millisecond)
+	assert.NoError(t, b.Store(ctx, "foo", nil))
+	assert.Eventually(t, func() bool {
+		_, err := os.Stat(p)
+		return os.IsNotExist(err)
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestTempPath(t *testing.T) {
+	dir := filepath.Join("root", "dir") + string(filepath.Separator)
+	assert.Equal(t, dir+"foo.42.tmp", tempPath(dir+"foo", 42))
+
+	// File names too long for a suffix are shortened, keeping them unique
+	long1 := strings.Repeat("x", maxFileName)
+	long2 := strings.Repeat("x", maxFileName-1) + "y"
+	p1, p2 := tempPath(dir+long1, 42), tempPath(dir+long2, 42)
+	assert.NotEqual(t, p1, p2)
+	for _, p := range []string{p1, p2} {
+		assert.Equal(t, dir, filepath.Dir(p)+string(filepath.Separator))
+		assert.LessOrEqual(t, len(filepath.Base(p)), maxFileName)
+		assert.True(t, strings.HasSuffix(p, ".42"+ignoreSuffix), p)
+	}
+
+	// Stores of such names do not fail on the temporary file
+	b, err := New(Options{RootPath: t.TempDir()})
+	assert.NoError(t, err)
+	assert.NoError(t, b.Store(context.Background(), long1, []byte("long")))
+	data, err := b.Load(context.Background(), long1)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("long"), data)
+}
+
+func TestBackend_globalPrefix(t *testing.T) {
+	ctx := context.Background()
+	tmpDir := t.TempDir()
+
+	for _, prefix := range []string{"/abs", "a/../b", ".hidden/", "a.tmp"} {
+		_, err := New(Options{RootPath: tmpDir, GlobalPrefix: prefix})
+		assert.Error(t, err, prefix)
+	}
+
+	b, err := New(Options{RootPath: tmpDir, GlobalPrefix: "tenant/a/"})
+	assert.NoError(t, err)
+	tester.DoBackendTests(t, b)
+	assert.NoError(t, b.Store(ctx, "foo", []byte("bar")))
+	data, err := os.ReadFile(filepath.Join(tmpDir, "tenant", "a", "foo"))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("bar"), data)
+
+	// Without trailing slash
+	b, err = New(Options{RootPath: tmpDir, GlobalPrefix: "tenant/a"})
+	assert.NoError(t, err)
+	data, err = b.Load(ctx, "foo")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("bar"), data)
 }
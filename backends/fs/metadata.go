@@ -0,0 +1,100 @@
+package fs
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/PowerDNS/simpleblob"
+)
+
+// metaDir is the directory holding the metadata sidecar files. It is hidden
+// from List because its name starts with a '.', which is not allowed in blob
+// names.
+const metaDir = ".meta"
+
+// sidecar is the content of a metadata sidecar file.
+type sidecar struct {
+	simpleblob.Metadata
+	// ModTime and Size describe the blob file when the metadata was
+	// written. The sidecar is removed when the blob is stored again, and
+	// these detect the changes made by other processes.
+	ModTime time.Time `json:"mod_time"`
+	Size    int64     `json:"size"`
+}
+
+func (b *Backend) metaPath(name string) string {
+	return filepath.Join(b.rootPath, metaDir, filepath.FromSlash(name))
+}
+
+// StoreWithMetadata satisfies simpleblob.MetadataStorer. The metadata is
+// stored in a sidecar file after the blob itself.
+func (b *Backend) StoreWithMetadata(ctx context.Context, name string, data []byte, md simpleblob.Metadata) error {
+	if err := b.Store(ctx, name, data); err != nil {
+		return err
+	}
+	info, err := os.Stat(b.path(name))
+	if err != nil {
+		return err
+	}
+	content, err := json.Marshal(sidecar{Metadata: md, ModTime: info.ModTime(), Size: info.Size()})
+	if err != nil {
+		return err
+	}
+	fullPath, err := b.writePath(metaDir + "/" + name)
+	if err != nil {
+		return err
+	}
+	if err := b.mkdirAll(filepath.Dir(fullPath)); err != nil {
+		return err
+	}
+	f, err := b.createFile(fullPath)
+	if err != nil {
+		return err
+	}
+	return writeAtomic(f, content)
+}
+
+// LoadMetadata satisfies simpleblob.MetadataStorer.
+func (b *Backend) LoadMetadata(ctx context.Context, name string) (simpleblob.Metadata, error) {
+	if !allowedName(name) {
+		return simpleblob.Metadata{}, os.ErrNotExist
+	}
+	fullPath, err := b.readPath(name)
+	if err != nil {
+		return simpleblob.Metadata{}, err
+	}
+	info, err := os.Stat(fullPath)
+	if err != nil {
+		return simpleblob.Metadata{}, err
+	}
+	content, err := os.ReadFile(b.metaPath(name))
+	if os.IsNotExist(err) {
+		return simpleblob.Metadata{}, nil
+	}
+	if err != nil {
+		return simpleblob.Metadata{}, err
+	}
+	var sc sidecar
+	if err := json.Unmarshal(content, &sc); err != nil {
+		return simpleblob.Metadata{}, err
+	}
+	if !sc.ModTime.Equal(info.ModTime()) || sc.Size != info.Size() {
+		return simpleblob.Metadata{}, nil // stale
+	}
+	return sc.Metadata, nil
+}
+
+// deleteMetadata removes the sidecar file of the named blob, if any.
+func (b *Backend) deleteMetadata(name string) {
+	fullPath, err := b.writePath(metaDir + "/" + name)
+	if err != nil {
+		return
+	}
+	if err := os.Remove(fullPath); err != nil {
+		return
+	}
+	b.removeEmptyDirs(metaDir + "/" + name)
+}
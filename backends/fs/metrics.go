@@ -0,0 +1,82 @@
+package fs
+
+import (
+	"errors"
+	"io"
+	"os"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	metricCalls = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "storage_fs_call_total",
+			Help: "Filesystem backend calls by method",
+		},
+		[]string{"method"},
+	)
+	metricCallErrors = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "storage_fs_call_error_total",
+			Help: "Filesystem backend call errors by method, not counting missing blobs",
+		},
+		[]string{"method"},
+	)
+	metricCallDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "storage_fs_call_duration_seconds",
+			Help:    "Duration of filesystem backend calls by method",
+			Buckets: prometheus.ExponentialBuckets(0.0001, 4, 10), // 100µs to 26s
+		},
+		[]string{"method"},
+	)
+	metricWrittenBytes = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "storage_fs_written_bytes_total",
+			Help: "Bytes of successfully stored blobs",
+		},
+	)
+	metricReadBytes = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "storage_fs_read_bytes_total",
+			Help: "Bytes of blobs read",
+		},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(metricCalls)
+	prometheus.MustRegister(metricCallErrors)
+	prometheus.MustRegister(metricCallDuration)
+	prometheus.MustRegister(metricWrittenBytes)
+	prometheus.MustRegister(metricReadBytes)
+}
+
+// observe records a call to method. The returned function must be called
+// with a pointer to the error of the call when it is done, which is
+// typically done with:
+//
+//	defer observe("load")(&err)
+func observe(method string) func(*error) {
+	start := time.Now()
+	metricCalls.WithLabelValues(method).Inc()
+	return func(err *error) {
+		metricCallDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+		if *err != nil && !errors.Is(*err, os.ErrNotExist) {
+			metricCallErrors.WithLabelValues(method).Inc()
+		}
+	}
+}
+
+// countingReader counts the bytes read from a blob.
+type countingReader struct {
+	io.ReadCloser
+}
+
+func (r countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	metricReadBytes.Add(float64(n))
+	return n, err
+}
@@ -0,0 +1,46 @@
+package fs
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetrics(t *testing.T) {
+	ctx := context.Background()
+	b, err := New(Options{RootPath: t.TempDir()})
+	assert.NoError(t, err)
+
+	calls := testutil.ToFloat64(metricCalls.WithLabelValues("load"))
+	errs := testutil.ToFloat64(metricCallErrors.WithLabelValues("load"))
+	written := testutil.ToFloat64(metricWrittenBytes)
+	read := testutil.ToFloat64(metricReadBytes)
+
+	assert.NoError(t, b.Store(ctx, "foo", []byte("bar")))
+	w, err := b.NewWriter(ctx, "stream")
+	assert.NoError(t, err)
+	_, err = w.Write([]byte("12345"))
+	assert.NoError(t, err)
+	assert.NoError(t, w.Close())
+	assert.Equal(t, written+8, testutil.ToFloat64(metricWrittenBytes))
+
+	_, err = b.Load(ctx, "foo")
+	assert.NoError(t, err)
+	r, err := b.NewReader(ctx, "stream")
+	assert.NoError(t, err)
+	_, err = io.ReadAll(r)
+	assert.NoError(t, err)
+	assert.NoError(t, r.Close())
+	assert.Equal(t, read+8, testutil.ToFloat64(metricReadBytes))
+
+	// Missing blobs are not errors
+	_, err = b.Load(ctx, "missing")
+	assert.Error(t, err)
+	_, err = b.Load(ctx, "../invalid")
+	assert.Error(t, err)
+	assert.Equal(t, calls+3, testutil.ToFloat64(metricCalls.WithLabelValues("load")))
+	assert.Equal(t, errs, testutil.ToFloat64(metricCallErrors.WithLabelValues("load")))
+}
@@ -0,0 +1,67 @@
+package fs
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// setPerms applies the FileMode, UID and GID options to a newly created file.
+func (b *Backend) setPerms(f *os.File) error {
+	if b.opt.FileMode != 0 {
+		if err := f.Chmod(b.opt.FileMode); err != nil {
+			return err
+		}
+	}
+	if uid, gid, ok := b.owner(); ok {
+		return f.Chown(uid, gid)
+	}
+	return nil
+}
+
+// mkdirAll is like os.MkdirAll, but applies the DirMode, UID and GID options
+// to the directories it creates.
+func (b *Backend) mkdirAll(dir string) error {
+	if b.opt.DirMode == 0 && b.opt.UID == 0 && b.opt.GID == 0 {
+		return os.MkdirAll(dir, 0o755)
+	}
+	if info, err := os.Stat(dir); err == nil && info.IsDir() {
+		return nil
+	}
+	if parent := filepath.Dir(dir); parent != dir {
+		if err := b.mkdirAll(parent); err != nil {
+			return err
+		}
+	}
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		if os.IsExist(err) {
+			return nil // created in the meantime
+		}
+		return err
+	}
+	if b.opt.DirMode != 0 {
+		// Unlike Mkdir, not affected by the umask
+		if err := os.Chmod(dir, b.opt.DirMode); err != nil {
+			return err
+		}
+	}
+	if uid, gid, ok := b.owner(); ok {
+		return os.Chown(dir, uid, gid)
+	}
+	return nil
+}
+
+// owner returns the arguments for Chown from the UID and GID options, and
+// whether Chown needs to be called.
+func (b *Backend) owner() (uid, gid int, ok bool) {
+	if b.opt.UID == 0 && b.opt.GID == 0 {
+		return 0, 0, false
+	}
+	uid, gid = -1, -1 // unchanged
+	if b.opt.UID != 0 {
+		uid = b.opt.UID
+	}
+	if b.opt.GID != 0 {
+		gid = b.opt.GID
+	}
+	return uid, gid, true
+}
@@ -0,0 +1,81 @@
+package fs
+
+import (
+	"errors"
+	"os"
+	"sync"
+)
+
+// ErrQuotaExceeded is returned when storing a blob would exceed the
+// MaxBytes or MaxObjects options.
+var ErrQuotaExceeded = errors.New("fs: quota exceeded")
+
+// quota tracks the usage of the backend for the MaxBytes and MaxObjects
+// options.
+type quota struct {
+	mu         sync.Mutex
+	maxBytes   int64
+	maxObjects int64
+	bytes      int64
+	objects    int64
+}
+
+// update accounts for a blob of oldSize being replaced by one of newSize. A
+// size of -1 means that the blob does not exist. It fails without changing
+// the usage if it grows beyond a limit.
+func (q *quota) update(oldSize, newSize int64) error {
+	dBytes, dObjects := delta(oldSize, newSize)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if dBytes > 0 && q.maxBytes > 0 && q.bytes+dBytes > q.maxBytes {
+		return ErrQuotaExceeded
+	}
+	if dObjects > 0 && q.maxObjects > 0 && q.objects+dObjects > q.maxObjects {
+		return ErrQuotaExceeded
+	}
+	q.bytes += dBytes
+	q.objects += dObjects
+	return nil
+}
+
+// revert undoes a successful update with the same arguments.
+func (q *quota) revert(oldSize, newSize int64) {
+	dBytes, dObjects := delta(oldSize, newSize)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.bytes -= dBytes
+	q.objects -= dObjects
+}
+
+func delta(oldSize, newSize int64) (dBytes, dObjects int64) {
+	if oldSize >= 0 {
+		dBytes -= oldSize
+		dObjects--
+	}
+	if newSize >= 0 {
+		dBytes += newSize
+		dObjects++
+	}
+	return dBytes, dObjects
+}
+
+// reserve accounts for storing a blob of size at fullPath. The returned
+// function undoes it, and is never nil. Concurrent writes to the same
+// blob can make the usage drift slightly.
+func (b *Backend) reserve(fullPath string, size int64) (func(), error) {
+	if b.quota == nil {
+		return func() {}, nil
+	}
+	oldSize := int64(-1)
+	if info, err := os.Stat(fullPath); err == nil {
+		oldSize = info.Size()
+	}
+	if err := b.quota.update(oldSize, size); err != nil {
+		return func() {}, err
+	}
+	return func() {
+		b.quota.revert(oldSize, size)
+	}, nil
+}
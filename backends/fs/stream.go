@@ -4,29 +4,98 @@ import (
 	"context"
 	"io"
 	"os"
-	"path/filepath"
+
+	"github.com/PowerDNS/simpleblob"
 )
 
 // NewReader provides an optimized way to read from named file.
-func (b *Backend) NewReader(ctx context.Context, name string) (io.ReadCloser, error) {
+func (b *Backend) NewReader(ctx context.Context, name string) (_ io.ReadCloser, err error) {
+	defer observe("reader")(&err)
+
 	if err := ctx.Err(); err != nil {
 		return nil, err
 	}
 	if !allowedName(name) {
 		return nil, os.ErrPermission
 	}
-	fullPath := filepath.Join(b.rootPath, name)
-	return os.Open(fullPath)
+	fullPath, err := b.readPath(name)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(fullPath)
+	if err != nil {
+		return nil, err
+	}
+	return countingReader{ReadCloser: f}, nil
 }
 
 // NewWriter provides an optimized way to write to a file.
-func (b *Backend) NewWriter(ctx context.Context, name string) (io.WriteCloser, error) {
+func (b *Backend) NewWriter(ctx context.Context, name string) (_ io.WriteCloser, err error) {
+	defer observe("writer")(&err)
+
 	if err := ctx.Err(); err != nil {
 		return nil, err
 	}
 	if !allowedName(name) {
 		return nil, os.ErrPermission
 	}
-	fullPath := filepath.Join(b.rootPath, name)
-	return createAtomic(fullPath)
+	fullPath, err := b.mkdirs(name)
+	if err != nil {
+		return nil, err
+	}
+	f, err := b.createBlob(fullPath)
+	if err != nil {
+		return nil, err
+	}
+	return &writer{ctx: ctx, atomicFile: f, b: b, name: name}, nil
+}
+
+// writer does not create the file if its context is done before Close.
+type writer struct {
+	ctx context.Context
+	*atomicFile
+	b    *Backend
+	name string
+}
+
+func (w *writer) Close() error {
+	if err := w.ctx.Err(); err != nil {
+		w.Clean()
+		return err
+	}
+	if err := w.atomicFile.Close(); err != nil {
+		return err
+	}
+	w.b.deleteMetadata(w.name)
+	return nil
+}
+
+// StoreReader streams r to a file, which is only created if all of r
+// could be read.
+func (b *Backend) StoreReader(ctx context.Context, name string, r io.Reader, size int64) (err error) {
+	defer observe("store")(&err)
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if !allowedName(name) {
+		return os.ErrPermission
+	}
+	fullPath, err := b.mkdirs(name)
+	if err != nil {
+		return err
+	}
+	f, err := b.createBlob(fullPath)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, simpleblob.LimitReader(r, size)); err != nil {
+		f.Clean()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	b.deleteMetadata(name)
+	return nil
 }
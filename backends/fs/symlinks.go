@@ -0,0 +1,92 @@
+package fs
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Values for the Symlinks option
+const (
+	// SymlinksSkip ignores symlinks, as if they did not exist.
+	SymlinksSkip = "skip"
+	// SymlinksFollow treats symlinks to files like the files themselves.
+	SymlinksFollow = "follow"
+	// SymlinksReject fails on symlinks with ErrSymlink.
+	SymlinksReject = "reject"
+)
+
+// ErrSymlink is returned when a symlink is found with SymlinksReject, and
+// when a blob would be written through a symlink to a directory with
+// SymlinksSkip.
+var ErrSymlink = errors.New("fs: symlinks are not allowed")
+
+func checkSymlinks(policy string) error {
+	switch policy {
+	case "", SymlinksSkip, SymlinksFollow, SymlinksReject:
+		return nil
+	}
+	return fmt.Errorf("options.symlinks must be one of %q, %q or %q for the fs backend",
+		SymlinksSkip, SymlinksFollow, SymlinksReject)
+}
+
+// readPath returns the path of the file for the named blob, checking the
+// path against the Symlinks option.
+func (b *Backend) readPath(name string) (string, error) {
+	fullPath := b.path(name)
+	if b.opt.Symlinks == SymlinksFollow {
+		return fullPath, nil
+	}
+	// Check all the components of the name, as a symlink to a directory
+	// can point outside of the root path as well.
+	p := b.rootPath
+	for _, seg := range strings.Split(name, "/") {
+		p = filepath.Join(p, seg)
+		info, err := os.Lstat(p)
+		if err != nil {
+			return "", err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return "", b.symlinkError(p)
+		}
+	}
+	return fullPath, nil
+}
+
+// symlinkError returns the error to use for the symlink at fpath.
+func (b *Backend) symlinkError(fpath string) error {
+	err := os.ErrNotExist
+	if b.opt.Symlinks == SymlinksReject {
+		err = ErrSymlink
+	}
+	return &os.PathError{Op: "open", Path: fpath, Err: err}
+}
+
+// writePath returns the path of the file for the named blob, checking its
+// existing parent directories against the Symlinks option. Unless symlinks
+// are followed, a blob is never written or deleted through a symlink to a
+// directory, which can point outside of the root path.
+func (b *Backend) writePath(name string) (string, error) {
+	fullPath := b.path(name)
+	if b.opt.Symlinks == SymlinksFollow {
+		return fullPath, nil
+	}
+	p := b.rootPath
+	segs := strings.Split(name, "/")
+	for _, seg := range segs[:len(segs)-1] {
+		p = filepath.Join(p, seg)
+		info, err := os.Lstat(p)
+		if os.IsNotExist(err) {
+			break // created by mkdirs
+		}
+		if err != nil {
+			return "", err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return "", &os.PathError{Op: "mkdir", Path: p, Err: ErrSymlink}
+		}
+	}
+	return fullPath, nil
+}
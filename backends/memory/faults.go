@@ -0,0 +1,80 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"time"
+)
+
+// ErrInjected is returned by operations that fail because of the
+// FailPatterns or FailEvery options, unless FailError is set.
+var ErrInjected = errors.New("memory: injected failure")
+
+// FaultOptions make the backend slow or fail on purpose, to test how
+// callers handle failures without a separate mock.
+type FaultOptions struct {
+	// FailPatterns makes operations on names matching any of these
+	// path.Match patterns fail. For List, the prefix is matched.
+	FailPatterns []string `yaml:"fail_patterns"`
+	// FailEvery makes every Nth operation fail.
+	FailEvery int `yaml:"fail_every"`
+	// FailError is the error returned for injected failures. It defaults
+	// to ErrInjected.
+	FailError error `yaml:"-"`
+	// Latency is slept before every operation, or until the context is
+	// done.
+	Latency time.Duration `yaml:"latency"`
+}
+
+// check returns an error if the options are invalid.
+func (o FaultOptions) check() error {
+	if o.FailEvery < 0 {
+		return fmt.Errorf("memory: fail_every must not be negative")
+	}
+	for _, pattern := range o.FailPatterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("memory: fail_patterns: %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// begin counts a call to method, checks ctx and then injects faults for it.
+func (b *Backend) begin(ctx context.Context, method int, name string) error {
+	b.stats.calls[method].Add(1)
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return b.inject(ctx, name)
+}
+
+// inject sleeps and returns an error as configured by the FaultOptions.
+func (b *Backend) inject(ctx context.Context, name string) error {
+	opt := b.opt.Faults
+	if opt.Latency > 0 {
+		t := time.NewTimer(opt.Latency)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		}
+	}
+
+	fail := opt.FailEvery > 0 && b.ops.Add(1)%int64(opt.FailEvery) == 0
+	for _, pattern := range opt.FailPatterns {
+		if fail {
+			break
+		}
+		fail, _ = path.Match(pattern, name) // validated by check
+	}
+	if !fail {
+		return nil
+	}
+	if opt.FailError != nil {
+		return opt.FailError
+	}
+	return ErrInjected
+}
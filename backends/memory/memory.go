@@ -1,31 +1,104 @@
 package memory
 
 import (
+	"container/list"
 	"context"
+	"fmt"
 	"os"
 	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus"
+	"gopkg.in/yaml.v2"
 
 	"github.com/PowerDNS/simpleblob"
 )
 
+// Options describes the storage options for the memory backend
+type Options struct {
+	// MaxBytes and MaxObjects limit the total size and number of blobs.
+	// When a Store exceeds them, the least recently used blobs are evicted.
+	// A value of 0 means no limit.
+	MaxBytes   int64 `yaml:"max_bytes"`
+	MaxObjects int   `yaml:"max_objects"`
+	// PersistPath is a file to save snapshots to, in the format of SaveTo.
+	// If it exists, it is loaded when the backend is created.
+	PersistPath string `yaml:"persist_path"`
+	// PersistInterval is the minimum interval between snapshots saved to
+	// PersistPath in the background after a change. By default, snapshots
+	// are only saved when Persist is called.
+	PersistInterval time.Duration `yaml:"persist_interval"`
+	// ZeroCopy makes Load behave like LoadShared, and Store keep the data
+	// passed to it instead of a copy. Callers must then never modify data
+	// after passing it to Store, or data returned by Load.
+	ZeroCopy bool `yaml:"zero_copy"`
+	// Initial contains blobs to store when the backend is created, by name.
+	Initial map[string]string `yaml:"initial"`
+	// InitialDir is a directory with files to store when the backend is
+	// created, named by their path relative to it with '/' separators.
+	// Initial takes precedence for the same name. Blobs restored from
+	// PersistPath take precedence over both.
+	InitialDir string `yaml:"initial_dir"`
+	// ReadOnly makes all write operations return ErrReadOnly, after the
+	// initial contents have been stored.
+	ReadOnly bool `yaml:"read_only"`
+	// Faults injects latency and failures, for tests.
+	Faults FaultOptions `yaml:"faults"`
+	// Metrics enables Prometheus metrics for the object count, total size
+	// and operations of this backend. They are registered with Registerer,
+	// or with prometheus.DefaultRegisterer if it is not set. Setting
+	// Registerer implies Metrics.
+	Metrics    bool                  `yaml:"metrics"`
+	Registerer prometheus.Registerer `yaml:"-"`
+	// Instance is added as the "storage_instance" label to the metrics, to
+	// tell several memory backends apart in the same registry. The
+	// "instance" label is not used, as Prometheus sets it to the scraped
+	// target.
+	Instance string `yaml:"instance"`
+
+	// Not loaded from YAML
+	Logger logr.Logger `yaml:"-"`
+}
+
+// entry is a blob, stored in the LRU list.
+type entry struct {
+	name string
+	data []byte
+}
+
 type Backend struct {
-	mu    sync.Mutex
-	blobs map[string][]byte
+	opt Options
+
+	mu        sync.Mutex
+	blobs     map[string]*list.Element
+	lru       *list.List // of *entry, most recently used first
+	size      int64
+	evictions int64
+
+	stats   stats
+	ops     atomic.Int64 // for FailEvery
+	persist persister
+	log     logr.Logger
 }
 
 func (b *Backend) List(ctx context.Context, prefix string) (simpleblob.BlobList, error) {
+	if err := b.begin(ctx, callList, prefix); err != nil {
+		return nil, err
+	}
 	var blobs simpleblob.BlobList
 
 	b.mu.Lock()
-	for name, data := range b.blobs {
+	for name, elem := range b.blobs {
 		if !strings.HasPrefix(name, prefix) {
 			continue
 		}
 		blobs = append(blobs, simpleblob.Blob{
 			Name: name,
-			Size: int64(len(data)),
+			Size: int64(len(elem.Value.(*entry).data)),
 		})
 	}
 	b.mu.Unlock()
@@ -35,42 +108,230 @@ func (b *Backend) List(ctx context.Context, prefix string) (simpleblob.BlobList,
 }
 
 func (b *Backend) Load(ctx context.Context, name string) ([]byte, error) {
-	b.mu.Lock()
-	data, exists := b.blobs[name]
-	b.mu.Unlock()
-
-	if !exists {
-		return nil, os.ErrNotExist
+	data, err := b.LoadShared(ctx, name)
+	if err != nil || b.opt.ZeroCopy {
+		return data, err
 	}
 	dataCopy := make([]byte, len(data))
 	copy(dataCopy, data) // safe, because data was a copy itself
 	return dataCopy, nil
 }
 
+// LoadShared is like Load, but returns the stored data without copying it.
+// The returned slice must not be modified by the caller. It remains valid
+// after the blob is overwritten or deleted, because stored data is never
+// modified, only replaced.
+func (b *Backend) LoadShared(ctx context.Context, name string) ([]byte, error) {
+	if err := b.begin(ctx, callLoad, name); err != nil {
+		return nil, err
+	}
+	data, exists := b.get(name)
+	if !exists {
+		return nil, os.ErrNotExist
+	}
+	b.stats.readBytes.Add(int64(len(data)))
+	return data, nil
+}
+
 func (b *Backend) Store(ctx context.Context, name string, data []byte) error {
-	dataCopy := make([]byte, len(data))
-	copy(dataCopy, data)
+	if err := b.begin(ctx, callStore, name); err != nil {
+		return err
+	}
+	if err := b.writable("store", name); err != nil {
+		return err
+	}
+	if err := b.checkSize(name, data); err != nil {
+		return err
+	}
+	dataCopy := b.own(data)
 
 	b.mu.Lock()
-	b.blobs[name] = dataCopy
+	b.set(name, dataCopy)
 	b.mu.Unlock()
 
+	b.stored(len(data))
+	return nil
+}
+
+// StoreIfAbsent satisfies simpleblob.AbsentStorer.
+func (b *Backend) StoreIfAbsent(ctx context.Context, name string, data []byte) error {
+	if err := b.begin(ctx, callStore, name); err != nil {
+		return err
+	}
+	if err := b.writable("store", name); err != nil {
+		return err
+	}
+	if err := b.checkSize(name, data); err != nil {
+		return err
+	}
+	dataCopy := b.own(data)
+
+	b.mu.Lock()
+	if _, exists := b.blobs[name]; exists {
+		b.mu.Unlock()
+		return os.ErrExist
+	}
+	b.set(name, dataCopy)
+	b.mu.Unlock()
+
+	b.stored(len(data))
 	return nil
 }
 
 func (b *Backend) Delete(ctx context.Context, name string) error {
+	if err := b.begin(ctx, callDelete, name); err != nil {
+		return err
+	}
+	if err := b.writable("delete", name); err != nil {
+		return err
+	}
+	b.mu.Lock()
+	elem, exists := b.blobs[name]
+	if exists {
+		b.remove(elem)
+	}
+	b.mu.Unlock()
+
+	if exists {
+		b.changed()
+	}
+	return nil
+}
+
+// Evictions returns the number of blobs evicted to respect the MaxBytes and
+// MaxObjects options.
+func (b *Backend) Evictions() int64 {
 	b.mu.Lock()
 	defer b.mu.Unlock()
-	delete(b.blobs, name)
+	return b.evictions
+}
+
+// get returns the stored data of a blob and marks it as recently used.
+func (b *Backend) get(name string) ([]byte, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	elem, exists := b.blobs[name]
+	if !exists {
+		b.stats.misses.Add(1)
+		return nil, false
+	}
+	b.lru.MoveToFront(elem)
+	return elem.Value.(*entry).data, true
+}
+
+// own returns data to be stored, which is a copy unless ZeroCopy is set.
+func (b *Backend) own(data []byte) []byte {
+	if b.opt.ZeroCopy {
+		return data
+	}
+	dataCopy := make([]byte, len(data))
+	copy(dataCopy, data)
+	return dataCopy
+}
+
+// stored records a successful store of size bytes.
+func (b *Backend) stored(size int) {
+	b.stats.writtenBytes.Add(int64(size))
+	b.changed()
+}
+
+// checkSize returns an error if data can never fit within MaxBytes.
+func (b *Backend) checkSize(name string, data []byte) error {
+	if b.opt.MaxBytes > 0 && int64(len(data)) > b.opt.MaxBytes {
+		return fmt.Errorf("memory: blob %q is larger than max_bytes", name)
+	}
 	return nil
 }
 
+// set stores data under name and evicts blobs if needed. b.mu must be held.
+func (b *Backend) set(name string, data []byte) {
+	if elem, exists := b.blobs[name]; exists {
+		b.remove(elem)
+	}
+	b.blobs[name] = b.lru.PushFront(&entry{name: name, data: data})
+	b.size += int64(len(data))
+
+	for b.lru.Len() > 1 && b.overLimits() {
+		b.remove(b.lru.Back())
+		b.evictions++
+	}
+}
+
+// overLimits returns whether the MaxBytes or MaxObjects options are
+// exceeded. b.mu must be held.
+func (b *Backend) overLimits() bool {
+	return (b.opt.MaxBytes > 0 && b.size > b.opt.MaxBytes) ||
+		(b.opt.MaxObjects > 0 && b.lru.Len() > b.opt.MaxObjects)
+}
+
+// remove removes a blob. b.mu must be held.
+func (b *Backend) remove(elem *list.Element) {
+	e := b.lru.Remove(elem).(*entry)
+	delete(b.blobs, e.name)
+	b.size -= int64(len(e.data))
+}
+
+// New creates a new memory backend without limits.
 func New() *Backend {
-	return &Backend{blobs: make(map[string][]byte)}
+	b, _ := NewWithOptions(Options{})
+	return b
+}
+
+// NewWithOptions creates a new memory backend with the given options.
+func NewWithOptions(opt Options) (*Backend, error) {
+	if opt.MaxBytes < 0 || opt.MaxObjects < 0 {
+		return nil, fmt.Errorf("memory: max_bytes and max_objects must not be negative")
+	}
+	if err := opt.Faults.check(); err != nil {
+		return nil, err
+	}
+	log := opt.Logger
+	if log.GetSink() == nil {
+		log = logr.Discard()
+	}
+	b := &Backend{
+		opt:   opt,
+		blobs: make(map[string]*list.Element),
+		lru:   list.New(),
+		log:   log.WithName("memory"),
+	}
+	if opt.PersistPath != "" {
+		if err := b.restore(); err != nil {
+			return nil, err
+		}
+		b.persist.last = time.Now()
+	}
+	if err := b.seed(); err != nil {
+		return nil, err
+	}
+	if opt.Metrics || opt.Registerer != nil {
+		reg := opt.Registerer
+		if reg == nil {
+			reg = prometheus.DefaultRegisterer
+		}
+		if err := reg.Register(newCollector(b, opt.Instance)); err != nil {
+			return nil, fmt.Errorf("memory: register metrics: %w", err)
+		}
+	}
+	return b, nil
 }
 
 func init() {
 	simpleblob.RegisterBackend("memory", func(ctx context.Context, p simpleblob.InitParams) (simpleblob.Interface, error) {
-		return New(), nil
+		// Unknown options are ignored, as they were before the memory
+		// backend had any options.
+		var opt Options
+		y, err := yaml.Marshal(p.OptionMap.Coerce(&opt))
+		if err != nil {
+			return nil, err
+		}
+		if err := yaml.Unmarshal(y, &opt); err != nil {
+			return nil, err
+		}
+		if err := p.OptionsThroughYAML(&Options{}); err != nil {
+			p.Logger.Info("memory: ignoring unknown options", "error", err.Error())
+		}
+		opt.Logger = p.Logger
+		return NewWithOptions(opt)
 	})
 }
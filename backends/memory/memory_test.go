@@ -1,12 +1,306 @@
 package memory
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/PowerDNS/simpleblob"
 	"github.com/PowerDNS/simpleblob/tester"
 )
 
 func TestBackend(t *testing.T) {
 	b := New()
 	tester.DoBackendTests(t, b)
+	tester.DoStreamTests(t, b)
+	tester.DoContextTests(t, b)
+}
+
+func TestBackend_folders(t *testing.T) {
+	tester.DoFolderTests(t, New(), tester.FolderOptions{})
+}
+
+func TestBackend_metadata(t *testing.T) {
+	tester.DoMetadataTests(t, New())
+}
+
+func TestBackend_names(t *testing.T) {
+	tester.DoNameTests(t, New(), tester.Capabilities{})
+}
+
+func FuzzBackend(f *testing.F) {
+	tester.FuzzBackend(f, func() simpleblob.Interface {
+		return New()
+	})
+}
+
+func BenchmarkBackend(b *testing.B) {
+	tester.RunBenchmarks(b, New())
+}
+
+func TestBackend_limits(t *testing.T) {
+	ctx := context.Background()
+	b, err := NewWithOptions(Options{MaxBytes: 10, MaxObjects: 3})
+	require.NoError(t, err)
+
+	require.NoError(t, b.Store(ctx, "a", []byte("1")))
+	require.NoError(t, b.Store(ctx, "b", []byte("2")))
+	require.NoError(t, b.Store(ctx, "c", []byte("3")))
+	_, err = b.Load(ctx, "a") // now more recently used than b
+	require.NoError(t, err)
+
+	// Too many objects
+	require.NoError(t, b.Store(ctx, "d", []byte("4")))
+	ls, err := b.List(ctx, "")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "c", "d"}, ls.Names())
+
+	// Too many bytes
+	require.NoError(t, b.Store(ctx, "e", []byte("12345678")))
+	ls, err = b.List(ctx, "")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "d", "e"}, ls.Names())
+	assert.EqualValues(t, 2, b.Evictions())
+
+	// Never fits
+	assert.Error(t, b.Store(ctx, "big", make([]byte, 11)))
+	_, err = b.Load(ctx, "big")
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestRegistered(t *testing.T) {
+	ctx := context.Background()
+	// Unknown options are ignored for compatibility
+	st, err := simpleblob.GetBackend(ctx, "memory", map[string]interface{}{
+		"max_objects": 1,
+		"foo":         "ignored",
+	})
+	require.NoError(t, err)
+	require.NoError(t, st.Store(ctx, "a", nil))
+	require.NoError(t, st.Store(ctx, "b", nil))
+	ls, err := st.List(ctx, "")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"b"}, ls.Names())
+
+	_, err = simpleblob.GetBackend(ctx, "memory", map[string]interface{}{
+		"max_objects": -1,
+	})
+	assert.Error(t, err)
+}
+
+func TestRegistered_initial(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "sub"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "sub", "file"), []byte("from dir"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "both"), []byte("from dir"), 0o644))
+
+	st, err := simpleblob.GetBackend(ctx, "memory", map[string]interface{}{
+		"initial_dir": dir,
+		"initial": map[string]interface{}{
+			"both": "from map",
+			"foo":  "bar",
+		},
+		"read_only": true,
+	})
+	require.NoError(t, err)
+	ls, err := st.List(ctx, "")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"both", "foo", "sub/file"}, ls.Names())
+	data, err := st.Load(ctx, "both")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("from map"), data)
+	data, err = st.Load(ctx, "sub/file")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("from dir"), data)
+
+	assert.ErrorIs(t, st.Store(ctx, "foo", nil), ErrReadOnly)
+	assert.ErrorIs(t, st.Delete(ctx, "foo"), os.ErrPermission)
+	_, err = simpleblob.NewWriter(ctx, st, "foo")
+	assert.ErrorIs(t, err, ErrReadOnly)
+	_, err = simpleblob.GetBackend(ctx, "memory", map[string]interface{}{
+		"initial_dir": filepath.Join(dir, "missing"),
+	})
+	assert.Error(t, err)
+}
+
+func TestBackend_stream(t *testing.T) {
+	ctx := context.Background()
+	b := New()
+
+	w, err := b.NewWriter(ctx, "foo")
+	require.NoError(t, err)
+	_, err = w.Write([]byte("bar"))
+	require.NoError(t, err)
+	_, err = b.Load(ctx, "foo")
+	assert.ErrorIs(t, err, os.ErrNotExist) // not yet committed
+	require.NoError(t, w.Close())
+	assert.ErrorIs(t, w.Close(), simpleblob.ErrClosed)
+
+	r, err := b.NewReader(ctx, "foo")
+	require.NoError(t, err)
+	require.NoError(t, b.Store(ctx, "foo", []byte("replaced")))
+	data, err := io.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("bar"), data) // reads the blob as it was
+	require.NoError(t, r.Close())
+}
+
+func TestBackend_zeroCopy(t *testing.T) {
+	ctx := context.Background()
+	// Not using DoBackendTests, which checks that loaded data is a copy
+	b, err := NewWithOptions(Options{ZeroCopy: true})
+	require.NoError(t, err)
+
+	data := []byte("foo")
+	require.NoError(t, b.Store(ctx, "a", data))
+	loaded, err := b.Load(ctx, "a")
+	require.NoError(t, err)
+	assert.Same(t, &data[0], &loaded[0])
+
+	// Shared data is not modified when the blob is replaced
+	b = New()
+	require.NoError(t, b.Store(ctx, "a", []byte("foo")))
+	shared, err := b.LoadShared(ctx, "a")
+	require.NoError(t, err)
+	require.NoError(t, b.Store(ctx, "a", []byte("bar")))
+	assert.Equal(t, []byte("foo"), shared)
+	loaded, err = b.Load(ctx, "a")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("bar"), loaded)
+}
+
+func TestBackend_faults(t *testing.T) {
+	ctx := context.Background()
+	b, err := NewWithOptions(Options{Faults: FaultOptions{
+		FailPatterns: []string{"bad/*"},
+	}})
+	require.NoError(t, err)
+	assert.ErrorIs(t, b.Store(ctx, "bad/foo", nil), ErrInjected)
+	_, err = b.Load(ctx, "bad/foo")
+	assert.ErrorIs(t, err, ErrInjected)
+	assert.NoError(t, b.Store(ctx, "good/foo", nil))
+
+	errFull := errors.New("disk full")
+	b, err = NewWithOptions(Options{Faults: FaultOptions{
+		FailEvery: 3,
+		FailError: errFull,
+	}})
+	require.NoError(t, err)
+	var errs []error
+	for i := 0; i < 6; i++ {
+		errs = append(errs, b.Store(ctx, "foo", nil))
+	}
+	assert.Equal(t, []error{nil, nil, errFull, nil, nil, errFull}, errs)
+
+	b, err = NewWithOptions(Options{Faults: FaultOptions{
+		Latency: time.Hour,
+	}})
+	require.NoError(t, err)
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	_, err = b.List(ctx, "")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	_, err = NewWithOptions(Options{Faults: FaultOptions{
+		FailPatterns: []string{"["},
+	}})
+	assert.Error(t, err)
+}
+
+func TestBackend_snapshot(t *testing.T) {
+	ctx := context.Background()
+	b := New()
+	require.NoError(t, b.Store(ctx, "foo", []byte("bar")))
+	require.NoError(t, b.Store(ctx, "dir/empty", nil))
+
+	var buf bytes.Buffer
+	require.NoError(t, b.SaveTo(&buf))
+
+	b2 := New()
+	require.NoError(t, b2.Store(ctx, "foo", []byte("old")))
+	require.NoError(t, b2.Store(ctx, "other", []byte("kept")))
+	require.NoError(t, b2.LoadFrom(&buf))
+	ls, err := b2.List(ctx, "")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"dir/empty", "foo", "other"}, ls.Names())
+	data, err := b2.Load(ctx, "foo")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("bar"), data)
+}
+
+func TestBackend_persist(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "snapshot.tar")
+
+	b, err := NewWithOptions(Options{PersistPath: path, PersistInterval: time.Millisecond})
+	require.NoError(t, err)
+	require.NoError(t, b.Store(ctx, "foo", []byte("bar")))
+	time.Sleep(2 * time.Millisecond)
+	require.NoError(t, b.Store(ctx, "fizz", []byte("buzz"))) // triggers a save
+	assert.Eventually(t, func() bool {
+		b2, err := NewWithOptions(Options{PersistPath: path})
+		require.NoError(t, err)
+		ls, err := b2.List(ctx, "")
+		require.NoError(t, err)
+		return len(ls) == 2
+	}, time.Second, 10*time.Millisecond)
+
+	require.NoError(t, b.Delete(ctx, "foo"))
+	require.NoError(t, b.Persist())
+	b2, err := NewWithOptions(Options{PersistPath: path})
+	require.NoError(t, err)
+	ls, err := b2.List(ctx, "")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"fizz"}, ls.Names())
+
+	// Restored blobs take precedence over the initial contents
+	b2, err = NewWithOptions(Options{PersistPath: path, Initial: map[string]string{
+		"fizz": "seeded",
+		"foo":  "seeded",
+	}})
+	require.NoError(t, err)
+	data, err := b2.Load(ctx, "fizz")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("buzz"), data)
+	data, err = b2.Load(ctx, "foo")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("seeded"), data)
+
+	waitPersisted(t, b)
+}
+
+func TestBackend_persistLastChange(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "snapshot.tar")
+
+	b, err := NewWithOptions(Options{PersistPath: path, PersistInterval: 20 * time.Millisecond})
+	require.NoError(t, err)
+	require.NoError(t, b.Store(ctx, "foo", []byte("bar"))) // within the interval
+	_, err = os.Stat(path)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	assert.Eventually(t, func() bool {
+		_, err := os.Stat(path)
+		return err == nil
+	}, time.Second, 5*time.Millisecond)
+
+	waitPersisted(t, b)
+}
+
+// waitPersisted waits for background saves, before the directory gets
+// removed.
+func waitPersisted(t *testing.T, b *Backend) {
+	assert.Eventually(t, func() bool {
+		b.persist.mu.Lock()
+		defer b.persist.mu.Unlock()
+		return !b.persist.saving && b.persist.timer == nil && !b.persist.dirty
+	}, time.Second, time.Millisecond)
 }
@@ -0,0 +1,88 @@
+package memory
+
+import (
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// methods are the values of the method label of the call counter.
+var methods = []string{"list", "load", "store", "delete"}
+
+// stats holds the operation counters of a backend. They are always
+// maintained, but only exported when metrics are enabled.
+type stats struct {
+	calls        [4]atomic.Int64 // indexed like methods
+	misses       atomic.Int64
+	readBytes    atomic.Int64
+	writtenBytes atomic.Int64
+}
+
+const (
+	callList = iota
+	callLoad
+	callStore
+	callDelete
+)
+
+// collector exports the metrics of a backend. The object count and total
+// size are read from the backend when collected.
+type collector struct {
+	b *Backend
+
+	objects      *prometheus.Desc
+	bytes        *prometheus.Desc
+	evictions    *prometheus.Desc
+	calls        *prometheus.Desc
+	misses       *prometheus.Desc
+	readBytes    *prometheus.Desc
+	writtenBytes *prometheus.Desc
+}
+
+func newCollector(b *Backend, instance string) *collector {
+	var constLabels prometheus.Labels
+	if instance != "" {
+		constLabels = prometheus.Labels{"storage_instance": instance}
+	}
+	desc := func(name, help string, labels ...string) *prometheus.Desc {
+		return prometheus.NewDesc("storage_memory_"+name, help, labels, constLabels)
+	}
+	return &collector{
+		b:            b,
+		objects:      desc("objects", "Number of blobs stored"),
+		bytes:        desc("bytes", "Total size of blobs stored"),
+		evictions:    desc("evictions_total", "Blobs evicted to respect the size limits"),
+		calls:        desc("call_total", "Memory backend calls by method", "method"),
+		misses:       desc("load_miss_total", "Loads of blobs that do not exist"),
+		readBytes:    desc("read_bytes_total", "Bytes of blobs read"),
+		writtenBytes: desc("written_bytes_total", "Bytes of successfully stored blobs"),
+	}
+}
+
+func (c *collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.objects
+	ch <- c.bytes
+	ch <- c.evictions
+	ch <- c.calls
+	ch <- c.misses
+	ch <- c.readBytes
+	ch <- c.writtenBytes
+}
+
+func (c *collector) Collect(ch chan<- prometheus.Metric) {
+	b := c.b
+	b.mu.Lock()
+	objects, size, evictions := b.lru.Len(), b.size, b.evictions
+	b.mu.Unlock()
+
+	ch <- prometheus.MustNewConstMetric(c.objects, prometheus.GaugeValue, float64(objects))
+	ch <- prometheus.MustNewConstMetric(c.bytes, prometheus.GaugeValue, float64(size))
+	ch <- prometheus.MustNewConstMetric(c.evictions, prometheus.CounterValue, float64(evictions))
+	for i, method := range methods {
+		ch <- prometheus.MustNewConstMetric(c.calls, prometheus.CounterValue,
+			float64(b.stats.calls[i].Load()), method)
+	}
+	ch <- prometheus.MustNewConstMetric(c.misses, prometheus.CounterValue, float64(b.stats.misses.Load()))
+	ch <- prometheus.MustNewConstMetric(c.readBytes, prometheus.CounterValue, float64(b.stats.readBytes.Load()))
+	ch <- prometheus.MustNewConstMetric(c.writtenBytes, prometheus.CounterValue, float64(b.stats.writtenBytes.Load()))
+}
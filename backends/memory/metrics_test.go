@@ -0,0 +1,84 @@
+package memory
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetrics(t *testing.T) {
+	ctx := context.Background()
+	reg := prometheus.NewRegistry()
+	b, err := NewWithOptions(Options{MaxObjects: 2, Registerer: reg, Instance: "cache"})
+	require.NoError(t, err)
+
+	require.NoError(t, b.Store(ctx, "a", []byte("1")))
+	require.NoError(t, b.Store(ctx, "b", []byte("22")))
+	w, err := b.NewWriter(ctx, "c")
+	require.NoError(t, err)
+	_, err = w.Write([]byte("333"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close()) // evicts "a"
+
+	_, err = b.Load(ctx, "b")
+	assert.NoError(t, err)
+	_, err = b.Load(ctx, "a")
+	assert.Error(t, err)
+	r, err := b.NewReader(ctx, "c")
+	require.NoError(t, err)
+	_, err = io.ReadAll(r)
+	assert.NoError(t, err)
+	assert.NoError(t, r.Close())
+	assert.NoError(t, b.Delete(ctx, "b"))
+
+	expected := `
+# HELP storage_memory_bytes Total size of blobs stored
+# TYPE storage_memory_bytes gauge
+storage_memory_bytes{storage_instance="cache"} 3
+# HELP storage_memory_call_total Memory backend calls by method
+# TYPE storage_memory_call_total counter
+storage_memory_call_total{method="delete",storage_instance="cache"} 1
+storage_memory_call_total{method="list",storage_instance="cache"} 0
+storage_memory_call_total{method="load",storage_instance="cache"} 3
+storage_memory_call_total{method="store",storage_instance="cache"} 3
+# HELP storage_memory_evictions_total Blobs evicted to respect the size limits
+# TYPE storage_memory_evictions_total counter
+storage_memory_evictions_total{storage_instance="cache"} 1
+# HELP storage_memory_load_miss_total Loads of blobs that do not exist
+# TYPE storage_memory_load_miss_total counter
+storage_memory_load_miss_total{storage_instance="cache"} 1
+# HELP storage_memory_objects Number of blobs stored
+# TYPE storage_memory_objects gauge
+storage_memory_objects{storage_instance="cache"} 1
+# HELP storage_memory_read_bytes_total Bytes of blobs read
+# TYPE storage_memory_read_bytes_total counter
+storage_memory_read_bytes_total{storage_instance="cache"} 5
+# HELP storage_memory_written_bytes_total Bytes of successfully stored blobs
+# TYPE storage_memory_written_bytes_total counter
+storage_memory_written_bytes_total{storage_instance="cache"} 6
+`
+	assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(expected)))
+
+	// A second backend needs its own instance label
+	_, err = NewWithOptions(Options{Registerer: reg, Instance: "cache"})
+	assert.Error(t, err)
+	_, err = NewWithOptions(Options{Registerer: reg, Instance: "other"})
+	assert.NoError(t, err)
+}
+
+func TestMetrics_rejectedWrites(t *testing.T) {
+	ctx := context.Background()
+	b, err := NewWithOptions(Options{ReadOnly: true})
+	require.NoError(t, err)
+
+	assert.ErrorIs(t, b.Store(ctx, "a", nil), ErrReadOnly)
+	_, err = b.NewWriter(ctx, "a")
+	assert.ErrorIs(t, err, ErrReadOnly)
+	assert.Equal(t, int64(2), b.stats.calls[callStore].Load())
+}
@@ -0,0 +1,187 @@
+package memory
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// SaveTo writes a snapshot of all blobs to w, as a tar archive with one file
+// per blob.
+func (b *Backend) SaveTo(w io.Writer) error {
+	// Stored data is never modified, only replaced, so it can be written
+	// without holding the lock.
+	b.mu.Lock()
+	entries := make([]*entry, 0, len(b.blobs))
+	for _, elem := range b.blobs {
+		entries = append(entries, elem.Value.(*entry))
+	}
+	b.mu.Unlock()
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].name < entries[j].name
+	})
+
+	tw := tar.NewWriter(w)
+	for _, e := range entries {
+		hdr := &tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     e.name,
+			Size:     int64(len(e.data)),
+			Mode:     0o644,
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := tw.Write(e.data); err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+// LoadFrom stores all blobs from a snapshot written by SaveTo, replacing the
+// blobs with the same name. Other blobs are kept.
+func (b *Backend) LoadFrom(r io.Reader) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return err
+		}
+		if err := b.checkSize(hdr.Name, data); err != nil {
+			return err
+		}
+		b.mu.Lock()
+		b.set(hdr.Name, data)
+		b.mu.Unlock()
+	}
+}
+
+// persister saves snapshots to the PersistPath option.
+type persister struct {
+	saveMu sync.Mutex // serializes saves, which use the same temp file
+
+	mu     sync.Mutex
+	last   time.Time   // end of the last background save
+	dirty  bool        // changed since the last save started
+	saving bool        // a background save is running
+	timer  *time.Timer // pending background save
+}
+
+// Persist saves a snapshot to the file set by the PersistPath option,
+// replacing it atomically. It should be called before exiting, as changes
+// made since the last periodic save are lost otherwise.
+func (b *Backend) Persist() error {
+	if b.opt.PersistPath == "" {
+		return fmt.Errorf("memory: persist_path is not set")
+	}
+	b.persist.saveMu.Lock()
+	defer b.persist.saveMu.Unlock()
+	b.persist.mu.Lock()
+	b.persist.dirty = false
+	b.persist.mu.Unlock()
+
+	tmp := b.opt.PersistPath + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	err = b.SaveTo(f)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, b.opt.PersistPath)
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		b.persist.mu.Lock()
+		b.persist.dirty = true
+		b.persist.mu.Unlock()
+	}
+	return err
+}
+
+// restore loads the snapshot at PersistPath, if any.
+func (b *Backend) restore() error {
+	f, err := os.Open(b.opt.PersistPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := b.LoadFrom(f); err != nil {
+		return fmt.Errorf("memory: load %s: %w", b.opt.PersistPath, err)
+	}
+	return nil
+}
+
+// changed records a change, and schedules a background save once
+// PersistInterval has elapsed since the last one.
+func (b *Backend) changed() {
+	if b.opt.PersistPath == "" {
+		return
+	}
+	p := &b.persist
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.dirty = true
+	if b.opt.PersistInterval > 0 {
+		b.schedulePersist()
+	}
+}
+
+// schedulePersist starts a background save, or arms a timer for when
+// PersistInterval has elapsed since the last one. Changes made during a
+// save are saved by the next one. b.persist.mu must be held.
+func (b *Backend) schedulePersist() {
+	p := &b.persist
+	if p.saving || p.timer != nil {
+		return
+	}
+	if wait := b.opt.PersistInterval - time.Since(p.last); wait > 0 {
+		p.timer = time.AfterFunc(wait, func() {
+			p.mu.Lock()
+			defer p.mu.Unlock()
+			p.timer = nil
+			if p.dirty {
+				b.schedulePersist()
+			}
+		})
+		return
+	}
+	p.saving = true
+	go func() {
+		if err := b.Persist(); err != nil {
+			// Persist marked the backend dirty again, so this is retried
+			b.log.Error(err, "save snapshot", "path", b.opt.PersistPath)
+		}
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		p.last = time.Now()
+		p.saving = false
+		if p.dirty {
+			b.schedulePersist()
+		}
+	}()
+}
@@ -0,0 +1,82 @@
+package memory
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// ErrReadOnly is returned by write operations when the ReadOnly option is
+// set. Like the readonly wrapper, it wraps os.ErrPermission.
+var ErrReadOnly = fmt.Errorf("memory: read-only backend: %w", os.ErrPermission)
+
+// seed stores the Initial and InitialDir contents. Blobs that already exist,
+// because they were restored from PersistPath, are left untouched.
+func (b *Backend) seed() error {
+	b.mu.Lock()
+	restored := make(map[string]bool, len(b.blobs))
+	for name := range b.blobs {
+		restored[name] = true
+	}
+	b.mu.Unlock()
+	seedBlob := func(name string, data []byte) error {
+		if restored[name] {
+			return nil
+		}
+		return b.seedBlob(name, data)
+	}
+
+	if b.opt.InitialDir != "" {
+		err := filepath.WalkDir(b.opt.InitialDir, func(p string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			rel, err := filepath.Rel(b.opt.InitialDir, p)
+			if err != nil {
+				return err
+			}
+			data, err := os.ReadFile(p)
+			if err != nil {
+				return err
+			}
+			return seedBlob(filepath.ToSlash(rel), data)
+		})
+		if err != nil {
+			return fmt.Errorf("memory: initial_dir: %w", err)
+		}
+	}
+
+	// Sorted, so that the result does not depend on map order if blobs
+	// get evicted
+	names := make([]string, 0, len(b.opt.Initial))
+	for name := range b.opt.Initial {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := seedBlob(name, []byte(b.opt.Initial[name])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *Backend) seedBlob(name string, data []byte) error {
+	if err := b.checkSize(name, data); err != nil {
+		return err
+	}
+	b.mu.Lock()
+	b.set(name, data)
+	b.mu.Unlock()
+	return nil
+}
+
+// writable returns ErrReadOnly if the ReadOnly option is set.
+func (b *Backend) writable(op, name string) error {
+	if b.opt.ReadOnly {
+		return fmt.Errorf("%s %q: %w", op, name, ErrReadOnly)
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package memory
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+
+	"github.com/PowerDNS/simpleblob"
+)
+
+// NewReader satisfies simpleblob.StreamReader. It reads the stored blob
+// directly, without copying it.
+func (b *Backend) NewReader(ctx context.Context, name string) (io.ReadCloser, error) {
+	if err := b.begin(ctx, callLoad, name); err != nil {
+		return nil, err
+	}
+	data, exists := b.get(name)
+	if !exists {
+		return nil, os.ErrNotExist
+	}
+	// Stored data is never modified, only replaced
+	return &reader{r: bytes.NewReader(data), stats: &b.stats}, nil
+}
+
+// NewWriter satisfies simpleblob.StreamWriter. The blob is stored when the
+// writer is closed, unless ctx is done by then.
+func (b *Backend) NewWriter(ctx context.Context, name string) (io.WriteCloser, error) {
+	if err := b.begin(ctx, callStore, name); err != nil {
+		return nil, err
+	}
+	if err := b.writable("write", name); err != nil {
+		return nil, err
+	}
+	return &writer{ctx: ctx, b: b, name: name}, nil
+}
+
+type reader struct {
+	r      *bytes.Reader
+	stats  *stats
+	closed bool
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	if r.closed {
+		return 0, simpleblob.ErrClosed
+	}
+	n, err := r.r.Read(p)
+	r.stats.readBytes.Add(int64(n))
+	return n, err
+}
+
+func (r *reader) Close() error {
+	r.closed = true
+	return nil
+}
+
+type writer struct {
+	ctx    context.Context
+	b      *Backend
+	name   string
+	buf    bytes.Buffer
+	closed bool
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, simpleblob.ErrClosed
+	}
+	return w.buf.Write(p)
+}
+
+func (w *writer) Close() error {
+	if w.closed {
+		return simpleblob.ErrClosed
+	}
+	w.closed = true
+	if err := w.ctx.Err(); err != nil {
+		return err
+	}
+	data := w.buf.Bytes()
+	if err := w.b.checkSize(w.name, data); err != nil {
+		return err
+	}
+	// The buffer is not used anymore, so no copy is needed
+	w.b.mu.Lock()
+	w.b.set(w.name, data)
+	w.b.mu.Unlock()
+
+	w.b.stored(len(data))
+	return nil
+}
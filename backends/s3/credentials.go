@@ -1,12 +1,103 @@
 package s3
 
 import (
+	"net/http"
 	"os"
 	"time"
 
 	"github.com/minio/minio-go/v7/pkg/credentials"
 )
 
+// Values for Options.CredentialsSource.
+const (
+	CredentialsIAM     = "iam"
+	CredentialsProfile = "profile"
+	CredentialsEnv     = "env"
+	CredentialsChain   = "chain"
+)
+
+// Values for Options.SignatureVersion.
+const (
+	SignatureV4        = "v4"
+	SignatureV2        = "v2"
+	SignatureAnonymous = "anonymous"
+)
+
+// credentials returns the credentials selected by the options.
+func (o Options) credentials() *credentials.Credentials {
+	var p credentials.Provider
+	switch {
+	case o.SignatureVersion == SignatureAnonymous:
+		// Static returns anonymous values without keys
+		return credentials.New(&credentials.Static{})
+	case o.CredentialsSource == CredentialsIAM:
+		p = o.iamProvider()
+	case o.CredentialsSource == CredentialsProfile:
+		p = o.profileProvider()
+	case o.CredentialsSource == CredentialsEnv:
+		p = &credentials.EnvAWS{}
+	case o.CredentialsSource == CredentialsChain:
+		p = &credentials.Chain{Providers: []credentials.Provider{
+			&credentials.EnvAWS{},
+			o.profileProvider(),
+			o.iamProvider(),
+		}}
+	case o.AccessKeyFile != "":
+		p = &FileSecretsCredentials{
+			AccessKeyFile:   o.AccessKeyFile,
+			SecretKeyFile:   o.SecretKeyFile,
+			RefreshInterval: o.SecretsRefreshInterval,
+		}
+	default:
+		p = &credentials.Static{Value: credentials.Value{
+			AccessKeyID:     o.AccessKey,
+			SecretAccessKey: o.SecretKey,
+		}}
+	}
+	if o.SignatureVersion == SignatureV2 {
+		p = signerProvider{Provider: p, signerType: credentials.SignatureV2}
+	}
+	return credentials.New(p)
+}
+
+// signerProvider overrides the signature type of the values retrieved by
+// a provider.
+type signerProvider struct {
+	credentials.Provider
+	signerType credentials.SignatureType
+}
+
+func (p signerProvider) Retrieve() (credentials.Value, error) {
+	v, err := p.Provider.Retrieve()
+	if err == nil && v.SignerType != credentials.SignatureAnonymous {
+		v.SignerType = p.signerType
+	}
+	return v, err
+}
+
+func (o Options) profileProvider() *credentials.FileAWSCredentials {
+	return &credentials.FileAWSCredentials{
+		Filename: o.AWSCredentialsFile,
+		Profile:  o.AWSProfile,
+	}
+}
+
+// iamProvider returns a provider for EC2 and ECS roles, and for IRSA. The
+// environment variables set by AWS take precedence over the options, as
+// implemented by minio.
+func (o Options) iamProvider() *credentials.IAM {
+	p := &credentials.IAM{
+		Client: &http.Client{
+			Transport: http.DefaultTransport,
+		},
+		Endpoint: o.IAMEndpoint,
+		Region:   o.Region,
+	}
+	p.EKSIdentity.TokenFile = o.WebIdentityTokenFile
+	p.EKSIdentity.RoleARN = o.RoleARN
+	return p
+}
+
 // FileSecretsCredentials is an implementation of Minio's credentials.Provider,
 // allowing to read credentials from Kubernetes or Docker secrets, as described in
 // https://kubernetes.io/docs/tasks/inject-data-application/distribute-credentials-secure
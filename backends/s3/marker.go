@@ -2,22 +2,114 @@ package s3
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
 	"time"
 )
 
+// Marker describes the last change recorded in the update marker.
+type Marker struct {
+	// Version is the format of the marker, 1 for the original
+	// "name:etag:nanos:deleted" format, or 2 for JSON.
+	Version int `json:"v"`
+	// Seq is incremented by every write of a version 2 marker. It is 0 for
+	// version 1.
+	Seq uint64 `json:"seq,omitempty"`
+	// Instance identifies the writer of a version 2 marker.
+	Instance string `json:"instance,omitempty"`
+	// Op is "store" or "delete".
+	Op   string `json:"op"`
+	Name string `json:"name"`
+	ETag string `json:"etag,omitempty"`
+	// Time is the time of the change in nanoseconds since the UNIX epoch.
+	Time int64 `json:"time"`
+}
+
+// Values for Marker.Op.
+const (
+	MarkerOpStore  = "store"
+	MarkerOpDelete = "delete"
+)
+
+// ParseMarker parses the content of an update marker in any version.
+func ParseMarker(data []byte) (Marker, error) {
+	if len(data) > 0 && data[0] == '{' {
+		var m Marker
+		if err := json.Unmarshal(data, &m); err != nil {
+			return Marker{}, fmt.Errorf("parse update marker: %w", err)
+		}
+		if m.Version != 2 {
+			return Marker{}, fmt.Errorf("unsupported update marker version %d", m.Version)
+		}
+		return m, nil
+	}
+
+	// Version 1, parsed from the end because names may contain ':'
+	fields := strings.Split(string(data), ":")
+	if len(fields) < 4 {
+		return Marker{}, fmt.Errorf("invalid update marker %q", data)
+	}
+	n := len(fields)
+	nanos, err := strconv.ParseInt(fields[n-2], 10, 64)
+	if err != nil {
+		return Marker{}, fmt.Errorf("invalid update marker %q: %w", data, err)
+	}
+	isDel, err := strconv.ParseBool(fields[n-1])
+	if err != nil {
+		return Marker{}, fmt.Errorf("invalid update marker %q: %w", data, err)
+	}
+	m := Marker{
+		Version: 1,
+		Op:      MarkerOpStore,
+		Name:    strings.Join(fields[:n-3], ":"),
+		ETag:    fields[n-3],
+		Time:    nanos,
+	}
+	if isDel {
+		m.Op = MarkerOpDelete
+	}
+	return m, nil
+}
+
 // setMarker puts name and etag into the object identified by
 // UpdateMarkerFilename.
 // An empty etag string means that the object identified by name was deleted.
 //
 // In case the UseUpdateMarker option is false, this function doesn't do
-// anything and returns no error.
+// anything and returns no error, except invalidating the cached List if
+// UseBucketNotifications is enabled.
+// With UpdateMarkerReadOnly, the marker is not written, but the cached List
+// is invalidated.
 func (b *Backend) setMarker(ctx context.Context, name, etag string, isDel bool) error {
+	if b.opt.UseBucketNotifications {
+		// Do not wait for the notification of our own change
+		b.invalidateList()
+	}
 	if !b.opt.UseUpdateMarker {
 		return nil
 	}
+	if b.opt.UpdateMarkerReadOnly {
+		// Only make our own change visible to us
+		b.mu.Lock()
+		b.lastList = nil
+		b.mu.Unlock()
+		return nil
+	}
 	nanos := time.Now().UnixNano()
-	s := fmt.Sprintf("%s:%s:%d:%v", name, etag, nanos, isDel)
+	var s string
+	if b.opt.UpdateMarkerVersion == 2 {
+		var err error
+		if s, err = b.markerV2(ctx, name, etag, isDel, nanos); err != nil {
+			return err
+		}
+	} else {
+		s = fmt.Sprintf("%s:%s:%d:%v", name, etag, nanos, isDel)
+	}
 	// Here, we're not using Store because markerName already has the global prefix.
 	_, err := b.doStore(ctx, b.markerName, []byte(s))
 	if err != nil {
@@ -26,6 +118,66 @@ func (b *Backend) setMarker(ctx context.Context, name, etag string, isDel bool)
 	b.mu.Lock()
 	defer b.mu.Unlock()
 	b.lastList = nil
+	b.observeMarker(s)
 	b.lastMarker = s
 	return nil
 }
+
+// markerV2 returns the content of a version 2 marker following the
+// current one. The current marker is loaded to get its sequence number, so
+// concurrent writers can produce the same sequence number, which readers
+// report as out of order.
+func (b *Backend) markerV2(ctx context.Context, name, etag string, isDel bool, nanos int64) (string, error) {
+	m := Marker{
+		Version:  2,
+		Seq:      1,
+		Instance: b.opt.UpdateMarkerInstance,
+		Op:       MarkerOpStore,
+		Name:     name,
+		ETag:     etag,
+		Time:     nanos,
+	}
+	if isDel {
+		m.Op = MarkerOpDelete
+	}
+	r, err := b.doLoadReader(ctx, b.markerName)
+	if err == nil {
+		var buf strings.Builder
+		_, err = io.Copy(&buf, r)
+		_ = r.Close()
+		if err != nil {
+			return "", err
+		}
+		// A version 1 or corrupt marker restarts the sequence
+		if prev, err := ParseMarker([]byte(buf.String())); err == nil {
+			m.Seq = prev.Seq + 1
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return "", err
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// observeMarker checks the sequence of a newly read marker against the
+// previous one, and counts the gaps and sequence numbers going backwards.
+// b.mu must be held.
+func (b *Backend) observeMarker(s string) {
+	m, err := ParseMarker([]byte(s))
+	if err != nil || m.Version < 2 {
+		return
+	}
+	last := b.lastSeq
+	b.lastSeq = m.Seq
+	switch {
+	case last == 0:
+	case m.Seq <= last:
+		metricMarkerOutOfOrder.Inc()
+		b.log.Info("update marker out of order", "seq", m.Seq, "last_seq", last, "instance", m.Instance)
+	case m.Seq > last+1:
+		metricMarkerSkipped.Add(float64(m.Seq - last - 1))
+	}
+}
@@ -0,0 +1,47 @@
+package s3
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseMarker(t *testing.T) {
+	m, err := ParseMarker([]byte("foo:bar:abc123:1700000000:true"))
+	require.NoError(t, err)
+	assert.Equal(t, Marker{
+		Version: 1,
+		Op:      MarkerOpDelete,
+		Name:    "foo:bar",
+		ETag:    "abc123",
+		Time:    1700000000,
+	}, m)
+
+	m, err = ParseMarker([]byte(`{"v":2,"seq":3,"instance":"a","op":"store","name":"foo","time":1}`))
+	require.NoError(t, err)
+	assert.EqualValues(t, 3, m.Seq)
+	assert.Equal(t, "a", m.Instance)
+
+	for _, s := range []string{"", "foo", "foo::x:true", `{"v":3}`, `{`} {
+		_, err = ParseMarker([]byte(s))
+		assert.Error(t, err, s)
+	}
+}
+
+func TestBackend_observeMarker(t *testing.T) {
+	b := &Backend{}
+	skipped := testutil.ToFloat64(metricMarkerSkipped)
+	outOfOrder := testutil.ToFloat64(metricMarkerOutOfOrder)
+
+	b.observeMarker(`{"v":2,"seq":5,"op":"store","name":"foo","time":1}`)
+	b.observeMarker(`{"v":2,"seq":6,"op":"store","name":"foo","time":2}`)
+	b.observeMarker(`{"v":2,"seq":9,"op":"store","name":"foo","time":3}`)
+	assert.Equal(t, skipped+2, testutil.ToFloat64(metricMarkerSkipped))
+	b.observeMarker(`{"v":2,"seq":9,"op":"delete","name":"foo","time":4}`)
+	assert.Equal(t, outOfOrder+1, testutil.ToFloat64(metricMarkerOutOfOrder))
+	// Version 1 markers are ignored
+	b.observeMarker("foo::1:false")
+	assert.EqualValues(t, 9, b.lastSeq)
+}
@@ -1,6 +1,9 @@
 package s3
 
 import (
+	"io"
+	"sync"
+
 	"github.com/prometheus/client_golang/prometheus"
 )
 
@@ -19,6 +22,44 @@ var (
 		},
 		[]string{"method"},
 	)
+	metricCallsInFlight = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "storage_s3_calls_in_flight",
+			Help: "S3 API calls in progress by method, including the reading of loaded blobs",
+		},
+		[]string{"method"},
+	)
+	metricUploadedBytes = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "storage_s3_uploaded_bytes_total",
+			Help: "Bytes of successfully stored blobs sent to S3",
+		},
+	)
+	metricDownloadedBytes = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "storage_s3_downloaded_bytes_total",
+			Help: "Bytes of blobs read from S3",
+		},
+	)
+	metricRetryableResponses = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "storage_s3_retryable_responses_total",
+			Help: "S3 responses with a status causing a retry by the client, unless retries are exhausted, by status",
+		},
+		[]string{"status"},
+	)
+	metricMarkerSkipped = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "storage_s3_update_marker_skipped_total",
+			Help: "Version 2 update markers written by other instances and never read by this one",
+		},
+	)
+	metricMarkerOutOfOrder = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "storage_s3_update_marker_out_of_order_total",
+			Help: "Version 2 update markers read with a sequence number not above the previous one",
+		},
+	)
 	metricCallErrors = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "storage_s3_call_error_total",
@@ -32,4 +73,37 @@ func init() {
 	prometheus.MustRegister(metricLastCallTimestamp)
 	prometheus.MustRegister(metricCalls)
 	prometheus.MustRegister(metricCallErrors)
+	prometheus.MustRegister(metricCallsInFlight)
+	prometheus.MustRegister(metricUploadedBytes)
+	prometheus.MustRegister(metricDownloadedBytes)
+	prometheus.MustRegister(metricRetryableResponses)
+	prometheus.MustRegister(metricMarkerSkipped)
+	prometheus.MustRegister(metricMarkerOutOfOrder)
+}
+
+// trackInFlight counts a call of method as in flight until the returned
+// function is called.
+func trackInFlight(method string) (done func()) {
+	g := metricCallsInFlight.WithLabelValues(method)
+	g.Inc()
+	return g.Dec
+}
+
+// downloadReader counts the bytes read from a downloaded blob, and keeps
+// the call in flight until it is closed.
+type downloadReader struct {
+	io.ReadCloser
+	once sync.Once
+	done func()
+}
+
+func (r *downloadReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	metricDownloadedBytes.Add(float64(n))
+	return n, err
+}
+
+func (r *downloadReader) Close() error {
+	r.once.Do(r.done)
+	return r.ReadCloser.Close()
 }
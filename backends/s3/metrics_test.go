@@ -0,0 +1,26 @@
+package s3
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDownloadReader(t *testing.T) {
+	before := testutil.ToFloat64(metricDownloadedBytes)
+	done := trackInFlight("test")
+	assert.Equal(t, 1.0, testutil.ToFloat64(metricCallsInFlight.WithLabelValues("test")))
+
+	r := &downloadReader{ReadCloser: io.NopCloser(strings.NewReader("foobar")), done: done}
+	data, err := io.ReadAll(r)
+	assert.NoError(t, err)
+	assert.Equal(t, "foobar", string(data))
+	assert.Equal(t, before+6, testutil.ToFloat64(metricDownloadedBytes))
+
+	assert.NoError(t, r.Close())
+	assert.NoError(t, r.Close())
+	assert.Equal(t, 0.0, testutil.ToFloat64(metricCallsInFlight.WithLabelValues("test")))
+}
@@ -0,0 +1,96 @@
+package s3
+
+import (
+	"context"
+	"time"
+
+	"github.com/PowerDNS/simpleblob"
+)
+
+// notificationEvents are the bucket events invalidating the cached List.
+var notificationEvents = []string{
+	"s3:ObjectCreated:*",
+	"s3:ObjectRemoved:*",
+}
+
+// notificationRetryInterval is the time between two attempts to listen to
+// bucket notifications after an error.
+const notificationRetryInterval = 5 * time.Second
+
+// listenNotifications invalidates the cached List on every bucket event,
+// until ctx is canceled. The cache is not used while not listening.
+func (b *Backend) listenNotifications(ctx context.Context) {
+	for ctx.Err() == nil {
+		b.mu.Lock()
+		b.listening = true
+		b.mu.Unlock()
+		// Events may have been missed while not listening
+		b.invalidateList()
+
+		metricCalls.WithLabelValues("listen-notifications").Inc()
+		metricLastCallTimestamp.WithLabelValues("listen-notifications").SetToCurrentTime()
+		ch := b.client.ListenBucketNotification(ctx, b.opt.Bucket, b.opt.GlobalPrefix, "", notificationEvents)
+		var err error
+		for info := range ch {
+			if info.Err != nil {
+				err = info.Err
+				break
+			}
+			if len(info.Records) > 0 {
+				b.invalidateList()
+			}
+		}
+
+		b.mu.Lock()
+		b.listening = false
+		b.mu.Unlock()
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			metricCallErrors.WithLabelValues("listen-notifications").Inc()
+			b.log.Error(err, "bucket notifications interrupted", "retry_in", notificationRetryInterval)
+		}
+		select {
+		case <-time.After(notificationRetryInterval):
+		case <-ctx.Done():
+		}
+	}
+}
+
+// invalidateList drops the cached List.
+func (b *Backend) invalidateList() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.lastList = nil
+	b.listGen++
+}
+
+// listNotified serves List from a cache invalidated by bucket notifications.
+func (b *Backend) listNotified(ctx context.Context, prefix string) (simpleblob.BlobList, error) {
+	b.mu.Lock()
+	useCache := b.listening && b.lastList != nil &&
+		time.Since(b.lastTime) < b.opt.UpdateMarkerForceListInterval
+	blobs := b.lastList
+	gen := b.listGen
+	b.mu.Unlock()
+
+	if useCache {
+		return blobs.WithPrefix(prefix), nil
+	}
+
+	blobs, err := b.doList(ctx, b.opt.GlobalPrefix) // We want to cache all, so no prefix
+	if err != nil {
+		return nil, err
+	}
+
+	b.mu.Lock()
+	// Do not cache a list that may predate an event
+	if gen == b.listGen {
+		b.lastList = blobs
+		b.lastTime = time.Now()
+	}
+	b.mu.Unlock()
+
+	return blobs.WithPrefix(prefix), nil
+}
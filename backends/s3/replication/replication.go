@@ -0,0 +1,117 @@
+// Package replication configures the replication of the bucket of an s3
+// backend to a second bucket, to bootstrap active-passive disaster
+// recovery from the same configuration as the backend.
+//
+// The remote target must be registered beforehand. With MinIO, this is done
+// with `mc admin bucket remote add`, which returns the ARN to use as
+// DestinationARN. Both buckets must have versioning enabled, which Configure
+// does for the source bucket.
+package replication
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/replication"
+
+	"github.com/PowerDNS/simpleblob/backends/s3"
+)
+
+// DefaultRuleID is the default value for RuleID.
+const DefaultRuleID = "simpleblob"
+
+// Options describes the replication of a bucket
+type Options struct {
+	// DestinationARN identifies the destination bucket. With MinIO, it is
+	// the ARN of the remote target, like
+	// "arn:minio:replication::<id>:<bucket>". With AWS, it is the ARN of the
+	// bucket, like "arn:aws:s3:::<bucket>".
+	DestinationARN string `yaml:"destination_arn"`
+	// RoleARN is the IAM role used by AWS to replicate objects. It is not
+	// used by MinIO.
+	RoleARN string `yaml:"role_arn"`
+	// RuleID identifies the replication rule, which is replaced if it
+	// already exists. It defaults to DefaultRuleID.
+	RuleID string `yaml:"rule_id"`
+	// Priority of the rule, if the bucket has other rules.
+	Priority int `yaml:"priority"`
+	// Prefix limits replication to the blobs with this prefix. It is
+	// relative to the GlobalPrefix of the backend.
+	Prefix string `yaml:"prefix"`
+
+	// ReplicateDeletes replicates deletions of specific versions.
+	ReplicateDeletes bool `yaml:"replicate_deletes"`
+	// ReplicateDeleteMarkers replicates deletions of blobs.
+	ReplicateDeleteMarkers bool `yaml:"replicate_delete_markers"`
+	// ReplicateExisting replicates the blobs stored before the rule was
+	// added. This is only supported by MinIO.
+	ReplicateExisting bool `yaml:"replicate_existing"`
+}
+
+func (o Options) Check() error {
+	if o.DestinationARN == "" {
+		return fmt.Errorf("replication: destination_arn is required")
+	}
+	if o.Priority < 0 {
+		return fmt.Errorf("replication: priority must not be negative")
+	}
+	return nil
+}
+
+func enable(v bool) string {
+	if v {
+		return "enable"
+	}
+	return "disable"
+}
+
+// Configure enables versioning on the bucket of b, and adds or replaces a
+// rule replicating it as described by opt.
+func Configure(ctx context.Context, b *s3.Backend, opt Options) error {
+	if err := opt.Check(); err != nil {
+		return err
+	}
+	if opt.RuleID == "" {
+		opt.RuleID = DefaultRuleID
+	}
+	client := b.Client()
+	bopt := b.Options()
+
+	if err := client.EnableVersioning(ctx, bopt.Bucket); err != nil {
+		return fmt.Errorf("replication: enable versioning: %w", err)
+	}
+
+	cfg, err := client.GetBucketReplication(ctx, bopt.Bucket)
+	if err != nil && minio.ToErrorResponse(err).Code != "ReplicationConfigurationNotFoundError" {
+		return fmt.Errorf("replication: get configuration: %w", err)
+	}
+	ropt := replication.Options{
+		Op:                      replication.AddOption,
+		ID:                      opt.RuleID,
+		RoleArn:                 opt.RoleARN,
+		DestBucket:              opt.DestinationARN,
+		Prefix:                  bopt.GlobalPrefix + opt.Prefix,
+		Priority:                strconv.Itoa(opt.Priority),
+		RuleStatus:              "enable",
+		ReplicateDeletes:        enable(opt.ReplicateDeletes),
+		ReplicateDeleteMarkers:  enable(opt.ReplicateDeleteMarkers),
+		ExistingObjectReplicate: enable(opt.ReplicateExisting),
+	}
+	// RemoveRule refuses to remove the last rule
+	rules := cfg.Rules[:0]
+	for _, rule := range cfg.Rules {
+		if rule.ID != opt.RuleID {
+			rules = append(rules, rule)
+		}
+	}
+	cfg.Rules = rules
+	if err := cfg.AddRule(ropt); err != nil {
+		return fmt.Errorf("replication: %w", err)
+	}
+	if err := client.SetBucketReplication(ctx, bopt.Bucket, cfg); err != nil {
+		return fmt.Errorf("replication: set configuration: %w", err)
+	}
+	return nil
+}
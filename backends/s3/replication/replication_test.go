@@ -0,0 +1,13 @@
+package replication
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOptions_Check(t *testing.T) {
+	assert.Error(t, Options{}.Check())
+	assert.Error(t, Options{DestinationARN: "arn:aws:s3:::foo", Priority: -1}.Check())
+	assert.NoError(t, Options{DestinationARN: "arn:aws:s3:::foo"}.Check())
+}
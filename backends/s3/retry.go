@@ -0,0 +1,126 @@
+package s3
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// DefaultRetryAfterMax is the default value for RetryAfterMax.
+const DefaultRetryAfterMax = 30 * time.Second
+
+// minioRetry holds the minio retry settings, which are global to the
+// process. They are set by the first backend created, before any of its
+// clients can read them, and cannot be changed afterwards.
+var minioRetry struct {
+	sync.Mutex
+	set                     bool
+	maxRetries              int
+	backoffUnit, backoffCap time.Duration
+}
+
+// setMinioRetry applies the retry options to the minio client package, or
+// checks that they match the ones already applied.
+func setMinioRetry(opt Options) error {
+	minioRetry.Lock()
+	defer minioRetry.Unlock()
+	if !minioRetry.set {
+		minioRetry.set = true
+		if opt.MaxRetries > 0 {
+			minio.MaxRetry = opt.MaxRetries
+		}
+		if opt.RetryBackoffUnit > 0 {
+			minio.DefaultRetryUnit = opt.RetryBackoffUnit
+		}
+		if opt.RetryBackoffCap > 0 {
+			minio.DefaultRetryCap = opt.RetryBackoffCap
+		}
+		minioRetry.maxRetries = minio.MaxRetry
+		minioRetry.backoffUnit = minio.DefaultRetryUnit
+		minioRetry.backoffCap = minio.DefaultRetryCap
+		return nil
+	}
+	if (opt.MaxRetries > 0 && opt.MaxRetries != minioRetry.maxRetries) ||
+		(opt.RetryBackoffUnit > 0 && opt.RetryBackoffUnit != minioRetry.backoffUnit) ||
+		(opt.RetryBackoffCap > 0 && opt.RetryBackoffCap != minioRetry.backoffCap) {
+		return fmt.Errorf("s3 storage.options: max_retries, retry_backoff_unit and retry_backoff_cap are global to the process, and already set to %d, %s and %s by the first s3 backend",
+			minioRetry.maxRetries, minioRetry.backoffUnit, minioRetry.backoffCap)
+	}
+	return nil
+}
+
+// retryTransport counts the responses the minio client retries. The
+// Retry-After header of these responses delays the next request, which is
+// the retry if any, for at most retryAfterMax.
+type retryTransport struct {
+	http.RoundTripper
+	retryAfterMax time.Duration // no waiting if 0
+
+	mu        sync.Mutex
+	notBefore time.Time
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.mu.Lock()
+	wait := time.Until(t.notBefore)
+	t.mu.Unlock()
+	if wait > 0 {
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		}
+	}
+
+	resp, err := t.RoundTripper.RoundTrip(req)
+	if err != nil || !isRetryableStatus(resp.StatusCode) {
+		return resp, err
+	}
+	metricRetryableResponses.WithLabelValues(strconv.Itoa(resp.StatusCode)).Inc()
+	if t.retryAfterMax <= 0 {
+		return resp, nil
+	}
+	now := time.Now()
+	if wait := retryAfter(resp.Header.Get("Retry-After"), now); wait > 0 {
+		t.mu.Lock()
+		t.notBefore = now.Add(min(wait, t.retryAfterMax))
+		t.mu.Unlock()
+	}
+	return resp, nil
+}
+
+// isRetryableStatus returns true for the HTTP statuses retried by minio.
+func isRetryableStatus(code int) bool {
+	switch code {
+	case http.StatusTooManyRequests,
+		499, // client closed request, used by nginx
+		http.StatusInternalServerError,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout,
+		520: // unknown error, used by Cloudflare
+		return true
+	}
+	return false
+}
+
+// retryAfter parses the value of a Retry-After header, which is either a
+// number of seconds or an HTTP date.
+func retryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(value); err == nil {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return t.Sub(now)
+	}
+	return 0
+}
@@ -0,0 +1,59 @@
+package s3
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	assert.Equal(t, 2*time.Second, retryAfter("2", now))
+	assert.Equal(t, 3*time.Second, retryAfter("Mon, 01 Jan 2024 00:00:03 GMT", now))
+	assert.Zero(t, retryAfter("", now))
+	assert.Zero(t, retryAfter("soon", now))
+}
+
+func TestRetryTransport(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "10")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	before := testutil.ToFloat64(metricRetryableResponses.WithLabelValues("503"))
+	c := &http.Client{Transport: &retryTransport{
+		RoundTripper:  http.DefaultTransport,
+		retryAfterMax: 50 * time.Millisecond,
+	}}
+	// The response is returned without waiting
+	start := time.Now()
+	resp, err := c.Get(srv.URL)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.Less(t, time.Since(start), 50*time.Millisecond)
+
+	// The next request waits
+	start = time.Now()
+	resp, err = c.Get(srv.URL)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+	assert.Less(t, time.Since(start), 5*time.Second)
+	assert.Equal(t, before+2, testutil.ToFloat64(metricRetryableResponses.WithLabelValues("503")))
+}
+
+func TestSetMinioRetry(t *testing.T) {
+	// The first backend of the tests sets the defaults
+	assert.NoError(t, setMinioRetry(Options{}))
+	assert.NoError(t, setMinioRetry(Options{MaxRetries: minio.MaxRetry}))
+	assert.Error(t, setMinioRetry(Options{MaxRetries: minio.MaxRetry + 1}))
+	assert.Error(t, setMinioRetry(Options{RetryBackoffCap: time.Hour}))
+}
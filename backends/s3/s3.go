@@ -3,12 +3,14 @@ package s3
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"net/url"
 	"os"
 	"runtime/debug"
+	"slices"
 	"sort"
 	"strings"
 	"sync"
@@ -17,7 +19,7 @@ import (
 	"github.com/PowerDNS/go-tlsconfig"
 	"github.com/go-logr/logr"
 	"github.com/minio/minio-go/v7"
-	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/minio/minio-go/v7/pkg/encrypt"
 
 	"github.com/PowerDNS/simpleblob"
 )
@@ -44,6 +46,21 @@ const (
 	DefaultDisableContentMd5 = false
 )
 
+// ErrAnonymousReadOnly is returned by write operations when the Anonymous
+// option is enabled.
+var ErrAnonymousReadOnly = fmt.Errorf("anonymous s3 backend is read-only: %w", os.ErrPermission)
+
+// ErrReservedName is returned by write operations and Delete for the name of
+// the update marker when UseUpdateMarker is enabled, as List never returns it
+// and the backend manages it.
+var ErrReservedName = fmt.Errorf("name is reserved for the s3 update marker: %w", os.ErrPermission)
+
+// Values for Options.GlobalPrefixSlash.
+const (
+	GlobalPrefixSlashAppend  = "append"
+	GlobalPrefixSlashRequire = "require"
+)
+
 // Options describes the storage options for the S3 backend
 type Options struct {
 	// AccessKey and SecretKey are statically defined here.
@@ -66,15 +83,79 @@ type Options struct {
 	// which is currently 15s.
 	SecretsRefreshInterval time.Duration `yaml:"secrets_refresh_interval"`
 
+	// CredentialsSource selects where credentials are retrieved from,
+	// instead of AccessKey and SecretKey or their files:
+	//   - "iam": the EC2 instance role, the ECS task role, or the IRSA web
+	//     identity on EKS, depending on the environment.
+	//   - "profile": a profile from the AWS shared credentials file.
+	//   - "env": the AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY environment
+	//     variables.
+	//   - "chain": the first of "env", "profile" and "iam" that works.
+	// It defaults to using the static keys or key files.
+	CredentialsSource string `yaml:"credentials_source"`
+
+	// AWSProfile is the profile used by the "profile" source. It defaults
+	// to $AWS_PROFILE, or "default".
+	AWSProfile string `yaml:"aws_profile"`
+	// AWSCredentialsFile is the file used by the "profile" source. It
+	// defaults to $AWS_SHARED_CREDENTIALS_FILE, or ~/.aws/credentials.
+	AWSCredentialsFile string `yaml:"aws_credentials_file"`
+
+	// IAMEndpoint overrides the endpoint used by the "iam" source, which
+	// otherwise depends on the environment.
+	IAMEndpoint string `yaml:"iam_endpoint"`
+	// WebIdentityTokenFile and RoleARN configure IRSA for the "iam" source.
+	// They default to $AWS_WEB_IDENTITY_TOKEN_FILE and $AWS_ROLE_ARN, which
+	// are set by EKS.
+	WebIdentityTokenFile string `yaml:"web_identity_token_file"`
+	RoleARN              string `yaml:"role_arn"`
+
+	// SignatureVersion selects how requests are signed: "v4", "v2" for
+	// legacy S3 compatible appliances that reject V4 signatures, or
+	// "anonymous" to send unsigned requests, in which case no credentials
+	// are needed. It defaults to "v4". Note that minio always uses V4 for
+	// AWS endpoints.
+	SignatureVersion string `yaml:"signature_version"`
+
+	// Anonymous gives read-only access to public buckets, using unsigned
+	// requests and no credentials. Store and Delete return an error
+	// wrapping os.ErrPermission.
+	Anonymous bool `yaml:"anonymous"`
+
 	// Region defaults to "us-east-1", which also works for Minio
 	Region string `yaml:"region"`
 	Bucket string `yaml:"bucket"`
 	// CreateBucket tells us to try to create the bucket
 	CreateBucket bool `yaml:"create_bucket"`
+	// BucketVersioning enables versioning on the bucket at init when
+	// CreateBucket is set, even if the bucket already existed.
+	BucketVersioning bool `yaml:"bucket_versioning"`
+	// BucketObjectLock enables object locking, and thus versioning, when
+	// the bucket is created. Object locking cannot be enabled on existing
+	// buckets.
+	BucketObjectLock bool `yaml:"bucket_object_lock"`
+	// ObjectLockRetentionMode and ObjectLockRetentionDays set the default
+	// retention of the objects of a bucket with object locking, at init
+	// when CreateBucket is set. The mode is "GOVERNANCE" or "COMPLIANCE".
+	ObjectLockRetentionMode string `yaml:"object_lock_retention_mode"`
+	ObjectLockRetentionDays uint   `yaml:"object_lock_retention_days"`
+
+	// BucketPolicy is a JSON policy document applied to the bucket at init
+	// when CreateBucket is set, e.g. to grant read access to other accounts
+	// in test environments. It replaces any existing policy.
+	BucketPolicy string `yaml:"bucket_policy"`
+	// CannedACL is a canned ACL, like "bucket-owner-full-control" or
+	// "public-read", applied to every stored object. The minio client does
+	// not support bucket ACLs, so use BucketPolicy for those.
+	CannedACL string `yaml:"canned_acl"`
 
 	// GlobalPrefix is a prefix applied to all operations, allowing work within a prefix
-	// seamlessly
+	// seamlessly. It must be a valid prefix according to simpleblob.CheckPrefix.
 	GlobalPrefix string `yaml:"global_prefix"`
+	// GlobalPrefixSlash selects how a GlobalPrefix without a trailing '/'
+	// is handled: "append" appends one, "require" is an error, and the
+	// default is to use it as is, so that "foo" and "bar" give "foobar".
+	GlobalPrefixSlash string `yaml:"global_prefix_slash"`
 
 	// PrefixFolders can be enabled to make List operations show nested prefixes as folders
 	// instead of recursively listing all contents of nested prefixes
@@ -101,6 +182,25 @@ type Options struct {
 	// DisableContentMd5 defines whether to disable sending the Content-MD5 header
 	DisableContentMd5 bool `yaml:"disable_send_content_md5"`
 
+	// Checksum selects a checksum sent in a trailing header of uploads
+	// instead of the Content-MD5 header: "crc32c", "crc32", "sha256" or
+	// "sha1". It is computed while streaming, which is faster than MD5, and
+	// is accepted by newer AWS integrity enforcement. Setting it disables
+	// Content-MD5 like DisableContentMd5. It requires V4 signatures.
+	Checksum string `yaml:"checksum"`
+
+	// ServerSideEncryption requests server-side encryption of stored
+	// objects: "sse-s3" for keys managed by S3, "sse-kms" for a KMS key,
+	// or "sse-c" for a key provided by us. It defaults to no encryption,
+	// leaving the bucket default in effect.
+	ServerSideEncryption string `yaml:"server_side_encryption"`
+	// SSEKMSKeyID is the KMS key used with "sse-kms". It defaults to the
+	// AWS managed key.
+	SSEKMSKeyID string `yaml:"sse_kms_key_id"`
+	// SSECustomerKeyFile is the path to the 256-bit key used with "sse-c",
+	// raw or base64 encoded. The same key must be used to read the objects.
+	SSECustomerKeyFile string `yaml:"sse_customer_key_file"`
+
 	// NumMinioThreads defines the number of threads that Minio uses for its workers.
 	// It defaults to the using the default value defined by the Minio client.
 	NumMinioThreads uint `yaml:"num_minio_threads"`
@@ -114,21 +214,90 @@ type Options struct {
 	// is currently 20s.
 	InitTimeout time.Duration `yaml:"init_timeout"`
 
+	// MaxRetries is the maximum number of retries of a failed request by
+	// the minio client. RetryBackoffUnit and RetryBackoffCap configure the
+	// exponential backoff between retries. They default to the minio
+	// defaults, currently 10 retries, 200ms and 1s.
+	// Note that these settings are global to the minio client package, so
+	// they apply to all S3 backends of the process. They are applied by the
+	// first S3 backend created, and creating another one with different
+	// values fails.
+	MaxRetries       int           `yaml:"max_retries"`
+	RetryBackoffUnit time.Duration `yaml:"retry_backoff_unit"`
+	RetryBackoffCap  time.Duration `yaml:"retry_backoff_cap"`
+	// RetryAfterMax is the maximum time waited for the Retry-After header of
+	// a throttled response, like a 503 SlowDown, before the next request of
+	// the backend, usually the retry of the minio client, which still
+	// applies its own backoff. A negative value disables waiting.
+	// It defaults to DefaultRetryAfterMax.
+	RetryAfterMax time.Duration `yaml:"retry_after_max"`
+
+	// RequestTimeout limits the duration of the calls that do not transfer
+	// blob contents: List, Stat, Delete and ListVersions, including their
+	// retries by the minio client. Loads and stores are only limited by the
+	// 15 minutes timeout of the HTTP client, to allow large transfers.
+	// Note that a List of a large bucket sends many requests, which must all
+	// complete within this timeout.
+	// It defaults to no timeout.
+	RequestTimeout time.Duration `yaml:"request_timeout"`
+
 	// UseUpdateMarker makes the backend write and read a file to determine if
 	// it can cache the last List command. The file contains the name of the
 	// last file stored or deleted.
 	// This can reduce the number of LIST commands sent to S3, replacing them
 	// with GET commands that are about 12x cheaper.
 	// If enabled, it MUST be enabled on all instances!
+	// The UpdateMarkerFilename name is then reserved: it is not listed, and
+	// storing or deleting it fails with ErrReservedName.
 	// CAVEAT: This will NOT work correctly if the bucket itself is replicated
 	//         in an active-active fashion between data centers! In that case
 	//         do not enable this option.
 	UseUpdateMarker bool `yaml:"use_update_marker"`
-	// UpdateMarkerForceListInterval is used when UseUpdateMarker is enabled.
+	// UpdateMarkerForceListInterval is used when UseUpdateMarker or
+	// UseBucketNotifications is enabled.
 	// A LIST command will be sent when this interval has passed without a
 	// change in marker, to ensure a full sync even if the marker would for
 	// some reason get out of sync.
 	UpdateMarkerForceListInterval time.Duration `yaml:"update_marker_force_list_interval"`
+	// UpdateMarkerVersion selects the format of the written marker: 1 for
+	// "name:etag:nanos:deleted", or 2 for a JSON record with a sequence
+	// number and the instance that wrote it, which allows detecting missed
+	// and out of order updates. Readers support both versions, so all
+	// instances must be upgraded before enabling version 2.
+	// It defaults to 1.
+	UpdateMarkerVersion int `yaml:"update_marker_version"`
+	// UpdateMarkerInstance identifies this instance in version 2 markers.
+	// It defaults to the hostname.
+	UpdateMarkerInstance string `yaml:"update_marker_instance"`
+	// UpdateMarkerReadOnly is used when UseUpdateMarker is enabled. It makes
+	// this instance use the marker to cache List, but never write it. This
+	// avoids marker write races when many read-mostly instances share a
+	// bucket. Changes made by this instance are only seen by the others
+	// after the next marker update or forced LIST.
+	UpdateMarkerReadOnly bool `yaml:"update_marker_read_only"`
+
+	// UseBucketNotifications caches the result of List, and listens to
+	// bucket notifications to invalidate it when a blob is stored or
+	// deleted. This avoids the marker writes of UseUpdateMarker, but only
+	// works with MinIO, which supports listening to notifications over
+	// HTTP. The cache is not used while not listening, and a LIST command
+	// is still sent after UpdateMarkerForceListInterval, in case events
+	// were missed. It cannot be combined with UseUpdateMarker.
+	UseBucketNotifications bool `yaml:"use_bucket_notifications"`
+
+	// ListPartitions splits the key space of List into ranges that are
+	// listed concurrently, which reduces the latency of listing large
+	// buckets. Each value is the start of a range, relative to the listed
+	// prefix, e.g. ["4", "8", "c"] for four ranges of hex keys. Keys are
+	// never missed, but ranges can be unbalanced if they do not match the
+	// distribution of the keys. With PrefixFolders, values cannot contain
+	// a '/', as a folder split across two ranges would be listed twice.
+	ListPartitions []string `yaml:"list_partitions"`
+	// ListHexPartitions generates ListPartitions splitting hex keys, like
+	// the ones of the hashprefix wrapper, into this number of ranges.
+	// It must be between 2 and 256, and cannot be combined with
+	// ListPartitions.
+	ListHexPartitions int `yaml:"list_hex_partitions"`
 
 	// Not loaded from YAML
 	Logger logr.Logger `yaml:"-"`
@@ -137,6 +306,35 @@ type Options struct {
 func (o Options) Check() error {
 	hasSecretsCreds := o.AccessKeyFile != "" && o.SecretKeyFile != ""
 	hasStaticCreds := o.AccessKey != "" && o.SecretKey != ""
+	switch o.CredentialsSource {
+	case "":
+	case CredentialsIAM, CredentialsProfile, CredentialsEnv, CredentialsChain:
+		if hasSecretsCreds || hasStaticCreds {
+			return fmt.Errorf("s3 storage.options: credentials_source cannot be combined with access keys")
+		}
+		hasStaticCreds = true // provided by the source
+	default:
+		return fmt.Errorf("s3 storage.options: unknown credentials_source %q", o.CredentialsSource)
+	}
+	if o.Anonymous {
+		if o.SignatureVersion != "" && o.SignatureVersion != SignatureAnonymous {
+			return fmt.Errorf("s3 storage.options: anonymous requires the anonymous signature_version")
+		}
+		if o.CreateBucket {
+			return fmt.Errorf("s3 storage.options: anonymous cannot be combined with create_bucket")
+		}
+		o.SignatureVersion = SignatureAnonymous
+	}
+	switch o.SignatureVersion {
+	case "", SignatureV4, SignatureV2:
+	case SignatureAnonymous:
+		if hasSecretsCreds || hasStaticCreds {
+			return fmt.Errorf("s3 storage.options: anonymous signature_version cannot be combined with credentials")
+		}
+		hasStaticCreds = true // none needed
+	default:
+		return fmt.Errorf("s3 storage.options: unknown signature_version %q", o.SignatureVersion)
+	}
 	if !hasSecretsCreds && !hasStaticCreds {
 		return fmt.Errorf("s3 storage.options: credentials are required, fill either (access_key and secret_key) or (access_key_filename and secret_key_filename)")
 	}
@@ -146,6 +344,90 @@ func (o Options) Check() error {
 	if o.Bucket == "" {
 		return fmt.Errorf("s3 storage.options: bucket is required")
 	}
+	if o.MaxRetries < 0 || o.RetryBackoffUnit < 0 || o.RetryBackoffCap < 0 {
+		return fmt.Errorf("s3 storage.options: retry options must not be negative")
+	}
+	if o.Checksum != "" {
+		if _, err := checksumType(o.Checksum); err != nil {
+			return fmt.Errorf("s3 storage.options: %w", err)
+		}
+		if o.SignatureVersion != "" && o.SignatureVersion != SignatureV4 {
+			return fmt.Errorf("s3 storage.options: checksum requires the v4 signature_version")
+		}
+	}
+	if err := simpleblob.CheckPrefix(o.GlobalPrefix); err != nil {
+		return fmt.Errorf("s3 storage.options: global_prefix: %w", err)
+	}
+	switch o.GlobalPrefixSlash {
+	case "", GlobalPrefixSlashAppend:
+	case GlobalPrefixSlashRequire:
+		if o.GlobalPrefix != "" && !strings.HasSuffix(o.GlobalPrefix, "/") {
+			return fmt.Errorf("s3 storage.options: global_prefix must end with '/'")
+		}
+	default:
+		return fmt.Errorf("s3 storage.options: unknown global_prefix_slash %q", o.GlobalPrefixSlash)
+	}
+	if o.RequestTimeout < 0 {
+		return fmt.Errorf("s3 storage.options: request_timeout must not be negative")
+	}
+	if o.UpdateMarkerVersion < 0 || o.UpdateMarkerVersion > 2 {
+		return fmt.Errorf("s3 storage.options: update_marker_version must be 1 or 2")
+	}
+	if o.UpdateMarkerReadOnly && !o.UseUpdateMarker {
+		return fmt.Errorf("s3 storage.options: update_marker_read_only requires use_update_marker")
+	}
+	if o.UseUpdateMarker && o.UseBucketNotifications {
+		return fmt.Errorf("s3 storage.options: use_update_marker cannot be combined with use_bucket_notifications")
+	}
+	if o.ListHexPartitions != 0 {
+		if o.ListHexPartitions < 2 || o.ListHexPartitions > 256 {
+			return fmt.Errorf("s3 storage.options: list_hex_partitions must be between 2 and 256")
+		}
+		if len(o.ListPartitions) > 0 {
+			return fmt.Errorf("s3 storage.options: list_hex_partitions cannot be combined with list_partitions")
+		}
+	}
+	if o.PrefixFolders {
+		for _, p := range o.ListPartitions {
+			if strings.Contains(p, "/") {
+				return fmt.Errorf("s3 storage.options: list_partitions cannot contain '/' with prefix_folders")
+			}
+		}
+	}
+	if (o.BucketVersioning || o.BucketObjectLock || o.ObjectLockRetentionMode != "") && !o.CreateBucket {
+		return fmt.Errorf("s3 storage.options: bucket_versioning, bucket_object_lock and object lock retention require create_bucket")
+	}
+	if o.ObjectLockRetentionMode != "" || o.ObjectLockRetentionDays != 0 {
+		if !o.BucketObjectLock {
+			return fmt.Errorf("s3 storage.options: object lock retention requires bucket_object_lock")
+		}
+		if !minio.RetentionMode(o.ObjectLockRetentionMode).IsValid() {
+			return fmt.Errorf("s3 storage.options: object_lock_retention_mode must be GOVERNANCE or COMPLIANCE")
+		}
+		if o.ObjectLockRetentionDays == 0 {
+			return fmt.Errorf("s3 storage.options: object_lock_retention_days is required")
+		}
+	}
+	if o.BucketPolicy != "" {
+		if !o.CreateBucket {
+			return fmt.Errorf("s3 storage.options: bucket_policy requires create_bucket")
+		}
+		if !json.Valid([]byte(o.BucketPolicy)) {
+			return fmt.Errorf("s3 storage.options: bucket_policy is not valid JSON")
+		}
+	}
+	switch o.ServerSideEncryption {
+	case "", SSES3, SSEKMS:
+	case SSEC:
+		if o.SSECustomerKeyFile == "" {
+			return fmt.Errorf("s3 storage.options: sse_customer_key_file is required for sse-c")
+		}
+	default:
+		return fmt.Errorf("s3 storage.options: unknown server_side_encryption %q", o.ServerSideEncryption)
+	}
+	if o.SSEKMSKeyID != "" && o.ServerSideEncryption != SSEKMS {
+		return fmt.Errorf("s3 storage.options: sse_kms_key_id requires sse-kms")
+	}
 	return nil
 }
 
@@ -155,17 +437,29 @@ type Backend struct {
 	client     *minio.Client
 	log        logr.Logger
 	markerName string
+	// partitions are the sorted starts of the List ranges
+	partitions []string
+	// checksum is sent with uploads instead of Content-MD5, if set
+	checksum minio.ChecksumType
+	// sse is applied to PutObject, and to GetObject for SSE-C
+	sse encrypt.ServerSide
 
 	mu         sync.Mutex
 	lastMarker string
+	lastSeq    uint64 // of the last version 2 marker read
 	lastList   simpleblob.BlobList
 	lastTime   time.Time
+	listening  bool   // listening to bucket notifications
+	listGen    uint64 // incremented when the cached list is invalidated
 }
 
 func (b *Backend) List(ctx context.Context, prefix string) (blobList simpleblob.BlobList, err error) {
 	// Handle global prefix
 	combinedPrefix := b.prependGlobalPrefix(prefix)
 
+	if b.opt.UseBucketNotifications {
+		return b.listNotified(ctx, prefix)
+	}
 	if !b.opt.UseUpdateMarker {
 		return b.doList(ctx, combinedPrefix)
 	}
@@ -197,6 +491,9 @@ func (b *Backend) List(ctx context.Context, prefix string) (blobList simpleblob.
 	}
 
 	b.mu.Lock()
+	if upstreamMarker != b.lastMarker {
+		b.observeMarker(upstreamMarker)
+	}
 	b.lastMarker = upstreamMarker
 	b.lastList = blobs
 	b.lastTime = time.Now()
@@ -206,16 +503,67 @@ func (b *Backend) List(ctx context.Context, prefix string) (blobList simpleblob.
 }
 
 func (b *Backend) doList(ctx context.Context, prefix string) (simpleblob.BlobList, error) {
+	defer trackInFlight("list")()
+	ctx, cancel := b.withRequestTimeout(ctx)
+	defer cancel()
+
+	if len(b.partitions) == 0 {
+		blobs, err := b.listRange(ctx, prefix, "", "")
+		if err != nil {
+			return nil, err
+		}
+		// Minio appears to return them sorted, but maybe not all implementations
+		// will, so we sort explicitly.
+		sort.Sort(blobs)
+		return blobs, nil
+	}
+
+	// List the ranges (start, end] concurrently, the first one including
+	// everything before its end, and the last one everything after its start.
+	n := len(b.partitions) + 1
+	lists := make([]simpleblob.BlobList, n)
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		var start, end string
+		if i > 0 {
+			start = prefix + b.partitions[i-1]
+		}
+		if i < n-1 {
+			end = prefix + b.partitions[i]
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			lists[i], errs[i] = b.listRange(ctx, prefix, start, end)
+		}(i)
+	}
+	wg.Wait()
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+
+	var blobs simpleblob.BlobList
+	for _, ls := range lists {
+		blobs = append(blobs, ls...)
+	}
+	sort.Sort(blobs)
+	return blobs, nil
+}
+
+// listRange lists the keys starting with prefix that are after start and
+// up to end included. Empty start or end values do not limit the range.
+func (b *Backend) listRange(ctx context.Context, prefix, start, end string) (simpleblob.BlobList, error) {
 	var blobs simpleblob.BlobList
 
-	// Runes to strip from blob names for GlobalPrefix
-	// This is fine, because we can trust the API to only return with the prefix.
-	// TODO: trust but verify
-	gpEndIndex := len(b.opt.GlobalPrefix)
+	// Stop the listing when the end of the range is reached
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
 
 	objCh := b.client.ListObjects(ctx, b.opt.Bucket, minio.ListObjectsOptions{
-		Prefix:    prefix,
-		Recursive: !b.opt.PrefixFolders && !b.opt.HideFolders,
+		Prefix:     prefix,
+		Recursive:  !b.opt.PrefixFolders && !b.opt.HideFolders,
+		StartAfter: start,
 	})
 	for obj := range objCh {
 		// Handle error returned by MinIO client
@@ -226,7 +574,10 @@ func (b *Backend) doList(ctx context.Context, prefix string) (simpleblob.BlobLis
 
 		metricCalls.WithLabelValues("list").Inc()
 		metricLastCallTimestamp.WithLabelValues("list").SetToCurrentTime()
-		if obj.Key == b.markerName {
+		if end != "" && obj.Key > end {
+			break
+		}
+		if b.opt.UseUpdateMarker && obj.Key == b.markerName {
 			continue
 		}
 
@@ -235,18 +586,16 @@ func (b *Backend) doList(ctx context.Context, prefix string) (simpleblob.BlobLis
 		}
 
 		// Strip global prefix from blob
-		blobName := obj.Key
-		if gpEndIndex > 0 {
-			blobName = blobName[gpEndIndex:]
+		blobName, ok := strings.CutPrefix(obj.Key, b.opt.GlobalPrefix)
+		if !ok || blobName == "" {
+			// Trust but verify: ignore keys outside of the prefix, and the
+			// folder of the prefix itself
+			continue
 		}
 
 		blobs = append(blobs, simpleblob.Blob{Name: blobName, Size: obj.Size})
 	}
 
-	// Minio appears to return them sorted, but maybe not all implementations
-	// will, so we sort explicitly.
-	sort.Sort(blobs)
-
 	return blobs, nil
 }
 
@@ -269,37 +618,146 @@ func (b *Backend) Load(ctx context.Context, name string) ([]byte, error) {
 }
 
 func (b *Backend) doLoadReader(ctx context.Context, name string) (io.ReadCloser, error) {
+	return b.doLoadVersionReader(ctx, name, "")
+}
+
+// doLoadVersionReader opens a specific version of an object, or its latest
+// version if versionID is empty.
+func (b *Backend) doLoadVersionReader(ctx context.Context, name, versionID string) (io.ReadCloser, error) {
 	metricCalls.WithLabelValues("load").Inc()
 	metricLastCallTimestamp.WithLabelValues("load").SetToCurrentTime()
+	done := trackInFlight("load")
 
-	obj, err := b.client.GetObject(ctx, b.opt.Bucket, name, minio.GetObjectOptions{})
+	getOpts := b.getObjectOptions()
+	getOpts.VersionID = versionID
+	obj, err := b.client.GetObject(ctx, b.opt.Bucket, name, getOpts)
 	if err = convertMinioError(err, false); err != nil {
 		metricCallErrors.WithLabelValues("load").Inc()
+		done()
 		return nil, err
 	}
 	if obj == nil {
+		done()
 		return nil, os.ErrNotExist
 	}
-	info, err := obj.Stat()
-	if err = convertMinioError(err, false); err != nil {
+	// GetObject is lazy, Stat sends the GET request and waits for its
+	// response headers. The body is only read by the caller.
+	if err := checkObjectInfo(obj.Stat()); err != nil {
 		metricCallErrors.WithLabelValues("load").Inc()
+		_ = obj.Close()
+		done()
 		return nil, err
 	}
+	return &downloadReader{ReadCloser: obj, done: done}, nil
+}
+
+// Stat satisfies simpleblob.Statter. It sends a HEAD request through
+// StatObject, so it is cheaper than Load to check if a blob exists.
+func (b *Backend) Stat(ctx context.Context, name string) (simpleblob.BlobInfo, error) {
+	info, err := b.doStat(ctx, b.prependGlobalPrefix(name))
+	if err != nil {
+		return simpleblob.BlobInfo{}, err
+	}
+	return simpleblob.BlobInfo{
+		Blob: simpleblob.Blob{Name: name, Size: info.Size, ModTime: info.LastModified},
+		ETag: info.ETag,
+	}, nil
+}
+
+func (b *Backend) doStat(ctx context.Context, name string) (minio.ObjectInfo, error) {
+	ctx, cancel := b.withRequestTimeout(ctx)
+	defer cancel()
+
+	metricCalls.WithLabelValues("stat").Inc()
+	metricLastCallTimestamp.WithLabelValues("stat").SetToCurrentTime()
+	defer trackInFlight("stat")()
+
+	info, err := b.client.StatObject(ctx, b.opt.Bucket, name, b.getObjectOptions())
+	if err := checkObjectInfo(info, err); err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			metricCallErrors.WithLabelValues("stat").Inc()
+		}
+		return minio.ObjectInfo{}, err
+	}
+	return info, nil
+}
+
+// checkObjectInfo converts the error returned with info by a GET or HEAD
+// request.
+func checkObjectInfo(info minio.ObjectInfo, err error) error {
+	if err = convertMinioError(err, false); err != nil {
+		return err
+	}
 	if info.Key == "" {
 		// minio will return an object with empty fields when name
 		// is not present in bucket.
-		return nil, os.ErrNotExist
+		return os.ErrNotExist
 	}
-	return obj, nil
+	return nil
 }
 
 // Store sets the content of the object identified by name to the content
 // of data, in the S3 Bucket configured in b.
 func (b *Backend) Store(ctx context.Context, name string, data []byte) error {
+	_, err := b.StoreWithResult(ctx, name, data)
+	return err
+}
+
+// StoreWithResult is like Store, but also returns the information about the
+// upload returned by S3, like the ETag and the version ID of the object.
+func (b *Backend) StoreWithResult(ctx context.Context, name string, data []byte) (minio.UploadInfo, error) {
+	if b.opt.Anonymous {
+		return minio.UploadInfo{}, fmt.Errorf("store %q: %w", name, ErrAnonymousReadOnly)
+	}
+	if err := b.checkReserved("store", name); err != nil {
+		return minio.UploadInfo{}, err
+	}
 	// Prepend global prefix
 	name = b.prependGlobalPrefix(name)
 
 	info, err := b.doStore(ctx, name, data)
+	if err != nil {
+		return info, err
+	}
+	return info, b.setMarker(ctx, name, info.ETag, false)
+}
+
+// StoreReader satisfies simpleblob.ReaderStorer. When size is known, small
+// blobs are uploaded in a single request instead of the multipart upload
+// used by NewWriter.
+func (b *Backend) StoreReader(ctx context.Context, name string, r io.Reader, size int64) error {
+	if b.opt.Anonymous {
+		return fmt.Errorf("store %q: %w", name, ErrAnonymousReadOnly)
+	}
+	if err := b.checkReserved("store", name); err != nil {
+		return err
+	}
+	// Prepend global prefix
+	name = b.prependGlobalPrefix(name)
+
+	info, err := b.doStoreReader(ctx, name, simpleblob.LimitReader(r, size), size)
+	if err != nil {
+		return err
+	}
+	return b.setMarker(ctx, name, info.ETag, false)
+}
+
+// StoreIfAbsent satisfies simpleblob.AbsentStorer, using a conditional
+// If-None-Match: * upload. This requires support from the server, which AWS
+// S3 and recent MinIO versions have.
+func (b *Backend) StoreIfAbsent(ctx context.Context, name string, data []byte) error {
+	if b.opt.Anonymous {
+		return fmt.Errorf("store %q: %w", name, ErrAnonymousReadOnly)
+	}
+	if err := b.checkReserved("store", name); err != nil {
+		return err
+	}
+	// Prepend global prefix
+	name = b.prependGlobalPrefix(name)
+
+	putObjectOptions := b.putObjectOptions()
+	putObjectOptions.SetMatchETagExcept("*")
+	info, err := b.doPut(ctx, name, bytes.NewReader(data), int64(len(data)), putObjectOptions)
 	if err != nil {
 		return err
 	}
@@ -314,26 +772,96 @@ func (b *Backend) doStore(ctx context.Context, name string, data []byte) (minio.
 // doStoreReader stores data with key name in S3, using r as a source for data.
 // The value of size may be -1, in case the size is not known.
 func (b *Backend) doStoreReader(ctx context.Context, name string, r io.Reader, size int64) (minio.UploadInfo, error) {
-	metricCalls.WithLabelValues("store").Inc()
-	metricLastCallTimestamp.WithLabelValues("store").SetToCurrentTime()
+	return b.doPut(ctx, name, r, size, b.putObjectOptions())
+}
 
+// putObjectOptions returns the options used for all uploads.
+func (b *Backend) putObjectOptions() minio.PutObjectOptions {
 	putObjectOptions := minio.PutObjectOptions{
-		NumThreads:     b.opt.NumMinioThreads,
-		SendContentMd5: !b.opt.DisableContentMd5,
+		NumThreads:           b.opt.NumMinioThreads,
+		SendContentMd5:       !b.opt.DisableContentMd5 && b.checksum == 0,
+		ServerSideEncryption: b.sse,
+		Checksum:             b.checksum,
 	}
+	if b.opt.CannedACL != "" {
+		putObjectOptions.UserMetadata = map[string]string{"x-amz-acl": b.opt.CannedACL}
+	}
+	return putObjectOptions
+}
+
+// doPut uploads r to S3 with the given options, recording the metrics.
+func (b *Backend) doPut(ctx context.Context, name string, r io.Reader, size int64, putObjectOptions minio.PutObjectOptions) (minio.UploadInfo, error) {
+	metricCalls.WithLabelValues("store").Inc()
+	metricLastCallTimestamp.WithLabelValues("store").SetToCurrentTime()
+	defer trackInFlight("store")()
 
 	// minio accepts size == -1, meaning the size is unknown.
 	info, err := b.client.PutObject(ctx, b.opt.Bucket, name, r, size, putObjectOptions)
 	err = convertMinioError(err, false)
 	if err != nil {
 		metricCallErrors.WithLabelValues("store").Inc()
+		return info, err
+	}
+	metricUploadedBytes.Add(float64(info.Size))
+	return info, nil
+}
+
+// checksumType returns the minio checksum type for the Checksum option,
+// or 0 if the option is empty.
+func checksumType(name string) (minio.ChecksumType, error) {
+	switch name {
+	case "":
+		return 0, nil
+	case "crc32c":
+		return minio.ChecksumCRC32C, nil
+	case "crc32":
+		return minio.ChecksumCRC32, nil
+	case "sha256":
+		return minio.ChecksumSHA256, nil
+	case "sha1":
+		return minio.ChecksumSHA1, nil
+	}
+	return 0, fmt.Errorf("unknown checksum %q", name)
+}
+
+// Client returns the minio client used by b, for operations that are not
+// covered by this package.
+func (b *Backend) Client() *minio.Client {
+	return b.client
+}
+
+// Options returns the options of b, with their defaults applied.
+func (b *Backend) Options() Options {
+	return b.opt
+}
+
+// withRequestTimeout limits ctx to RequestTimeout, if set.
+func (b *Backend) withRequestTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if b.opt.RequestTimeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, b.opt.RequestTimeout)
+}
+
+// getObjectOptions returns the options for GetObject and StatObject.
+func (b *Backend) getObjectOptions() minio.GetObjectOptions {
+	var opt minio.GetObjectOptions
+	// Only SSE-C needs headers on reads
+	if b.sse != nil && b.sse.Type() == encrypt.SSEC {
+		opt.ServerSideEncryption = b.sse
 	}
-	return info, err
+	return opt
 }
 
 // Delete removes the object identified by name from the S3 Bucket
 // configured in b.
 func (b *Backend) Delete(ctx context.Context, name string) error {
+	if b.opt.Anonymous {
+		return fmt.Errorf("delete %q: %w", name, ErrAnonymousReadOnly)
+	}
+	if err := b.checkReserved("delete", name); err != nil {
+		return err
+	}
 	// Prepend global prefix
 	name = b.prependGlobalPrefix(name)
 
@@ -344,8 +872,12 @@ func (b *Backend) Delete(ctx context.Context, name string) error {
 }
 
 func (b *Backend) doDelete(ctx context.Context, name string) error {
+	ctx, cancel := b.withRequestTimeout(ctx)
+	defer cancel()
+
 	metricCalls.WithLabelValues("delete").Inc()
 	metricLastCallTimestamp.WithLabelValues("delete").SetToCurrentTime()
+	defer trackInFlight("delete")()
 
 	err := b.client.RemoveObject(ctx, b.opt.Bucket, name, minio.RemoveObjectOptions{})
 	if err = convertMinioError(err, false); err != nil {
@@ -373,6 +905,22 @@ func New(ctx context.Context, opt Options) (*Backend, error) {
 	if opt.SecretsRefreshInterval == 0 {
 		opt.SecretsRefreshInterval = DefaultSecretsRefreshInterval
 	}
+	if opt.Anonymous {
+		opt.SignatureVersion = SignatureAnonymous
+	}
+	if opt.GlobalPrefixSlash == GlobalPrefixSlashAppend && opt.GlobalPrefix != "" &&
+		!strings.HasSuffix(opt.GlobalPrefix, "/") {
+		opt.GlobalPrefix += "/"
+	}
+	if opt.UpdateMarkerVersion == 0 {
+		opt.UpdateMarkerVersion = 1
+	}
+	if opt.UpdateMarkerInstance == "" {
+		opt.UpdateMarkerInstance, _ = os.Hostname()
+	}
+	if opt.RetryAfterMax == 0 {
+		opt.RetryAfterMax = DefaultRetryAfterMax
+	}
 	if err := opt.Check(); err != nil {
 		return nil, err
 	}
@@ -405,6 +953,7 @@ func New(ctx context.Context, opt Options) (*Backend, error) {
 	}
 
 	// Some of the following calls require a short running context
+	bgctx := ctx
 	ctx, cancel := context.WithTimeout(ctx, opt.InitTimeout)
 	defer cancel()
 
@@ -426,20 +975,27 @@ func New(ctx context.Context, opt Options) (*Backend, error) {
 		return nil, fmt.Errorf("unsupported scheme for S3: %q, use http or https", u.Scheme)
 	}
 
-	creds := credentials.NewStaticV4(opt.AccessKey, opt.SecretKey, "")
-	if opt.AccessKeyFile != "" {
-		creds = credentials.New(&FileSecretsCredentials{
-			AccessKeyFile:   opt.AccessKeyFile,
-			SecretKeyFile:   opt.SecretKeyFile,
-			RefreshInterval: opt.SecretsRefreshInterval,
-		})
+	creds := opt.credentials()
+	sse, err := opt.serverSide()
+	if err != nil {
+		return nil, err
+	}
+
+	checksum, err := checksumType(opt.Checksum)
+	if err != nil {
+		return nil, err
 	}
 
+	if err := setMinioRetry(opt); err != nil {
+		return nil, err
+	}
 	cfg := &minio.Options{
 		Creds:     creds,
 		Secure:    useSSL,
-		Transport: hc.Transport,
+		Transport: &retryTransport{RoundTripper: hc.Transport, retryAfterMax: opt.RetryAfterMax},
 		Region:    opt.Region,
+		// Needed for checksums
+		TrailingHeaders: checksum != 0,
 	}
 
 	// Remove scheme from URL.
@@ -461,7 +1017,10 @@ func New(ctx context.Context, opt Options) (*Backend, error) {
 		metricCalls.WithLabelValues("create-bucket").Inc()
 		metricLastCallTimestamp.WithLabelValues("create-bucket").SetToCurrentTime()
 
-		err := client.MakeBucket(ctx, opt.Bucket, minio.MakeBucketOptions{Region: opt.Region})
+		err := client.MakeBucket(ctx, opt.Bucket, minio.MakeBucketOptions{
+			Region:        opt.Region,
+			ObjectLocking: opt.BucketObjectLock,
+		})
 		if err != nil {
 			if err := convertMinioError(err, false); err != nil {
 				return nil, err
@@ -469,17 +1028,83 @@ func New(ctx context.Context, opt Options) (*Backend, error) {
 		}
 	}
 
+	if opt.BucketVersioning {
+		metricCalls.WithLabelValues("enable-versioning").Inc()
+		metricLastCallTimestamp.WithLabelValues("enable-versioning").SetToCurrentTime()
+
+		if err := client.EnableVersioning(ctx, opt.Bucket); err != nil {
+			metricCallErrors.WithLabelValues("enable-versioning").Inc()
+			return nil, fmt.Errorf("enable bucket versioning: %w", err)
+		}
+	}
+
+	if opt.ObjectLockRetentionMode != "" {
+		metricCalls.WithLabelValues("set-object-lock").Inc()
+		metricLastCallTimestamp.WithLabelValues("set-object-lock").SetToCurrentTime()
+
+		mode := minio.RetentionMode(opt.ObjectLockRetentionMode)
+		unit := minio.Days
+		err := client.SetObjectLockConfig(ctx, opt.Bucket, &mode, &opt.ObjectLockRetentionDays, &unit)
+		if err != nil {
+			metricCallErrors.WithLabelValues("set-object-lock").Inc()
+			return nil, fmt.Errorf("set object lock configuration: %w", err)
+		}
+	}
+
+	if opt.BucketPolicy != "" {
+		metricCalls.WithLabelValues("set-bucket-policy").Inc()
+		metricLastCallTimestamp.WithLabelValues("set-bucket-policy").SetToCurrentTime()
+
+		if err := client.SetBucketPolicy(ctx, opt.Bucket, opt.BucketPolicy); err != nil {
+			metricCallErrors.WithLabelValues("set-bucket-policy").Inc()
+			return nil, fmt.Errorf("set bucket policy: %w", err)
+		}
+	}
+
 	b := &Backend{
-		opt:    opt,
-		config: cfg,
-		client: client,
-		log:    log,
+		opt:      opt,
+		config:   cfg,
+		client:   client,
+		log:      log,
+		sse:      sse,
+		checksum: checksum,
+	}
+	b.partitions = listPartitions(opt)
+	if opt.UseBucketNotifications {
+		go b.listenNotifications(bgctx)
 	}
 	b.setGlobalPrefix(opt.GlobalPrefix)
 
 	return b, nil
 }
 
+// listPartitions returns the sorted starts of the List ranges.
+func listPartitions(opt Options) []string {
+	var partitions []string
+	if n := opt.ListHexPartitions; n > 0 {
+		for i := 1; i < n; i++ {
+			partitions = append(partitions, fmt.Sprintf("%02x", i*256/n))
+		}
+		return partitions
+	}
+	for _, p := range opt.ListPartitions {
+		if p != "" {
+			partitions = append(partitions, p)
+		}
+	}
+	sort.Strings(partitions)
+	return slices.Compact(partitions)
+}
+
+// checkReserved returns ErrReservedName if name, without the global prefix,
+// is the name of the update marker and the marker is used.
+func (b *Backend) checkReserved(op, name string) error {
+	if b.opt.UseUpdateMarker && b.prependGlobalPrefix(name) == b.markerName {
+		return fmt.Errorf("%s %q: %w", op, name, ErrReservedName)
+	}
+	return nil
+}
+
 // setGlobalPrefix updates the global prefix in b and the cached marker name,
 // so it can be dynamically changed in tests.
 func (b *Backend) setGlobalPrefix(prefix string) {
@@ -499,6 +1124,9 @@ func convertMinioError(err error, isList bool) error {
 	if !isList && errRes.StatusCode == 404 {
 		return fmt.Errorf("%w: %s", os.ErrNotExist, err.Error())
 	}
+	if !isList && errRes.StatusCode == 412 {
+		return fmt.Errorf("%w: %s", os.ErrExist, err.Error())
+	}
 	if errRes.Code == "BucketAlreadyOwnedByYou" {
 		return nil
 	}
@@ -1,16 +1,23 @@
 package s3
 
 import (
+	"bytes"
 	"context"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
 	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/minio/minio-go/v7/pkg/encrypt"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/testcontainers/testcontainers-go"
 	testcontainersminio "github.com/testcontainers/testcontainers-go/modules/minio"
 
+	"github.com/PowerDNS/simpleblob/backends/fs"
+	"github.com/PowerDNS/simpleblob/backends/memory"
 	"github.com/PowerDNS/simpleblob/tester"
 )
 
@@ -70,9 +77,45 @@ func TestBackend(t *testing.T) {
 
 	b := getBackend(ctx, t)
 	tester.DoBackendTests(t, b)
+	tester.DoStreamTests(t, b)
+	tester.DoContextTests(t, b)
 	assert.Len(t, b.lastMarker, 0)
 }
 
+func TestBackend_metadata(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	b := getBackend(ctx, t)
+	tester.DoMetadataTests(t, b)
+}
+
+func TestBackend_migration(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	b := getBackend(ctx, t)
+	dir, err := fs.New(fs.Options{RootPath: t.TempDir()})
+	require.NoError(t, err)
+	tester.DoMigrationTests(t, memory.New(), dir, b, memory.New())
+}
+
+func TestBackend_names(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	b := getBackend(ctx, t)
+	tester.DoNameTests(t, b, tester.Capabilities{})
+
+	b.opt.UseUpdateMarker = true
+	tester.DoNameTests(t, b, tester.Capabilities{
+		RejectsName: func(name string) bool {
+			return name == UpdateMarkerFilename
+		},
+	})
+	assert.ErrorIs(t, b.Delete(ctx, UpdateMarkerFilename), ErrReservedName)
+}
+
 func TestBackend_marker(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
@@ -115,82 +158,389 @@ func TestBackend_globalPrefixAndMarker(t *testing.T) {
 	assert.NotEmpty(t, b.lastMarker)
 }
 
-func TestBackend_recursive(t *testing.T) {
-	// NB: Those tests are for PrefixFolders, a deprecated option.
+func TestBackend_folders(t *testing.T) {
+	// NB: working with folders with S3 is flaky, because a `foo` key
+	// will shadow all `foo/*` keys while listing,
+	// even though those `foo/*` keys exist and they hold the values they're expected to.
+	for _, tc := range []struct {
+		name string
+		mode tester.FolderMode
+	}{
+		{"recursive", tester.FoldersRecursive},
+		// PrefixFolders is a deprecated option
+		{"PrefixFolders", tester.FoldersAsPrefixes},
+		{"HideFolders", tester.FoldersHidden},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+
+			b := getBackend(ctx, t)
+			b.opt.PrefixFolders = tc.mode == tester.FoldersAsPrefixes
+			b.opt.HideFolders = tc.mode == tester.FoldersHidden
+			opt := tester.FolderOptions{Mode: tc.mode, NoBlobAndFolder: true}
+
+			tester.DoFolderTests(t, b, opt)
+			b.setGlobalPrefix("v7/")
+			tester.DoFolderTests(t, b, opt)
+			assert.Empty(t, b.lastMarker)
+		})
+	}
+}
 
+func TestOptions_credentials(t *testing.T) {
+	opt := Options{Bucket: "foo", CredentialsSource: CredentialsProfile}
+	assert.NoError(t, opt.Check())
+	opt.AccessKey, opt.SecretKey = "key", "secret"
+	assert.Error(t, opt.Check())
+	assert.Error(t, Options{Bucket: "foo", CredentialsSource: "nope"}.Check())
+
+	file := filepath.Join(t.TempDir(), "credentials")
+	require.NoError(t, os.WriteFile(file, []byte("[other]\naws_access_key_id = id\naws_secret_access_key = secret\n"), 0o600))
+	t.Setenv("AWS_ACCESS_KEY_ID", "")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "")
+	creds := Options{
+		CredentialsSource:  CredentialsChain,
+		AWSProfile:         "other",
+		AWSCredentialsFile: file,
+	}.credentials()
+	v, err := creds.Get()
+	require.NoError(t, err)
+	assert.Equal(t, "id", v.AccessKeyID)
+	assert.Equal(t, "secret", v.SecretAccessKey)
+}
+
+func TestOptions_serverSide(t *testing.T) {
+	assert.Error(t, Options{Bucket: "foo", AccessKey: "a", SecretKey: "b", ServerSideEncryption: SSEC}.Check())
+	assert.Error(t, Options{Bucket: "foo", AccessKey: "a", SecretKey: "b", SSEKMSKeyID: "key"}.Check())
+
+	dir := t.TempDir()
+	raw := filepath.Join(dir, "raw")
+	require.NoError(t, os.WriteFile(raw, make([]byte, 32), 0o600))
+	encoded := filepath.Join(dir, "encoded")
+	require.NoError(t, os.WriteFile(encoded, []byte("AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA=\n"), 0o600))
+	short := filepath.Join(dir, "short")
+	require.NoError(t, os.WriteFile(short, []byte("foo"), 0o600))
+
+	for _, path := range []string{raw, encoded} {
+		sse, err := Options{ServerSideEncryption: SSEC, SSECustomerKeyFile: path}.serverSide()
+		assert.NoError(t, err)
+		assert.Equal(t, encrypt.SSEC, sse.Type())
+	}
+	_, err := Options{ServerSideEncryption: SSEC, SSECustomerKeyFile: short}.serverSide()
+	assert.Error(t, err)
+}
+
+func TestBackend_versions(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
 	b := getBackend(ctx, t)
+	require.NoError(t, b.client.EnableVersioning(ctx, b.opt.Bucket))
 
-	// Starts empty
-	ls, err := b.List(ctx, "")
-	assert.NoError(t, err)
-	assert.Len(t, ls, 0)
+	require.NoError(t, b.Store(ctx, "foo", []byte("v1")))
+	require.NoError(t, b.Store(ctx, "foo", []byte("v2")))
+	require.NoError(t, b.Store(ctx, "foo-other", []byte("other")))
+	require.NoError(t, b.Delete(ctx, "foo"))
 
-	// Add items
-	err = b.Store(ctx, "bar-1", []byte("bar1"))
-	assert.NoError(t, err)
-	err = b.Store(ctx, "bar-2", []byte("bar2"))
+	versions, err := b.ListVersions(ctx, "foo")
+	require.NoError(t, err)
+	require.Len(t, versions, 3)
+	assert.True(t, versions[2].Deleted)
+	data, err := b.LoadVersion(ctx, "foo", versions[0].ID)
 	assert.NoError(t, err)
-	err = b.Store(ctx, "foo/bar-3", []byte("bar3"))
+	assert.Equal(t, []byte("v1"), data)
+	data, err = b.LoadVersion(ctx, "foo", versions[1].ID)
 	assert.NoError(t, err)
+	assert.Equal(t, []byte("v2"), data)
+}
 
-	// List all - PrefixFolders disabled (default)
-	ls, err = b.List(ctx, "")
-	assert.NoError(t, err)
-	assert.Equal(t, ls.Names(), []string{"bar-1", "bar-2", "foo/bar-3"})
+func TestOptions_signature(t *testing.T) {
+	assert.NoError(t, Options{Bucket: "foo", SignatureVersion: SignatureAnonymous}.Check())
+	assert.Error(t, Options{Bucket: "foo", SignatureVersion: SignatureAnonymous, AccessKey: "a", SecretKey: "b"}.Check())
+	assert.Error(t, Options{Bucket: "foo", SignatureVersion: "v3", AccessKey: "a", SecretKey: "b"}.Check())
 
-	// List all - PrefixFolders enabled
-	b.opt.PrefixFolders = true
+	v, err := Options{SignatureVersion: SignatureV2, AccessKey: "a", SecretKey: "b"}.credentials().Get()
+	require.NoError(t, err)
+	assert.Equal(t, credentials.SignatureV2, v.SignerType)
+	v, err = Options{SignatureVersion: SignatureAnonymous}.credentials().Get()
+	require.NoError(t, err)
+	assert.Equal(t, credentials.SignatureAnonymous, v.SignerType)
+}
 
-	ls, err = b.List(ctx, "")
-	assert.NoError(t, err)
-	assert.Equal(t, ls.Names(), []string{"bar-1", "bar-2", "foo/"})
+func TestSelectOptions(t *testing.T) {
+	_, err := SelectOptions{}.minioOptions("SELECT * FROM S3Object")
+	assert.Error(t, err)
 
-	// List all - PrefixFolders disabled
-	b.opt.PrefixFolders = false
+	opt, err := SelectOptions{
+		Input: minio.SelectObjectInputSerialization{CSV: &minio.CSVInputOptions{}},
+	}.minioOptions("SELECT * FROM S3Object")
+	require.NoError(t, err)
+	assert.Equal(t, minio.QueryExpressionTypeSQL, opt.ExpressionType)
+	require.NotNil(t, opt.OutputSerialization.JSON)
+	assert.Equal(t, "\n", opt.OutputSerialization.JSON.RecordDelimiter)
+}
 
-	ls, err = b.List(ctx, "")
-	assert.NoError(t, err)
-	assert.Equal(t, ls.Names(), []string{"bar-1", "bar-2", "foo/bar-3"})
+func TestBackend_bucketPolicy(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
 
-	assert.Len(t, b.lastMarker, 0)
+	b := getBackend(ctx, t)
+	opt := b.opt
+	opt.BucketPolicy = `{
+		"Version": "2012-10-17",
+		"Statement": [{
+			"Effect": "Allow",
+			"Principal": {"AWS": ["*"]},
+			"Action": ["s3:GetObject"],
+			"Resource": ["arn:aws:s3:::test-bucket/*"]
+		}]
+	}`
+	b, err := New(ctx, opt)
+	require.NoError(t, err)
+	policy, err := b.client.GetBucketPolicy(ctx, opt.Bucket)
+	require.NoError(t, err)
+	assert.Contains(t, policy, "s3:GetObject")
 }
 
-func TestHideFolders(t *testing.T) {
-	// NB: working with folders with S3 is flaky, because a `foo` key
-	// will shadow all `foo/*` keys while listing,
-	// even though those `foo/*` keys exist and they hold the values they're expected to.
+func TestOptions_bucketPolicy(t *testing.T) {
+	opt := Options{Bucket: "foo", AccessKey: "a", SecretKey: "b", BucketPolicy: "{}"}
+	assert.Error(t, opt.Check())
+	opt.CreateBucket = true
+	assert.NoError(t, opt.Check())
+	opt.BucketPolicy = "{"
+	assert.Error(t, opt.Check())
+}
 
+func TestBackend_stat(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
 	b := getBackend(ctx, t)
-	b.opt.HideFolders = true
+	upload, err := b.StoreWithResult(ctx, "foo", []byte("bar"))
+	require.NoError(t, err)
+	assert.NotEmpty(t, upload.ETag)
 
-	p := []byte("123")
-	err := b.Store(ctx, "foo", p)
-	assert.NoError(t, err)
-	err = b.Store(ctx, "bar/baz", p)
-	assert.NoError(t, err)
+	info, err := b.Stat(ctx, "foo")
+	require.NoError(t, err)
+	assert.Equal(t, upload.ETag, info.ETag)
+	assert.Equal(t, "foo", info.Name)
+	assert.EqualValues(t, 3, info.Size)
+	assert.False(t, info.ModTime.IsZero())
 
-	t.Run("at root", func(t *testing.T) {
-		ls, err := b.List(ctx, "")
-		assert.NoError(t, err)
-		assert.Equal(t, []string{"foo"}, ls.Names())
+	_, err = b.Stat(ctx, "missing")
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestListPartitions(t *testing.T) {
+	assert.Equal(t, []string{"40", "80", "c0"}, listPartitions(Options{ListHexPartitions: 4}))
+	assert.Len(t, listPartitions(Options{ListHexPartitions: 256}), 255)
+	assert.Equal(t, []string{"a", "b"}, listPartitions(Options{ListPartitions: []string{"b", "", "a", "b"}}))
+	assert.Error(t, Options{Bucket: "foo", AccessKey: "a", SecretKey: "b", ListHexPartitions: 1}.Check())
+	assert.NoError(t, Options{Bucket: "foo", AccessKey: "a", SecretKey: "b", ListPartitions: []string{"dir/m"}}.Check())
+	assert.Error(t, Options{Bucket: "foo", AccessKey: "a", SecretKey: "b", ListPartitions: []string{"dir/m"}, PrefixFolders: true}.Check())
+}
+
+func TestBackend_listPartitions(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	b := getBackend(ctx, t)
+	b.partitions = listPartitions(Options{ListPartitions: []string{"bar-2", "f"}})
+	tester.DoBackendTests(t, b)
+
+	var names []string
+	for _, name := range []string{"00", "3f", "40", "41", "7f", "80", "ff", "zz"} {
+		require.NoError(t, b.Store(ctx, "hex/"+name, nil))
+		names = append(names, "hex/"+name)
+	}
+	b.partitions = listPartitions(Options{ListHexPartitions: 4})
+	ls, err := b.List(ctx, "hex/")
+	require.NoError(t, err)
+	assert.Equal(t, names, ls.Names())
+}
+
+func TestBackend_bucketNotifications(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	b := getBackend(ctx, t)
+	opt := b.opt
+	opt.UseBucketNotifications = true
+	b, err := New(ctx, opt)
+	require.NoError(t, err)
+	tester.DoBackendTests(t, b)
+
+	// Changes made by other clients are seen
+	ls, err := b.List(ctx, "")
+	require.NoError(t, err)
+	_, err = b.client.PutObject(ctx, opt.Bucket, "other", bytes.NewReader(nil), 0, minio.PutObjectOptions{})
+	require.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		ls2, err := b.List(ctx, "")
+		return err == nil && len(ls2) == len(ls)+1
+	}, 5*time.Second, 100*time.Millisecond)
+}
+
+func TestBackend_anonymous(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	assert.Error(t, Options{Bucket: "foo", Anonymous: true, AccessKey: "a", SecretKey: "b"}.Check())
+	assert.Error(t, Options{Bucket: "foo", Anonymous: true, CreateBucket: true}.Check())
+
+	// Writes are rejected without sending requests
+	b, err := New(ctx, Options{
+		EndpointURL: "http://127.0.0.1:1",
+		Bucket:      "foo",
+		Anonymous:   true,
 	})
+	require.NoError(t, err)
+	assert.ErrorIs(t, b.Store(ctx, "foo", nil), os.ErrPermission)
+	assert.ErrorIs(t, b.Delete(ctx, "foo"), os.ErrPermission)
+	_, err = b.NewWriter(ctx, "foo")
+	assert.ErrorIs(t, err, os.ErrPermission)
+}
 
-	t.Run("with List prefix", func(t *testing.T) {
-		ls, err := b.List(ctx, "bar/")
-		assert.NoError(t, err)
-		assert.Equal(t, []string{"bar/baz"}, ls.Names())
+func TestBackend_requestTimeout(t *testing.T) {
+	ctx := context.Background()
+	b, err := New(ctx, Options{
+		EndpointURL:    "http://127.0.0.1:1",
+		Bucket:         "foo",
+		Anonymous:      true,
+		RequestTimeout: time.Nanosecond,
 	})
+	require.NoError(t, err)
+	_, err = b.List(ctx, "")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	_, err = b.Stat(ctx, "foo")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
 
-	t.Run("with global prefix", func(t *testing.T) {
-		b.setGlobalPrefix("bar/")
-		ls, err := b.List(ctx, "")
-		assert.NoError(t, err)
-		assert.Equal(t, []string{"baz"}, ls.Names())
+func TestBackend_checksum(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	assert.Error(t, Options{Bucket: "foo", AccessKey: "a", SecretKey: "b", Checksum: "md4"}.Check())
+	assert.Error(t, Options{Bucket: "foo", AccessKey: "a", SecretKey: "b", Checksum: "crc32c", SignatureVersion: SignatureV2}.Check())
+
+	b := getBackend(ctx, t)
+	opt := b.opt
+	opt.Checksum = "crc32c"
+	b, err := New(ctx, opt)
+	require.NoError(t, err)
+	tester.DoBackendTests(t, b)
+}
+
+func TestBackend_bucketObjectLock(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	base := Options{Bucket: "foo", AccessKey: "a", SecretKey: "b"}
+	opt := base
+	opt.BucketVersioning = true
+	assert.Error(t, opt.Check())
+	opt = base
+	opt.CreateBucket = true
+	opt.ObjectLockRetentionMode = "GOVERNANCE"
+	opt.ObjectLockRetentionDays = 1
+	assert.Error(t, opt.Check())
+	opt.BucketObjectLock = true
+	assert.NoError(t, opt.Check())
+	opt.ObjectLockRetentionMode = "forever"
+	assert.Error(t, opt.Check())
+
+	b := getBackend(ctx, t)
+	opt = b.opt
+	opt.Bucket = "locked-bucket"
+	opt.BucketObjectLock = true
+	opt.ObjectLockRetentionMode = "GOVERNANCE"
+	opt.ObjectLockRetentionDays = 1
+	b, err := New(ctx, opt)
+	require.NoError(t, err)
+
+	enabled, mode, validity, unit, err := b.client.GetObjectLockConfig(ctx, opt.Bucket)
+	require.NoError(t, err)
+	assert.Equal(t, "Enabled", enabled)
+	assert.Equal(t, minio.Governance, *mode)
+	assert.EqualValues(t, 1, *validity)
+	assert.Equal(t, minio.Days, *unit)
+	versioning, err := b.client.GetBucketVersioning(ctx, opt.Bucket)
+	require.NoError(t, err)
+	assert.True(t, versioning.Enabled())
+}
+
+func TestBackend_markerReadOnly(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	assert.Error(t, Options{Bucket: "foo", AccessKey: "a", SecretKey: "b", UpdateMarkerReadOnly: true}.Check())
+
+	b := getBackend(ctx, t)
+	b.opt.UseUpdateMarker = true
+	b.opt.UpdateMarkerReadOnly = true
+	tester.DoBackendTests(t, b)
+	assert.Empty(t, b.lastMarker)
+	_, err := b.Load(ctx, UpdateMarkerFilename)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestBackend_markerV2(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	b := getBackend(ctx, t)
+	b.opt.UseUpdateMarker = true
+	b.opt.UpdateMarkerVersion = 2
+	b.opt.UpdateMarkerInstance = "test"
+
+	tester.DoBackendTests(t, b)
+	data, err := b.Load(ctx, UpdateMarkerFilename)
+	require.NoError(t, err)
+	m, err := ParseMarker(data)
+	require.NoError(t, err)
+	assert.Equal(t, 2, m.Version)
+	assert.Equal(t, "test", m.Instance)
+	assert.Equal(t, MarkerOpDelete, m.Op)
+	assert.Equal(t, "foo-1", m.Name)
+	assert.Greater(t, m.Seq, uint64(1))
+	assert.Equal(t, m.Seq, b.lastSeq)
+}
+
+func TestOptions_globalPrefix(t *testing.T) {
+	base := Options{Bucket: "foo", AccessKey: "a", SecretKey: "b"}
+	for _, prefix := range []string{"/foo/", "../foo/", "foo//"} {
+		opt := base
+		opt.GlobalPrefix = prefix
+		assert.Error(t, opt.Check(), prefix)
+	}
+	opt := base
+	opt.GlobalPrefix = "foo"
+	opt.GlobalPrefixSlash = GlobalPrefixSlashRequire
+	assert.Error(t, opt.Check())
+
+	b, err := New(context.Background(), Options{
+		EndpointURL:       "http://127.0.0.1:1",
+		Bucket:            "foo",
+		Anonymous:         true,
+		GlobalPrefix:      "foo",
+		GlobalPrefixSlash: GlobalPrefixSlashAppend,
 	})
+	require.NoError(t, err)
+	assert.Equal(t, "foo/", b.Options().GlobalPrefix)
+	assert.Equal(t, "foo/"+UpdateMarkerFilename, b.markerName)
+}
+
+func TestBackend_storeIfAbsent(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	b := getBackend(ctx, t)
+	require.NoError(t, b.StoreIfAbsent(ctx, "claim", []byte("first")))
+	err := b.StoreIfAbsent(ctx, "claim", []byte("second"))
+	assert.ErrorIs(t, err, os.ErrExist)
+
+	data, err := b.Load(ctx, "claim")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("first"), data)
 }
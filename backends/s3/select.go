@@ -0,0 +1,75 @@
+package s3
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// SelectOptions describes the formats used by Select.
+type SelectOptions struct {
+	// Input describes the format of the object. Exactly one of CSV, JSON
+	// and Parquet must be set.
+	Input minio.SelectObjectInputSerialization
+	// Output describes the format of the returned records. It defaults to
+	// JSON, one record per line.
+	Output minio.SelectObjectOutputSerialization
+}
+
+// minioOptions returns the options for SelectObjectContent.
+func (o SelectOptions) minioOptions(expr string) (minio.SelectObjectOptions, error) {
+	n := 0
+	if o.Input.CSV != nil {
+		n++
+	}
+	if o.Input.JSON != nil {
+		n++
+	}
+	if o.Input.Parquet != nil {
+		n++
+	}
+	if n != 1 {
+		return minio.SelectObjectOptions{}, fmt.Errorf("s3 select: exactly one input format must be set")
+	}
+	opt := minio.SelectObjectOptions{
+		Expression:          expr,
+		ExpressionType:      minio.QueryExpressionTypeSQL,
+		InputSerialization:  o.Input,
+		OutputSerialization: o.Output,
+	}
+	if opt.OutputSerialization.CSV == nil && opt.OutputSerialization.JSON == nil {
+		opt.OutputSerialization.JSON = &minio.JSONOutputOptions{}
+		opt.OutputSerialization.JSON.SetRecordDelimiter("\n")
+	}
+	return opt, nil
+}
+
+// Select runs an S3 Select SQL expression on the blob identified by name,
+// and returns a reader streaming the matching records. Only these records
+// are transferred, instead of the whole blob.
+//
+// Not all S3 implementations support S3 Select.
+func (b *Backend) Select(ctx context.Context, name, sqlExpr string, opts SelectOptions) (io.ReadCloser, error) {
+	name = b.prependGlobalPrefix(name)
+	opt, err := opts.minioOptions(sqlExpr)
+	if err != nil {
+		return nil, err
+	}
+	if gopt := b.getObjectOptions(); gopt.ServerSideEncryption != nil {
+		opt.ServerSideEncryption = gopt.ServerSideEncryption
+	}
+
+	metricCalls.WithLabelValues("select").Inc()
+	metricLastCallTimestamp.WithLabelValues("select").SetToCurrentTime()
+	done := trackInFlight("select")
+
+	res, err := b.client.SelectObjectContent(ctx, b.opt.Bucket, name, opt)
+	if err = convertMinioError(err, false); err != nil {
+		metricCallErrors.WithLabelValues("select").Inc()
+		done()
+		return nil, err
+	}
+	return &downloadReader{ReadCloser: res, done: done}, nil
+}
@@ -0,0 +1,54 @@
+package s3
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"os"
+
+	"github.com/minio/minio-go/v7/pkg/encrypt"
+)
+
+// Values for Options.ServerSideEncryption.
+const (
+	SSES3  = "sse-s3"
+	SSEKMS = "sse-kms"
+	SSEC   = "sse-c"
+)
+
+// serverSide returns the server-side encryption selected by the options,
+// or nil if none is.
+func (o Options) serverSide() (encrypt.ServerSide, error) {
+	switch o.ServerSideEncryption {
+	case "":
+		return nil, nil
+	case SSES3:
+		return encrypt.NewSSE(), nil
+	case SSEKMS:
+		// A nil context is not sent
+		return encrypt.NewSSEKMS(o.SSEKMSKeyID, nil)
+	case SSEC:
+		key, err := readCustomerKey(o.SSECustomerKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		return encrypt.NewSSEC(key)
+	}
+	return nil, fmt.Errorf("unknown server_side_encryption %q", o.ServerSideEncryption)
+}
+
+// readCustomerKey reads a 256-bit SSE-C key, either raw or base64 encoded.
+func readCustomerKey(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 32 {
+		return data, nil
+	}
+	key, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(data)))
+	if err != nil || len(key) != 32 {
+		return nil, fmt.Errorf("sse_customer_key_file %q must contain a 32 bytes key, raw or base64 encoded", path)
+	}
+	return key, nil
+}
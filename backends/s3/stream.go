@@ -2,6 +2,7 @@ package s3
 
 import (
 	"context"
+	"fmt"
 	"io"
 
 	"github.com/PowerDNS/simpleblob"
@@ -25,6 +26,12 @@ func (b *Backend) NewWriter(ctx context.Context, name string) (io.WriteCloser, e
 	if err := ctx.Err(); err != nil {
 		return nil, err
 	}
+	if b.opt.Anonymous {
+		return nil, fmt.Errorf("write %q: %w", name, ErrAnonymousReadOnly)
+	}
+	if err := b.checkReserved("write", name); err != nil {
+		return nil, err
+	}
 	name = b.prependGlobalPrefix(name)
 	pr, pw := io.Pipe()
 	w := &writerWrapper{
@@ -35,13 +42,12 @@ func (b *Backend) NewWriter(ctx context.Context, name string) (io.WriteCloser, e
 		donePipe: make(chan struct{}),
 	}
 	go func() {
-		var err error
 		// The following call will return only on error or
 		// if the writing end of the pipe is closed.
-		// It is okay to write to w.info from this goroutine
+		// It is okay to write to w.info and w.err from this goroutine
 		// because it will only be used after w.donePipe is closed.
-		w.info, err = w.backend.doStoreReader(w.ctx, w.name, pr, -1)
-		_ = pr.CloseWithError(err) // Always returns nil.
+		w.info, w.err = w.backend.doStoreReader(w.ctx, w.name, pr, -1)
+		_ = pr.CloseWithError(w.err) // Always returns nil.
 		close(w.donePipe)
 	}()
 	return w, nil
@@ -55,12 +61,14 @@ type writerWrapper struct {
 	// to write the marker in Close.
 	ctx  context.Context
 	info minio.UploadInfo
+	err  error // of the upload
 	name string
 
 	// Writes are sent to this pipe
 	// and then written to S3 in a background goroutine.
 	pw       *io.PipeWriter
 	donePipe chan struct{}
+	closed   bool
 }
 
 func (w *writerWrapper) Write(p []byte) (int, error) {
@@ -70,12 +78,15 @@ func (w *writerWrapper) Write(p []byte) (int, error) {
 }
 
 func (w *writerWrapper) Close() error {
-	select {
-	case <-w.donePipe:
+	// The upload may have failed before Close, which must still report it
+	if w.closed {
 		return simpleblob.ErrClosed
-	default:
 	}
+	w.closed = true
 	_ = w.pw.Close() // Always returns nil.
 	<-w.donePipe     // Wait for doStoreReader to return and w.info to be set.
+	if w.err != nil {
+		return w.err
+	}
 	return w.backend.setMarker(w.ctx, w.name, w.info.ETag, false)
 }
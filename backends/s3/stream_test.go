@@ -0,0 +1,39 @@
+package s3
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/PowerDNS/simpleblob"
+)
+
+func TestNewWriter_uploadError(t *testing.T) {
+	// Denies all requests, including the start of the multipart upload
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/xml")
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write([]byte(`<Error><Code>AccessDenied</Code><Message>Access Denied</Message></Error>`))
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	b, err := New(ctx, Options{
+		EndpointURL: srv.URL,
+		AccessKey:   "access",
+		SecretKey:   "secret",
+		Bucket:      "bucket",
+	})
+	require.NoError(t, err)
+
+	w, err := b.NewWriter(ctx, "foo")
+	require.NoError(t, err)
+	_, _ = w.Write([]byte("data")) // may fail already
+	err = w.Close()
+	assert.ErrorContains(t, err, "Access Denied")
+	assert.ErrorIs(t, w.Close(), simpleblob.ErrClosed)
+}
@@ -0,0 +1,71 @@
+package s3
+
+import (
+	"context"
+	"io"
+	"slices"
+
+	"github.com/minio/minio-go/v7"
+
+	"github.com/PowerDNS/simpleblob"
+)
+
+var _ simpleblob.Versioner = (*Backend)(nil)
+
+// ListVersions satisfies simpleblob.Versioner. It returns the versions of
+// name kept by the bucket, including the current one, oldest first.
+// Versioning must be enabled on the bucket, otherwise only the current
+// version is returned.
+func (b *Backend) ListVersions(ctx context.Context, name string) ([]simpleblob.Version, error) {
+	name = b.prependGlobalPrefix(name)
+	ctx, cancel := b.withRequestTimeout(ctx)
+	defer cancel()
+
+	metricCalls.WithLabelValues("list-versions").Inc()
+	metricLastCallTimestamp.WithLabelValues("list-versions").SetToCurrentTime()
+	defer trackInFlight("list-versions")()
+
+	var versions []simpleblob.Version
+	objCh := b.client.ListObjects(ctx, b.opt.Bucket, minio.ListObjectsOptions{
+		Prefix:       name,
+		Recursive:    true,
+		WithVersions: true,
+	})
+	for obj := range objCh {
+		if err := convertMinioError(obj.Err, true); err != nil {
+			metricCallErrors.WithLabelValues("list-versions").Inc()
+			return nil, err
+		}
+		if obj.Key != name {
+			continue // other blob sharing the prefix
+		}
+		versions = append(versions, simpleblob.Version{
+			ID:      obj.VersionID,
+			Size:    obj.Size,
+			Time:    obj.LastModified,
+			Deleted: obj.IsDeleteMarker,
+			Current: obj.IsLatest && !obj.IsDeleteMarker,
+		})
+	}
+	// S3 returns the versions of a key latest first. Timestamps only have
+	// a one second resolution, so we do not sort on them.
+	slices.Reverse(versions)
+	return versions, nil
+}
+
+// LoadVersion satisfies simpleblob.Versioner. It loads the version of name
+// identified by its S3 version ID.
+func (b *Backend) LoadVersion(ctx context.Context, name, id string) ([]byte, error) {
+	name = b.prependGlobalPrefix(name)
+	r, err := b.doLoadVersionReader(ctx, name, id)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	p, err := io.ReadAll(r)
+	if err = convertMinioError(err, false); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
@@ -0,0 +1,515 @@
+package tiered
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+
+	"github.com/PowerDNS/simpleblob"
+)
+
+const (
+	// WriteThrough stores to the durable tier first, then to the fast tier,
+	// and only returns once both are done.
+	WriteThrough = "through"
+	// WriteBack stores to the fast tier and queues the write to the durable
+	// tier in the background.
+	WriteBack = "back"
+
+	// DefaultWritePolicy is the write policy used when none is configured.
+	DefaultWritePolicy = WriteThrough
+	// DefaultWriteBackQueueSize is the number of pending durable writes
+	// allowed before Store blocks, when using WriteBack.
+	DefaultWriteBackQueueSize = 1000
+)
+
+// TierOptions describes the backend used for one tier.
+type TierOptions struct {
+	Type    string               `yaml:"type"`
+	Options simpleblob.OptionMap `yaml:"options"`
+}
+
+// Options describes the storage options for the tiered backend
+type Options struct {
+	// Fast and Durable describe the backends to use for each tier when the
+	// backend is created through simpleblob.GetBackend.
+	Fast    TierOptions `yaml:"fast"`
+	Durable TierOptions `yaml:"durable"`
+
+	// WritePolicy is either "through" (the default) or "back".
+	WritePolicy string `yaml:"write_policy"`
+
+	// WriteBackQueueSize is the number of durable writes that can be pending
+	// when WritePolicy is "back". It defaults to DefaultWriteBackQueueSize.
+	WriteBackQueueSize int `yaml:"write_back_queue_size"`
+
+	// DisablePopulate disables the background population of the fast tier
+	// when a blob is loaded from the durable tier.
+	DisablePopulate bool `yaml:"disable_populate"`
+
+	// Not loaded from YAML
+	Logger logr.Logger `yaml:"-"`
+}
+
+func (o Options) Check() error {
+	switch o.WritePolicy {
+	case WriteThrough, WriteBack:
+	default:
+		return fmt.Errorf("tiered storage.options: unsupported write_policy %q, use %q or %q",
+			o.WritePolicy, WriteThrough, WriteBack)
+	}
+	if o.WriteBackQueueSize < 0 {
+		return fmt.Errorf("tiered storage.options: write_back_queue_size must not be negative")
+	}
+	return nil
+}
+
+// op is a durable write queued by the WriteBack policy.
+type op struct {
+	name    string
+	data    []byte // never modified once queued
+	delete  bool
+	modTime time.Time
+}
+
+// Backend combines a fast tier, like memory or fs, with a durable tier,
+// like S3. Reads fall back from the fast tier to the durable tier, writes
+// go to both according to the configured write policy.
+type Backend struct {
+	ctx     context.Context
+	opt     Options
+	fast    simpleblob.Interface
+	durable simpleblob.Interface
+	log     logr.Logger
+
+	queue   chan *op
+	pending sync.WaitGroup // queued writes and background populations
+
+	// closed is set when the background writer stopped, after which no
+	// writes can be queued. Queuing holds a read lock.
+	closeMu sync.RWMutex
+	closed  bool
+
+	// gen is incremented on every write, so that a background population
+	// started before a write does not overwrite a newer value.
+	// dirty holds the queued durable writes per name, oldest first. While
+	// a name is dirty, the last of them is authoritative for it, as the
+	// fast tier may have evicted or failed to read the blob.
+	// locks serializes the writes to the fast tier for a name, so that a
+	// population checks gen and stores atomically.
+	// written is closed and replaced whenever a queued write completes.
+	mu      sync.Mutex
+	gen     uint64
+	dirty   map[string][]*op
+	locks   map[string]*nameLock
+	written chan struct{}
+}
+
+// nameLock is a lock for a single name, removed when no longer used.
+type nameLock struct {
+	sync.Mutex
+	refs int
+}
+
+func (b *Backend) List(ctx context.Context, prefix string) (simpleblob.BlobList, error) {
+	blobs, err := b.durable.List(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+	if b.opt.WritePolicy != WriteBack {
+		return blobs, nil
+	}
+
+	// Some writes may not have reached the durable tier yet, in which case
+	// the last queued write is the most recent view of those blobs.
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.dirty) == 0 {
+		return blobs, nil
+	}
+	var merged simpleblob.BlobList
+	for _, blob := range blobs {
+		if len(b.dirty[blob.Name]) == 0 {
+			merged = append(merged, blob)
+		}
+	}
+	for name, ops := range b.dirty {
+		o := ops[len(ops)-1]
+		if !o.delete && strings.HasPrefix(name, prefix) {
+			merged = append(merged, simpleblob.Blob{
+				Name:    name,
+				Size:    int64(len(o.data)),
+				ModTime: o.modTime,
+			})
+		}
+	}
+	sort.Sort(merged)
+	return merged, nil
+}
+
+func (b *Backend) Load(ctx context.Context, name string) ([]byte, error) {
+	data, err := b.fast.Load(ctx, name)
+	if err == nil {
+		return data, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		b.log.V(1).Info("fast tier load failed", "name", name, "error", err)
+	}
+
+	gen, pending := b.state(name)
+	if pending != nil {
+		// A write of this name has not reached the durable tier yet
+		if pending.delete {
+			return nil, os.ErrNotExist
+		}
+		data := make([]byte, len(pending.data))
+		copy(data, pending.data)
+		return data, nil
+	}
+	data, err = b.durable.Load(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if !b.opt.DisablePopulate {
+		b.populate(name, data, gen)
+	}
+	return data, nil
+}
+
+// NewReader satisfies StreamReader. The fast tier is not populated when
+// reading a blob this way.
+func (b *Backend) NewReader(ctx context.Context, name string) (io.ReadCloser, error) {
+	r, err := simpleblob.NewReader(ctx, b.fast, name)
+	if err == nil {
+		return r, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		b.log.V(1).Info("fast tier reader failed", "name", name, "error", err)
+	}
+	if _, pending := b.state(name); pending != nil {
+		if pending.delete {
+			return nil, os.ErrNotExist
+		}
+		return io.NopCloser(bytes.NewReader(pending.data)), nil
+	}
+	return simpleblob.NewReader(ctx, b.durable, name)
+}
+
+func (b *Backend) Store(ctx context.Context, name string, data []byte) error {
+	if b.opt.WritePolicy == WriteBack {
+		dataCopy := make([]byte, len(data))
+		copy(dataCopy, data)
+		o := &op{name: name, data: dataCopy, modTime: time.Now()}
+		unlock := b.lockName(name)
+		b.markDirty(o)
+		err := b.fast.Store(ctx, name, data)
+		unlock()
+		if err != nil {
+			b.done(o)
+			return err
+		}
+		return b.enqueue(ctx, o)
+	}
+	if err := b.durable.Store(ctx, name, data); err != nil {
+		return err
+	}
+	// The generation changes after the durable write, as a Load may have
+	// read the previous value until then.
+	unlock := b.lockName(name)
+	defer unlock()
+	b.bump()
+	if err := b.fast.Store(ctx, name, data); err != nil {
+		// Do not leave the previous value in the fast tier
+		if derr := b.fast.Delete(ctx, name); derr != nil {
+			b.log.Error(derr, "invalidate fast tier", "name", name)
+		}
+		return err
+	}
+	return nil
+}
+
+func (b *Backend) Delete(ctx context.Context, name string) error {
+	if b.opt.WritePolicy == WriteBack {
+		o := &op{name: name, delete: true}
+		unlock := b.lockName(name)
+		b.markDirty(o)
+		err := b.fast.Delete(ctx, name)
+		unlock()
+		if err != nil {
+			b.done(o)
+			return err
+		}
+		return b.enqueue(ctx, o)
+	}
+	if err := b.durable.Delete(ctx, name); err != nil {
+		return err
+	}
+	unlock := b.lockName(name)
+	defer unlock()
+	b.bump()
+	return b.fast.Delete(ctx, name)
+}
+
+// StoreIfAbsent satisfies simpleblob.AbsentStorer, using the durable
+// tier's implementation if it has one. With the WriteBack policy, it
+// first waits for the queued writes of name to reach the durable tier.
+func (b *Backend) StoreIfAbsent(ctx context.Context, name string, data []byte) error {
+	unlock := b.lockName(name)
+	defer unlock()
+	if err := b.waitWritten(ctx, name); err != nil {
+		return err
+	}
+	if err := simpleblob.StoreIfAbsent(ctx, b.durable, name, data); err != nil {
+		return err
+	}
+	b.bump()
+	if err := b.fast.Store(ctx, name, data); err != nil {
+		// The blob was claimed in the durable tier, so this is not
+		// reported to the caller, who could not retry anyway
+		b.log.Error(err, "store to fast tier", "name", name)
+		if derr := b.fast.Delete(ctx, name); derr != nil {
+			b.log.Error(derr, "invalidate fast tier", "name", name)
+		}
+	}
+	return nil
+}
+
+// waitWritten waits until no durable write of name is queued. The name
+// lock must be held, so that no new write gets queued.
+func (b *Backend) waitWritten(ctx context.Context, name string) error {
+	for {
+		b.mu.Lock()
+		n, written := len(b.dirty[name]), b.written
+		b.mu.Unlock()
+		if n == 0 {
+			return nil
+		}
+		select {
+		case <-written:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Flush waits until all queued durable writes and background populations
+// of the fast tier have completed.
+func (b *Backend) Flush() {
+	b.pending.Wait()
+}
+
+// state returns the current write generation and the last durable write
+// pending for name, if any.
+func (b *Backend) state(name string) (gen uint64, pending *op) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if ops := b.dirty[name]; len(ops) > 0 {
+		pending = ops[len(ops)-1]
+	}
+	return b.gen, pending
+}
+
+func (b *Backend) bump() {
+	b.mu.Lock()
+	b.gen++
+	b.mu.Unlock()
+}
+
+// lockName locks the fast tier writes for name, and returns the function
+// to unlock them.
+func (b *Backend) lockName(name string) (unlock func()) {
+	b.mu.Lock()
+	l := b.locks[name]
+	if l == nil {
+		l = &nameLock{}
+		b.locks[name] = l
+	}
+	l.refs++
+	b.mu.Unlock()
+
+	l.Lock()
+	return func() {
+		l.Unlock()
+		b.mu.Lock()
+		l.refs--
+		if l.refs == 0 {
+			delete(b.locks, name)
+		}
+		b.mu.Unlock()
+	}
+}
+
+// markDirty records a durable write that is about to be queued. It must be
+// followed by a call to enqueue or done.
+func (b *Backend) markDirty(o *op) {
+	b.pending.Add(1)
+	b.mu.Lock()
+	b.gen++
+	b.dirty[o.name] = append(b.dirty[o.name], o)
+	b.mu.Unlock()
+}
+
+// populate stores data in the fast tier in the background, unless a write
+// happened since gen was obtained.
+func (b *Backend) populate(name string, data []byte, gen uint64) {
+	b.pending.Add(1)
+	go func() {
+		defer b.pending.Done()
+		unlock := b.lockName(name)
+		defer unlock()
+		if current, _ := b.state(name); current != gen {
+			return // a newer write may have changed this blob
+		}
+		if err := b.fast.Store(b.ctx, name, data); err != nil {
+			b.log.Error(err, "populate fast tier", "name", name)
+		}
+	}()
+}
+
+// enqueue queues o for the durable tier, blocking if the queue is full.
+func (b *Backend) enqueue(ctx context.Context, o *op) error {
+	b.closeMu.RLock()
+	defer b.closeMu.RUnlock()
+	if b.closed {
+		b.done(o)
+		return b.ctx.Err()
+	}
+	select {
+	case b.queue <- o:
+		return nil
+	case <-ctx.Done():
+		b.done(o)
+		return ctx.Err()
+	case <-b.ctx.Done():
+		b.done(o)
+		return b.ctx.Err()
+	}
+}
+
+// done marks a queued write as completed, or as dropped.
+func (b *Backend) done(o *op) {
+	b.mu.Lock()
+	ops := b.dirty[o.name]
+	for i, p := range ops {
+		if p == o {
+			ops = append(ops[:i:i], ops[i+1:]...)
+			break
+		}
+	}
+	if len(ops) == 0 {
+		delete(b.dirty, o.name)
+	} else {
+		b.dirty[o.name] = ops
+	}
+	close(b.written)
+	b.written = make(chan struct{})
+	b.mu.Unlock()
+	b.pending.Done()
+}
+
+// writeBack applies queued writes to the durable tier in order, so that a
+// Delete following a Store of the same name is never reordered.
+func (b *Backend) writeBack() {
+	for {
+		select {
+		case o := <-b.queue:
+			var err error
+			if o.delete {
+				err = b.durable.Delete(b.ctx, o.name)
+			} else {
+				err = b.durable.Store(b.ctx, o.name, o.data)
+			}
+			if err != nil {
+				b.log.Error(err, "write back to durable tier", "name", o.name, "delete", o.delete)
+			}
+			b.done(o)
+		case <-b.ctx.Done():
+			b.drain()
+			return
+		}
+	}
+}
+
+// drain drops the writes still queued when the backend context is done,
+// so that Flush does not wait for them forever.
+func (b *Backend) drain() {
+	b.closeMu.Lock()
+	b.closed = true
+	b.closeMu.Unlock()
+	for {
+		select {
+		case o := <-b.queue:
+			b.log.Error(b.ctx.Err(), "write back to durable tier dropped", "name", o.name, "delete", o.delete)
+			b.done(o)
+		default:
+			return
+		}
+	}
+}
+
+// New creates a new tiered backend from two existing backends.
+// The lifetime of the context passed in must span the lifetime of the whole
+// backend instance, as it is used for background operations.
+func New(ctx context.Context, fast, durable simpleblob.Interface, opt Options) (*Backend, error) {
+	if opt.WritePolicy == "" {
+		opt.WritePolicy = DefaultWritePolicy
+	}
+	if opt.WriteBackQueueSize == 0 {
+		opt.WriteBackQueueSize = DefaultWriteBackQueueSize
+	}
+	if err := opt.Check(); err != nil {
+		return nil, err
+	}
+
+	log := opt.Logger
+	if log.GetSink() == nil {
+		log = logr.Discard()
+	}
+
+	b := &Backend{
+		ctx:     ctx,
+		opt:     opt,
+		fast:    fast,
+		durable: durable,
+		log:     log.WithName("tiered"),
+		dirty:   make(map[string][]*op),
+		locks:   make(map[string]*nameLock),
+		written: make(chan struct{}),
+	}
+	if opt.WritePolicy == WriteBack {
+		b.queue = make(chan *op, opt.WriteBackQueueSize)
+		go b.writeBack()
+	}
+	return b, nil
+}
+
+func init() {
+	simpleblob.RegisterBackend("tiered", func(ctx context.Context, p simpleblob.InitParams) (simpleblob.Interface, error) {
+		var opt Options
+		if err := p.OptionsThroughYAML(&opt); err != nil {
+			return nil, err
+		}
+		opt.Logger = p.Logger
+		if opt.Fast.Type == "" || opt.Durable.Type == "" {
+			return nil, fmt.Errorf("tiered storage.options: fast.type and durable.type are required")
+		}
+		fast, err := simpleblob.GetBackend(ctx, opt.Fast.Type, opt.Fast.Options, simpleblob.WithLogger(p.Logger))
+		if err != nil {
+			return nil, fmt.Errorf("tiered fast tier: %w", err)
+		}
+		durable, err := simpleblob.GetBackend(ctx, opt.Durable.Type, opt.Durable.Options, simpleblob.WithLogger(p.Logger))
+		if err != nil {
+			return nil, fmt.Errorf("tiered durable tier: %w", err)
+		}
+		return New(ctx, fast, durable, opt)
+	})
+}
@@ -0,0 +1,225 @@
+package tiered
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/PowerDNS/simpleblob"
+	"github.com/PowerDNS/simpleblob/backends/memory"
+	"github.com/PowerDNS/simpleblob/tester"
+)
+
+func TestBackend(t *testing.T) {
+	for _, policy := range []string{WriteThrough, WriteBack} {
+		t.Run(policy, func(t *testing.T) {
+			b, err := New(context.Background(), memory.New(), memory.New(), Options{WritePolicy: policy})
+			require.NoError(t, err)
+			tester.DoBackendTests(t, b)
+			b.Flush()
+		})
+	}
+}
+
+func TestBackend_populate(t *testing.T) {
+	ctx := context.Background()
+	fast, durable := memory.New(), memory.New()
+	b, err := New(ctx, fast, durable, Options{})
+	require.NoError(t, err)
+
+	require.NoError(t, durable.Store(ctx, "foo", []byte("bar")))
+	_, err = fast.Load(ctx, "foo")
+	assert.Error(t, err)
+
+	data, err := b.Load(ctx, "foo")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("bar"), data)
+
+	b.Flush()
+	data, err = fast.Load(ctx, "foo")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("bar"), data)
+}
+
+func TestBackend_writeBack(t *testing.T) {
+	ctx := context.Background()
+	fast, durable := memory.New(), memory.New()
+	b, err := New(ctx, fast, durable, Options{WritePolicy: WriteBack})
+	require.NoError(t, err)
+
+	require.NoError(t, b.Store(ctx, "foo", []byte("bar")))
+	require.NoError(t, b.Store(ctx, "baz", []byte("qux")))
+	require.NoError(t, b.Delete(ctx, "baz"))
+	b.Flush()
+
+	ls, err := durable.List(ctx, "")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"foo"}, ls.Names())
+}
+
+// hooked is a memory backend calling hooks before loads and stores.
+type hooked struct {
+	*memory.Backend
+	beforeLoad  func()
+	beforeStore func() error
+}
+
+func (h *hooked) Load(ctx context.Context, name string) ([]byte, error) {
+	data, err := h.Backend.Load(ctx, name)
+	if h.beforeLoad != nil {
+		h.beforeLoad()
+	}
+	return data, err
+}
+
+func (h *hooked) Store(ctx context.Context, name string, data []byte) error {
+	if h.beforeStore != nil {
+		if err := h.beforeStore(); err != nil {
+			return err
+		}
+	}
+	return h.Backend.Store(ctx, name, data)
+}
+
+func TestBackend_populateStale(t *testing.T) {
+	ctx := context.Background()
+	fast, durable := memory.New(), &hooked{Backend: memory.New()}
+	b, err := New(ctx, fast, durable, Options{})
+	require.NoError(t, err)
+	require.NoError(t, durable.Backend.Store(ctx, "foo", []byte("old")))
+
+	// A Load reads the old value while a Store is in progress, and only
+	// populates the fast tier once the Store completed
+	loaded, release, returned := make(chan struct{}), make(chan struct{}), make(chan struct{})
+	durable.beforeLoad = func() {
+		close(loaded)
+		<-release
+	}
+	durable.beforeStore = func() error {
+		go func() {
+			defer close(returned)
+			data, err := b.Load(ctx, "foo")
+			assert.NoError(t, err)
+			assert.Equal(t, []byte("old"), data)
+		}()
+		<-loaded
+		return nil
+	}
+	require.NoError(t, b.Store(ctx, "foo", []byte("new")))
+	durable.beforeLoad, durable.beforeStore = nil, nil
+	close(release)
+	<-returned
+	b.Flush()
+
+	data, err := fast.Load(ctx, "foo")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("new"), data)
+}
+
+func TestBackend_fastStoreFailure(t *testing.T) {
+	ctx := context.Background()
+	fast, durable := &hooked{Backend: memory.New()}, memory.New()
+	b, err := New(ctx, fast, durable, Options{})
+	require.NoError(t, err)
+	require.NoError(t, b.Store(ctx, "foo", []byte("old")))
+
+	fast.beforeStore = func() error { return errors.New("full") }
+	assert.Error(t, b.Store(ctx, "foo", []byte("new")))
+	data, err := b.Load(ctx, "foo")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("new"), data)
+}
+
+func TestBackend_writeBackCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	block := make(chan struct{})
+	durable := &hooked{Backend: memory.New(), beforeStore: func() error {
+		<-block
+		return nil
+	}}
+	b, err := New(ctx, memory.New(), durable, Options{WritePolicy: WriteBack})
+	require.NoError(t, err)
+	for _, name := range []string{"a", "b", "c"} {
+		require.NoError(t, b.Store(context.Background(), name, []byte(name)))
+	}
+	cancel()
+	close(block)
+
+	flushed := make(chan struct{})
+	go func() {
+		b.Flush()
+		close(flushed)
+	}()
+	select {
+	case <-flushed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Flush did not return")
+	}
+	assert.ErrorIs(t, b.Store(context.Background(), "d", []byte("d")), context.Canceled)
+}
+
+func TestBackend_writeBackEvicted(t *testing.T) {
+	ctx := context.Background()
+	block := make(chan struct{})
+	durable := &hooked{Backend: memory.New(), beforeStore: func() error {
+		<-block
+		return nil
+	}}
+	fast, err := memory.NewWithOptions(memory.Options{MaxBytes: 4})
+	require.NoError(t, err)
+	b, err := New(ctx, fast, durable, Options{WritePolicy: WriteBack})
+	require.NoError(t, err)
+
+	// The fast tier evicts "a" before it reaches the durable tier
+	require.NoError(t, b.Store(ctx, "a", []byte("aaa")))
+	require.NoError(t, b.Store(ctx, "b", []byte("bbb")))
+	require.NoError(t, b.Store(ctx, "c", []byte("ccc")))
+	require.NoError(t, b.Delete(ctx, "c"))
+	_, err = fast.Load(ctx, "a")
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	data, err := b.Load(ctx, "a")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("aaa"), data)
+	r, err := b.NewReader(ctx, "a")
+	require.NoError(t, err)
+	data, err = io.ReadAll(r)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("aaa"), data)
+	assert.NoError(t, r.Close())
+	_, err = b.Load(ctx, "c")
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	ls, err := b.List(ctx, "")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, ls.Names())
+	assert.Equal(t, int64(3), ls[0].Size)
+
+	close(block)
+	b.Flush()
+	data, err = b.Load(ctx, "a")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("aaa"), data)
+}
+
+func TestRegistered(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	b, err := simpleblob.GetBackend(ctx, "tiered", simpleblob.OptionMap{
+		"fast":         map[string]interface{}{"type": "memory"},
+		"durable":      map[string]interface{}{"type": "memory"},
+		"write_policy": WriteBack,
+	})
+	require.NoError(t, err)
+	tester.DoBackendTests(t, b)
+
+	_, err = simpleblob.GetBackend(ctx, "tiered", simpleblob.OptionMap{
+		"fast": map[string]interface{}{"type": "memory"},
+	})
+	assert.Error(t, err)
+}
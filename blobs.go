@@ -2,12 +2,16 @@ package simpleblob
 
 import (
 	"strings"
+	"time"
 )
 
 // Blob describes a single blob
 type Blob struct {
 	Name string
 	Size int64
+	// ModTime is the time the blob was last stored, if known. Not all
+	// backends provide it in listings.
+	ModTime time.Time
 }
 
 // BlobList is a slice of Blob structs
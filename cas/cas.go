@@ -0,0 +1,242 @@
+// Package cas provides content-addressable storage on top of any
+// simpleblob backend.
+//
+// Payloads are stored once per SHA-256 digest, and a manifest maps names
+// to digests. Storing the same payload under several names only stores it
+// once, and payloads are verified against their digest when loaded.
+//
+// The manifest is cached in memory and written back on every change, so a
+// given set of blobs must only be written to by a single CAS instance at a
+// time.
+package cas
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/PowerDNS/simpleblob"
+)
+
+const (
+	// ManifestName is the name of the blob holding the manifest.
+	ManifestName = "cas-manifest.json"
+	// ObjectPrefix is the prefix of the blobs holding the payloads, which
+	// is followed by the hex encoded SHA-256 digest of the payload.
+	ObjectPrefix = "cas-object-"
+)
+
+// ErrDigestMismatch is returned when a loaded payload does not match its
+// digest.
+var ErrDigestMismatch = errors.New("cas: payload does not match digest")
+
+// Entry is the manifest entry of a name.
+type Entry struct {
+	Digest string `json:"digest"` // hex encoded SHA-256
+	Size   int64  `json:"size"`
+}
+
+// manifest is the stored format of the manifest.
+type manifest struct {
+	Version int              `json:"version"`
+	Blobs   map[string]Entry `json:"blobs"`
+}
+
+// CAS implements simpleblob.Interface using content-addressable storage.
+type CAS struct {
+	st simpleblob.Interface
+
+	mu    sync.Mutex
+	blobs map[string]Entry
+	refs  map[string]int // number of names by digest
+}
+
+// Digest returns the manifest entry for name.
+func (c *CAS) Digest(name string) (Entry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.blobs[name]
+	return e, ok
+}
+
+func (c *CAS) List(ctx context.Context, prefix string) (simpleblob.BlobList, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var blobs simpleblob.BlobList
+	for name, e := range c.blobs {
+		if strings.HasPrefix(name, prefix) {
+			blobs = append(blobs, simpleblob.Blob{Name: name, Size: e.Size})
+		}
+	}
+	sort.Sort(blobs)
+	return blobs, nil
+}
+
+// Load loads the payload of name and verifies it against its digest.
+func (c *CAS) Load(ctx context.Context, name string) ([]byte, error) {
+	e, ok := c.Digest(name)
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	data, err := c.st.Load(ctx, ObjectPrefix+e.Digest)
+	if err != nil {
+		return nil, err
+	}
+	if digest(data) != e.Digest {
+		return nil, fmt.Errorf("%w: %s", ErrDigestMismatch, name)
+	}
+	return data, nil
+}
+
+// NewReader satisfies StreamReader. The payload is loaded and verified
+// completely before it is returned.
+func (c *CAS) NewReader(ctx context.Context, name string) (io.ReadCloser, error) {
+	data, err := c.Load(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+// Store stores data under name. The payload is only uploaded if no other
+// name refers to the same digest.
+func (c *CAS) Store(ctx context.Context, name string, data []byte) error {
+	e := Entry{Digest: digest(data), Size: int64(len(data))}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.refs[e.Digest] == 0 {
+		if err := c.st.Store(ctx, ObjectPrefix+e.Digest, data); err != nil {
+			return err
+		}
+	}
+	old, exists := c.blobs[name]
+	c.blobs[name] = e
+	c.refs[e.Digest]++
+	if exists {
+		c.unref(old.Digest)
+	}
+	if err := c.save(ctx); err != nil {
+		// Restore the previous state, the object is left for GC
+		c.unref(e.Digest)
+		if exists {
+			c.blobs[name] = old
+			c.refs[old.Digest]++
+		} else {
+			delete(c.blobs, name)
+		}
+		return err
+	}
+	return nil
+}
+
+// Delete removes name from the manifest. The payload is only removed by GC.
+func (c *CAS) Delete(ctx context.Context, name string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	old, exists := c.blobs[name]
+	if !exists {
+		return nil
+	}
+	delete(c.blobs, name)
+	c.unref(old.Digest)
+	if err := c.save(ctx); err != nil {
+		c.blobs[name] = old
+		c.refs[old.Digest]++
+		return err
+	}
+	return nil
+}
+
+// GC deletes the payloads that are not referenced by any name, and returns
+// the number of payloads deleted.
+func (c *CAS) GC(ctx context.Context) (int, error) {
+	objects, err := c.st.List(ctx, ObjectPrefix)
+	if err != nil {
+		return 0, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	deleted := 0
+	for _, o := range objects {
+		d := strings.TrimPrefix(o.Name, ObjectPrefix)
+		if c.refs[d] > 0 {
+			continue
+		}
+		if err := c.st.Delete(ctx, o.Name); err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+// Reload reads the manifest from storage again, discarding the cached one.
+func (c *CAS) Reload(ctx context.Context) error {
+	data, err := c.st.Load(ctx, ManifestName)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	m := manifest{Blobs: make(map[string]Entry)}
+	if err == nil {
+		if err := json.Unmarshal(data, &m); err != nil {
+			return fmt.Errorf("cas: decode manifest: %w", err)
+		}
+		if m.Version != 1 {
+			return fmt.Errorf("cas: unsupported manifest version %d", m.Version)
+		}
+	}
+	refs := make(map[string]int)
+	for _, e := range m.Blobs {
+		refs[e.Digest]++
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.blobs = m.Blobs
+	if c.blobs == nil {
+		c.blobs = make(map[string]Entry)
+	}
+	c.refs = refs
+	return nil
+}
+
+// save writes the manifest. c.mu must be held.
+func (c *CAS) save(ctx context.Context) error {
+	data, err := json.Marshal(manifest{Version: 1, Blobs: c.blobs})
+	if err != nil {
+		return err
+	}
+	return c.st.Store(ctx, ManifestName, data)
+}
+
+// unref removes a reference to digest d. c.mu must be held.
+func (c *CAS) unref(d string) {
+	c.refs[d]--
+	if c.refs[d] <= 0 {
+		delete(c.refs, d)
+	}
+}
+
+func digest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// New creates a CAS on top of st, loading the existing manifest if any.
+func New(ctx context.Context, st simpleblob.Interface) (*CAS, error) {
+	c := &CAS{st: st}
+	if err := c.Reload(ctx); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
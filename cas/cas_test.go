@@ -0,0 +1,63 @@
+package cas
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/PowerDNS/simpleblob/backends/memory"
+	"github.com/PowerDNS/simpleblob/tester"
+)
+
+func TestCAS(t *testing.T) {
+	c, err := New(context.Background(), memory.New())
+	require.NoError(t, err)
+	tester.DoBackendTests(t, c)
+}
+
+func TestCAS_dedup(t *testing.T) {
+	ctx := context.Background()
+	st := memory.New()
+	c, err := New(ctx, st)
+	require.NoError(t, err)
+
+	require.NoError(t, c.Store(ctx, "a", []byte("same")))
+	require.NoError(t, c.Store(ctx, "b", []byte("same")))
+	require.NoError(t, c.Store(ctx, "c", []byte("other")))
+	objects, err := st.List(ctx, ObjectPrefix)
+	assert.NoError(t, err)
+	assert.Len(t, objects, 2)
+
+	// Overwriting and deleting leaves unreferenced payloads for GC
+	require.NoError(t, c.Store(ctx, "c", []byte("same")))
+	require.NoError(t, c.Delete(ctx, "a"))
+	n, err := c.GC(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	data, err := c.Load(ctx, "b")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("same"), data)
+
+	// The manifest is persisted
+	c2, err := New(ctx, st)
+	require.NoError(t, err)
+	ls, err := c2.List(ctx, "")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"b", "c"}, ls.Names())
+}
+
+func TestCAS_integrity(t *testing.T) {
+	ctx := context.Background()
+	st := memory.New()
+	c, err := New(ctx, st)
+	require.NoError(t, err)
+
+	require.NoError(t, c.Store(ctx, "foo", []byte("bar")))
+	e, ok := c.Digest("foo")
+	require.True(t, ok)
+	require.NoError(t, st.Store(ctx, ObjectPrefix+e.Digest, []byte("corrupted")))
+	_, err = c.Load(ctx, "foo")
+	assert.ErrorIs(t, err, ErrDigestMismatch)
+}
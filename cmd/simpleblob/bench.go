@@ -0,0 +1,267 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+
+	"github.com/PowerDNS/simpleblob"
+)
+
+func init() {
+	commands["bench"] = command{
+		usage: "[-ops write,read,list] [-size sizes] [-concurrency n] [-duration d] [-prefix prefix] [-keep]",
+		help:  "measure the throughput and latency of the backend",
+		run:   runBench,
+	}
+}
+
+// sizeRange is a range of blob sizes, picked uniformly.
+type sizeRange struct {
+	min, max int64
+}
+
+// sizeDist is a distribution of blob sizes: each blob gets a size from one
+// of the ranges, picked uniformly.
+type sizeDist []sizeRange
+
+func (d sizeDist) max() int64 {
+	var n int64
+	for _, r := range d {
+		n = max(n, r.max)
+	}
+	return n
+}
+
+func (d sizeDist) pick(rnd *rand.Rand) int64 {
+	r := d[rnd.IntN(len(d))]
+	return r.min + rnd.Int64N(r.max-r.min+1)
+}
+
+var sizeUnits = map[string]int64{
+	"":    1,
+	"B":   1,
+	"K":   1 << 10,
+	"KiB": 1 << 10,
+	"KB":  1e3,
+	"M":   1 << 20,
+	"MiB": 1 << 20,
+	"MB":  1e6,
+	"G":   1 << 30,
+	"GiB": 1 << 30,
+	"GB":  1e9,
+}
+
+// parseSize parses a size like 512, 64KiB, 1MB or 2G.
+func parseSize(s string) (int64, error) {
+	i := strings.IndexFunc(s, func(r rune) bool { return r < '0' || r > '9' })
+	if i < 0 {
+		i = len(s)
+	}
+	n, err := strconv.ParseInt(s[:i], 10, 64)
+	unit, ok := sizeUnits[s[i:]]
+	if err != nil || !ok || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return n * unit, nil
+}
+
+// parseSizeDist parses a comma separated list of sizes and ranges of sizes,
+// like 1KiB,64KiB-1MiB.
+func parseSizeDist(s string) (sizeDist, error) {
+	var d sizeDist
+	for _, part := range strings.Split(s, ",") {
+		from, to, isRange := strings.Cut(part, "-")
+		var r sizeRange
+		var err error
+		if r.min, err = parseSize(from); err != nil {
+			return nil, err
+		}
+		r.max = r.min
+		if isRange {
+			if r.max, err = parseSize(to); err != nil {
+				return nil, err
+			}
+			if r.max < r.min {
+				return nil, fmt.Errorf("invalid size range %q", part)
+			}
+		}
+		d = append(d, r)
+	}
+	return d, nil
+}
+
+// benchResult holds the measurements of a workload.
+type benchResult struct {
+	latencies []time.Duration
+	bytes     int64
+	elapsed   time.Duration
+}
+
+// percentile returns the latency below which p percent of the operations
+// completed. The latencies must be sorted.
+func (r benchResult) percentile(p int) time.Duration {
+	if len(r.latencies) == 0 {
+		return 0
+	}
+	i := (len(r.latencies)*p + 99) / 100
+	return r.latencies[max(i, 1)-1]
+}
+
+// workload runs op with the given concurrency until ctx is done, and
+// returns the measurements. The op returns the number of bytes transferred.
+func workload(ctx context.Context, concurrency int, op func(ctx context.Context, worker int, rnd *rand.Rand) (int64, error)) (benchResult, error) {
+	var res benchResult
+	var mu sync.Mutex
+	g, gctx := errgroup.WithContext(ctx)
+	start := time.Now()
+	for w := 0; w < concurrency; w++ {
+		g.Go(func() error {
+			rnd := rand.New(rand.NewPCG(uint64(start.UnixNano()), uint64(w)))
+			var latencies []time.Duration
+			var total int64
+			defer func() {
+				mu.Lock()
+				res.latencies = append(res.latencies, latencies...)
+				res.bytes += total
+				mu.Unlock()
+			}()
+			for gctx.Err() == nil {
+				t := time.Now()
+				n, err := op(gctx, w, rnd)
+				if err != nil {
+					if gctx.Err() != nil {
+						return nil // interrupted by the end of the run
+					}
+					return err
+				}
+				latencies = append(latencies, time.Since(t))
+				total += n
+			}
+			return nil
+		})
+	}
+	err := g.Wait()
+	res.elapsed = time.Since(start)
+	sort.Slice(res.latencies, func(i, j int) bool { return res.latencies[i] < res.latencies[j] })
+	return res, err
+}
+
+func runBench(ctx context.Context, e *env, args []string) error {
+	flags := flag.NewFlagSet("bench", flag.ContinueOnError)
+	opsFlag := flags.String("ops", "write,read,list", "comma separated `workloads` to run in order: write, read, list")
+	sizeFlag := flags.String("size", "64KiB", "blob `sizes` as a comma separated list of sizes and ranges, like 1KiB,64KiB-1MiB")
+	concurrency := flags.Int("concurrency", 4, "number of concurrent operations")
+	duration := flags.Duration("duration", 10*time.Second, "duration of each workload")
+	prefix := flags.String("prefix", "simpleblob-bench/", "prefix of the blobs written and read")
+	keep := flags.Bool("keep", false, "do not delete the written blobs at the end")
+	if err := parseFlags(flags, e, args, 0, 0); err != nil {
+		return err
+	}
+	sizes, err := parseSizeDist(*sizeFlag)
+	if err != nil {
+		return err
+	}
+	if *concurrency < 1 || *duration <= 0 {
+		return errUsage
+	}
+	ops := strings.Split(*opsFlag, ",")
+	for _, op := range ops {
+		if op != "write" && op != "read" && op != "list" {
+			return fmt.Errorf("unknown workload %q", op)
+		}
+	}
+
+	data := make([]byte, sizes.max())
+	for i := range data {
+		data[i] = byte(rand.IntN(256))
+	}
+	// written[w] are the names of the blobs written by worker w, and
+	// attempted[w] also includes the ones of interrupted writes
+	written := make([][]string, *concurrency)
+	attempted := make([][]string, *concurrency)
+	var names []string // for reads
+	defer func() {
+		if *keep {
+			return
+		}
+		for _, ws := range attempted {
+			for _, name := range ws {
+				_ = e.st.Delete(context.WithoutCancel(ctx), name)
+			}
+		}
+	}()
+
+	fmt.Fprintf(e.stdout, "%-6s %8s %10s %10s %10s %10s %10s %10s\n",
+		"op", "count", "ops/s", "MiB/s", "p50", "p90", "p99", "max")
+	for _, opName := range ops {
+		var op func(ctx context.Context, worker int, rnd *rand.Rand) (int64, error)
+		switch opName {
+		case "write":
+			op = func(ctx context.Context, w int, rnd *rand.Rand) (int64, error) {
+				name := fmt.Sprintf("%s%d-%d", *prefix, w, len(attempted[w]))
+				size := sizes.pick(rnd)
+				attempted[w] = append(attempted[w], name)
+				if err := e.st.Store(ctx, name, data[:size]); err != nil {
+					return 0, err
+				}
+				written[w] = append(written[w], name)
+				return size, nil
+			}
+		case "read":
+			names = names[:0]
+			for _, ws := range written {
+				names = append(names, ws...)
+			}
+			if len(names) == 0 {
+				ls, err := e.st.List(ctx, *prefix)
+				if err != nil {
+					return err
+				}
+				names = ls.Names()
+			}
+			if len(names) == 0 {
+				return fmt.Errorf("no blobs to read under %q, run the write workload first", *prefix)
+			}
+			op = func(ctx context.Context, w int, rnd *rand.Rand) (int64, error) {
+				r, err := simpleblob.NewReader(ctx, e.st, names[rnd.IntN(len(names))])
+				if err != nil {
+					return 0, err
+				}
+				defer r.Close()
+				return io.Copy(io.Discard, r)
+			}
+		case "list":
+			op = func(ctx context.Context, w int, rnd *rand.Rand) (int64, error) {
+				_, err := e.st.List(ctx, *prefix)
+				return 0, err
+			}
+		}
+
+		wctx, cancel := context.WithTimeout(ctx, *duration)
+		res, err := workload(wctx, *concurrency, op)
+		cancel()
+		if err != nil {
+			return fmt.Errorf("%s: %w", opName, err)
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		seconds := res.elapsed.Seconds()
+		fmt.Fprintf(e.stdout, "%-6s %8d %10.1f %10.2f %10s %10s %10s %10s\n",
+			opName, len(res.latencies),
+			float64(len(res.latencies))/seconds, float64(res.bytes)/(1<<20)/seconds,
+			res.percentile(50).Round(time.Microsecond), res.percentile(90).Round(time.Microsecond),
+			res.percentile(99).Round(time.Microsecond), res.percentile(100).Round(time.Microsecond))
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/PowerDNS/simpleblob"
+)
+
+func init() {
+	commands["check-config"] = command{
+		usage:     "[-no-ping] [-timeout duration]",
+		help:      "check the backend options and that the storage is reachable",
+		run:       runCheckConfig,
+		noBackend: true,
+	}
+}
+
+// errCheckFailed is returned by check-config after printing the problem.
+var errCheckFailed = errors.New("configuration check failed")
+
+var unknownField = regexp.MustCompile(`field (\S+) not found in type`)
+
+// hint returns advice on how to fix an error, or "" if there is none.
+func hint(err error) string {
+	var netErr net.Error
+	var dnsErr *net.DNSError
+	switch {
+	case unknownField.MatchString(err.Error()):
+		return fmt.Sprintf("unknown option %s, check its spelling and indentation against the documentation of the backend",
+			unknownField.FindStringSubmatch(err.Error())[1])
+	case errors.Is(err, os.ErrNotExist):
+		return "a configured path or file does not exist"
+	case errors.Is(err, os.ErrPermission):
+		return "check the credentials and the permissions of the storage"
+	case errors.As(err, &dnsErr):
+		return "check the host name of the endpoint"
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr):
+		return "check the endpoint and that it can be reached from this host"
+	}
+	return ""
+}
+
+func runCheckConfig(ctx context.Context, e *env, args []string) error {
+	flags := flag.NewFlagSet("check-config", flag.ContinueOnError)
+	noPing := flags.Bool("no-ping", false, "only check the options, without connecting to the storage")
+	timeout := flags.Duration("timeout", 10*time.Second, "maximum duration of the ping")
+	if err := parseFlags(flags, e, args, 0, 0); err != nil {
+		return err
+	}
+	fail := func(stage string, err error) error {
+		fmt.Fprintf(e.stdout, "%s: FAILED\n  %s\n", stage, strings.ReplaceAll(err.Error(), "\n", "\n  "))
+		if h := hint(err); h != "" {
+			fmt.Fprintf(e.stdout, "  hint: %s\n", h)
+		}
+		return errCheckFailed
+	}
+
+	fmt.Fprintf(e.stdout, "type: %s\n", e.cfg.Type)
+	// Backends check their options when created
+	st, err := simpleblob.GetBackend(ctx, e.cfg.Type, e.cfg.optionMap())
+	if err != nil {
+		return fail("options", err)
+	}
+	fmt.Fprintln(e.stdout, "options: ok")
+	if *noPing {
+		return nil
+	}
+
+	pctx, cancel := context.WithTimeout(ctx, *timeout)
+	defer cancel()
+	start := time.Now()
+	if err := simpleblob.Ping(pctx, st); err != nil {
+		return fail("ping", err)
+	}
+	fmt.Fprintf(e.stdout, "ping: ok (%s)\n", time.Since(start).Round(time.Millisecond))
+	return nil
+}
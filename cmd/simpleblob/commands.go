@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"time"
+
+	"github.com/PowerDNS/simpleblob"
+)
+
+func init() {
+	commands["ls"] = command{
+		usage: "[-l] [prefix]",
+		help:  "list the blobs starting with prefix",
+		run:   runList,
+	}
+	commands["cat"] = command{
+		usage: "name...",
+		help:  "write the content of blobs to stdout",
+		run:   runCat,
+	}
+	commands["get"] = command{
+		usage: "name [file]",
+		help:  "save a blob to file, by default named like the last element of name",
+		run:   runGet,
+	}
+	commands["put"] = command{
+		usage: "name file|-",
+		help:  "store the content of file, or stdin if it is -, as a blob",
+		run:   runPut,
+	}
+	commands["rm"] = command{
+		usage: "name...",
+		help:  "delete blobs",
+		run:   runRemove,
+	}
+	commands["stat"] = command{
+		usage: "name...",
+		help:  "show information about blobs",
+		run:   runStat,
+	}
+}
+
+// parseFlags parses the flags of a command. It returns errUsage if the
+// number of remaining arguments is not between minArgs and maxArgs, or at
+// least minArgs if maxArgs is -1.
+func parseFlags(flags *flag.FlagSet, e *env, args []string, minArgs, maxArgs int) error {
+	flags.SetOutput(e.stderr)
+	if err := flags.Parse(args); err != nil {
+		return errUsage
+	}
+	if n := flags.NArg(); n < minArgs || (maxArgs >= 0 && n > maxArgs) {
+		return errUsage
+	}
+	return nil
+}
+
+func runList(ctx context.Context, e *env, args []string) error {
+	flags := flag.NewFlagSet("ls", flag.ContinueOnError)
+	long := flags.Bool("l", false, "show sizes and modification times")
+	if err := parseFlags(flags, e, args, 0, 1); err != nil {
+		return err
+	}
+	ls, err := e.st.List(ctx, flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	for _, blob := range ls {
+		if !*long {
+			fmt.Fprintln(e.stdout, blob.Name)
+			continue
+		}
+		modTime := "-"
+		if !blob.ModTime.IsZero() {
+			modTime = blob.ModTime.UTC().Format(time.RFC3339)
+		}
+		fmt.Fprintf(e.stdout, "%12d  %-20s  %s\n", blob.Size, modTime, blob.Name)
+	}
+	return nil
+}
+
+func runCat(ctx context.Context, e *env, args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+	for _, name := range args {
+		if err := copyBlob(ctx, e.st, name, e.stdout); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// copyBlob streams the content of a blob to w.
+func copyBlob(ctx context.Context, st simpleblob.Interface, name string, w io.Writer) error {
+	r, err := simpleblob.NewReader(ctx, st, name)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	_, err = io.Copy(w, r)
+	return err
+}
+
+func runGet(ctx context.Context, e *env, args []string) error {
+	if len(args) < 1 || len(args) > 2 {
+		return errUsage
+	}
+	name := args[0]
+	file := path.Base(name)
+	if len(args) == 2 {
+		file = args[1]
+	}
+	if file == "-" {
+		if err := copyBlob(ctx, e.st, name, e.stdout); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		return nil
+	}
+	// Check that the blob exists before creating the file
+	r, err := simpleblob.NewReader(ctx, e.st, name)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	defer r.Close()
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		_ = f.Close()
+		_ = os.Remove(file)
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return f.Close()
+}
+
+func runPut(ctx context.Context, e *env, args []string) error {
+	if len(args) != 2 {
+		return errUsage
+	}
+	name, file := args[0], args[1]
+	if file == "-" {
+		return pipeBlob(ctx, e.st, name, e.stdin)
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	return simpleblob.StoreReader(ctx, e.st, name, f, info.Size())
+}
+
+// pipeBlob streams r, of unknown size, to a blob. If r fails, the writer is
+// cancelled before being closed, so that no partial blob is stored.
+func pipeBlob(ctx context.Context, st simpleblob.Interface, name string, r io.Reader) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	w, err := simpleblob.NewWriter(ctx, st, name)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, r); err != nil {
+		cancel()
+		_ = w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+func runRemove(ctx context.Context, e *env, args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+	for _, name := range args {
+		if err := e.st.Delete(ctx, name); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func runStat(ctx context.Context, e *env, args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+	for i, name := range args {
+		info, err := simpleblob.Stat(ctx, e.st, name)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		if i > 0 {
+			fmt.Fprintln(e.stdout)
+		}
+		fmt.Fprintf(e.stdout, "name: %s\nsize: %d\n", info.Name, info.Size)
+		if !info.ModTime.IsZero() {
+			fmt.Fprintf(e.stdout, "modified: %s\n", info.ModTime.UTC().Format(time.RFC3339Nano))
+		}
+		if info.ETag != "" {
+			fmt.Fprintf(e.stdout, "etag: %s\n", info.ETag)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/PowerDNS/simpleblob"
+)
+
+// storageConfig is the configuration of a backend, in the format suggested
+// by the README.
+type storageConfig struct {
+	Type    string                 `yaml:"type"`
+	Options map[string]interface{} `yaml:"options"`
+}
+
+// loadConfig reads a storageConfig from a YAML file.
+func loadConfig(path string) (storageConfig, error) {
+	var cfg storageConfig
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, err
+	}
+	if err := yaml.UnmarshalStrict(data, &cfg); err != nil {
+		return cfg, fmt.Errorf("config %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// parseURL returns the storageConfig described by a URL like:
+//
+//	fs:///var/lib/blobs
+//	s3://bucket/global/prefix/?endpoint_url=http://localhost:9000
+//	memory:
+//
+// The scheme is the backend type. Query parameters are options, parsed as
+// YAML values, so that numbers and booleans get the right type.
+func parseURL(dsn string) (storageConfig, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return storageConfig{}, err
+	}
+	if u.Scheme == "" {
+		return storageConfig{}, fmt.Errorf("url %q: missing backend type", dsn)
+	}
+	cfg := storageConfig{
+		Type:    u.Scheme,
+		Options: make(map[string]interface{}),
+	}
+
+	switch cfg.Type {
+	case "fs":
+		root := u.Opaque // fs:relative/path
+		if root == "" {
+			root = u.Host + u.Path
+		}
+		if root != "" {
+			cfg.Options["root_path"] = root
+		}
+	case "s3":
+		if u.Host != "" {
+			cfg.Options["bucket"] = u.Host
+		}
+		if prefix := strings.TrimPrefix(u.Path, "/"); prefix != "" {
+			cfg.Options["global_prefix"] = prefix
+		}
+	default:
+		if u.Host != "" || u.Path != "" {
+			return storageConfig{}, fmt.Errorf("url %q: only query parameters are supported for type %s", dsn, cfg.Type)
+		}
+	}
+
+	// Values are kept as strings, and only parsed by the backend for
+	// options that are not strings, see simpleblob.OptionMap.Coerce.
+	for key, values := range u.Query() {
+		cfg.Options[key] = values[len(values)-1]
+	}
+	return cfg, nil
+}
+
+// mergeOptions adds the options of an inline YAML mapping to cfg.
+func (cfg *storageConfig) mergeOptions(inline string) error {
+	var opts map[string]interface{}
+	if err := yaml.Unmarshal([]byte(inline), &opts); err != nil {
+		return fmt.Errorf("options: %w", err)
+	}
+	if cfg.Options == nil {
+		cfg.Options = make(map[string]interface{})
+	}
+	for k, v := range opts {
+		cfg.Options[k] = v
+	}
+	return nil
+}
+
+// optionMap returns the options to pass to simpleblob.GetBackend.
+func (cfg storageConfig) optionMap() simpleblob.OptionMap {
+	return simpleblob.OptionMap(cfg.Options)
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+func init() {
+	commands["du"] = command{
+		usage: "[-depth n] [-h] [prefix]",
+		help:  "show the number and total size of blobs per folder, up to depth levels under prefix",
+		run:   runDiskUsage,
+	}
+}
+
+// usage is the number and total size of blobs in a folder.
+type usage struct {
+	count int
+	size  int64
+}
+
+// folderOf returns the folder a blob is counted in, which is the prefix
+// followed by at most depth levels of the rest of the name.
+func folderOf(prefix, name string, depth int) string {
+	rest := strings.TrimPrefix(name, prefix)
+	end := 0
+	for i := 0; i < depth; i++ {
+		slash := strings.IndexByte(rest[end:], '/')
+		if slash < 0 {
+			break
+		}
+		end += slash + 1
+	}
+	return prefix + rest[:end]
+}
+
+func runDiskUsage(ctx context.Context, e *env, args []string) error {
+	flags := flag.NewFlagSet("du", flag.ContinueOnError)
+	depth := flags.Int("depth", 1, "number of folder levels to show, 0 for the total only")
+	human := flags.Bool("h", false, "show sizes in human readable units")
+	if err := parseFlags(flags, e, args, 0, 1); err != nil {
+		return err
+	}
+	if *depth < 0 {
+		return errUsage
+	}
+	prefix := flags.Arg(0)
+	ls, err := e.st.List(ctx, prefix)
+	if err != nil {
+		return err
+	}
+
+	folders := make(map[string]*usage)
+	var total usage
+	for _, blob := range ls {
+		folder := folderOf(prefix, blob.Name, *depth)
+		u := folders[folder]
+		if u == nil {
+			u = &usage{}
+			folders[folder] = u
+		}
+		u.count++
+		u.size += blob.Size
+		total.count++
+		total.size += blob.Size
+	}
+
+	names := make([]string, 0, len(folders))
+	for name := range folders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	show := func(u usage, name string) {
+		size := fmt.Sprint(u.size)
+		if *human {
+			size = humanSize(u.size)
+		}
+		if name == "" {
+			name = "."
+		}
+		fmt.Fprintf(e.stdout, "%12s  %10d  %s\n", size, u.count, name)
+	}
+	if *depth > 0 {
+		for _, name := range names {
+			show(*folders[name], name)
+		}
+	}
+	show(total, "total")
+	return nil
+}
+
+// humanSize formats a number of bytes with a binary unit.
+func humanSize(n int64) string {
+	const units = "KMGTPE"
+	if n < 1024 {
+		return fmt.Sprintf("%dB", n)
+	}
+	f := float64(n)
+	i := -1
+	for f >= 1024 && i < len(units)-1 {
+		f /= 1024
+		i++
+	}
+	return fmt.Sprintf("%.1f%ciB", f, units[i])
+}
@@ -0,0 +1,139 @@
+// Command simpleblob inspects and modifies blobs in any simpleblob backend.
+//
+// Usage:
+//
+//	simpleblob [flags] <command> [arguments]
+//
+// The backend is configured with a YAML file in the format of the README
+// (-config), a URL like fs:///var/lib/blobs (-url), or a type (-type) with
+// inline YAML options (-options). Run simpleblob -h for the commands.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+
+	"github.com/PowerDNS/simpleblob"
+	_ "github.com/PowerDNS/simpleblob/backends/fs"
+	_ "github.com/PowerDNS/simpleblob/backends/memory"
+	_ "github.com/PowerDNS/simpleblob/backends/s3"
+	_ "github.com/PowerDNS/simpleblob/backends/tiered"
+)
+
+// env is what commands run with.
+type env struct {
+	st     simpleblob.Interface // nil for commands with noBackend
+	cfg    storageConfig
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+}
+
+// command is a subcommand of the CLI.
+type command struct {
+	usage string // arguments
+	help  string
+	run   func(ctx context.Context, e *env, args []string) error
+	// noBackend is set for commands that open the backend themselves
+	noBackend bool
+}
+
+// commands are the subcommands, by name.
+var commands = map[string]command{}
+
+// errUsage is returned for invalid arguments, after printing the usage.
+var errUsage = errors.New("invalid usage")
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	err := run(ctx, os.Args[1:], os.Stdin, os.Stdout, os.Stderr)
+	switch {
+	case errors.Is(err, errUsage), errors.Is(err, flag.ErrHelp):
+		os.Exit(2)
+	case err != nil:
+		fmt.Fprintf(os.Stderr, "simpleblob: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// run parses the arguments and runs a command.
+func run(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	flags := flag.NewFlagSet("simpleblob", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	configPath := flags.String("config", "", "YAML `file` with the backend type and options")
+	dsn := flags.String("url", os.Getenv("SIMPLEBLOB_URL"), "backend URL, like fs:///path or s3://bucket/prefix?endpoint_url=... (default $SIMPLEBLOB_URL)")
+	typeName := flags.String("type", "", "backend `type`, overriding the config")
+	options := flags.String("options", "", "inline YAML `mapping` of backend options, added to the config")
+	flags.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: simpleblob [flags] <command> [arguments]\n\nFlags:\n")
+		flags.PrintDefaults()
+		fmt.Fprintf(stderr, "\nCommands:\n")
+		names := make([]string, 0, len(commands))
+		for name := range commands {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			c := commands[name]
+			fmt.Fprintf(stderr, "  %s %s\n    \t%s\n", name, c.usage, c.help)
+		}
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return errUsage
+	}
+	name, args := flags.Arg(0), flags.Args()[1:]
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(stderr, "simpleblob: unknown command %q\n", name)
+		flags.Usage()
+		return errUsage
+	}
+
+	var cfg storageConfig
+	var err error
+	if *configPath != "" {
+		if cfg, err = loadConfig(*configPath); err != nil {
+			return err
+		}
+	}
+	if *dsn != "" {
+		if cfg, err = parseURL(*dsn); err != nil {
+			return err
+		}
+	}
+	if *typeName != "" {
+		cfg.Type = *typeName
+	}
+	if *options != "" {
+		if err := cfg.mergeOptions(*options); err != nil {
+			return err
+		}
+	}
+	if cfg.Type == "" {
+		return fmt.Errorf("no backend configured, use -config, -url or -type")
+	}
+
+	e := &env{cfg: cfg, stdin: stdin, stdout: stdout, stderr: stderr}
+	if !cmd.noBackend {
+		if e.st, err = simpleblob.GetBackend(ctx, cfg.Type, cfg.optionMap()); err != nil {
+			return err
+		}
+	}
+	err = cmd.run(ctx, e, args)
+	if errors.Is(err, errUsage) {
+		fmt.Fprintf(stderr, "Usage: simpleblob [flags] %s %s\n", name, cmd.usage)
+	}
+	return err
+}
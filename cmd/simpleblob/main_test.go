@@ -0,0 +1,324 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/PowerDNS/simpleblob"
+	"github.com/PowerDNS/simpleblob/backends/fs"
+	"github.com/PowerDNS/simpleblob/backends/memory"
+)
+
+// runCLI runs the CLI with the given arguments and returns its output.
+func runCLI(t *testing.T, stdin string, args ...string) (string, error) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	err := run(context.Background(), args, strings.NewReader(stdin), &stdout, &stderr)
+	return stdout.String(), err
+}
+
+func TestParseURL(t *testing.T) {
+	for _, tc := range []struct {
+		url      string
+		expected storageConfig
+	}{
+		{"fs:///var/lib/blobs", storageConfig{Type: "fs", Options: map[string]interface{}{"root_path": "/var/lib/blobs"}}},
+		{"fs:relative/dir", storageConfig{Type: "fs", Options: map[string]interface{}{"root_path": "relative/dir"}}},
+		{"s3://bucket/v1/?endpoint_url=http://localhost:9000&use_update_marker=true&secret_key=0123", storageConfig{Type: "s3", Options: map[string]interface{}{
+			"bucket":            "bucket",
+			"global_prefix":     "v1/",
+			"endpoint_url":      "http://localhost:9000",
+			"use_update_marker": "true",
+			"secret_key":        "0123",
+		}}},
+		{"memory:?max_objects=10", storageConfig{Type: "memory", Options: map[string]interface{}{"max_objects": "10"}}},
+	} {
+		cfg, err := parseURL(tc.url)
+		assert.NoError(t, err, tc.url)
+		assert.Equal(t, tc.expected, cfg, tc.url)
+	}
+
+	for _, bad := range []string{"no-scheme", "memory://host"} {
+		_, err := parseURL(bad)
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestRun(t *testing.T) {
+	root := t.TempDir()
+	dsn := "fs://" + root
+	file := filepath.Join(t.TempDir(), "file")
+	require.NoError(t, os.WriteFile(file, []byte("from file"), 0o644))
+
+	_, err := runCLI(t, "", "-url", dsn, "put", "dir/foo", file)
+	require.NoError(t, err)
+	_, err = runCLI(t, "from stdin", "-url", dsn, "put", "bar", "-")
+	require.NoError(t, err)
+
+	out, err := runCLI(t, "", "-url", dsn, "ls")
+	require.NoError(t, err)
+	assert.Equal(t, "bar\ndir/foo\n", out)
+	out, err = runCLI(t, "", "-url", dsn, "ls", "-l", "dir/")
+	require.NoError(t, err)
+	assert.Regexp(t, `^ +9  \S+  dir/foo\n$`, out)
+
+	out, err = runCLI(t, "", "-url", dsn, "cat", "bar", "dir/foo")
+	require.NoError(t, err)
+	assert.Equal(t, "from stdinfrom file", out)
+
+	dest := filepath.Join(t.TempDir(), "dest")
+	_, err = runCLI(t, "", "-url", dsn, "get", "bar", dest)
+	require.NoError(t, err)
+	data, err := os.ReadFile(dest)
+	require.NoError(t, err)
+	assert.Equal(t, "from stdin", string(data))
+
+	out, err = runCLI(t, "", "-type", "fs", "-options", "root_path: "+root, "stat", "dir/foo")
+	require.NoError(t, err)
+	assert.Contains(t, out, "name: dir/foo\nsize: 9\nmodified: ")
+
+	_, err = runCLI(t, "", "-url", dsn, "rm", "bar", "dir/foo")
+	require.NoError(t, err)
+	out, err = runCLI(t, "", "-url", dsn, "ls")
+	require.NoError(t, err)
+	assert.Empty(t, out)
+
+	_, err = runCLI(t, "", "-url", dsn, "cat", "missing")
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	_, err = runCLI(t, "", "-url", dsn, "put", "foo")
+	assert.ErrorIs(t, err, errUsage)
+	_, err = runCLI(t, "", "-url", dsn, "nope")
+	assert.ErrorIs(t, err, errUsage)
+	_, err = runCLI(t, "", "ls")
+	assert.Error(t, err)
+}
+
+func TestRun_config(t *testing.T) {
+	root := t.TempDir()
+	config := filepath.Join(t.TempDir(), "storage.yaml")
+	require.NoError(t, os.WriteFile(config, []byte("type: fs\noptions:\n  root_path: "+root+"\n"), 0o644))
+
+	_, err := runCLI(t, "foo", "-config", config, "put", "foo", "-")
+	require.NoError(t, err)
+	out, err := runCLI(t, "", "-config", config, "ls")
+	require.NoError(t, err)
+	assert.Equal(t, "foo\n", out)
+}
+
+func TestRun_sync(t *testing.T) {
+	src := "fs://" + t.TempDir()
+	dst := "fs://" + t.TempDir()
+	for name, data := range map[string]string{"a": "1", "dir/b": "22", "tmp/c": "3"} {
+		_, err := runCLI(t, data, "-url", src, "put", name, "-")
+		require.NoError(t, err)
+	}
+	_, err := runCLI(t, "old", "-url", dst, "put", "old", "-")
+	require.NoError(t, err)
+
+	out, err := runCLI(t, "", "-url", src, "sync", "-dry-run", "-delete", "-exclude", "tmp/", dst)
+	require.NoError(t, err)
+	assert.Contains(t, out, "would copy dir/b (2 bytes)\n")
+	assert.Contains(t, out, "would delete old\n")
+	out, err = runCLI(t, "", "-url", dst, "ls")
+	require.NoError(t, err)
+	assert.Equal(t, "old\n", out)
+
+	_, err = runCLI(t, "", "-url", src, "sync", "-delete", "-exclude", "tmp/", "-concurrency", "1", dst)
+	require.NoError(t, err)
+	out, err = runCLI(t, "", "-url", dst, "ls")
+	require.NoError(t, err)
+	assert.Equal(t, "a\ndir/b\n", out)
+
+	_, err = runCLI(t, "", "-url", src, "sync")
+	assert.ErrorIs(t, err, errUsage)
+}
+
+func TestRun_du(t *testing.T) {
+	dsn := "fs://" + t.TempDir()
+	for name, data := range map[string]string{"a": "1", "x/b": "22", "x/y/c": "333", "z/d": "4444"} {
+		_, err := runCLI(t, data, "-url", dsn, "put", name, "-")
+		require.NoError(t, err)
+	}
+
+	out, err := runCLI(t, "", "-url", dsn, "du")
+	require.NoError(t, err)
+	assert.Equal(t, ""+
+		"           1           1  .\n"+
+		"           5           2  x/\n"+
+		"           4           1  z/\n"+
+		"          10           4  total\n", out)
+
+	out, err = runCLI(t, "", "-url", dsn, "du", "-depth", "2", "x/")
+	require.NoError(t, err)
+	assert.Equal(t, ""+
+		"           2           1  x/\n"+
+		"           3           1  x/y/\n"+
+		"           5           2  total\n", out)
+
+	out, err = runCLI(t, "", "-url", dsn, "du", "-depth", "0", "-h")
+	require.NoError(t, err)
+	assert.Equal(t, "         10B           4  total\n", out)
+}
+
+func TestHumanSize(t *testing.T) {
+	assert.Equal(t, "1023B", humanSize(1023))
+	assert.Equal(t, "1.0KiB", humanSize(1024))
+	assert.Equal(t, "1.5MiB", humanSize(3<<19))
+	assert.Equal(t, "8.0EiB", humanSize(1<<63-1))
+}
+
+func TestPipeBlob(t *testing.T) {
+	ctx := context.Background()
+	for _, st := range []simpleblob.Interface{memory.New(), fsBackend(t)} {
+		large := strings.Repeat("x", 3<<20)
+		require.NoError(t, pipeBlob(ctx, st, "large", strings.NewReader(large)))
+		var out bytes.Buffer
+		require.NoError(t, copyBlob(ctx, st, "large", &out))
+		assert.Equal(t, len(large), out.Len())
+
+		// A failing input does not leave a partial blob
+		failing := io.MultiReader(strings.NewReader("partial"), iotest.ErrReader(io.ErrClosedPipe))
+		err := pipeBlob(ctx, st, "partial", failing)
+		assert.ErrorIs(t, err, io.ErrClosedPipe)
+		_, err = st.Load(ctx, "partial")
+		assert.ErrorIs(t, err, os.ErrNotExist)
+	}
+}
+
+func fsBackend(t *testing.T) simpleblob.Interface {
+	st, err := fs.New(fs.Options{RootPath: t.TempDir()})
+	require.NoError(t, err)
+	return st
+}
+
+func TestRun_checkConfig(t *testing.T) {
+	config := filepath.Join(t.TempDir(), "storage.yaml")
+	require.NoError(t, os.WriteFile(config, []byte("type: fs\noptions:\n  root_path: "+t.TempDir()+"\n"), 0o644))
+	out, err := runCLI(t, "", "-config", config, "check-config")
+	require.NoError(t, err)
+	assert.Regexp(t, `^type: fs\noptions: ok\nping: ok \(\S+\)\n$`, out)
+
+	out, err = runCLI(t, "", "-config", config, "-options", "root_pth: /tmp", "check-config", "-no-ping")
+	assert.ErrorIs(t, err, errCheckFailed)
+	assert.Contains(t, out, "options: FAILED\n")
+	assert.Contains(t, out, "hint: unknown option root_pth,")
+
+	out, err = runCLI(t, "", "-type", "nope", "check-config")
+	assert.ErrorIs(t, err, errCheckFailed)
+	assert.Contains(t, out, `storage.type "nope" not found`)
+}
+
+func TestParseSizeDist(t *testing.T) {
+	d, err := parseSizeDist("512,1KiB-2MB,3G")
+	require.NoError(t, err)
+	assert.Equal(t, sizeDist{{512, 512}, {1024, 2e6}, {3 << 30, 3 << 30}}, d)
+	assert.Equal(t, int64(3<<30), d.max())
+
+	for _, bad := range []string{"", "1X", "-1", "2K-1K", "1K-"} {
+		_, err := parseSizeDist(bad)
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestRun_bench(t *testing.T) {
+	dsn := "fs://" + t.TempDir()
+	_, err := runCLI(t, "keep", "-url", dsn, "put", "other", "-")
+	require.NoError(t, err)
+
+	out, err := runCLI(t, "", "-url", dsn, "bench", "-duration", "20ms", "-concurrency", "2", "-size", "1-1KiB")
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSuffix(out, "\n"), "\n")
+	require.Len(t, lines, 4, out)
+	assert.Regexp(t, `^op +count +ops/s +MiB/s +p50 +p90 +p99 +max$`, lines[0])
+	for i, op := range []string{"write", "read", "list"} {
+		assert.Regexp(t, `^`+op+` +[1-9]\d* `, lines[i+1])
+	}
+
+	// The written blobs are deleted
+	out, err = runCLI(t, "", "-url", dsn, "ls")
+	require.NoError(t, err)
+	assert.Equal(t, "other\n", out)
+
+	_, err = runCLI(t, "", "-url", dsn, "bench", "-ops", "read", "-duration", "10ms")
+	assert.ErrorContains(t, err, "no blobs to read")
+	_, err = runCLI(t, "", "-url", dsn, "bench", "-ops", "scan")
+	assert.ErrorContains(t, err, `unknown workload "scan"`)
+}
+
+func TestBlobHandler(t *testing.T) {
+	st := memory.New()
+	require.NoError(t, st.Store(context.Background(), "dir/page.html", []byte("<p>hi</p>")))
+	readOnly := httptest.NewServer(&blobHandler{st: st})
+	defer readOnly.Close()
+	readWrite := httptest.NewServer(&blobHandler{st: st, token: "secret"})
+	defer readWrite.Close()
+
+	do := func(method, url, token, body string) (int, string) {
+		t.Helper()
+		req, err := http.NewRequest(method, url, strings.NewReader(body))
+		require.NoError(t, err)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		data, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp.StatusCode, string(data)
+	}
+
+	code, body := do("GET", readOnly.URL+"/dir/page.html", "", "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "<p>hi</p>", body)
+	resp, err := http.Get(readOnly.URL + "/dir/page.html")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, "text/html; charset=utf-8", resp.Header.Get("Content-Type"))
+	assert.Equal(t, "9", resp.Header.Get("Content-Length"))
+
+	code, _ = do("GET", readOnly.URL+"/missing", "", "")
+	assert.Equal(t, http.StatusNotFound, code)
+	code, _ = do("PUT", readOnly.URL+"/new", "secret", "data")
+	assert.Equal(t, http.StatusMethodNotAllowed, code)
+
+	code, _ = do("PUT", readWrite.URL+"/new", "", "data")
+	assert.Equal(t, http.StatusUnauthorized, code)
+	code, _ = do("PUT", readWrite.URL+"/new", "wrong", "data")
+	assert.Equal(t, http.StatusUnauthorized, code)
+	code, _ = do("PUT", readWrite.URL+"/new", "secret", "data")
+	assert.Equal(t, http.StatusNoContent, code)
+
+	code, body = do("GET", readOnly.URL+"/", "", "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "dir/page.html\nnew\n", body)
+	code, body = do("GET", readOnly.URL+"/dir/", "", "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "dir/page.html\n", body)
+
+	code, _ = do("DELETE", readWrite.URL+"/new", "secret", "")
+	assert.Equal(t, http.StatusNoContent, code)
+	code, _ = do("GET", readOnly.URL+"/new", "", "")
+	assert.Equal(t, http.StatusNotFound, code)
+}
+
+func TestRun_serveToken(t *testing.T) {
+	// The usage printed for a bad flag does not leak the token
+	t.Setenv("SIMPLEBLOB_TOKEN", "s3cret")
+	var stdout, stderr bytes.Buffer
+	err := run(context.Background(), []string{"-url", "memory:", "serve", "-bogus"}, strings.NewReader(""), &stdout, &stderr)
+	assert.Error(t, err)
+	assert.Contains(t, stderr.String(), "-token")
+	assert.NotContains(t, stderr.String(), "s3cret")
+}
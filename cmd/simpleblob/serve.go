@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PowerDNS/simpleblob"
+)
+
+func init() {
+	commands["serve"] = command{
+		usage: "[-listen address] [-token token]",
+		help:  "serve the blobs over HTTP, read-only unless a token is set for writes",
+		run:   runServe,
+	}
+}
+
+// blobHandler serves a backend over HTTP:
+//
+//	GET /name      returns the blob
+//	GET /prefix/   lists the blobs under prefix, one per line
+//	HEAD /name     returns the headers of GET
+//	PUT /name      stores the request body, if token is set
+//	DELETE /name   deletes the blob, if token is set
+//
+// Writes require an "Authorization: Bearer <token>" header.
+type blobHandler struct {
+	st    simpleblob.Interface
+	token string // writes are disabled if empty
+}
+
+func (h *blobHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/")
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		if name == "" || strings.HasSuffix(name, "/") {
+			h.list(w, r, name)
+		} else {
+			h.get(w, r, name)
+		}
+	case http.MethodPut, http.MethodDelete:
+		if h.token == "" {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "read-only", http.StatusMethodNotAllowed)
+			return
+		}
+		if !h.authorized(r) {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "invalid token", http.StatusUnauthorized)
+			return
+		}
+		if name == "" || strings.HasSuffix(name, "/") {
+			http.Error(w, "missing blob name", http.StatusBadRequest)
+			return
+		}
+		var err error
+		if r.Method == http.MethodPut {
+			err = pipeBlob(r.Context(), h.st, name, r.Body)
+		} else {
+			err = h.st.Delete(r.Context(), name)
+		}
+		if err != nil {
+			httpError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Allow", "GET, HEAD, PUT, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *blobHandler) authorized(r *http.Request) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(token), []byte(h.token)) == 1
+}
+
+func (h *blobHandler) list(w http.ResponseWriter, r *http.Request, prefix string) {
+	ls, err := h.st.List(r.Context(), prefix)
+	if err != nil {
+		httpError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if r.Method == http.MethodHead {
+		return
+	}
+	for _, name := range ls.Names() {
+		fmt.Fprintln(w, name)
+	}
+}
+
+func (h *blobHandler) get(w http.ResponseWriter, r *http.Request, name string) {
+	// Stat is only used if cheap, as the fallback loads the blob
+	if _, ok := h.st.(simpleblob.Statter); ok {
+		info, err := simpleblob.Stat(r.Context(), h.st, name)
+		if err != nil {
+			httpError(w, err)
+			return
+		}
+		w.Header().Set("Content-Length", strconv.FormatInt(info.Size, 10))
+		if !info.ModTime.IsZero() {
+			w.Header().Set("Last-Modified", info.ModTime.UTC().Format(http.TimeFormat))
+		}
+		if info.ETag != "" {
+			w.Header().Set("ETag", strconv.Quote(strings.Trim(info.ETag, `"`)))
+		}
+	}
+	contentType := mime.TypeByExtension(path.Ext(name))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", contentType)
+	if r.Method == http.MethodHead {
+		return
+	}
+	rd, err := simpleblob.NewReader(r.Context(), h.st, name)
+	if err != nil {
+		httpError(w, err)
+		return
+	}
+	defer rd.Close()
+	_, _ = io.Copy(w, rd) // too late to report an error
+}
+
+// httpError replies with the status matching a backend error.
+func httpError(w http.ResponseWriter, err error) {
+	// Headers set for a successful response do not apply
+	w.Header().Del("Content-Length")
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		http.Error(w, "not found", http.StatusNotFound)
+	case errors.Is(err, os.ErrPermission):
+		http.Error(w, "forbidden", http.StatusForbidden)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func runServe(ctx context.Context, e *env, args []string) error {
+	flags := flag.NewFlagSet("serve", flag.ContinueOnError)
+	listen := flags.String("listen", ":8080", "`address` to listen on")
+	token := flags.String("token", "", "bearer token allowing PUT and DELETE requests (default $SIMPLEBLOB_TOKEN)")
+	if err := parseFlags(flags, e, args, 0, 0); err != nil {
+		return err
+	}
+	// Not a flag default, which would print the secret in the usage
+	if *token == "" {
+		*token = os.Getenv("SIMPLEBLOB_TOKEN")
+	}
+
+	ln, err := net.Listen("tcp", *listen)
+	if err != nil {
+		return err
+	}
+	srv := &http.Server{
+		Handler:           &blobHandler{st: e.st, token: *token},
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	mode := "read-only"
+	if *token != "" {
+		mode = "read-write"
+	}
+	fmt.Fprintf(e.stderr, "serving %s on http://%s (%s)\n", e.cfg.Type, ln.Addr(), mode)
+
+	stopped := make(chan error, 1)
+	go func() {
+		<-ctx.Done()
+		sctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+		defer cancel()
+		stopped <- srv.Shutdown(sctx)
+	}()
+	if err := srv.Serve(ln); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return <-stopped
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/PowerDNS/simpleblob"
+	blobsync "github.com/PowerDNS/simpleblob/sync"
+)
+
+func init() {
+	commands["sync"] = command{
+		usage: "[-include prefix]... [-exclude prefix]... [-hash] [-delete] [-concurrency n] [-dry-run] {dest-url | -dest-config file}",
+		help:  "copy the blobs missing or different in the destination backend",
+		run:   runSync,
+	}
+}
+
+// prefixList is a flag that can be repeated.
+type prefixList []string
+
+func (l *prefixList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *prefixList) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
+
+func runSync(ctx context.Context, e *env, args []string) error {
+	flags := flag.NewFlagSet("sync", flag.ContinueOnError)
+	var opt blobsync.Options
+	flags.Var((*prefixList)(&opt.Include), "include", "only sync blobs with this `prefix`, can be repeated")
+	flags.Var((*prefixList)(&opt.Exclude), "exclude", "skip blobs with this `prefix`, can be repeated")
+	hash := flags.Bool("hash", false, "compare the content of blobs of the same size")
+	flags.BoolVar(&opt.Delete, "delete", false, "delete the destination blobs missing in the source")
+	flags.IntVar(&opt.Concurrency, "concurrency", blobsync.DefaultConcurrency, "number of blobs copied in parallel")
+	flags.BoolVar(&opt.DryRun, "dry-run", false, "only show what would be done")
+	destConfig := flags.String("dest-config", "", "YAML `file` with the destination backend type and options")
+	if err := parseFlags(flags, e, args, 0, 1); err != nil {
+		return err
+	}
+	if (flags.NArg() == 1) == (*destConfig != "") {
+		return errUsage
+	}
+	if *hash {
+		opt.Compare = blobsync.CompareHash
+	}
+
+	var cfg storageConfig
+	var err error
+	if *destConfig != "" {
+		cfg, err = loadConfig(*destConfig)
+	} else {
+		cfg, err = parseURL(flags.Arg(0))
+	}
+	if err != nil {
+		return err
+	}
+	dst, err := simpleblob.GetBackend(ctx, cfg.Type, cfg.optionMap())
+	if err != nil {
+		return fmt.Errorf("destination: %w", err)
+	}
+
+	prefix := ""
+	if opt.DryRun {
+		prefix = "would "
+	}
+	var mu sync.Mutex
+	opt.OnAction = func(a blobsync.Action) {
+		mu.Lock()
+		defer mu.Unlock()
+		if a.Op == "copy" {
+			fmt.Fprintf(e.stdout, "%scopy %s (%d bytes)\n", prefix, a.Name, a.Size)
+		} else {
+			fmt.Fprintf(e.stdout, "%s%s %s\n", prefix, a.Op, a.Name)
+		}
+	}
+	res, err := blobsync.Sync(ctx, e.st, dst, opt)
+	fmt.Fprintf(e.stderr, "%d copied (%d bytes), %d deleted, %d unchanged\n",
+		res.Copied, res.Bytes, res.Deleted, res.Unchanged)
+	return err
+}
@@ -0,0 +1,25 @@
+package simpleblob
+
+import "context"
+
+// A Copier is an Interface providing an optimized way to copy a blob,
+// without transferring its content through the client.
+type Copier interface {
+	Interface
+	// Copy copies the blob named src to dst, replacing dst if it exists.
+	Copy(ctx context.Context, src, dst string) error
+}
+
+// Copy copies the blob named src to dst in st.
+// It uses the Copy method if available, else it loads src and stores it
+// as dst.
+func Copy(ctx context.Context, st Interface, src, dst string) error {
+	if c, ok := st.(Copier); ok {
+		return c.Copy(ctx, src, dst)
+	}
+	data, err := st.Load(ctx, src)
+	if err != nil {
+		return err
+	}
+	return st.Store(ctx, dst, data)
+}
@@ -0,0 +1,26 @@
+package simpleblob_test
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/PowerDNS/simpleblob"
+	"github.com/PowerDNS/simpleblob/backends/memory"
+)
+
+func TestCopy(t *testing.T) {
+	ctx := context.Background()
+	st := memory.New()
+	assert.NoError(t, st.Store(ctx, "foo", []byte("bar")))
+
+	assert.NoError(t, simpleblob.Copy(ctx, st, "foo", "copy"))
+	data, err := st.Load(ctx, "copy")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("bar"), data)
+
+	err = simpleblob.Copy(ctx, st, "missing", "copy")
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
@@ -0,0 +1,25 @@
+package simpleblob
+
+import "context"
+
+// Metadata holds optional information stored along with a blob.
+type Metadata struct {
+	// ContentType is the MIME type of the content.
+	ContentType string `json:"content_type,omitempty"`
+	// Checksum is a checksum of the content, in a format chosen by the
+	// caller, like "sha256:<hex>". Backends store it as is.
+	Checksum string `json:"checksum,omitempty"`
+	// User holds arbitrary user metadata.
+	User map[string]string `json:"user,omitempty"`
+}
+
+// A MetadataStorer is an Interface able to store Metadata along with blobs.
+type MetadataStorer interface {
+	Interface
+	// StoreWithMetadata is like Store, but also stores md for the blob.
+	StoreWithMetadata(ctx context.Context, name string, data []byte, md Metadata) error
+	// LoadMetadata returns the metadata of the named blob, or an error
+	// wrapping os.ErrNotExist if the blob does not exist. The metadata is
+	// empty if the blob was last stored without it.
+	LoadMetadata(ctx context.Context, name string) (Metadata, error)
+}
@@ -0,0 +1,87 @@
+package simpleblob
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+// MaxNameLength is the maximum length of a blob name in bytes, which is
+// the limit imposed by S3.
+const MaxNameLength = 1024
+
+// NameError is returned for blob names that are not valid.
+type NameError struct {
+	Name   string
+	Reason string
+}
+
+func (e *NameError) Error() string {
+	return fmt.Sprintf("invalid blob name %q: %s", e.Name, e.Reason)
+}
+
+// Unwrap allows checking for os.ErrInvalid with errors.Is.
+func (e *NameError) Unwrap() error {
+	return os.ErrInvalid
+}
+
+// CheckName returns a *NameError if name cannot be used portably across
+// backends. A valid name:
+//   - is not empty and at most MaxNameLength bytes long,
+//   - is valid UTF-8 without control characters,
+//   - does not start with '/',
+//   - does not contain empty, "." or ".." path segments when split on '/'.
+//
+// Backends may impose additional restrictions.
+func CheckName(name string) error {
+	reason := checkName(name)
+	if reason == "" {
+		return nil
+	}
+	return &NameError{Name: name, Reason: reason}
+}
+
+func checkName(name string) string {
+	if name == "" {
+		return "empty name"
+	}
+	if len(name) > MaxNameLength {
+		return fmt.Sprintf("longer than %d bytes", MaxNameLength)
+	}
+	if !utf8.ValidString(name) {
+		return "invalid UTF-8"
+	}
+	for _, r := range name {
+		if r < 0x20 || r == 0x7f {
+			return "contains control characters"
+		}
+	}
+	if strings.HasPrefix(name, "/") {
+		return "starts with '/'"
+	}
+	for _, seg := range strings.Split(name, "/") {
+		switch seg {
+		case "":
+			return "contains an empty path segment"
+		case ".", "..":
+			return fmt.Sprintf("contains a %q path segment", seg)
+		}
+	}
+	return ""
+}
+
+// CheckPrefix returns a *NameError if prefix cannot be used portably as a
+// prefix of blob names, like the GlobalPrefix option of some backends.
+// An empty prefix is valid, and a trailing '/' is allowed. Otherwise the
+// rules of CheckName apply.
+func CheckPrefix(prefix string) error {
+	if prefix == "" {
+		return nil
+	}
+	reason := checkName(strings.TrimSuffix(prefix, "/"))
+	if reason == "" {
+		return nil
+	}
+	return &NameError{Name: prefix, Reason: reason}
+}
@@ -0,0 +1,49 @@
+package simpleblob
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckName(t *testing.T) {
+	for _, name := range []string{
+		"foo",
+		"foo/bar-3",
+		".hidden",
+		"with space+plus%percent",
+		"ünïcödé/日本",
+		strings.Repeat("a", MaxNameLength),
+	} {
+		assert.NoError(t, CheckName(name), name)
+	}
+
+	for _, name := range []string{
+		"",
+		strings.Repeat("a", MaxNameLength+1),
+		"\xff",
+		"new\nline",
+		"/absolute",
+		"trailing/",
+		"double//slash",
+		"../escape",
+		"foo/./bar",
+	} {
+		err := CheckName(name)
+		var nameErr *NameError
+		assert.True(t, errors.As(err, &nameErr), "%q", name)
+		assert.ErrorIs(t, err, os.ErrInvalid)
+	}
+}
+
+func TestCheckPrefix(t *testing.T) {
+	for _, prefix := range []string{"", "foo", "foo/", "foo/bar/"} {
+		assert.NoError(t, CheckPrefix(prefix), prefix)
+	}
+	for _, prefix := range []string{"/", "/foo/", "foo//", "../foo/", "foo/../"} {
+		assert.ErrorIs(t, CheckPrefix(prefix), os.ErrInvalid, prefix)
+	}
+}
@@ -0,0 +1,33 @@
+package simpleblob
+
+import (
+	"context"
+	"errors"
+	"os"
+)
+
+// PingName is the blob name loaded by Ping for backends that do not
+// implement Pinger. The blob does not need to exist.
+const PingName = "simpleblob-ping"
+
+// A Pinger is an Interface providing a cheap way to check that the
+// underlying storage is reachable.
+type Pinger interface {
+	Interface
+	// Ping returns an error if the storage cannot be reached.
+	Ping(ctx context.Context) error
+}
+
+// Ping checks that st is reachable.
+// It uses the Ping method if available, else it loads PingName and
+// considers a missing blob a success.
+func Ping(ctx context.Context, st Interface) error {
+	if p, ok := st.(Pinger); ok {
+		return p.Ping(ctx)
+	}
+	_, err := st.Load(ctx, PingName)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
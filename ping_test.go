@@ -0,0 +1,19 @@
+package simpleblob_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/PowerDNS/simpleblob"
+	"github.com/PowerDNS/simpleblob/backends/memory"
+)
+
+func TestPing(t *testing.T) {
+	ctx := context.Background()
+	st := memory.New()
+	assert.NoError(t, simpleblob.Ping(ctx, st))
+	assert.NoError(t, st.Store(ctx, simpleblob.PingName, []byte("pong")))
+	assert.NoError(t, simpleblob.Ping(ctx, st))
+}
@@ -3,6 +3,8 @@ package simpleblob
 import (
 	"context"
 	"fmt"
+	"reflect"
+	"strings"
 	"sync"
 
 	"github.com/go-logr/logr"
@@ -45,7 +47,7 @@ type OptionMap map[string]interface{}
 // dest: pointer to destination struct
 func (ip InitParams) OptionsThroughYAML(dest interface{}) error {
 	// YAML roundtrip to get the options in a nice struct
-	y, err := yaml.Marshal(ip.OptionMap)
+	y, err := yaml.Marshal(ip.OptionMap.Coerce(dest))
 	if err != nil {
 		return err
 	}
@@ -55,6 +57,42 @@ func (ip InitParams) OptionsThroughYAML(dest interface{}) error {
 	return nil
 }
 
+// Coerce returns a copy of m where the string values of the options loaded
+// into fields of dest that are not strings are parsed as YAML, like values
+// read from a YAML file. This allows options given as text, like URL query
+// parameters, to set numbers and booleans, while strings are never
+// reinterpreted.
+// dest: pointer to destination struct
+func (m OptionMap) Coerce(dest interface{}) OptionMap {
+	t := reflect.TypeOf(dest)
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return m
+	}
+	res := make(OptionMap, len(m))
+	for k, v := range m {
+		res[k] = v
+	}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		key, _, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+		if key == "" {
+			key = strings.ToLower(f.Name) // like yaml.v2
+		}
+		s, ok := m[key].(string)
+		if !ok || f.Type.Kind() == reflect.String {
+			continue
+		}
+		var value interface{}
+		if err := yaml.Unmarshal([]byte(s), &value); err == nil && value != nil {
+			res[key] = value
+		}
+	}
+	return res
+}
+
 // Param is the type of extra init parameters. It is returned by
 // calling functional params like WithLogger.
 type Param func(ip *InitParams)
@@ -0,0 +1,35 @@
+package simpleblob
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOptionsThroughYAML(t *testing.T) {
+	var opt struct {
+		Key      string        `yaml:"key"`
+		Max      int           `yaml:"max"`
+		Enabled  bool          `yaml:"enabled"`
+		Interval time.Duration `yaml:"interval"`
+		Names    []string      `yaml:"names"`
+	}
+	// As given in a URL query
+	p := InitParams{OptionMap: OptionMap{
+		"key":      "0123",
+		"max":      "10",
+		"enabled":  "yes",
+		"interval": "1m",
+		"names":    "[a, b]",
+	}}
+	assert.NoError(t, p.OptionsThroughYAML(&opt))
+	assert.Equal(t, "0123", opt.Key)
+	assert.Equal(t, 10, opt.Max)
+	assert.True(t, opt.Enabled)
+	assert.Equal(t, time.Minute, opt.Interval)
+	assert.Equal(t, []string{"a", "b"}, opt.Names)
+
+	p.OptionMap["max"] = "many"
+	assert.Error(t, p.OptionsThroughYAML(&opt))
+}
@@ -0,0 +1,89 @@
+package simpleblob
+
+import (
+	"context"
+	"io"
+	"strings"
+)
+
+// WithPrefix returns an Interface that scopes all operations on st under
+// prefix. Names passed to and returned by it do not contain the prefix.
+//
+// Unlike the GlobalPrefix option of some backends, this works with any
+// backend. Note that the prefix is used as is, so a trailing '/' must be
+// included if the prefix represents a folder.
+func WithPrefix(st Interface, prefix string) Interface {
+	if prefix == "" {
+		return st
+	}
+	return &prefixed{st: st, prefix: prefix}
+}
+
+// prefixed is the Interface returned by WithPrefix.
+type prefixed struct {
+	st     Interface
+	prefix string
+}
+
+func (p *prefixed) List(ctx context.Context, prefix string) (BlobList, error) {
+	blobs, err := p.st.List(ctx, p.prefix+prefix)
+	if err != nil {
+		return nil, err
+	}
+	var stripped BlobList
+	for _, b := range blobs {
+		// Trust but verify: the prefix may have been ignored by the backend
+		name, ok := strings.CutPrefix(b.Name, p.prefix)
+		if !ok {
+			continue
+		}
+		b.Name = name
+		stripped = append(stripped, b)
+	}
+	return stripped, nil
+}
+
+func (p *prefixed) Load(ctx context.Context, name string) ([]byte, error) {
+	return p.st.Load(ctx, p.prefix+name)
+}
+
+func (p *prefixed) Store(ctx context.Context, name string, data []byte) error {
+	return p.st.Store(ctx, p.prefix+name, data)
+}
+
+func (p *prefixed) Delete(ctx context.Context, name string) error {
+	return p.st.Delete(ctx, p.prefix+name)
+}
+
+func (p *prefixed) NewReader(ctx context.Context, name string) (io.ReadCloser, error) {
+	return NewReader(ctx, p.st, p.prefix+name)
+}
+
+func (p *prefixed) NewWriter(ctx context.Context, name string) (io.WriteCloser, error) {
+	return NewWriter(ctx, p.st, p.prefix+name)
+}
+
+func (p *prefixed) Ping(ctx context.Context) error {
+	return Ping(ctx, p.st)
+}
+
+func (p *prefixed) Stat(ctx context.Context, name string) (BlobInfo, error) {
+	info, err := Stat(ctx, p.st, p.prefix+name)
+	if err != nil {
+		return BlobInfo{}, err
+	}
+	info.Name = name
+	return info, nil
+}
+
+func (p *prefixed) StoreReader(ctx context.Context, name string, r io.Reader, size int64) error {
+	return StoreReader(ctx, p.st, p.prefix+name, r, size)
+}
+
+func (p *prefixed) StoreIfAbsent(ctx context.Context, name string, data []byte) error {
+	return StoreIfAbsent(ctx, p.st, p.prefix+name, data)
+}
+
+func (p *prefixed) Copy(ctx context.Context, src, dst string) error {
+	return Copy(ctx, p.st, p.prefix+src, p.prefix+dst)
+}
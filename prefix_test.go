@@ -0,0 +1,26 @@
+package simpleblob_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/PowerDNS/simpleblob"
+	"github.com/PowerDNS/simpleblob/backends/memory"
+	"github.com/PowerDNS/simpleblob/tester"
+)
+
+func TestWithPrefix(t *testing.T) {
+	ctx := context.Background()
+	st := memory.New()
+	assert.NoError(t, st.Store(ctx, "outside", []byte("x")))
+
+	p := simpleblob.WithPrefix(st, "v1/")
+	tester.DoBackendTests(t, p)
+
+	assert.NoError(t, p.Store(ctx, "inside", []byte("y")))
+	ls, err := st.List(ctx, "")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"outside", "v1/bar-1", "v1/bar-2", "v1/fizz", "v1/inside"}, ls.Names())
+}
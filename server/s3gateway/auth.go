@@ -0,0 +1,252 @@
+package s3gateway
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Signature Version 4, see
+// https://docs.aws.amazon.com/AmazonS3/latest/API/sig-v4-authenticating-requests.html
+const (
+	signAlgorithm    = "AWS4-HMAC-SHA256"
+	chunkAlgorithm   = "AWS4-HMAC-SHA256-PAYLOAD"
+	amzDateFormat    = "20060102T150405Z"
+	scopeDateFormat  = "20060102"
+	service          = "s3"
+	scopeTerminator  = "aws4_request"
+	emptySHA256      = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	maxClockSkew     = 15 * time.Minute
+	maxPresignExpiry = 7 * 24 * time.Hour
+)
+
+// Values of the X-Amz-Content-Sha256 header besides the hex encoded hash.
+const (
+	unsignedPayload          = "UNSIGNED-PAYLOAD"
+	streamingPayload         = "STREAMING-AWS4-HMAC-SHA256-PAYLOAD"
+	streamingUnsignedTrailer = "STREAMING-UNSIGNED-PAYLOAD-TRAILER"
+)
+
+// signer holds what is needed to check the signatures of a request, and of
+// the chunks of its payload.
+type signer struct {
+	key       []byte    // derived from the secret key and the scope
+	time      time.Time // of the request
+	scope     string    // date/region/s3/aws4_request
+	signature string    // of the request, seed of the chunk signatures
+}
+
+// credential is the parsed Credential of an Authorization header or of a
+// presigned URL, like AKID/20240101/us-east-1/s3/aws4_request.
+type credential struct {
+	accessKey string
+	date      string
+	region    string
+}
+
+func parseCredential(s string) (credential, bool) {
+	parts := strings.Split(s, "/")
+	if len(parts) != 5 || parts[3] != service || parts[4] != scopeTerminator {
+		return credential{}, false
+	}
+	return credential{accessKey: parts[0], date: parts[1], region: parts[2]}, true
+}
+
+func (c credential) scope() string {
+	return strings.Join([]string{c.date, c.region, service, scopeTerminator}, "/")
+}
+
+// authenticate checks the signature of a request, from its Authorization
+// header or its query for presigned URLs. It returns the signer for chunked
+// payloads.
+func (g *Gateway) authenticate(r *http.Request) (*signer, *s3Error) {
+	var (
+		cred          credential
+		signedHeaders []string
+		signature     string
+		amzDate       string
+		expires       time.Duration
+		ok            bool
+	)
+	query := r.URL.Query()
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		params, found := strings.CutPrefix(auth, signAlgorithm+" ")
+		if !found {
+			return nil, errAuthorizationHeaderMalformed
+		}
+		for _, param := range strings.Split(params, ",") {
+			key, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+			switch key {
+			case "Credential":
+				cred, ok = parseCredential(value)
+				if !ok {
+					return nil, errAuthorizationHeaderMalformed
+				}
+			case "SignedHeaders":
+				signedHeaders = strings.Split(value, ";")
+			case "Signature":
+				signature = value
+			}
+		}
+		amzDate = r.Header.Get("X-Amz-Date")
+	} else if query.Has("X-Amz-Signature") {
+		if query.Get("X-Amz-Algorithm") != signAlgorithm {
+			return nil, errAuthorizationQueryParametersError
+		}
+		cred, ok = parseCredential(query.Get("X-Amz-Credential"))
+		if !ok {
+			return nil, errAuthorizationQueryParametersError
+		}
+		signedHeaders = strings.Split(query.Get("X-Amz-SignedHeaders"), ";")
+		signature = query.Get("X-Amz-Signature")
+		amzDate = query.Get("X-Amz-Date")
+		seconds, err := strconv.Atoi(query.Get("X-Amz-Expires"))
+		if err != nil || seconds < 0 || time.Duration(seconds)*time.Second > maxPresignExpiry {
+			return nil, errAuthorizationQueryParametersError
+		}
+		expires = time.Duration(seconds) * time.Second
+	} else {
+		return nil, errAccessDenied
+	}
+	if cred.accessKey == "" || len(signedHeaders) == 0 || signature == "" {
+		return nil, errAuthorizationHeaderMalformed
+	}
+	if cred.accessKey != g.opt.AccessKey {
+		return nil, errInvalidAccessKeyID
+	}
+	if cred.region != g.opt.Region {
+		return nil, errAuthorizationHeaderMalformed
+	}
+
+	t, err := time.Parse(amzDateFormat, amzDate)
+	if err != nil || t.Format(scopeDateFormat) != cred.date {
+		return nil, errAccessDenied
+	}
+	now := g.now()
+	if expires > 0 {
+		if now.Before(t.Add(-maxClockSkew)) || now.After(t.Add(expires)) {
+			return nil, errAccessDenied
+		}
+	} else if d := now.Sub(t); d > maxClockSkew || d < -maxClockSkew {
+		return nil, errRequestTimeTooSkewed
+	}
+
+	payloadHash := unsignedPayload
+	if expires == 0 {
+		payloadHash = r.Header.Get("X-Amz-Content-Sha256")
+	}
+	s := &signer{
+		key:       signingKey(g.opt.SecretKey, cred),
+		time:      t,
+		scope:     cred.scope(),
+		signature: signature,
+	}
+	stringToSign := strings.Join([]string{
+		signAlgorithm,
+		amzDate,
+		s.scope,
+		sha256Hex([]byte(canonicalRequest(r, signedHeaders, payloadHash))),
+	}, "\n")
+	if !hmac.Equal([]byte(hex.EncodeToString(hmacSHA256(s.key, stringToSign))), []byte(signature)) {
+		return nil, errSignatureDoesNotMatch
+	}
+	return s, nil
+}
+
+// chunkSignature returns the expected signature of a chunk of a streaming
+// payload.
+func (s *signer) chunkSignature(prevSignature string, data []byte) string {
+	stringToSign := strings.Join([]string{
+		chunkAlgorithm,
+		s.time.Format(amzDateFormat),
+		s.scope,
+		prevSignature,
+		emptySHA256,
+		sha256Hex(data),
+	}, "\n")
+	return hex.EncodeToString(hmacSHA256(s.key, stringToSign))
+}
+
+func signingKey(secret string, cred credential) []byte {
+	key := hmacSHA256([]byte("AWS4"+secret), cred.date)
+	key = hmacSHA256(key, cred.region)
+	key = hmacSHA256(key, service)
+	return hmacSHA256(key, scopeTerminator)
+}
+
+// canonicalRequest returns the canonical form of r that is signed.
+func canonicalRequest(r *http.Request, signedHeaders []string, payloadHash string) string {
+	var query []string
+	for key, values := range r.URL.Query() {
+		if key == "X-Amz-Signature" {
+			continue
+		}
+		for _, value := range values {
+			query = append(query, uriEncode(key, true)+"="+uriEncode(value, true))
+		}
+	}
+	sort.Strings(query)
+
+	var headers strings.Builder
+	for _, name := range signedHeaders {
+		var value string
+		switch name {
+		case "host":
+			value = r.Host
+		case "content-length":
+			value = strconv.FormatInt(r.ContentLength, 10)
+		default:
+			var values []string
+			for _, v := range r.Header.Values(name) {
+				values = append(values, strings.Join(strings.Fields(v), " "))
+			}
+			value = strings.Join(values, ",")
+		}
+		headers.WriteString(name + ":" + value + "\n")
+	}
+
+	return strings.Join([]string{
+		r.Method,
+		uriEncode(r.URL.Path, false),
+		strings.Join(query, "&"),
+		headers.String(),
+		strings.Join(signedHeaders, ";"),
+		payloadHash,
+	}, "\n")
+}
+
+// uriEncode encodes s like AWS does: all bytes but the unreserved
+// characters are percent encoded, and slashes too if encodeSlash is set.
+func uriEncode(s string, encodeSlash bool) string {
+	const hexDigits = "0123456789ABCDEF"
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~', c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			b.WriteByte('%')
+			b.WriteByte(hexDigits[c>>4])
+			b.WriteByte(hexDigits[c&15])
+		}
+	}
+	return b.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,135 @@
+package s3gateway
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// maxKeys is the default and maximum number of keys returned in a list.
+const maxKeys = 1000
+
+// listParams are the query parameters of both versions of ListObjects.
+var listParams = map[string]bool{
+	"list-type": true, "prefix": true, "delimiter": true, "max-keys": true,
+	"encoding-type": true, "marker": true, "continuation-token": true,
+	"start-after": true, "fetch-owner": true, "x-id": true,
+}
+
+// isListQuery returns whether a query on a bucket is a ListObjects.
+func isListQuery(query url.Values) bool {
+	for key := range query {
+		if !listParams[key] {
+			return false
+		}
+	}
+	return true
+}
+
+func (g *Gateway) listObjects(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	v2 := query.Get("list-type") == "2"
+	prefix := query.Get("prefix")
+	delimiter := query.Get("delimiter")
+	limit := maxKeys
+	if s := query.Get("max-keys"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			g.writeError(w, r, errInvalidArgument)
+			return
+		}
+		limit = min(n, maxKeys)
+	}
+	encode := func(s string) string { return s }
+	switch query.Get("encoding-type") {
+	case "":
+	case "url":
+		encode = url.QueryEscape
+	default:
+		g.writeError(w, r, errInvalidArgument)
+		return
+	}
+
+	// Keys are listed after marker, excluded
+	marker := query.Get("marker")
+	if v2 {
+		marker = query.Get("start-after")
+		if token := query.Get("continuation-token"); token != "" {
+			decoded, err := base64.RawURLEncoding.DecodeString(token)
+			if err != nil {
+				g.writeError(w, r, errInvalidArgument)
+				return
+			}
+			marker = string(decoded)
+		}
+	}
+
+	ls, err := g.st.List(r.Context(), prefix)
+	if err != nil {
+		g.writeError(w, r, toS3Error(err))
+		return
+	}
+	sort.Sort(ls)
+
+	res := listBucketResult{
+		Name:         g.opt.Bucket,
+		Prefix:       encode(prefix),
+		Delimiter:    encode(delimiter),
+		MaxKeys:      limit,
+		EncodingType: query.Get("encoding-type"),
+	}
+	var last string // last key or common prefix returned
+	for _, blob := range ls {
+		entry, isPrefix := blob.Name, false
+		if delimiter != "" {
+			rest := strings.TrimPrefix(blob.Name, prefix)
+			if i := strings.Index(rest, delimiter); i >= 0 {
+				entry, isPrefix = prefix+rest[:i+len(delimiter)], true
+			}
+		}
+		if entry <= marker || entry == last {
+			continue
+		}
+		if len(res.Contents)+len(res.CommonPrefixes) == limit {
+			res.IsTruncated = true
+			break
+		}
+		last = entry
+		if isPrefix {
+			res.CommonPrefixes = append(res.CommonPrefixes, commonPrefix{Prefix: encode(entry)})
+			continue
+		}
+		res.Contents = append(res.Contents, object{
+			Key:          encode(blob.Name),
+			LastModified: modTime(blob.ModTime),
+			Size:         blob.Size,
+			StorageClass: "STANDARD",
+		})
+	}
+
+	if v2 {
+		res.KeyCount = len(res.Contents) + len(res.CommonPrefixes)
+		res.StartAfter = encode(query.Get("start-after"))
+		res.ContinuationToken = query.Get("continuation-token")
+		if res.IsTruncated {
+			res.NextContinuationToken = base64.RawURLEncoding.EncodeToString([]byte(last))
+		}
+	} else {
+		res.Marker = encode(marker)
+		if res.IsTruncated {
+			res.NextMarker = encode(last)
+		}
+	}
+	writeXML(w, http.StatusOK, res)
+}
+
+func (g *Gateway) listBuckets(w http.ResponseWriter) {
+	var res listAllMyBucketsResult
+	res.Owner.ID = "simpleblob"
+	res.Owner.DisplayName = "simpleblob"
+	res.Buckets = []bucket{{Name: g.opt.Bucket, CreationDate: g.created}}
+	writeXML(w, http.StatusOK, res)
+}
@@ -0,0 +1,261 @@
+package s3gateway
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PowerDNS/simpleblob"
+)
+
+// maxParts is the maximum number of parts of a multipart upload.
+const maxParts = 10000
+
+// upload is a multipart upload in progress. Its parts are kept in
+// temporary files until it is completed, aborted or expired.
+type upload struct {
+	key string
+	dir string
+
+	// mu serializes the changes of the parts with their use on completion.
+	// done is set once the upload is completed or removed.
+	mu       sync.Mutex
+	parts    map[int]part
+	lastUsed time.Time
+	done     bool
+}
+
+type part struct {
+	md5  []byte
+	size int64
+}
+
+func (p part) etag() string {
+	return hex.EncodeToString(p.md5)
+}
+
+// getUpload returns the upload with the given ID, for key.
+func (g *Gateway) getUpload(id, key string) (*upload, *s3Error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	u := g.uploads[id]
+	if u == nil || u.key != key {
+		return nil, errNoSuchUpload
+	}
+	return u, nil
+}
+
+// forgetUpload removes an upload from the ones in progress, and returns it.
+func (g *Gateway) forgetUpload(id string) *upload {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	u := g.uploads[id]
+	delete(g.uploads, id)
+	return u
+}
+
+// removeUpload forgets an upload and deletes its parts, after the request
+// using it, if any, is done.
+func (g *Gateway) removeUpload(id string) {
+	u := g.forgetUpload(id)
+	if u == nil {
+		return
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.finish()
+}
+
+// finish marks the upload as done and deletes its parts. It must be called
+// with mu held.
+func (u *upload) finish() {
+	u.done = true
+	_ = os.RemoveAll(u.dir)
+}
+
+// removeExpiredUploads removes the uploads that received no part for
+// longer than the UploadTTL.
+func (g *Gateway) removeExpiredUploads() {
+	deadline := g.now().Add(-g.opt.UploadTTL)
+	g.mu.Lock()
+	uploads := make(map[string]*upload, len(g.uploads))
+	for id, u := range g.uploads {
+		uploads[id] = u
+	}
+	g.mu.Unlock()
+	for id, u := range uploads {
+		u.mu.Lock()
+		expired := u.lastUsed.Before(deadline)
+		u.mu.Unlock()
+		if expired {
+			g.removeUpload(id)
+		}
+	}
+}
+
+func (g *Gateway) createUpload(w http.ResponseWriter, r *http.Request, key string) {
+	g.removeExpiredUploads()
+	dir, err := os.MkdirTemp(g.opt.TempDir, "s3gateway-upload-")
+	if err != nil {
+		g.writeError(w, r, toS3Error(err))
+		return
+	}
+	id := make([]byte, 16)
+	_, _ = rand.Read(id)
+	uploadID := hex.EncodeToString(id)
+
+	g.mu.Lock()
+	g.uploads[uploadID] = &upload{key: key, dir: dir, parts: make(map[int]part), lastUsed: g.now()}
+	g.mu.Unlock()
+
+	writeXML(w, http.StatusOK, initiateMultipartUploadResult{
+		Bucket:   g.opt.Bucket,
+		Key:      key,
+		UploadID: uploadID,
+	})
+}
+
+func (g *Gateway) uploadPart(w http.ResponseWriter, r *http.Request, key string, s *signer) {
+	query := r.URL.Query()
+	u, s3err := g.getUpload(query.Get("uploadId"), key)
+	if s3err != nil {
+		g.writeError(w, r, s3err)
+		return
+	}
+	number, err := strconv.Atoi(query.Get("partNumber"))
+	if err != nil || number < 1 || number > maxParts {
+		g.writeError(w, r, errInvalidArgument)
+		return
+	}
+	body, size, s3err := payload(r, s)
+	if s3err != nil {
+		g.writeError(w, r, s3err)
+		return
+	}
+
+	// Parts are written to a temporary name first, as they may be
+	// uploaded again
+	f, err := os.CreateTemp(u.dir, "part-")
+	if err != nil {
+		g.writeError(w, r, toS3Error(err))
+		return
+	}
+	hash := md5.New()
+	n, err := io.Copy(io.MultiWriter(f, hash), simpleblob.LimitReader(body, size))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+		g.writeError(w, r, toS3Error(err))
+		return
+	}
+
+	// The file of a part and its ETag change together, so that a completion
+	// never uses a file that does not match the ETag it checked
+	p := part{md5: hash.Sum(nil), size: n}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.done {
+		_ = os.Remove(f.Name())
+		g.writeError(w, r, errNoSuchUpload)
+		return
+	}
+	if err := os.Rename(f.Name(), filepath.Join(u.dir, strconv.Itoa(number))); err != nil {
+		_ = os.Remove(f.Name())
+		g.writeError(w, r, toS3Error(err))
+		return
+	}
+	u.parts[number] = p
+	u.lastUsed = g.now()
+	w.Header().Set("ETag", strconv.Quote(p.etag()))
+	w.WriteHeader(http.StatusOK)
+}
+
+func (g *Gateway) completeUpload(w http.ResponseWriter, r *http.Request, key string) {
+	uploadID := r.URL.Query().Get("uploadId")
+	u, s3err := g.getUpload(uploadID, key)
+	if s3err != nil {
+		g.writeError(w, r, s3err)
+		return
+	}
+	var req completeMultipartUpload
+	if err := xml.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&req); err != nil || len(req.Parts) == 0 {
+		g.writeError(w, r, errMalformedXML)
+		return
+	}
+
+	// Concurrent requests cannot change the parts anymore, as the upload
+	// is done once completed
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.done {
+		g.writeError(w, r, errNoSuchUpload)
+		return
+	}
+	var files []*os.File
+	defer func() {
+		for _, f := range files {
+			_ = f.Close()
+		}
+	}()
+	var readers []io.Reader
+	var size int64
+	etags := md5.New()
+	for i, p := range req.Parts {
+		stored, ok := u.parts[p.PartNumber]
+		if !ok || stored.etag() != strings.Trim(p.ETag, `"`) {
+			g.writeError(w, r, errInvalidPart)
+			return
+		}
+		if i > 0 && p.PartNumber <= req.Parts[i-1].PartNumber {
+			g.writeError(w, r, errInvalidPartOrder)
+			return
+		}
+		f, err := os.Open(filepath.Join(u.dir, strconv.Itoa(p.PartNumber)))
+		if err != nil {
+			g.writeError(w, r, toS3Error(err))
+			return
+		}
+		files = append(files, f)
+		readers = append(readers, f)
+		size += stored.size
+		etags.Write(stored.md5)
+	}
+
+	if err := simpleblob.StoreReader(r.Context(), g.st, key, io.MultiReader(readers...), size); err != nil {
+		g.writeError(w, r, toS3Error(err))
+		return
+	}
+	for _, f := range files {
+		_ = f.Close()
+	}
+	files = nil
+	g.forgetUpload(uploadID)
+	u.finish()
+	writeXML(w, http.StatusOK, completeMultipartUploadResult{
+		Bucket: g.opt.Bucket,
+		Key:    key,
+		ETag:   strconv.Quote(fmt.Sprintf("%x-%d", etags.Sum(nil), len(req.Parts))),
+	})
+}
+
+func (g *Gateway) abortUpload(w http.ResponseWriter, r *http.Request, key string) {
+	uploadID := r.URL.Query().Get("uploadId")
+	if _, s3err := g.getUpload(uploadID, key); s3err != nil {
+		g.writeError(w, r, s3err)
+		return
+	}
+	g.removeUpload(uploadID)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,169 @@
+package s3gateway
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Errors of the payload readers, converted to S3 errors by toS3Error.
+var (
+	errPayloadSignature = errors.New("chunk signature mismatch")
+	errPayloadHash      = errors.New("payload hash mismatch")
+	errPayloadMalformed = errors.New("malformed chunked payload")
+)
+
+// maxChunkSize limits the memory used by a chunk of a streaming payload,
+// which is buffered until its signature is checked.
+const maxChunkSize = 16 << 20
+
+// payload returns a reader for the content of a PUT request, and its size,
+// or -1 if unknown. The reader fails if the content does not match its
+// hashes or signatures, in which case it must not be stored.
+// The signer is nil for anonymous requests.
+func payload(r *http.Request, s *signer) (io.Reader, int64, *s3Error) {
+	var body io.Reader = r.Body
+	size := r.ContentLength
+
+	switch contentSHA256 := r.Header.Get("X-Amz-Content-Sha256"); contentSHA256 {
+	case streamingPayload, streamingUnsignedTrailer:
+		var err error
+		if size, err = strconv.ParseInt(r.Header.Get("X-Amz-Decoded-Content-Length"), 10, 64); err != nil || size < 0 {
+			return nil, 0, errMissingContentLength
+		}
+		c := &chunkReader{r: bufio.NewReader(body), trailer: contentSHA256 == streamingUnsignedTrailer}
+		if contentSHA256 == streamingPayload && s != nil {
+			c.signer, c.prevSignature = s, s.signature
+		}
+		body = c
+	case "", unsignedPayload:
+	default:
+		expected, err := hex.DecodeString(contentSHA256)
+		if err != nil || len(expected) != sha256.Size {
+			return nil, 0, errInvalidDigest
+		}
+		body = &hashReader{r: body, h: sha256.New(), expected: expected}
+	}
+
+	if contentMD5 := r.Header.Get("Content-Md5"); contentMD5 != "" {
+		expected, err := base64.StdEncoding.DecodeString(contentMD5)
+		if err != nil || len(expected) != md5.Size {
+			return nil, 0, errInvalidDigest
+		}
+		body = &hashReader{r: body, h: md5.New(), expected: expected}
+	}
+	return body, size, nil
+}
+
+// hashReader fails at the end of its content if it does not have the
+// expected hash.
+type hashReader struct {
+	r        io.Reader
+	h        hash.Hash
+	expected []byte
+}
+
+func (h *hashReader) Read(p []byte) (int, error) {
+	n, err := h.r.Read(p)
+	h.h.Write(p[:n])
+	if err == io.EOF && !bytes.Equal(h.h.Sum(nil), h.expected) {
+		return n, errPayloadHash
+	}
+	return n, err
+}
+
+// chunkReader decodes an aws-chunked payload, made of chunks like:
+//
+//	<hex size>;chunk-signature=<signature>\r\n<data>\r\n
+//
+// and ending with a chunk of size 0, followed by trailing headers if
+// trailer is set. Chunks are only returned once their signature is checked,
+// if signer is set.
+type chunkReader struct {
+	r             *bufio.Reader
+	signer        *signer
+	prevSignature string
+	trailer       bool
+
+	chunk []byte // not read yet
+	done  bool
+	err   error
+}
+
+func (c *chunkReader) Read(p []byte) (int, error) {
+	for len(c.chunk) == 0 {
+		if c.err != nil {
+			return 0, c.err
+		}
+		if c.done {
+			return 0, io.EOF
+		}
+		c.err = c.next()
+	}
+	n := copy(p, c.chunk)
+	c.chunk = c.chunk[n:]
+	return n, nil
+}
+
+// next reads the next chunk.
+func (c *chunkReader) next() error {
+	line, err := c.readLine()
+	if err != nil {
+		return err
+	}
+	sizeHex, ext, _ := strings.Cut(line, ";")
+	size, err := strconv.ParseInt(sizeHex, 16, 64)
+	if err != nil || size < 0 || size > maxChunkSize {
+		return errPayloadMalformed
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(c.r, data); err != nil {
+		return errPayloadMalformed
+	}
+
+	if c.signer != nil {
+		signature, ok := strings.CutPrefix(ext, "chunk-signature=")
+		if !ok || signature != c.signer.chunkSignature(c.prevSignature, data) {
+			return errPayloadSignature
+		}
+		c.prevSignature = signature
+	}
+
+	if size > 0 || !c.trailer {
+		// Chunk data, or the end of a payload without trailer
+		if line, err := c.readLine(); err != nil || line != "" {
+			return errPayloadMalformed
+		}
+	} else {
+		// Trailing headers end with an empty line. They are not checked.
+		for {
+			line, err := c.readLine()
+			if err != nil {
+				return err
+			}
+			if line == "" {
+				break
+			}
+		}
+	}
+	c.chunk = data
+	c.done = size == 0
+	return nil
+}
+
+func (c *chunkReader) readLine() (string, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return "", errPayloadMalformed
+	}
+	return strings.TrimSuffix(line, "\r\n"), nil
+}
@@ -0,0 +1,364 @@
+// Package s3gateway serves any simpleblob backend over a minimal S3 API, so
+// that tools that only speak S3 can use it, for example during a migration.
+//
+// A Gateway serves a single bucket with path-style URLs, and supports:
+//
+//   - GetObject and HeadObject, with single byte ranges
+//   - PutObject, including aws-chunked streaming payloads and If-None-Match: *
+//   - DeleteObject
+//   - Multipart uploads, without listing of uploads and parts
+//   - ListObjects and ListObjectsV2, with delimiters and pagination
+//   - HeadBucket, GetBucketLocation and ListBuckets
+//
+// Requests are authenticated with Signature Version 4, in the Authorization
+// header or presigned URLs. Copies, versioning, ACLs and object metadata
+// are not supported.
+package s3gateway
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PowerDNS/simpleblob"
+)
+
+// DefaultRegion is the default value for Options.Region.
+const DefaultRegion = "us-east-1"
+
+// DefaultUploadTTL is the default value for Options.UploadTTL.
+const DefaultUploadTTL = 24 * time.Hour
+
+// Options describes the options for a Gateway
+type Options struct {
+	// Bucket is the name of the bucket served. It is required.
+	Bucket string
+	// Region is the region clients must sign their requests for. It
+	// defaults to DefaultRegion.
+	Region string
+	// AccessKey and SecretKey are the credentials clients must sign
+	// their requests with. If both are empty, all requests are allowed.
+	AccessKey string
+	SecretKey string
+	// ReadOnly rejects requests that modify blobs.
+	ReadOnly bool
+	// TempDir is where the parts of multipart uploads are kept until the
+	// upload is completed. It defaults to os.TempDir().
+	TempDir string
+	// UploadTTL is the time after which a multipart upload that received no
+	// part is aborted. Expired uploads are removed when a new upload is
+	// created. It defaults to DefaultUploadTTL.
+	UploadTTL time.Duration
+}
+
+// Check returns an error if the options are invalid.
+func (o Options) Check() error {
+	if o.Bucket == "" {
+		return fmt.Errorf("s3gateway: bucket is required")
+	}
+	if (o.AccessKey == "") != (o.SecretKey == "") {
+		return fmt.Errorf("s3gateway: access key and secret key must be set together")
+	}
+	if o.UploadTTL < 0 {
+		return fmt.Errorf("s3gateway: upload TTL must not be negative")
+	}
+	return nil
+}
+
+// Gateway is an http.Handler serving a backend over the S3 API.
+type Gateway struct {
+	st      simpleblob.Interface
+	opt     Options
+	now     func() time.Time
+	created time.Time // reported as the creation date of the bucket
+
+	mu      sync.Mutex
+	uploads map[string]*upload // by upload ID
+}
+
+// New returns a Gateway serving st.
+func New(st simpleblob.Interface, opt Options) (*Gateway, error) {
+	if opt.Region == "" {
+		opt.Region = DefaultRegion
+	}
+	if opt.UploadTTL == 0 {
+		opt.UploadTTL = DefaultUploadTTL
+	}
+	if err := opt.Check(); err != nil {
+		return nil, err
+	}
+	return &Gateway{
+		st:      st,
+		opt:     opt,
+		now:     time.Now,
+		created: time.Now().UTC(),
+		uploads: make(map[string]*upload),
+	}, nil
+}
+
+// Close aborts the multipart uploads in progress, deleting their parts.
+func (g *Gateway) Close() error {
+	g.mu.Lock()
+	ids := make([]string, 0, len(g.uploads))
+	for id := range g.uploads {
+		ids = append(ids, id)
+	}
+	g.mu.Unlock()
+	for _, id := range ids {
+		g.removeUpload(id)
+	}
+	return nil
+}
+
+// unsupported are the subresources of objects that are not implemented.
+var unsupported = []string{
+	"acl", "attributes", "legal-hold", "restore", "retention", "select",
+	"tagging", "torrent", "versionId",
+}
+
+// ServeHTTP implements http.Handler.
+func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var s *signer
+	if g.opt.AccessKey != "" {
+		var err *s3Error
+		if s, err = g.authenticate(r); err != nil {
+			g.writeError(w, r, err)
+			return
+		}
+	}
+
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	query := r.URL.Query()
+	switch {
+	case bucket == "":
+		if r.Method != http.MethodGet {
+			g.writeError(w, r, errMethodNotAllowed)
+			return
+		}
+		g.listBuckets(w)
+		return
+	case bucket != g.opt.Bucket:
+		g.writeError(w, r, errNoSuchBucket)
+		return
+	}
+	for _, sub := range unsupported {
+		if query.Has(sub) {
+			g.writeError(w, r, errNotImplemented)
+			return
+		}
+	}
+
+	if key == "" {
+		switch {
+		case r.Method == http.MethodHead:
+		case r.Method == http.MethodGet && query.Has("location"):
+			writeXML(w, http.StatusOK, locationConstraint{Location: g.opt.Region})
+		case r.Method == http.MethodGet && len(query) > 0 && !isListQuery(query):
+			g.writeError(w, r, errNotImplemented)
+		case r.Method == http.MethodGet:
+			g.listObjects(w, r)
+		case r.Method == http.MethodPut:
+			g.writeError(w, r, errBucketAlreadyOwnedByYou)
+		default:
+			g.writeError(w, r, errNotImplemented)
+		}
+		return
+	}
+
+	readOnly := r.Method == http.MethodGet || r.Method == http.MethodHead
+	if g.opt.ReadOnly && !readOnly {
+		g.writeError(w, r, errAccessDenied)
+		return
+	}
+	switch {
+	case readOnly && query.Has("uploadId"):
+		g.writeError(w, r, errNotImplemented) // ListParts
+	case readOnly:
+		g.getObject(w, r, key)
+	case r.Method == http.MethodPut && r.Header.Get("X-Amz-Copy-Source") != "":
+		g.writeError(w, r, errNotImplemented)
+	case r.Method == http.MethodPut && query.Has("partNumber"):
+		g.uploadPart(w, r, key, s)
+	case r.Method == http.MethodPut:
+		g.putObject(w, r, key, s)
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		g.createUpload(w, r, key)
+	case r.Method == http.MethodPost && query.Has("uploadId"):
+		g.completeUpload(w, r, key)
+	case r.Method == http.MethodDelete && query.Has("uploadId"):
+		g.abortUpload(w, r, key)
+	case r.Method == http.MethodDelete:
+		if err := g.st.Delete(r.Context(), key); err != nil {
+			g.writeError(w, r, toS3Error(err))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		g.writeError(w, r, errNotImplemented)
+	}
+}
+
+func (g *Gateway) getObject(w http.ResponseWriter, r *http.Request, key string) {
+	ctx := r.Context()
+	var info simpleblob.BlobInfo
+	var body io.ReadCloser
+	var err error
+	if _, ok := g.st.(simpleblob.Statter); ok {
+		if info, err = simpleblob.Stat(ctx, g.st, key); err == nil && r.Method == http.MethodGet {
+			body, err = simpleblob.NewReader(ctx, g.st, key)
+		}
+	} else {
+		// Stat would load the blob anyway
+		var data []byte
+		if data, err = g.st.Load(ctx, key); err == nil {
+			info.Name, info.Size = key, int64(len(data))
+			body = io.NopCloser(bytes.NewReader(data))
+		}
+	}
+	if err != nil {
+		g.writeError(w, r, toS3Error(err))
+		return
+	}
+	if body != nil {
+		defer body.Close()
+	}
+
+	h := w.Header()
+	h.Set("Content-Type", "application/octet-stream")
+	h.Set("Last-Modified", modTime(info.ModTime).Format(http.TimeFormat))
+	h.Set("Accept-Ranges", "bytes")
+	if info.ETag != "" {
+		h.Set("ETag", strconv.Quote(strings.Trim(info.ETag, `"`)))
+	}
+
+	status := http.StatusOK
+	length := info.Size
+	if spec := r.Header.Get("Range"); spec != "" {
+		start, end, ok := parseRange(spec, info.Size)
+		if !ok {
+			h.Set("Content-Range", fmt.Sprintf("bytes */%d", info.Size))
+			g.writeError(w, r, errInvalidRange)
+			return
+		}
+		if body != nil {
+			if _, err := io.CopyN(io.Discard, body, start); err != nil {
+				g.writeError(w, r, toS3Error(err))
+				return
+			}
+		}
+		h.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, info.Size))
+		status = http.StatusPartialContent
+		length = end - start + 1
+	}
+	h.Set("Content-Length", strconv.FormatInt(length, 10))
+	w.WriteHeader(status)
+	if body != nil {
+		_, _ = io.CopyN(w, body, length) // too late to report an error
+	}
+}
+
+// parseRange parses a Range header with a single range of bytes, and
+// returns its first and last byte.
+func parseRange(spec string, size int64) (start, end int64, ok bool) {
+	spec, ok = strings.CutPrefix(spec, "bytes=")
+	if !ok || strings.Contains(spec, ",") {
+		return 0, 0, false
+	}
+	first, last, ok := strings.Cut(spec, "-")
+	if !ok {
+		return 0, 0, false
+	}
+	var err error
+	if first == "" {
+		// Suffix range: the last bytes
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || n <= 0 || size == 0 {
+			return 0, 0, false
+		}
+		return max(size-n, 0), size - 1, true
+	}
+	if start, err = strconv.ParseInt(first, 10, 64); err != nil || start < 0 || start >= size {
+		return 0, 0, false
+	}
+	end = size - 1
+	if last != "" {
+		if end, err = strconv.ParseInt(last, 10, 64); err != nil || end < start {
+			return 0, 0, false
+		}
+		end = min(end, size-1)
+	}
+	return start, end, true
+}
+
+func (g *Gateway) putObject(w http.ResponseWriter, r *http.Request, key string, s *signer) {
+	ctx := r.Context()
+	body, size, s3err := payload(r, s)
+	if s3err != nil {
+		g.writeError(w, r, s3err)
+		return
+	}
+	// The ETag of a simple upload is the MD5 of its content
+	hash := md5.New()
+	body = io.TeeReader(body, hash)
+
+	var err error
+	switch r.Header.Get("If-None-Match") {
+	case "":
+		err = simpleblob.StoreReader(ctx, g.st, key, body, size)
+	case "*":
+		var data []byte
+		if data, err = io.ReadAll(simpleblob.LimitReader(body, size)); err == nil {
+			err = simpleblob.StoreIfAbsent(ctx, g.st, key, data)
+		}
+	default:
+		g.writeError(w, r, errNotImplemented)
+		return
+	}
+	if err != nil {
+		g.writeError(w, r, toS3Error(err))
+		return
+	}
+	w.Header().Set("ETag", strconv.Quote(hex.EncodeToString(hash.Sum(nil))))
+	w.WriteHeader(http.StatusOK)
+}
+
+// modTime returns the time to report for a blob modified at t, which may
+// be unknown.
+func modTime(t time.Time) time.Time {
+	if t.IsZero() {
+		return time.Unix(0, 0).UTC()
+	}
+	return t.UTC()
+}
+
+// toS3Error converts the errors of backends and payload readers.
+func toS3Error(err error) *s3Error {
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return errNoSuchKey
+	case errors.Is(err, os.ErrExist):
+		return errPreconditionFailed
+	case errors.Is(err, os.ErrPermission):
+		return errAccessDenied
+	case errors.Is(err, errors.ErrUnsupported):
+		return errNotImplemented
+	case errors.Is(err, errPayloadSignature):
+		return errSignatureDoesNotMatch
+	case errors.Is(err, errPayloadHash):
+		return errBadDigest
+	case errors.Is(err, errPayloadMalformed):
+		return errIncompleteBody
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return errIncompleteBody
+	}
+	return &s3Error{Code: "InternalError", Message: err.Error(), status: http.StatusInternalServerError}
+}
@@ -0,0 +1,278 @@
+package s3gateway_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/PowerDNS/simpleblob/backends/memory"
+	"github.com/PowerDNS/simpleblob/backends/s3"
+	"github.com/PowerDNS/simpleblob/server/s3gateway"
+	"github.com/PowerDNS/simpleblob/tester"
+)
+
+const (
+	accessKey = "gateway-access"
+	secretKey = "gateway-secret"
+)
+
+// serve starts a gateway in front of st, and returns its URL.
+func serve(t *testing.T, st *memory.Backend, opt s3gateway.Options) string {
+	t.Helper()
+	if opt.TempDir == "" {
+		opt.TempDir = t.TempDir()
+	}
+	g, err := s3gateway.New(st, opt)
+	require.NoError(t, err)
+	srv := httptest.NewServer(g)
+	t.Cleanup(func() {
+		srv.Close()
+		assert.NoError(t, g.Close())
+	})
+	return srv.URL
+}
+
+// client returns the s3 backend of simpleblob talking to a gateway.
+func client(t *testing.T, url string, opt s3.Options) *s3.Backend {
+	t.Helper()
+	opt.EndpointURL = url
+	if opt.Bucket == "" {
+		opt.Bucket = "bucket"
+	}
+	b, err := s3.New(context.Background(), opt)
+	require.NoError(t, err)
+	return b
+}
+
+func TestGateway(t *testing.T) {
+	url := serve(t, memory.New(), s3gateway.Options{
+		Bucket:    "bucket",
+		AccessKey: accessKey,
+		SecretKey: secretKey,
+	})
+	b := client(t, url, s3.Options{AccessKey: accessKey, SecretKey: secretKey})
+	tester.DoBackendTests(t, b)
+	tester.DoStreamTests(t, b)
+}
+
+func TestGateway_names(t *testing.T) {
+	url := serve(t, memory.New(), s3gateway.Options{
+		Bucket:    "bucket",
+		AccessKey: accessKey,
+		SecretKey: secretKey,
+	})
+	b := client(t, url, s3.Options{AccessKey: accessKey, SecretKey: secretKey})
+	tester.DoNameTests(t, b, tester.Capabilities{})
+
+	// The update marker name is reserved when it is used
+	b = client(t, url, s3.Options{AccessKey: accessKey, SecretKey: secretKey, UseUpdateMarker: true})
+	tester.DoNameTests(t, b, tester.Capabilities{
+		RejectsName: func(name string) bool { return name == s3.UpdateMarkerFilename },
+	})
+	assert.ErrorIs(t, b.Delete(context.Background(), s3.UpdateMarkerFilename), s3.ErrReservedName)
+}
+
+func TestGateway_folders(t *testing.T) {
+	url := serve(t, memory.New(), s3gateway.Options{
+		Bucket:    "bucket",
+		AccessKey: accessKey,
+		SecretKey: secretKey,
+	})
+	// The delimiter of ListObjects is used with PrefixFolders
+	b := client(t, url, s3.Options{AccessKey: accessKey, SecretKey: secretKey, PrefixFolders: true})
+	tester.DoFolderTests(t, b, tester.FolderOptions{Mode: tester.FoldersAsPrefixes})
+}
+
+func TestGateway_minio(t *testing.T) {
+	ctx := context.Background()
+	st := memory.New()
+	url := serve(t, st, s3gateway.Options{
+		Bucket:    "bucket",
+		AccessKey: accessKey,
+		SecretKey: secretKey,
+	})
+	c, err := minio.New(strings.TrimPrefix(url, "http://"), &minio.Options{
+		Creds:  credentials.NewStaticV4(accessKey, secretKey, ""),
+		Region: s3gateway.DefaultRegion,
+	})
+	require.NoError(t, err)
+
+	// Streaming signature with several chunks
+	large := strings.Repeat("0123456789abcdef", 20000)
+	_, err = c.PutObject(ctx, "bucket", "large", strings.NewReader(large), int64(len(large)), minio.PutObjectOptions{})
+	require.NoError(t, err)
+	data, err := st.Load(ctx, "large")
+	require.NoError(t, err)
+	assert.Equal(t, large, string(data))
+
+	// Ranges
+	opts := minio.GetObjectOptions{}
+	require.NoError(t, opts.SetRange(16, 31))
+	obj, err := c.GetObject(ctx, "bucket", "large", opts)
+	require.NoError(t, err)
+	data, err = io.ReadAll(obj)
+	require.NoError(t, err)
+	assert.Equal(t, "0123456789abcdef", string(data))
+
+	// Pagination
+	for _, name := range []string{"p/1", "p/2", "p/3", "p/sub/4", "p/sub/5"} {
+		require.NoError(t, st.Store(ctx, name, []byte(name)))
+	}
+	var keys []string
+	for obj := range c.ListObjects(ctx, "bucket", minio.ListObjectsOptions{Prefix: "p/", MaxKeys: 2}) {
+		require.NoError(t, obj.Err)
+		keys = append(keys, obj.Key)
+	}
+	assert.Equal(t, []string{"p/1", "p/2", "p/3", "p/sub/"}, keys)
+	keys = nil
+	for obj := range c.ListObjects(ctx, "bucket", minio.ListObjectsOptions{Prefix: "p/", MaxKeys: 2, UseV1: true, Recursive: true}) {
+		require.NoError(t, obj.Err)
+		keys = append(keys, obj.Key)
+	}
+	assert.Equal(t, []string{"p/1", "p/2", "p/3", "p/sub/4", "p/sub/5"}, keys)
+
+	// Presigned URLs
+	u, err := c.PresignedGetObject(ctx, "bucket", "p/1", time.Minute, nil)
+	require.NoError(t, err)
+	resp, err := http.Get(u.String())
+	require.NoError(t, err)
+	data, err = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "p/1", string(data))
+
+	buckets, err := c.ListBuckets(ctx)
+	require.NoError(t, err)
+	require.Len(t, buckets, 1)
+	assert.Equal(t, "bucket", buckets[0].Name)
+	exists, err := c.BucketExists(ctx, "other")
+	require.NoError(t, err)
+	assert.False(t, exists)
+}
+
+func TestGateway_auth(t *testing.T) {
+	ctx := context.Background()
+	st := memory.New()
+	require.NoError(t, st.Store(ctx, "foo", []byte("bar")))
+	url := serve(t, st, s3gateway.Options{
+		Bucket:    "bucket",
+		AccessKey: accessKey,
+		SecretKey: secretKey,
+	})
+
+	for _, opt := range []s3.Options{
+		{AccessKey: accessKey, SecretKey: "wrong"},
+		{AccessKey: "wrong", SecretKey: secretKey},
+		{AccessKey: accessKey, SecretKey: secretKey, Region: "eu-west-1"},
+		{Anonymous: true},
+	} {
+		b := client(t, url, opt)
+		_, err := b.Load(ctx, "foo")
+		assert.Error(t, err)
+		assert.Error(t, b.Store(ctx, "foo", []byte("changed")))
+		assert.Error(t, b.Delete(ctx, "foo"))
+	}
+
+	// Unsigned requests
+	resp, err := http.Get(url + "/bucket/foo")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	data, err := st.Load(ctx, "foo")
+	require.NoError(t, err)
+	assert.Equal(t, "bar", string(data))
+}
+
+func TestGateway_readOnly(t *testing.T) {
+	ctx := context.Background()
+	st := memory.New()
+	require.NoError(t, st.Store(ctx, "foo", []byte("bar")))
+	url := serve(t, st, s3gateway.Options{Bucket: "bucket", ReadOnly: true})
+
+	b := client(t, url, s3.Options{Anonymous: true})
+	data, err := b.Load(ctx, "foo")
+	require.NoError(t, err)
+	assert.Equal(t, "bar", string(data))
+	assert.Error(t, b.Store(ctx, "foo", []byte("changed")))
+
+	req, err := http.NewRequest(http.MethodDelete, url+"/bucket/foo", nil)
+	require.NoError(t, err)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	_, err = st.Load(ctx, "foo")
+	assert.NoError(t, err)
+
+	resp, err = http.Get(url + "/bucket/missing")
+	require.NoError(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	assert.Contains(t, string(body), "<Code>NoSuchKey</Code>")
+}
+
+func TestGateway_uploads(t *testing.T) {
+	ctx := context.Background()
+	tempDir := t.TempDir()
+	url := serve(t, memory.New(), s3gateway.Options{
+		Bucket:    "bucket",
+		AccessKey: accessKey,
+		SecretKey: secretKey,
+		TempDir:   tempDir,
+		UploadTTL: 50 * time.Millisecond,
+	})
+	c, err := minio.NewCore(strings.TrimPrefix(url, "http://"), &minio.Options{
+		Creds:  credentials.NewStaticV4(accessKey, secretKey, ""),
+		Region: s3gateway.DefaultRegion,
+	})
+	require.NoError(t, err)
+	putPart := func(id string) error {
+		_, err := c.PutObjectPart(ctx, "bucket", "foo", id, 1, strings.NewReader("part"), 4, minio.PutObjectPartOptions{})
+		return err
+	}
+
+	// Parts cannot be uploaded once the upload is completed
+	id, err := c.NewMultipartUpload(ctx, "bucket", "foo", minio.PutObjectOptions{})
+	require.NoError(t, err)
+	part, err := c.PutObjectPart(ctx, "bucket", "foo", id, 1, strings.NewReader("part"), 4, minio.PutObjectPartOptions{})
+	require.NoError(t, err)
+	_, err = c.CompleteMultipartUpload(ctx, "bucket", "foo", id, []minio.CompletePart{{PartNumber: 1, ETag: part.ETag}}, minio.PutObjectOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "NoSuchUpload", minio.ToErrorResponse(putPart(id)).Code)
+
+	// Abandoned uploads expire when another one is created
+	abandoned, err := c.NewMultipartUpload(ctx, "bucket", "foo", minio.PutObjectOptions{})
+	require.NoError(t, err)
+	require.NoError(t, putPart(abandoned))
+	time.Sleep(100 * time.Millisecond)
+	_, err = c.NewMultipartUpload(ctx, "bucket", "foo", minio.PutObjectOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "NoSuchUpload", minio.ToErrorResponse(putPart(abandoned)).Code)
+	entries, err := os.ReadDir(tempDir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
+
+func TestNew(t *testing.T) {
+	_, err := s3gateway.New(memory.New(), s3gateway.Options{})
+	assert.Error(t, err)
+	_, err = s3gateway.New(memory.New(), s3gateway.Options{Bucket: "b", AccessKey: "a"})
+	assert.Error(t, err)
+	_, err = s3gateway.New(memory.New(), s3gateway.Options{Bucket: "b", UploadTTL: -time.Second})
+	assert.Error(t, err)
+	_, err = s3gateway.New(memory.New(), s3gateway.Options{Bucket: "b"})
+	assert.NoError(t, err)
+}
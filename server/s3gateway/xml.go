@@ -0,0 +1,134 @@
+package s3gateway
+
+import (
+	"encoding/xml"
+	"net/http"
+	"time"
+)
+
+// s3Error is an error response of the S3 API.
+type s3Error struct {
+	XMLName  xml.Name `xml:"Error"`
+	Code     string
+	Message  string
+	Resource string `xml:",omitempty"`
+	status   int
+}
+
+func (e *s3Error) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+var (
+	errAccessDenied                      = &s3Error{Code: "AccessDenied", Message: "Access Denied", status: http.StatusForbidden}
+	errAuthorizationHeaderMalformed      = &s3Error{Code: "AuthorizationHeaderMalformed", Message: "The authorization header is malformed", status: http.StatusBadRequest}
+	errAuthorizationQueryParametersError = &s3Error{Code: "AuthorizationQueryParametersError", Message: "The authorization query parameters are invalid", status: http.StatusBadRequest}
+	errBadDigest                         = &s3Error{Code: "BadDigest", Message: "The content does not match the digest sent", status: http.StatusBadRequest}
+	errBucketAlreadyOwnedByYou           = &s3Error{Code: "BucketAlreadyOwnedByYou", Message: "The bucket already exists", status: http.StatusConflict}
+	errIncompleteBody                    = &s3Error{Code: "IncompleteBody", Message: "The body is shorter than announced or malformed", status: http.StatusBadRequest}
+	errInvalidAccessKeyID                = &s3Error{Code: "InvalidAccessKeyId", Message: "The access key does not exist", status: http.StatusForbidden}
+	errInvalidArgument                   = &s3Error{Code: "InvalidArgument", Message: "Invalid argument", status: http.StatusBadRequest}
+	errInvalidDigest                     = &s3Error{Code: "InvalidDigest", Message: "The digest is invalid", status: http.StatusBadRequest}
+	errInvalidRange                      = &s3Error{Code: "InvalidRange", Message: "The requested range is not satisfiable", status: http.StatusRequestedRangeNotSatisfiable}
+	errInvalidPart                       = &s3Error{Code: "InvalidPart", Message: "A part was not uploaded or its ETag does not match", status: http.StatusBadRequest}
+	errInvalidPartOrder                  = &s3Error{Code: "InvalidPartOrder", Message: "The parts are not in ascending order", status: http.StatusBadRequest}
+	errMalformedXML                      = &s3Error{Code: "MalformedXML", Message: "The XML is not well-formed", status: http.StatusBadRequest}
+	errMethodNotAllowed                  = &s3Error{Code: "MethodNotAllowed", Message: "The method is not allowed on this resource", status: http.StatusMethodNotAllowed}
+	errMissingContentLength              = &s3Error{Code: "MissingContentLength", Message: "The decoded content length is missing", status: http.StatusLengthRequired}
+	errNoSuchBucket                      = &s3Error{Code: "NoSuchBucket", Message: "The bucket does not exist", status: http.StatusNotFound}
+	errNoSuchKey                         = &s3Error{Code: "NoSuchKey", Message: "The key does not exist", status: http.StatusNotFound}
+	errNoSuchUpload                      = &s3Error{Code: "NoSuchUpload", Message: "The upload does not exist", status: http.StatusNotFound}
+	errNotImplemented                    = &s3Error{Code: "NotImplemented", Message: "This feature is not implemented by the gateway", status: http.StatusNotImplemented}
+	errPreconditionFailed                = &s3Error{Code: "PreconditionFailed", Message: "The key already exists", status: http.StatusPreconditionFailed}
+	errRequestTimeTooSkewed              = &s3Error{Code: "RequestTimeTooSkewed", Message: "The request time differs too much from the server time", status: http.StatusForbidden}
+	errSignatureDoesNotMatch             = &s3Error{Code: "SignatureDoesNotMatch", Message: "The signature does not match", status: http.StatusForbidden}
+)
+
+// writeError writes an error response. HEAD responses have no body.
+func (g *Gateway) writeError(w http.ResponseWriter, r *http.Request, e *s3Error) {
+	w.Header().Del("Content-Length")
+	if r.Method == http.MethodHead {
+		w.WriteHeader(e.status)
+		return
+	}
+	resp := *e
+	resp.Resource = r.URL.Path
+	writeXML(w, e.status, resp)
+}
+
+func writeXML(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	_, _ = w.Write([]byte(xml.Header))
+	_ = xml.NewEncoder(w).Encode(v)
+}
+
+type listBucketResult struct {
+	XMLName               xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ ListBucketResult"`
+	Name                  string
+	Prefix                string
+	Delimiter             string `xml:",omitempty"`
+	MaxKeys               int
+	EncodingType          string `xml:",omitempty"`
+	IsTruncated           bool
+	Marker                string         `xml:",omitempty"`
+	NextMarker            string         `xml:",omitempty"`
+	KeyCount              int            `xml:",omitempty"`
+	StartAfter            string         `xml:",omitempty"`
+	ContinuationToken     string         `xml:",omitempty"`
+	NextContinuationToken string         `xml:",omitempty"`
+	Contents              []object       `xml:"Contents"`
+	CommonPrefixes        []commonPrefix `xml:"CommonPrefixes"`
+}
+
+type object struct {
+	Key          string
+	LastModified time.Time
+	ETag         string `xml:",omitempty"`
+	Size         int64
+	StorageClass string
+}
+
+type commonPrefix struct {
+	Prefix string
+}
+
+type locationConstraint struct {
+	XMLName  xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ LocationConstraint"`
+	Location string   `xml:",chardata"`
+}
+
+type initiateMultipartUploadResult struct {
+	XMLName  xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ InitiateMultipartUploadResult"`
+	Bucket   string
+	Key      string
+	UploadID string `xml:"UploadId"`
+}
+
+type completeMultipartUpload struct {
+	Parts []struct {
+		PartNumber int
+		ETag       string
+	} `xml:"Part"`
+}
+
+type completeMultipartUploadResult struct {
+	XMLName xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ CompleteMultipartUploadResult"`
+	Bucket  string
+	Key     string
+	ETag    string
+}
+
+type listAllMyBucketsResult struct {
+	XMLName xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ ListAllMyBucketsResult"`
+	Owner   struct {
+		ID          string
+		DisplayName string
+	}
+	Buckets []bucket `xml:"Buckets>Bucket"`
+}
+
+type bucket struct {
+	Name         string
+	CreationDate time.Time
+}
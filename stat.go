@@ -0,0 +1,46 @@
+package simpleblob
+
+import (
+	"context"
+	"errors"
+	"os"
+)
+
+// BlobInfo describes a single blob, as returned by Stat.
+type BlobInfo struct {
+	Blob
+	// ETag identifies the content of the blob, if the backend provides
+	// one. Its format depends on the backend.
+	ETag string
+}
+
+// A Statter is an Interface providing a way to get information about a
+// blob without loading it.
+type Statter interface {
+	Interface
+	// Stat returns information about the named blob, or an error wrapping
+	// os.ErrNotExist if it does not exist.
+	Stat(ctx context.Context, name string) (BlobInfo, error)
+}
+
+// Stat returns information about the named blob in st.
+// It uses the Stat method if available, else it loads the blob.
+func Stat(ctx context.Context, st Interface, name string) (BlobInfo, error) {
+	if s, ok := st.(Statter); ok {
+		return s.Stat(ctx, name)
+	}
+	data, err := st.Load(ctx, name)
+	if err != nil {
+		return BlobInfo{}, err
+	}
+	return BlobInfo{Blob: Blob{Name: name, Size: int64(len(data))}}, nil
+}
+
+// Exists returns whether the named blob exists in st, using Stat.
+func Exists(ctx context.Context, st Interface, name string) (bool, error) {
+	_, err := Stat(ctx, st, name)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	return err == nil, err
+}
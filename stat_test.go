@@ -0,0 +1,28 @@
+package simpleblob_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/PowerDNS/simpleblob"
+	"github.com/PowerDNS/simpleblob/backends/memory"
+)
+
+func TestStat(t *testing.T) {
+	ctx := context.Background()
+	st := memory.New()
+	assert.NoError(t, st.Store(ctx, "foo", []byte("bar")))
+
+	info, err := simpleblob.Stat(ctx, st, "foo")
+	assert.NoError(t, err)
+	assert.Equal(t, simpleblob.Blob{Name: "foo", Size: 3}, info.Blob)
+
+	ok, err := simpleblob.Exists(ctx, st, "foo")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = simpleblob.Exists(ctx, st, "missing")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+}
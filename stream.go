@@ -81,3 +81,66 @@ func NewWriter(ctx context.Context, st Interface, name string) (io.WriteCloser,
 		name: name,
 	}, nil
 }
+
+// A ReaderStorer is an Interface providing an optimized way to store a blob
+// from an io.Reader of known size.
+type ReaderStorer interface {
+	Interface
+	// StoreReader stores the content read from r under name. A size of -1
+	// means that the size is unknown.
+	StoreReader(ctx context.Context, name string, r io.Reader, size int64) error
+}
+
+// StoreReader stores the content read from r, which is size bytes long, to
+// the named blob in st. A size of -1 means that the size is unknown, but
+// passing the real size, like the one of an os.File, allows backends to
+// pick the most efficient way to upload. If r fails or is shorter than
+// size, the blob is not stored.
+// It uses the StoreReader method if available, else it reads all of r and
+// calls Store.
+func StoreReader(ctx context.Context, st Interface, name string, r io.Reader, size int64) error {
+	if rs, ok := st.(ReaderStorer); ok {
+		return rs.StoreReader(ctx, name, r, size)
+	}
+	var buf bytes.Buffer
+	if size >= 0 {
+		buf.Grow(int(size))
+	}
+	if _, err := buf.ReadFrom(LimitReader(r, size)); err != nil {
+		return err
+	}
+	return st.Store(ctx, name, buf.Bytes())
+}
+
+// LimitReader returns a reader reading exactly size bytes from r, or all
+// of r if size is -1. The returned reader fails with io.ErrUnexpectedEOF
+// if r ends before size bytes. Bytes after size are ignored.
+// It is meant for implementations of ReaderStorer.
+func LimitReader(r io.Reader, size int64) io.Reader {
+	if size < 0 {
+		return r
+	}
+	return &sizeReader{r: r, remaining: size}
+}
+
+// sizeReader returns io.ErrUnexpectedEOF if the underlying reader ends
+// before the expected size, and ignores what follows it.
+type sizeReader struct {
+	r         io.Reader
+	remaining int64
+}
+
+func (s *sizeReader) Read(p []byte) (int, error) {
+	if s.remaining <= 0 {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > s.remaining {
+		p = p[:s.remaining]
+	}
+	n, err := s.r.Read(p)
+	s.remaining -= int64(n)
+	if err == io.EOF && s.remaining > 0 {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
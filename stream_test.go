@@ -0,0 +1,40 @@
+package simpleblob_test
+
+import (
+	"context"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/PowerDNS/simpleblob"
+	"github.com/PowerDNS/simpleblob/backends/memory"
+)
+
+func TestStoreReader(t *testing.T) {
+	ctx := context.Background()
+	st := memory.New()
+
+	assert.NoError(t, simpleblob.StoreReader(ctx, st, "known", strings.NewReader("hello"), 5))
+	assert.NoError(t, simpleblob.StoreReader(ctx, st, "unknown", strings.NewReader("world"), -1))
+	data, err := st.Load(ctx, "known")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("hello"), data)
+	data, err = st.Load(ctx, "unknown")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("world"), data)
+
+	// Extra content is ignored
+	assert.NoError(t, simpleblob.StoreReader(ctx, st, "long", strings.NewReader("hello"), 3))
+	data, err = st.Load(ctx, "long")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("hel"), data)
+
+	// A short reader does not store anything
+	err = simpleblob.StoreReader(ctx, st, "short", strings.NewReader("hi"), 5)
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	_, err = st.Load(ctx, "short")
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
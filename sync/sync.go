@@ -0,0 +1,248 @@
+// Package sync copies blobs from one simpleblob backend to another, for
+// backups and migrations.
+package sync
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	stdsync "sync"
+
+	"golang.org/x/sync/errgroup"
+
+	"github.com/PowerDNS/simpleblob"
+)
+
+// DefaultConcurrency is the default value for Options.Concurrency.
+const DefaultConcurrency = 4
+
+// Compare modes decide whether a blob that exists in both backends is copied.
+const (
+	// CompareSize copies blobs with a different size. This is the default.
+	CompareSize = "size"
+	// CompareHash copies blobs with a different size or content, which
+	// requires loading blobs of the same size from both backends.
+	CompareHash = "hash"
+)
+
+// Options describes the options for Sync
+type Options struct {
+	// Include limits the sync to blobs with one of these prefixes. All
+	// blobs are included by default.
+	Include []string
+	// Exclude skips blobs with one of these prefixes, even if included.
+	Exclude []string
+	// Compare is CompareSize (default) or CompareHash.
+	Compare string
+	// Delete deletes the included blobs of the destination that do not
+	// exist in the source.
+	Delete bool
+	// Concurrency is the number of blobs copied or compared at the same
+	// time. It defaults to DefaultConcurrency.
+	Concurrency int
+	// DryRun only reports the actions, without changing the destination.
+	DryRun bool
+	// OnAction, if set, is called for every blob copied or deleted, or that
+	// would be with DryRun. It may be called concurrently.
+	OnAction func(Action)
+}
+
+// Action is a change made to the destination.
+type Action struct {
+	Op   string // "copy" or "delete"
+	Name string
+	Size int64 // of the copied blob
+}
+
+// Result summarizes a Sync.
+type Result struct {
+	Copied    int
+	Deleted   int
+	Unchanged int
+	Bytes     int64 // copied
+}
+
+// included returns whether a blob is subject to the sync.
+func (opt Options) included(name string) bool {
+	for _, prefix := range opt.Exclude {
+		if strings.HasPrefix(name, prefix) {
+			return false
+		}
+	}
+	if len(opt.Include) == 0 {
+		return true
+	}
+	for _, prefix := range opt.Include {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// list returns the included blobs of st, by name.
+func (opt Options) list(ctx context.Context, st simpleblob.Interface) (map[string]simpleblob.Blob, error) {
+	prefixes := opt.Include
+	if len(prefixes) == 0 {
+		prefixes = []string{""}
+	}
+	blobs := make(map[string]simpleblob.Blob)
+	for _, prefix := range prefixes {
+		ls, err := st.List(ctx, prefix)
+		if err != nil {
+			return nil, err
+		}
+		for _, blob := range ls {
+			if opt.included(blob.Name) {
+				blobs[blob.Name] = blob
+			}
+		}
+	}
+	return blobs, nil
+}
+
+// Sync copies the blobs of src that are missing or different in dst. With
+// the Delete option, it also deletes the blobs of dst missing in src.
+// On error, the sync stops and the returned Result describes what was done.
+func Sync(ctx context.Context, src, dst simpleblob.Interface, opt Options) (Result, error) {
+	var res Result
+	switch opt.Compare {
+	case "":
+		opt.Compare = CompareSize
+	case CompareSize, CompareHash:
+	default:
+		return res, fmt.Errorf("sync: invalid compare mode %q", opt.Compare)
+	}
+	if opt.Concurrency <= 0 {
+		opt.Concurrency = DefaultConcurrency
+	}
+
+	srcBlobs, err := opt.list(ctx, src)
+	if err != nil {
+		return res, fmt.Errorf("sync: list source: %w", err)
+	}
+	dstBlobs, err := opt.list(ctx, dst)
+	if err != nil {
+		return res, fmt.Errorf("sync: list destination: %w", err)
+	}
+
+	// record counts an action done by a worker, or an unchanged blob if nil
+	var mu stdsync.Mutex
+	record := func(a *Action) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case a == nil:
+			res.Unchanged++
+		case a.Op == "copy":
+			res.Copied++
+			res.Bytes += a.Size
+		case a.Op == "delete":
+			res.Deleted++
+		}
+	}
+
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(opt.Concurrency)
+	do := func(a Action, f func() error) error {
+		if !opt.DryRun {
+			if err := f(); err != nil {
+				return fmt.Errorf("sync: %s %q: %w", a.Op, a.Name, err)
+			}
+		}
+		if opt.OnAction != nil {
+			opt.OnAction(a)
+		}
+		record(&a)
+		return nil
+	}
+
+	for _, name := range sortedNames(srcBlobs) {
+		blob := srcBlobs[name]
+		existing, exists := dstBlobs[name]
+		g.Go(func() error {
+			if exists && existing.Size == blob.Size {
+				same := true
+				if opt.Compare == CompareHash {
+					var err error
+					if same, err = sameContent(gctx, src, dst, name); err != nil {
+						return fmt.Errorf("sync: compare %q: %w", name, err)
+					}
+				}
+				if same {
+					record(nil)
+					return nil
+				}
+			}
+			return do(Action{Op: "copy", Name: name, Size: blob.Size}, func() error {
+				return copyBlob(gctx, src, dst, blob)
+			})
+		})
+	}
+	if opt.Delete {
+		for _, name := range sortedNames(dstBlobs) {
+			if _, exists := srcBlobs[name]; exists {
+				continue
+			}
+			g.Go(func() error {
+				return do(Action{Op: "delete", Name: name}, func() error {
+					return dst.Delete(gctx, name)
+				})
+			})
+		}
+	}
+
+	err = g.Wait()
+	return res, err
+}
+
+// copyBlob streams a blob from src to dst. The listed size is not passed
+// on, as the blob may have changed since it was listed, and StoreReader
+// would then store it truncated.
+func copyBlob(ctx context.Context, src, dst simpleblob.Interface, blob simpleblob.Blob) error {
+	r, err := simpleblob.NewReader(ctx, src, blob.Name)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	return simpleblob.StoreReader(ctx, dst, blob.Name, r, -1)
+}
+
+// sameContent returns whether a blob has the same content in both backends.
+func sameContent(ctx context.Context, a, b simpleblob.Interface, name string) (bool, error) {
+	ha, err := hash(ctx, a, name)
+	if err != nil {
+		return false, err
+	}
+	hb, err := hash(ctx, b, name)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(ha, hb), nil
+}
+
+func hash(ctx context.Context, st simpleblob.Interface, name string) ([]byte, error) {
+	r, err := simpleblob.NewReader(ctx, st, name)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+func sortedNames(blobs map[string]simpleblob.Blob) []string {
+	names := make([]string, 0, len(blobs))
+	for name := range blobs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
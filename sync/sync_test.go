@@ -0,0 +1,195 @@
+package sync_test
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/PowerDNS/simpleblob"
+	"github.com/PowerDNS/simpleblob/backends/memory"
+	blobsync "github.com/PowerDNS/simpleblob/sync"
+	"github.com/PowerDNS/simpleblob/tester"
+)
+
+func store(t *testing.T, b *memory.Backend, blobs map[string]string) {
+	t.Helper()
+	for name, data := range blobs {
+		require.NoError(t, b.Store(context.Background(), name, []byte(data)))
+	}
+}
+
+func content(t *testing.T, b *memory.Backend) map[string]string {
+	t.Helper()
+	ctx := context.Background()
+	ls, err := b.List(ctx, "")
+	require.NoError(t, err)
+	m := make(map[string]string)
+	for _, name := range ls.Names() {
+		data, err := b.Load(ctx, name)
+		require.NoError(t, err)
+		m[name] = string(data)
+	}
+	return m
+}
+
+// recorder collects the actions reported by Sync.
+type recorder struct {
+	mu      sync.Mutex
+	actions []string
+}
+
+func (r *recorder) add(a blobsync.Action) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.actions = append(r.actions, a.Op+" "+a.Name)
+}
+
+func (r *recorder) sorted() []string {
+	sort.Strings(r.actions)
+	return r.actions
+}
+
+func TestSync(t *testing.T) {
+	ctx := context.Background()
+	src, dst := memory.New(), memory.New()
+	store(t, src, map[string]string{
+		"a":      "1",
+		"b":      "22",
+		"c":      "333",
+		"sub/d":  "4",
+		"skip/e": "5",
+	})
+	store(t, dst, map[string]string{
+		"b":     "xx",  // same size, kept with CompareSize
+		"c":     "3",   // different size
+		"extra": "old", // only deleted with Delete
+	})
+
+	var rec recorder
+	res, err := blobsync.Sync(ctx, src, dst, blobsync.Options{
+		Exclude:  []string{"skip/"},
+		OnAction: rec.add,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, blobsync.Result{Copied: 3, Unchanged: 1, Bytes: 5}, res)
+	assert.Equal(t, []string{"copy a", "copy c", "copy sub/d"}, rec.sorted())
+	assert.Equal(t, map[string]string{
+		"a":     "1",
+		"b":     "xx",
+		"c":     "333",
+		"sub/d": "4",
+		"extra": "old",
+	}, content(t, dst))
+
+	// Content changes of the same size are only found by hash
+	rec = recorder{}
+	res, err = blobsync.Sync(ctx, src, dst, blobsync.Options{
+		Exclude:  []string{"skip/"},
+		Compare:  blobsync.CompareHash,
+		Delete:   true,
+		OnAction: rec.add,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, blobsync.Result{Copied: 1, Deleted: 1, Unchanged: 3, Bytes: 2}, res)
+	assert.Equal(t, []string{"copy b", "delete extra"}, rec.sorted())
+	assert.Equal(t, map[string]string{
+		"a":     "1",
+		"b":     "22",
+		"c":     "333",
+		"sub/d": "4",
+	}, content(t, dst))
+
+	// Nothing left to do
+	res, err = blobsync.Sync(ctx, src, dst, blobsync.Options{
+		Exclude: []string{"skip/"},
+		Compare: blobsync.CompareHash,
+		Delete:  true,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, blobsync.Result{Unchanged: 4}, res)
+}
+
+func TestSync_include(t *testing.T) {
+	ctx := context.Background()
+	src, dst := memory.New(), memory.New()
+	store(t, src, map[string]string{"in/a": "a", "in/x/b": "b", "out/c": "c"})
+	store(t, dst, map[string]string{"in/old": "d", "out/old": "e"})
+
+	res, err := blobsync.Sync(ctx, src, dst, blobsync.Options{
+		Include: []string{"in/"},
+		Exclude: []string{"in/x/"},
+		Delete:  true,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, blobsync.Result{Copied: 1, Deleted: 1, Bytes: 1}, res)
+	// Blobs outside the included prefixes are never deleted
+	assert.Equal(t, map[string]string{"in/a": "a", "out/old": "e"}, content(t, dst))
+}
+
+func TestSync_dryRun(t *testing.T) {
+	ctx := context.Background()
+	src, dst := memory.New(), memory.New()
+	store(t, src, map[string]string{"a": "1", "b": "22"})
+	store(t, dst, map[string]string{"c": "333"})
+
+	var rec recorder
+	res, err := blobsync.Sync(ctx, src, dst, blobsync.Options{
+		Delete:   true,
+		DryRun:   true,
+		OnAction: rec.add,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, blobsync.Result{Copied: 2, Deleted: 1, Bytes: 3}, res)
+	assert.Equal(t, []string{"copy a", "copy b", "delete c"}, rec.sorted())
+	assert.Equal(t, map[string]string{"c": "333"}, content(t, dst))
+}
+
+func TestSync_errors(t *testing.T) {
+	ctx := context.Background()
+	src, dst := memory.New(), memory.New()
+
+	_, err := blobsync.Sync(ctx, src, dst, blobsync.Options{Compare: "mtime"})
+	assert.ErrorContains(t, err, "invalid compare mode")
+
+	store(t, src, map[string]string{"a": "1"})
+	ro, err := memory.NewWithOptions(memory.Options{ReadOnly: true})
+	require.NoError(t, err)
+	_, err = blobsync.Sync(ctx, src, ro, blobsync.Options{})
+	assert.ErrorIs(t, err, memory.ErrReadOnly)
+}
+
+func TestSync_sameBlobs(t *testing.T) {
+	// A full sync leaves identical backends
+	ctx := context.Background()
+	src, dst := memory.New(), memory.New()
+	store(t, src, map[string]string{"x": "1", "y/z": "2"})
+	_, err := blobsync.Sync(ctx, src, dst, blobsync.Options{Concurrency: 1})
+	require.NoError(t, err)
+	tester.AssertSameBlobs(t, src, dst)
+}
+
+// growing is a memory backend where a blob grows right after it is listed.
+type growing struct {
+	*memory.Backend
+}
+
+func (g growing) List(ctx context.Context, prefix string) (simpleblob.BlobList, error) {
+	ls, err := g.Backend.List(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+	return ls, g.Backend.Store(ctx, "a", []byte("grown"))
+}
+
+func TestSync_changedAfterList(t *testing.T) {
+	ctx := context.Background()
+	src, dst := memory.New(), memory.New()
+	store(t, src, map[string]string{"a": "1"})
+	_, err := blobsync.Sync(ctx, growing{src}, dst, blobsync.Options{})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"a": "grown"}, content(t, dst))
+}
@@ -4,6 +4,10 @@ set -ex
 
 go test -count=1 "$@" ./...
 
+# Run the benchmarks briefly, so that they keep working and results show up
+# in the CI logs
+go test -count=1 -run '^$' -bench . -benchtime 100x ./backends/...
+
 # Run linters
 # Configure linters in .golangci.yml
 expected_version=1.61.0
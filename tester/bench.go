@@ -0,0 +1,95 @@
+package tester
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/PowerDNS/simpleblob"
+)
+
+// benchSizes are the payload sizes used by RunBenchmarks.
+var benchSizes = []int{1 << 10, 64 << 10, 1 << 20}
+
+// benchKeyCounts are the numbers of blobs listed by RunBenchmarks.
+var benchKeyCounts = []int{10, 1000}
+
+// RunBenchmarks runs Store, Load and List benchmarks against a backend,
+// with different payload sizes and numbers of blobs. Blobs are created
+// with names starting with "bench-" and deleted afterwards.
+func RunBenchmarks(b *testing.B, st simpleblob.Interface) {
+	ctx := context.Background()
+
+	for _, size := range benchSizes {
+		data := make([]byte, size)
+		name := fmt.Sprintf("bench-%d", size)
+
+		b.Run(fmt.Sprintf("Store/%s", sizeName(size)), func(b *testing.B) {
+			b.SetBytes(int64(size))
+			for i := 0; i < b.N; i++ {
+				if err := st.Store(ctx, name, data); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+
+		b.Run(fmt.Sprintf("Load/%s", sizeName(size)), func(b *testing.B) {
+			if err := st.Store(ctx, name, data); err != nil {
+				b.Fatal(err)
+			}
+			b.SetBytes(int64(size))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := st.Load(ctx, name); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+
+		if err := st.Delete(ctx, name); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	for _, count := range benchKeyCounts {
+		prefix := fmt.Sprintf("bench-list-%d/", count)
+		b.Run(fmt.Sprintf("List/%d", count), func(b *testing.B) {
+			for i := 0; i < count; i++ {
+				if err := st.Store(ctx, fmt.Sprintf("%s%06d", prefix, i), nil); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				ls, err := st.List(ctx, prefix)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if len(ls) != count {
+					b.Fatalf("listed %d blobs, expected %d", len(ls), count)
+				}
+			}
+		})
+
+		ls, err := st.List(ctx, prefix)
+		if err != nil {
+			b.Fatal(err)
+		}
+		for _, blob := range ls {
+			if err := st.Delete(ctx, blob.Name); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+// sizeName returns a short name for a payload size, like "64KiB".
+func sizeName(size int) string {
+	switch {
+	case size >= 1<<20 && size%(1<<20) == 0:
+		return fmt.Sprintf("%dMiB", size>>20)
+	case size >= 1<<10 && size%(1<<10) == 0:
+		return fmt.Sprintf("%dKiB", size>>10)
+	}
+	return fmt.Sprintf("%dB", size)
+}
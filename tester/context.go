@@ -0,0 +1,92 @@
+package tester
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/PowerDNS/simpleblob"
+	"github.com/stretchr/testify/assert"
+)
+
+// promptly is how fast operations must return once their context is done.
+const promptly = time.Second
+
+// DoContextTests tests that all operations of a backend return promptly
+// with the error of the context when it is cancelled or has expired, and
+// that writes with such a context have no effect.
+// The backend must not contain any blobs with names starting with "ctx-".
+func DoContextTests(t *testing.T, b simpleblob.Interface) {
+	ctx := context.Background()
+	assert.NoError(t, b.Store(ctx, "ctx-existing", []byte("foo")))
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	expired, cancel := context.WithDeadline(ctx, time.Now().Add(-time.Second))
+	defer cancel()
+	// Expires during the operation, unless it is very fast
+	short, cancel := context.WithTimeout(ctx, time.Microsecond)
+	defer cancel()
+
+	for _, tc := range []struct {
+		name string
+		ctx  context.Context
+		want error
+	}{
+		{"cancelled", cancelled, context.Canceled},
+		{"expired", expired, context.DeadlineExceeded},
+		{"short", short, context.DeadlineExceeded},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := tc.ctx
+			check := func(op string, f func() error) {
+				t.Helper()
+				start := time.Now()
+				err := f()
+				assert.Less(t, time.Since(start), promptly, "%s did not return promptly", op)
+				if tc.name == "short" && err == nil {
+					return // completed before the deadline
+				}
+				assert.ErrorIs(t, err, tc.want, op)
+			}
+
+			check("List", func() error {
+				_, err := b.List(ctx, "ctx-")
+				return err
+			})
+			check("Load", func() error {
+				_, err := b.Load(ctx, "ctx-existing")
+				return err
+			})
+			check("Store", func() error {
+				return b.Store(ctx, "ctx-new", []byte("bar"))
+			})
+			check("Delete", func() error {
+				return b.Delete(ctx, "ctx-existing")
+			})
+			check("NewReader", func() error {
+				r, err := simpleblob.NewReader(ctx, b, "ctx-existing")
+				if err == nil {
+					_ = r.Close()
+				}
+				return err
+			})
+
+			if tc.name == "short" {
+				// Whatever happened, the blobs must be intact
+				_ = b.Delete(context.Background(), "ctx-new")
+				assert.NoError(t, b.Store(context.Background(), "ctx-existing", []byte("foo")))
+				return
+			}
+			// Writes had no effect
+			_, err := b.Load(context.Background(), "ctx-new")
+			assert.ErrorIs(t, err, os.ErrNotExist)
+			data, err := b.Load(context.Background(), "ctx-existing")
+			assert.NoError(t, err)
+			assert.Equal(t, []byte("foo"), data)
+		})
+	}
+
+	assert.NoError(t, b.Delete(ctx, "ctx-existing"))
+}
@@ -0,0 +1,120 @@
+package tester
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/PowerDNS/simpleblob"
+	"github.com/stretchr/testify/assert"
+)
+
+// FolderMode describes how List handles names containing '/'.
+type FolderMode int
+
+const (
+	// FoldersRecursive means that List returns all blobs matching the
+	// prefix, which is the default for all backends.
+	FoldersRecursive FolderMode = iota
+	// FoldersAsPrefixes means that List returns a single name ending with
+	// '/' for every folder nested under the prefix, like the PrefixFolders
+	// option of the S3 backend.
+	FoldersAsPrefixes
+	// FoldersHidden means that List omits the blobs in folders nested under
+	// the prefix, like the HideFolders option of the S3 backend.
+	FoldersHidden
+)
+
+// FolderOptions describes how a backend handles folders.
+type FolderOptions struct {
+	Mode FolderMode
+	// NoBlobAndFolder means that a name cannot be used for both a blob and
+	// a folder, like with the fs backend, or that the blob then shadows the
+	// folder when listing, like with S3. The tests then do not do this.
+	NoBlobAndFolder bool
+}
+
+// DoFolderTests tests how a backend lists and handles nested names, both
+// directly and through simpleblob.WithPrefix.
+// The backend must be empty.
+func DoFolderTests(t *testing.T, b simpleblob.Interface, opt FolderOptions) {
+	t.Run("direct", func(t *testing.T) {
+		doFolderTests(t, b, opt)
+	})
+	t.Run("prefixed", func(t *testing.T) {
+		doFolderTests(t, simpleblob.WithPrefix(b, "prefixed/"), opt)
+		ls, err := b.List(context.Background(), "")
+		assert.NoError(t, err)
+		assert.Empty(t, ls.Names(), "blobs left after deleting through the prefix")
+	})
+}
+
+func doFolderTests(t *testing.T, b simpleblob.Interface, opt FolderOptions) {
+	ctx := context.Background()
+
+	// "dirx" shares a prefix with "dir" but is not in the folder
+	names := []string{"a", "dir/b", "dir/sub/c", "dirx"}
+	if !opt.NoBlobAndFolder {
+		names = append(names, "dir")
+	}
+	for _, name := range names {
+		assert.NoError(t, b.Store(ctx, name, []byte(name)), "store %q", name)
+	}
+	for _, name := range names {
+		data, err := b.Load(ctx, name)
+		assert.NoError(t, err, "load %q", name)
+		assert.Equal(t, []byte(name), data, "load %q", name)
+	}
+
+	list := func(prefix string, recursive, prefixes, hidden []string) {
+		t.Helper()
+		ls, err := b.List(ctx, prefix)
+		assert.NoError(t, err)
+		expected := hidden
+		switch opt.Mode {
+		case FoldersRecursive:
+			expected = recursive
+		case FoldersAsPrefixes:
+			expected = prefixes
+		}
+		assert.Equal(t, expected, ls.Names(), "list %q", prefix)
+	}
+	// withDir adds "dir" before the other names if it was stored
+	withDir := func(names ...string) []string {
+		if opt.NoBlobAndFolder {
+			return names
+		}
+		return append([]string{names[0], "dir"}, names[1:]...)
+	}
+
+	list("",
+		withDir("a", "dir/b", "dir/sub/c", "dirx"),
+		withDir("a", "dir/", "dirx"),
+		withDir("a", "dirx"))
+	list("dir/",
+		[]string{"dir/b", "dir/sub/c"},
+		[]string{"dir/b", "dir/sub/"},
+		[]string{"dir/b"})
+	list("dir/sub/",
+		[]string{"dir/sub/c"},
+		[]string{"dir/sub/c"},
+		[]string{"dir/sub/c"})
+	list("dir/s",
+		[]string{"dir/sub/c"},
+		[]string{"dir/sub/"},
+		nil)
+
+	// The folder disappears with its last blob
+	assert.NoError(t, b.Delete(ctx, "dir/sub/c"))
+	list("dir/",
+		[]string{"dir/b"},
+		[]string{"dir/b"},
+		[]string{"dir/b"})
+	_, err := b.Load(ctx, "dir/sub/c")
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	for _, name := range names {
+		assert.NoError(t, b.Delete(ctx, name), "delete %q", name)
+	}
+	list("", nil, nil, nil)
+}
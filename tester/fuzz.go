@@ -0,0 +1,82 @@
+package tester
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/PowerDNS/simpleblob"
+)
+
+// maxFuzzPayload is the size above which fuzz inputs are skipped.
+const maxFuzzPayload = 1 << 20
+
+// FuzzBackend fuzzes the handling of names and payloads by the backends
+// returned by factory, which may be called for every input. Names that
+// fail simpleblob.CheckName are skipped. The backend may reject other
+// names with an error, but must then not list them. Otherwise, the blob
+// must round-trip and be deleted.
+//
+// The seed corpus contains the TrickyNames.
+func FuzzBackend(f *testing.F, factory func() simpleblob.Interface) {
+	f.Add("foo", []byte("bar"))
+	f.Add("dir/foo", []byte{})
+	f.Add("a", []byte{0, 0xff, '\n', '\r'})
+	for _, name := range TrickyNames {
+		f.Add(name, []byte(name))
+	}
+
+	f.Fuzz(func(t *testing.T, name string, data []byte) {
+		if simpleblob.CheckName(name) != nil || len(data) > maxFuzzPayload {
+			t.Skip()
+		}
+		ctx := context.Background()
+		st := factory()
+
+		if err := st.Store(ctx, name, data); err != nil {
+			ls, err := st.List(ctx, name)
+			if err != nil {
+				t.Fatalf("list %q: %v", name, err)
+			}
+			for _, blob := range ls {
+				if blob.Name == name {
+					t.Fatalf("%q listed after failed store", name)
+				}
+			}
+			return
+		}
+
+		loaded, err := st.Load(ctx, name)
+		if err != nil {
+			t.Fatalf("load %q: %v", name, err)
+		}
+		if !bytes.Equal(data, loaded) {
+			t.Fatalf("load %q: got %d bytes, expected %d", name, len(loaded), len(data))
+		}
+		ls, err := st.List(ctx, name)
+		if err != nil {
+			t.Fatalf("list %q: %v", name, err)
+		}
+		found := false
+		for _, blob := range ls {
+			if blob.Name == name {
+				found = true
+				if blob.Size != int64(len(data)) {
+					t.Fatalf("list %q: size %d, expected %d", name, blob.Size, len(data))
+				}
+			}
+		}
+		if !found {
+			t.Fatalf("%q not listed with itself as prefix: %v", name, ls.Names())
+		}
+
+		if err := st.Delete(ctx, name); err != nil {
+			t.Fatalf("delete %q: %v", name, err)
+		}
+		if _, err := st.Load(ctx, name); !errors.Is(err, os.ErrNotExist) {
+			t.Fatalf("load %q after delete: %v", name, err)
+		}
+	})
+}
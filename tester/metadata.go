@@ -0,0 +1,105 @@
+package tester
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/PowerDNS/simpleblob"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// DoMetadataTests tests Stat, and StoreWithMetadata and LoadMetadata if the
+// backend is a simpleblob.MetadataStorer. Modification times and ETags are
+// only checked if the backend returns them.
+// The backend must not contain any blobs with names starting with "meta-".
+func DoMetadataTests(t *testing.T, b simpleblob.Interface) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Missing blob
+	_, err := simpleblob.Stat(ctx, b, "meta-foo")
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	exists, err := simpleblob.Exists(ctx, b, "meta-foo")
+	assert.NoError(t, err)
+	assert.False(t, exists)
+
+	// Modification times may have a resolution of a second
+	before := time.Now().Truncate(time.Second)
+	require.NoError(t, b.Store(ctx, "meta-foo", []byte("foo")))
+	info, err := simpleblob.Stat(ctx, b, "meta-foo")
+	require.NoError(t, err)
+	assert.Equal(t, "meta-foo", info.Name)
+	assert.EqualValues(t, 3, info.Size)
+	if !info.ModTime.IsZero() {
+		assert.False(t, info.ModTime.Before(before), "modtime %v before store at %v", info.ModTime, before)
+		assert.False(t, info.ModTime.After(time.Now().Add(time.Minute)), "modtime %v in the future", info.ModTime)
+	}
+	exists, err = simpleblob.Exists(ctx, b, "meta-foo")
+	assert.NoError(t, err)
+	assert.True(t, exists)
+
+	// Stable without writes
+	again, err := simpleblob.Stat(ctx, b, "meta-foo")
+	require.NoError(t, err)
+	assert.Equal(t, info.ETag, again.ETag)
+	assert.True(t, info.ModTime.Equal(again.ModTime), "modtime changed without writes")
+
+	// List agrees with Stat
+	ls, err := b.List(ctx, "meta-foo")
+	assert.NoError(t, err)
+	if assert.Len(t, ls, 1) {
+		assert.Equal(t, info.Size, ls[0].Size)
+		if !ls[0].ModTime.IsZero() && !info.ModTime.IsZero() {
+			assert.True(t, info.ModTime.Equal(ls[0].ModTime), "modtime differs between List and Stat")
+		}
+	}
+
+	// Overwrite
+	require.NoError(t, b.Store(ctx, "meta-foo", []byte("foobar")))
+	over, err := simpleblob.Stat(ctx, b, "meta-foo")
+	require.NoError(t, err)
+	assert.EqualValues(t, 6, over.Size)
+	assert.False(t, over.ModTime.Before(info.ModTime), "modtime went backwards")
+	if info.ETag != "" {
+		assert.NotEqual(t, info.ETag, over.ETag, "ETag did not change with the content")
+	}
+
+	// Delete
+	require.NoError(t, b.Delete(ctx, "meta-foo"))
+	_, err = simpleblob.Stat(ctx, b, "meta-foo")
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	exists, err = simpleblob.Exists(ctx, b, "meta-foo")
+	assert.NoError(t, err)
+	assert.False(t, exists)
+
+	ms, ok := b.(simpleblob.MetadataStorer)
+	if !ok {
+		return
+	}
+	md := simpleblob.Metadata{
+		ContentType: "text/plain",
+		User:        map[string]string{"origin": "tester"},
+	}
+	require.NoError(t, ms.StoreWithMetadata(ctx, "meta-md", []byte("foo"), md))
+	loaded, err := ms.LoadMetadata(ctx, "meta-md")
+	assert.NoError(t, err)
+	assert.Equal(t, md.ContentType, loaded.ContentType)
+	assert.Equal(t, md.User, loaded.User)
+	info, err = simpleblob.Stat(ctx, b, "meta-md")
+	assert.NoError(t, err)
+	assert.EqualValues(t, 3, info.Size)
+
+	// Storing without metadata clears it
+	require.NoError(t, b.Store(ctx, "meta-md", []byte("bar")))
+	loaded, err = ms.LoadMetadata(ctx, "meta-md")
+	assert.NoError(t, err)
+	assert.Empty(t, loaded.ContentType)
+	assert.Empty(t, loaded.User)
+
+	require.NoError(t, b.Delete(ctx, "meta-md"))
+	_, err = ms.LoadMetadata(ctx, "meta-md")
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
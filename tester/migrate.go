@@ -0,0 +1,115 @@
+package tester
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"testing"
+
+	"github.com/PowerDNS/simpleblob"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// datasetNames are the names of the generated dataset. They are meant to
+// be portable across all backends.
+var datasetNames = []string{
+	"empty",
+	"small",
+	"medium",
+	"large",
+	"dir/a",
+	"dir/sub/b",
+	"dir-sibling",
+	"unicode-é-日本語",
+	"with space+plus%percent",
+}
+
+// DoMigrationTests stores a generated dataset in the first backend, then
+// copies it from each backend to the next one, and verifies that every
+// backend ends up with the same names, sizes and content.
+// The backends must be empty, and are emptied afterwards.
+func DoMigrationTests(t *testing.T, chain ...simpleblob.Interface) {
+	require.GreaterOrEqual(t, len(chain), 2, "need at least two backends")
+	ctx := context.Background()
+
+	for i, name := range datasetNames {
+		require.NoError(t, chain[0].Store(ctx, name, datasetContent(i)), "store %q", name)
+	}
+	for i := 1; i < len(chain); i++ {
+		require.NoError(t, copyAll(ctx, chain[i-1], chain[i]), "copy to backend %d", i)
+		AssertSameBlobs(t, chain[0], chain[i])
+	}
+
+	for _, st := range chain {
+		for _, name := range datasetNames {
+			assert.NoError(t, st.Delete(ctx, name))
+		}
+	}
+}
+
+// datasetContent returns deterministic content of various sizes, which
+// is not the same for any two blobs.
+func datasetContent(i int) []byte {
+	sizes := []int{0, 1, 4 << 10, 256 << 10}
+	size := sizes[i%len(sizes)] + i
+	data := make([]byte, size)
+	for j := range data {
+		data[j] = byte(i*31 + j*7)
+	}
+	return data
+}
+
+// copyAll copies all blobs from src to dst.
+func copyAll(ctx context.Context, src, dst simpleblob.Interface) error {
+	ls, err := src.List(ctx, "")
+	if err != nil {
+		return err
+	}
+	for _, blob := range ls {
+		data, err := src.Load(ctx, blob.Name)
+		if err != nil {
+			return err
+		}
+		if err := dst.Store(ctx, blob.Name, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AssertSameBlobs asserts that a and b contain the same blobs, with the
+// same sizes and content.
+func AssertSameBlobs(t *testing.T, a, b simpleblob.Interface) bool {
+	t.Helper()
+	ha, err := blobHashes(a)
+	if !assert.NoError(t, err) {
+		return false
+	}
+	hb, err := blobHashes(b)
+	if !assert.NoError(t, err) {
+		return false
+	}
+	return assert.Equal(t, ha, hb)
+}
+
+// blobHashes returns the size and SHA-256 hash of every blob in st.
+func blobHashes(st simpleblob.Interface) (map[string]string, error) {
+	ctx := context.Background()
+	ls, err := st.List(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	hashes := make(map[string]string, len(ls))
+	for _, blob := range ls {
+		data, err := st.Load(ctx, blob.Name)
+		if err != nil {
+			return nil, err
+		}
+		if int64(len(data)) != blob.Size {
+			return nil, fmt.Errorf("%q: listed with size %d, loaded %d bytes", blob.Name, blob.Size, len(data))
+		}
+		hashes[blob.Name] = fmt.Sprintf("%d:%x", len(data), sha256.Sum256(data))
+	}
+	return hashes, nil
+}
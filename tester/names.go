@@ -0,0 +1,113 @@
+package tester
+
+import (
+	"context"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/PowerDNS/simpleblob"
+	"github.com/stretchr/testify/assert"
+)
+
+// TrickyNames are names that backends may get wrong because of encoding,
+// escaping or length. They are valid according to simpleblob.CheckName.
+var TrickyNames = []string{
+	"unicode-é",
+	"unicode-日本語",
+	"unicode-😀",
+	"unicode-e\u0301", // decomposed é, distinct from the one above
+	"with space",
+	"with  two  spaces ",
+	"plus+sign",
+	"percent%20encoded",
+	"percent%",
+	"question?mark",
+	"hash#mark",
+	"amp&ersand",
+	"equals=sign",
+	"semicolon;",
+	"quote'and\"double",
+	"back\\slash",
+	"tilde~",
+	"brackets[0]{1}(2)",
+	"star*",
+	"colon:",
+	"pipe|",
+	"angle<>",
+	"dir/unicode-é",
+	"update-marker", // the S3 update marker
+	".hidden",
+	"ends-with.tmp",
+	"long-" + strings.Repeat("x", 250), // 255 bytes, the usual file name limit
+	"long/" + strings.TrimSuffix(strings.Repeat(strings.Repeat("y", 99)+"/", 10), "/"),
+}
+
+// DoNameTests tests that blobs with each of the TrickyNames can be stored,
+// listed, loaded and deleted, unless the backend declares that it rejects
+// them, in which case storing must fail.
+// The backend must be empty.
+func DoNameTests(t *testing.T, b simpleblob.Interface, caps Capabilities) {
+	ctx := context.Background()
+
+	for _, name := range TrickyNames {
+		if err := simpleblob.CheckName(name); err != nil {
+			t.Fatalf("invalid tricky name: %v", err)
+		}
+		data := []byte("data of " + name)
+
+		if caps.rejectsName(name) {
+			assert.Error(t, b.Store(ctx, name, data), "%q should be rejected", name)
+			ls, err := b.List(ctx, "")
+			assert.NoError(t, err)
+			assert.NotContains(t, ls.Names(), name)
+			continue
+		}
+
+		if !assert.NoError(t, b.Store(ctx, name, data), "store %q", name) {
+			continue
+		}
+		loaded, err := b.Load(ctx, name)
+		assert.NoError(t, err, "load %q", name)
+		assert.Equal(t, data, loaded, "load %q", name)
+
+		r, err := simpleblob.NewReader(ctx, b, name)
+		if assert.NoError(t, err, "reader %q", name) {
+			loaded, err = io.ReadAll(r)
+			assert.NoError(t, err)
+			assert.Equal(t, data, loaded, "reader %q", name)
+			assert.NoError(t, r.Close())
+		}
+
+		ls, err := b.List(ctx, name)
+		assert.NoError(t, err)
+		assert.Contains(t, ls.Names(), name, "list with prefix %q", name)
+		for _, blob := range ls {
+			if blob.Name == name {
+				assert.EqualValues(t, len(data), blob.Size, "size of %q", name)
+			}
+		}
+	}
+
+	// All accepted names are listed, exactly as stored and sorted
+	var expected []string
+	for _, name := range TrickyNames {
+		if !caps.rejectsName(name) {
+			expected = append(expected, name)
+		}
+	}
+	ls, err := b.List(ctx, "")
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, expected, ls.Names())
+	assert.IsIncreasing(t, ls.Names())
+
+	for _, name := range expected {
+		assert.NoError(t, b.Delete(ctx, name), "delete %q", name)
+		_, err := b.Load(ctx, name)
+		assert.ErrorIs(t, err, os.ErrNotExist, "load %q after delete", name)
+	}
+	ls, err = b.List(ctx, "")
+	assert.NoError(t, err)
+	assert.Empty(t, ls.Names())
+}
@@ -0,0 +1,131 @@
+package tester
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/PowerDNS/simpleblob"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// largeSize is the size of the payload used to test streaming. It is
+// larger than the default buffer sizes of the backends, and not a multiple
+// of common block sizes.
+const largeSize = 8<<20 + 7
+
+// DoStreamTests tests the NewReader and NewWriter semantics of a backend.
+// It also works for backends without a StreamReader or StreamWriter
+// implementation, in which case the fallbacks are tested.
+// The backend must not contain any blobs with names starting with "stream-".
+func DoStreamTests(t *testing.T, b simpleblob.Interface) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Not visible before Close
+	w, err := simpleblob.NewWriter(ctx, b, "stream-foo")
+	require.NoError(t, err)
+	_, err = w.Write([]byte("foo"))
+	assert.NoError(t, err)
+	_, err = b.Load(ctx, "stream-foo")
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	ls, err := b.List(ctx, "stream-")
+	assert.NoError(t, err)
+	assert.Empty(t, ls.Names())
+	assert.NoError(t, w.Close())
+
+	// Double Close fails and does not change the blob
+	assert.Error(t, w.Close())
+	_, err = w.Write([]byte("bar")) // Cannot write after close
+	assert.Error(t, err)
+	data, err := b.Load(ctx, "stream-foo")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("foo"), data)
+
+	// Overwrite with an empty blob
+	w, err = simpleblob.NewWriter(ctx, b, "stream-foo")
+	require.NoError(t, err)
+	assert.NoError(t, w.Close())
+	data, err = b.Load(ctx, "stream-foo")
+	assert.NoError(t, err)
+	assert.Empty(t, data)
+
+	// Large payload, written in odd chunks
+	large := make([]byte, largeSize)
+	for i := range large {
+		large[i] = byte(i % 251)
+	}
+	w, err = simpleblob.NewWriter(ctx, b, "stream-large")
+	require.NoError(t, err)
+	for p := large; len(p) > 0; {
+		n := min(len(p), 65537)
+		written, err := w.Write(p[:n])
+		require.NoError(t, err)
+		require.Equal(t, n, written)
+		p = p[n:]
+	}
+	assert.NoError(t, w.Close())
+	ls, err = b.List(ctx, "stream-large")
+	assert.NoError(t, err)
+	if assert.Len(t, ls, 1) {
+		assert.EqualValues(t, largeSize, ls[0].Size)
+	}
+	r, err := simpleblob.NewReader(ctx, b, "stream-large")
+	require.NoError(t, err)
+	data, err = io.ReadAll(r)
+	assert.NoError(t, err)
+	assert.True(t, bytes.Equal(large, data), "large payload differs")
+	assert.NoError(t, r.Close())
+
+	// Reader of a missing blob
+	_, err = simpleblob.NewReader(ctx, b, "stream-missing")
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	// Cancelled before the writer is created
+	cancelled, cancelNow := context.WithCancel(ctx)
+	cancelNow()
+	if w, err = simpleblob.NewWriter(cancelled, b, "stream-cancelled"); err == nil {
+		_, _ = w.Write([]byte("foo"))
+		assert.Error(t, w.Close(), "Close with a cancelled context")
+	}
+	_, err = b.Load(ctx, "stream-cancelled")
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	// Cancelled mid-stream: the blob is either complete or not stored
+	wctx, wcancel := context.WithCancel(ctx)
+	w, err = simpleblob.NewWriter(wctx, b, "stream-mid")
+	require.NoError(t, err)
+	_, err = w.Write(large[:largeSize/2])
+	assert.NoError(t, err)
+	wcancel()
+	_, werr := w.Write(large[largeSize/2:])
+	cerr := w.Close()
+	data, err = b.Load(ctx, "stream-mid")
+	if werr == nil && cerr == nil {
+		assert.NoError(t, err)
+		assert.True(t, bytes.Equal(large, data), "blob stored after cancel differs")
+	} else {
+		assert.ErrorIs(t, err, os.ErrNotExist, "partial blob stored after cancel")
+	}
+
+	// Reader cancelled mid-stream: fails or returns everything
+	rctx, rcancel := context.WithCancel(ctx)
+	r, err = simpleblob.NewReader(rctx, b, "stream-large")
+	require.NoError(t, err)
+	_, err = io.ReadFull(r, make([]byte, 1024))
+	assert.NoError(t, err)
+	rcancel()
+	rest, err := io.ReadAll(r)
+	if err == nil {
+		assert.True(t, bytes.Equal(large[1024:], rest), "truncated read after cancel")
+	}
+	assert.NoError(t, r.Close())
+
+	// Clean up
+	for _, name := range []string{"stream-foo", "stream-large", "stream-mid"} {
+		assert.NoError(t, b.Delete(ctx, name))
+	}
+}
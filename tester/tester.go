@@ -5,17 +5,71 @@ import (
 	"io"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/PowerDNS/simpleblob"
 	"github.com/stretchr/testify/assert"
-	"github.com/stretchr/testify/require"
 )
 
+// Capabilities describes legitimate differences between backends, which
+// the tests take into account.
+type Capabilities struct {
+	// RejectsName returns whether the backend refuses to store a blob with
+	// the given name, which must then return an error.
+	RejectsName func(name string) bool
+	// NoOverwrite means that storing a blob that already exists fails,
+	// like with write-once storage.
+	NoOverwrite bool
+	// NoFolders means that names containing '/' are rejected, which is
+	// then checked.
+	NoFolders bool
+	// EventuallyConsistent means that List may not immediately reflect
+	// writes and deletes, so its results are not checked after them.
+	EventuallyConsistent bool
+	// ConsistencyWindow, if set, is how long List may take to reflect
+	// writes and deletes. Its results are then checked again until they
+	// are as expected or the window has passed. It takes precedence over
+	// EventuallyConsistent.
+	ConsistencyWindow time.Duration
+}
+
+// rejectsName calls RejectsName if set.
+func (c Capabilities) rejectsName(name string) bool {
+	return c.RejectsName != nil && c.RejectsName(name)
+}
+
 // DoBackendTests tests a backend for conformance
 func DoBackendTests(t *testing.T, b simpleblob.Interface) {
+	DoBackendTestsWith(t, b, Capabilities{})
+}
+
+// DoBackendTestsWith tests a backend for conformance, taking its
+// capabilities into account. The backend must be empty.
+func DoBackendTestsWith(t *testing.T, b simpleblob.Interface, caps Capabilities) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	// listed checks the blobs returned by List after a write, within the
+	// ConsistencyWindow if set, or not at all if List is eventually
+	// consistent.
+	listed := func(prefix string, check func(t assert.TestingT, ls simpleblob.BlobList)) {
+		t.Helper()
+		if window := caps.ConsistencyWindow; window > 0 {
+			assert.EventuallyWithT(t, func(c *assert.CollectT) {
+				ls, err := b.List(ctx, prefix)
+				if assert.NoError(c, err) {
+					check(c, ls)
+				}
+			}, window, min(window/10, 100*time.Millisecond), "list %q", prefix)
+			return
+		}
+		ls, err := b.List(ctx, prefix)
+		assert.NoError(t, err)
+		if !caps.EventuallyConsistent {
+			check(t, ls)
+		}
+	}
+
 	// Starts empty
 	ls, err := b.List(ctx, "")
 	assert.NoError(t, err)
@@ -31,23 +85,30 @@ func DoBackendTests(t *testing.T, b simpleblob.Interface) {
 	assert.NoError(t, err)
 
 	// Overwrite
+	bar1 := []byte("bar1")
 	err = b.Store(ctx, "bar-1", []byte("bar1"))
-	assert.NoError(t, err)
+	if caps.NoOverwrite {
+		assert.Error(t, err)
+		bar1 = []byte("bar")
+	} else {
+		assert.NoError(t, err)
+	}
 
 	// List all
-	ls, err = b.List(ctx, "")
-	assert.NoError(t, err)
-	assert.Equal(t, ls.Names(), []string{"bar-1", "bar-2", "foo-1"}) // sorted
+	listed("", func(t assert.TestingT, ls simpleblob.BlobList) {
+		assert.Equal(t, ls.Names(), []string{"bar-1", "bar-2", "foo-1"}) // sorted
+	})
 
 	// List with prefix
-	ls, err = b.List(ctx, "foo-")
-	assert.NoError(t, err)
-	assert.Equal(t, ls.Names(), []string{"foo-1"})
-	require.NotEmpty(t, ls)
-	assert.Equal(t, ls[0].Size, int64(3))
-	ls, err = b.List(ctx, "bar-")
-	assert.NoError(t, err)
-	assert.Equal(t, ls.Names(), []string{"bar-1", "bar-2"}) // sorted
+	listed("foo-", func(t assert.TestingT, ls simpleblob.BlobList) {
+		assert.Equal(t, ls.Names(), []string{"foo-1"})
+		if assert.NotEmpty(t, ls) {
+			assert.Equal(t, ls[0].Size, int64(3))
+		}
+	})
+	listed("bar-", func(t assert.TestingT, ls simpleblob.BlobList) {
+		assert.Equal(t, ls.Names(), []string{"bar-1", "bar-2"}) // sorted
+	})
 
 	// List with non-existing prefix
 	ls, err = b.List(ctx, "does-not-exist-")
@@ -72,13 +133,13 @@ func DoBackendTests(t *testing.T, b simpleblob.Interface) {
 	// Check overwritten data
 	data, err = b.Load(ctx, "bar-1")
 	assert.NoError(t, err)
-	assert.Equal(t, data, []byte("bar1"))
+	assert.Equal(t, data, bar1)
 
 	// Verify that Load makes a copy
 	data[0] = '!'
 	data, err = b.Load(ctx, "bar-1")
 	assert.NoError(t, err)
-	assert.Equal(t, data, []byte("bar1"))
+	assert.Equal(t, data, bar1)
 
 	// Change foo buffer to verify that Store made a copy
 	foo[0] = '!'
@@ -96,18 +157,26 @@ func DoBackendTests(t *testing.T, b simpleblob.Interface) {
 	ls, err = b.List(ctx, "") // File should not exist before close
 	assert.NoError(t, err)
 	assert.NotContains(t, ls.Names(), "fizz")
-	assert.Equal(t, ls.Names(), []string{"bar-1", "bar-2", "foo-1"})
+	listed("", func(t assert.TestingT, ls simpleblob.BlobList) {
+		assert.Equal(t, ls.Names(), []string{"bar-1", "bar-2", "foo-1"})
+	})
 	assert.NoError(t, w.Close()) // Normal close
 	assert.EqualValues(t, len(buzz), n)
 	data, err = b.Load(ctx, "fizz")
 	assert.NoError(t, err)
 	assert.Equal(t, buzz, data)
-	ls, err = b.List(ctx, "")
-	assert.NoError(t, err)
-	assert.Contains(t, ls.Names(), "fizz")
+	listed("", func(t assert.TestingT, ls simpleblob.BlobList) {
+		assert.Contains(t, ls.Names(), "fizz")
+	})
 	_, err = w.Write(buzz) // Cannot write after close
 	assert.Error(t, err)
 
+	// Names with folders are rejected. Folder support itself is tested by
+	// DoFolderTests.
+	if caps.NoFolders {
+		assert.Error(t, b.Store(ctx, "dir/a", []byte("a")))
+	}
+
 	// Load non-existing
 	_, err = b.Load(ctx, "does-not-exist")
 	assert.ErrorIs(t, err, os.ErrNotExist)
@@ -129,7 +198,7 @@ func DoBackendTests(t *testing.T, b simpleblob.Interface) {
 	assert.ErrorIs(t, err, os.ErrNotExist)
 
 	// Should not appear in list anymore
-	ls, err = b.List(ctx, "")
-	assert.NoError(t, err)
-	assert.NotContains(t, ls.Names(), "foo-1")
+	listed("", func(t assert.TestingT, ls simpleblob.BlobList) {
+		assert.NotContains(t, ls.Names(), "foo-1")
+	})
 }
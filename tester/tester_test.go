@@ -0,0 +1,43 @@
+package tester_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/PowerDNS/simpleblob"
+	"github.com/PowerDNS/simpleblob/backends/memory"
+	"github.com/PowerDNS/simpleblob/tester"
+)
+
+// lagging is a backend whose List results are only refreshed after a delay,
+// like an eventually consistent store.
+type lagging struct {
+	*memory.Backend
+	lag time.Duration
+
+	mu      sync.Mutex
+	listed  simpleblob.BlobList
+	updated time.Time
+}
+
+func (l *lagging) List(ctx context.Context, prefix string) (simpleblob.BlobList, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if time.Since(l.updated) > l.lag {
+		ls, err := l.Backend.List(ctx, "")
+		if err != nil {
+			return nil, err
+		}
+		l.listed, l.updated = ls, time.Now()
+	}
+	return l.listed.WithPrefix(prefix), nil
+}
+
+func TestDoBackendTestsWith_consistencyWindow(t *testing.T) {
+	b := &lagging{Backend: memory.New(), lag: 50 * time.Millisecond}
+	tester.DoBackendTestsWith(t, b, tester.Capabilities{
+		ConsistencyWindow: time.Second,
+	})
+}
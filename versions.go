@@ -0,0 +1,32 @@
+package simpleblob
+
+import (
+	"context"
+	"time"
+)
+
+// Version describes a previous revision of a blob.
+type Version struct {
+	// ID identifies the version for LoadVersion. Its format depends on the
+	// backend.
+	ID   string
+	Size int64
+	// Time is when this version was replaced or deleted, or when it was
+	// stored if the backend keeps the current version in the list as well.
+	Time time.Time
+	// Deleted is true if this version marks the deletion of the blob.
+	Deleted bool
+	// Current is true for the version returned by Load. Backends that
+	// only list previous versions never set it.
+	Current bool
+}
+
+// A Versioner is an Interface keeping previous versions of blobs.
+type Versioner interface {
+	Interface
+	// ListVersions returns the versions of the named blob, oldest first.
+	ListVersions(ctx context.Context, name string) ([]Version, error)
+	// LoadVersion brings a version of a blob, chosen by name and version
+	// ID, into memory.
+	LoadVersion(ctx context.Context, name, id string) ([]byte, error)
+}
@@ -0,0 +1,237 @@
+package batch
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/PowerDNS/simpleblob"
+)
+
+// DefaultTempPrefix is the default value for TempPrefix.
+const DefaultTempPrefix = "simpleblob-batch-"
+
+// ErrCommitted is returned when a Batch is used after Commit or Discard.
+var ErrCommitted = errors.New("batch: already committed")
+
+// Options describes the options for the batch wrapper
+type Options struct {
+	// TempPrefix is the prefix of the names data is staged under before
+	// being applied. It is hidden from List.
+	// It defaults to DefaultTempPrefix.
+	TempPrefix string
+}
+
+// Backend is a wrapper offering batches of Store and Delete operations
+// through its Batch method. Other operations go to the wrapped backend.
+type Backend struct {
+	st  simpleblob.Interface
+	opt Options
+
+	mu sync.Mutex // serializes commits
+}
+
+func (b *Backend) List(ctx context.Context, prefix string) (simpleblob.BlobList, error) {
+	blobs, err := b.st.List(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+	var res simpleblob.BlobList
+	for _, blob := range blobs {
+		if !strings.HasPrefix(blob.Name, b.opt.TempPrefix) {
+			res = append(res, blob)
+		}
+	}
+	return res, nil
+}
+
+func (b *Backend) Load(ctx context.Context, name string) ([]byte, error) {
+	return b.st.Load(ctx, name)
+}
+
+func (b *Backend) Store(ctx context.Context, name string, data []byte) error {
+	return b.st.Store(ctx, name, data)
+}
+
+func (b *Backend) Delete(ctx context.Context, name string) error {
+	return b.st.Delete(ctx, name)
+}
+
+// NewReader satisfies StreamReader, using the wrapped backend's
+// implementation if it has one.
+func (b *Backend) NewReader(ctx context.Context, name string) (io.ReadCloser, error) {
+	return simpleblob.NewReader(ctx, b.st, name)
+}
+
+// NewWriter satisfies StreamWriter, using the wrapped backend's
+// implementation if it has one.
+func (b *Backend) NewWriter(ctx context.Context, name string) (io.WriteCloser, error) {
+	return simpleblob.NewWriter(ctx, b.st, name)
+}
+
+// Batch returns a new empty batch.
+func (b *Backend) Batch() *Batch {
+	return &Batch{b: b}
+}
+
+// op is a staged operation. A nil data means a deletion.
+type op struct {
+	name string
+	data []byte
+}
+
+// Batch stages Store and Delete operations until Commit.
+//
+// Commit first writes all data under temporary names, then copies them to
+// their final names, and restores the previous contents on a best-effort
+// basis if one of them fails. The slow and failure prone part happens before
+// anything visible changes, so readers never observe a partial update caused
+// by a failed upload, only one while the copies are applied. The copies are
+// cheap if the wrapped backend is a simpleblob.Copier, like fs or s3, and
+// use Load and Store otherwise.
+//
+// A Batch is not safe for concurrent use.
+type Batch struct {
+	b    *Backend
+	ops  []op
+	done bool
+}
+
+// Store stages storing data under name. The data must not be modified until
+// Commit returns.
+func (bt *Batch) Store(name string, data []byte) {
+	if data == nil {
+		data = []byte{}
+	}
+	bt.ops = append(bt.ops, op{name: name, data: data})
+}
+
+// Delete stages deleting name.
+func (bt *Batch) Delete(name string) {
+	bt.ops = append(bt.ops, op{name: name})
+}
+
+// Len returns the number of staged operations.
+func (bt *Batch) Len() int {
+	return len(bt.ops)
+}
+
+// Discard drops all staged operations.
+func (bt *Batch) Discard() {
+	bt.ops = nil
+	bt.done = true
+}
+
+// previous is the content of a name before the batch was applied.
+type previous struct {
+	name   string
+	data   []byte
+	exists bool
+}
+
+// Commit applies the staged operations in order. If it fails, the
+// operations already applied are rolled back on a best-effort basis,
+// and errors encountered during the rollback are joined to the returned
+// error.
+func (bt *Batch) Commit(ctx context.Context) (err error) {
+	if bt.done {
+		return ErrCommitted
+	}
+	bt.done = true
+	b := bt.b
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// Stage the data under temporary names
+	temps := make(map[int]string)
+	defer func() {
+		// Always clean up, even if the context was canceled
+		ctx := context.WithoutCancel(ctx)
+		for _, name := range temps {
+			if derr := b.st.Delete(ctx, name); derr != nil && !errors.Is(derr, os.ErrNotExist) {
+				err = errors.Join(err, fmt.Errorf("batch: delete %q: %w", name, derr))
+			}
+		}
+	}()
+	id, err := randomID()
+	if err != nil {
+		return err
+	}
+	for i, o := range bt.ops {
+		if o.data == nil {
+			continue
+		}
+		temp := b.opt.TempPrefix + id + "-" + strconv.Itoa(i)
+		temps[i] = temp
+		if err := b.st.Store(ctx, temp, o.data); err != nil {
+			return fmt.Errorf("batch: stage %q: %w", o.name, err)
+		}
+	}
+
+	// Apply, keeping the previous contents for rollback
+	var applied []previous
+	for i, o := range bt.ops {
+		prev := previous{name: o.name, exists: true}
+		prev.data, err = b.st.Load(ctx, o.name)
+		if errors.Is(err, os.ErrNotExist) {
+			prev.exists = false
+		} else if err != nil {
+			return errors.Join(fmt.Errorf("batch: load %q: %w", o.name, err), bt.rollback(ctx, applied))
+		}
+		if o.data == nil {
+			err = b.st.Delete(ctx, o.name)
+		} else {
+			err = simpleblob.Copy(ctx, b.st, temps[i], o.name)
+		}
+		if err != nil {
+			return errors.Join(fmt.Errorf("batch: apply %q: %w", o.name, err), bt.rollback(ctx, applied))
+		}
+		applied = append(applied, prev)
+	}
+	return nil
+}
+
+// rollback restores the previous contents in reverse order.
+func (bt *Batch) rollback(ctx context.Context, applied []previous) error {
+	ctx = context.WithoutCancel(ctx)
+	var errs []error
+	for i := len(applied) - 1; i >= 0; i-- {
+		p := applied[i]
+		var err error
+		if p.exists {
+			err = bt.b.st.Store(ctx, p.name, p.data)
+		} else {
+			err = bt.b.st.Delete(ctx, p.name)
+			if errors.Is(err, os.ErrNotExist) {
+				err = nil
+			}
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("batch: rollback %q: %w", p.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func randomID() (string, error) {
+	var buf [8]byte
+	if _, err := rand.Read(buf[:]); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf[:]), nil
+}
+
+// New creates a new batch wrapper around st.
+func New(st simpleblob.Interface, opt Options) *Backend {
+	if opt.TempPrefix == "" {
+		opt.TempPrefix = DefaultTempPrefix
+	}
+	return &Backend{st: st, opt: opt}
+}
@@ -0,0 +1,136 @@
+package batch
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/PowerDNS/simpleblob/backends/memory"
+	"github.com/PowerDNS/simpleblob/tester"
+)
+
+var errFull = errors.New("full")
+
+// failing is a memory backend failing to store one name, or the names
+// with a prefix.
+type failing struct {
+	*memory.Backend
+	name   string
+	prefix string
+}
+
+func (f *failing) Store(ctx context.Context, name string, data []byte) error {
+	if name == f.name || (f.prefix != "" && strings.HasPrefix(name, f.prefix)) {
+		return errFull
+	}
+	return f.Backend.Store(ctx, name, data)
+}
+
+// copier is a memory backend with a Copy method, counting the copies.
+type copier struct {
+	*memory.Backend
+	copies int
+}
+
+func (c *copier) Copy(ctx context.Context, src, dst string) error {
+	c.copies++
+	data, err := c.Backend.Load(ctx, src)
+	if err != nil {
+		return err
+	}
+	return c.Backend.Store(ctx, dst, data)
+}
+
+func TestBackend(t *testing.T) {
+	tester.DoBackendTests(t, New(memory.New(), Options{}))
+}
+
+func TestBatch(t *testing.T) {
+	ctx := context.Background()
+	st := memory.New()
+	b := New(st, Options{})
+	require.NoError(t, st.Store(ctx, "a", []byte("old")))
+	require.NoError(t, st.Store(ctx, "c", []byte("gone")))
+
+	bt := b.Batch()
+	bt.Store("a", []byte("new"))
+	bt.Store("b", []byte("b"))
+	bt.Delete("c")
+	assert.Equal(t, 3, bt.Len())
+	require.NoError(t, bt.Commit(ctx))
+	assert.ErrorIs(t, bt.Commit(ctx), ErrCommitted)
+
+	// No temporary blobs are left behind
+	ls, err := st.List(ctx, "")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, ls.Names())
+	data, err := b.Load(ctx, "a")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("new"), data)
+}
+
+func TestBatch_rollback(t *testing.T) {
+	ctx := context.Background()
+	st := &failing{Backend: memory.New(), name: "c"}
+	b := New(st, Options{})
+	require.NoError(t, st.Store(ctx, "a", []byte("old")))
+
+	bt := b.Batch()
+	bt.Store("a", []byte("new"))
+	bt.Store("b", []byte("b"))
+	bt.Store("c", []byte("c"))
+	assert.ErrorIs(t, bt.Commit(ctx), errFull)
+
+	ls, err := st.List(ctx, "")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a"}, ls.Names())
+	data, err := b.Load(ctx, "a")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("old"), data)
+}
+
+func TestBatch_stageFailure(t *testing.T) {
+	ctx := context.Background()
+	st := &failing{Backend: memory.New(), prefix: DefaultTempPrefix}
+	b := New(st, Options{})
+	require.NoError(t, st.Store(ctx, "a", []byte("old")))
+	require.NoError(t, st.Store(ctx, "c", []byte("kept")))
+
+	bt := b.Batch()
+	bt.Delete("c")
+	bt.Store("a", []byte("new"))
+	assert.ErrorIs(t, bt.Commit(ctx), errFull)
+
+	// Nothing was applied
+	ls, err := st.List(ctx, "")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "c"}, ls.Names())
+	data, err := b.Load(ctx, "a")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("old"), data)
+}
+
+func TestBatch_staged(t *testing.T) {
+	ctx := context.Background()
+	st := &copier{Backend: memory.New()}
+	b := New(st, Options{})
+	require.NoError(t, st.Store(ctx, "c", []byte("gone")))
+
+	bt := b.Batch()
+	bt.Store("a", []byte("a"))
+	bt.Store("b", []byte("b"))
+	bt.Delete("c")
+	require.NoError(t, bt.Commit(ctx))
+	assert.Equal(t, 2, st.copies)
+
+	ls, err := st.List(ctx, "")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, ls.Names())
+	data, err := b.Load(ctx, "b")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("b"), data)
+}
@@ -0,0 +1,155 @@
+package chaos
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/PowerDNS/simpleblob"
+)
+
+// ErrInjected is the error returned by injected failures, unless
+// Options.Err is set.
+var ErrInjected = errors.New("chaos: injected failure")
+
+// Options describes the options for the chaos wrapper. Rates are
+// probabilities between 0 and 1.
+type Options struct {
+	// ErrorRate is the probability of an operation failing without reaching
+	// the wrapped backend.
+	ErrorRate float64
+	// PartialWriteRate is the probability of Store only storing the first
+	// part of the data and returning an error, like an interrupted upload
+	// to a backend without atomic writes would.
+	PartialWriteRate float64
+	// StaleListRate is the probability of List returning the result of a
+	// previous List with the same prefix, like an eventually consistent
+	// backend would.
+	StaleListRate float64
+
+	// Err is the error returned by injected failures.
+	// It defaults to ErrInjected.
+	Err error
+	// Seed makes the injected failures reproducible. If zero, the current
+	// time is used.
+	Seed int64
+}
+
+// Backend injects failures into the operations on a backend, to test
+// how applications handle them.
+type Backend struct {
+	st  simpleblob.Interface
+	opt Options
+
+	mu    sync.Mutex
+	rnd   *rand.Rand
+	lists map[string]simpleblob.BlobList // previous List results by prefix
+}
+
+// roll returns true with probability rate.
+func (b *Backend) roll(rate float64) bool {
+	if rate <= 0 {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.rnd.Float64() < rate
+}
+
+func (b *Backend) fail() error {
+	if b.roll(b.opt.ErrorRate) {
+		return b.opt.Err
+	}
+	return nil
+}
+
+func (b *Backend) List(ctx context.Context, prefix string) (simpleblob.BlobList, error) {
+	if err := b.fail(); err != nil {
+		return nil, err
+	}
+	if b.roll(b.opt.StaleListRate) {
+		b.mu.Lock()
+		blobs, ok := b.lists[prefix]
+		b.mu.Unlock()
+		if ok {
+			return append(simpleblob.BlobList(nil), blobs...), nil
+		}
+	}
+	blobs, err := b.st.List(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+	if b.opt.StaleListRate > 0 {
+		b.mu.Lock()
+		b.lists[prefix] = append(simpleblob.BlobList(nil), blobs...)
+		b.mu.Unlock()
+	}
+	return blobs, nil
+}
+
+func (b *Backend) Load(ctx context.Context, name string) ([]byte, error) {
+	if err := b.fail(); err != nil {
+		return nil, err
+	}
+	return b.st.Load(ctx, name)
+}
+
+func (b *Backend) Store(ctx context.Context, name string, data []byte) error {
+	if err := b.fail(); err != nil {
+		return err
+	}
+	if len(data) > 0 && b.roll(b.opt.PartialWriteRate) {
+		b.mu.Lock()
+		n := b.rnd.Intn(len(data))
+		b.mu.Unlock()
+		if err := b.st.Store(ctx, name, data[:n]); err != nil {
+			return err
+		}
+		return b.opt.Err
+	}
+	return b.st.Store(ctx, name, data)
+}
+
+func (b *Backend) Delete(ctx context.Context, name string) error {
+	if err := b.fail(); err != nil {
+		return err
+	}
+	return b.st.Delete(ctx, name)
+}
+
+// StoreIfAbsent satisfies AbsentStorer, using the wrapped backend's
+// implementation if it has one. Writes are never partial, as the wrapped
+// backend would then refuse the retry.
+func (b *Backend) StoreIfAbsent(ctx context.Context, name string, data []byte) error {
+	if err := b.fail(); err != nil {
+		return err
+	}
+	return simpleblob.StoreIfAbsent(ctx, b.st, name, data)
+}
+
+// NewReader satisfies StreamReader. Only opening the reader can fail.
+func (b *Backend) NewReader(ctx context.Context, name string) (io.ReadCloser, error) {
+	if err := b.fail(); err != nil {
+		return nil, err
+	}
+	return simpleblob.NewReader(ctx, b.st, name)
+}
+
+// New creates a new chaos wrapper around st.
+func New(st simpleblob.Interface, opt Options) *Backend {
+	if opt.Err == nil {
+		opt.Err = ErrInjected
+	}
+	if opt.Seed == 0 {
+		opt.Seed = time.Now().UnixNano()
+	}
+	return &Backend{
+		st:    st,
+		opt:   opt,
+		rnd:   rand.New(rand.NewSource(opt.Seed)),
+		lists: make(map[string]simpleblob.BlobList),
+	}
+}
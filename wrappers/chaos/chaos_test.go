@@ -0,0 +1,53 @@
+package chaos
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/PowerDNS/simpleblob/backends/memory"
+	"github.com/PowerDNS/simpleblob/tester"
+)
+
+func TestBackend(t *testing.T) {
+	// No failures by default
+	tester.DoBackendTests(t, New(memory.New(), Options{}))
+}
+
+func TestBackend_errors(t *testing.T) {
+	ctx := context.Background()
+	b := New(memory.New(), Options{ErrorRate: 0.5, Seed: 1})
+	failures := 0
+	for i := 0; i < 1000; i++ {
+		if errors.Is(b.Delete(ctx, "foo"), ErrInjected) {
+			failures++
+		}
+	}
+	assert.InDelta(t, 500, failures, 100)
+}
+
+func TestBackend_partialWrite(t *testing.T) {
+	ctx := context.Background()
+	st := memory.New()
+	b := New(st, Options{PartialWriteRate: 1})
+	assert.ErrorIs(t, b.Store(ctx, "foo", []byte("0123456789")), ErrInjected)
+	data, err := st.Load(ctx, "foo")
+	assert.NoError(t, err)
+	assert.Less(t, len(data), 10)
+}
+
+func TestBackend_staleList(t *testing.T) {
+	ctx := context.Background()
+	st := memory.New()
+	b := New(st, Options{StaleListRate: 1})
+
+	ls, err := b.List(ctx, "")
+	assert.NoError(t, err)
+	assert.Empty(t, ls)
+	assert.NoError(t, b.Store(ctx, "foo", nil))
+	ls, err = b.List(ctx, "")
+	assert.NoError(t, err)
+	assert.Empty(t, ls)
+}
@@ -0,0 +1,387 @@
+package chunked
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/PowerDNS/simpleblob"
+)
+
+const (
+	// DefaultChunkPrefix is the default value for ChunkPrefix.
+	DefaultChunkPrefix = "chunk-"
+	// DefaultMinSize is the default value for MinSize.
+	DefaultMinSize = 256 << 10
+	// DefaultAvgSize is the default value for AvgSize.
+	DefaultAvgSize = 1 << 20
+	// DefaultMaxSize is the default value for MaxSize.
+	DefaultMaxSize = 4 << 20
+)
+
+// Options describes the options for the chunked wrapper
+type Options struct {
+	// ChunkPrefix is the prefix of the blobs holding the chunks, followed
+	// by the hex encoded SHA-256 digest of the chunk. Names with this prefix
+	// cannot be used for blobs. It defaults to DefaultChunkPrefix.
+	ChunkPrefix string
+
+	// MinSize, AvgSize and MaxSize determine the size of the chunks.
+	// They default to 256 KiB, 1 MiB and 4 MiB.
+	MinSize int
+	AvgSize int
+	MaxSize int
+}
+
+// ErrNotManifest is returned when loading a blob of the wrapped backend that
+// is not a chunked manifest, like one stored without this wrapper.
+var ErrNotManifest = errors.New("chunked: not a chunked manifest")
+
+// chunkRef is a chunk in a manifest.
+type chunkRef struct {
+	Digest string `json:"digest"`
+	Size   int64  `json:"size"`
+}
+
+// manifest is stored under the name of the blob.
+type manifest struct {
+	Version int        `json:"chunked_version"`
+	Size    int64      `json:"size"`
+	Chunks  []chunkRef `json:"chunks"`
+}
+
+// Backend splits blobs into content-defined chunks, each stored once under
+// its digest, and stores a manifest listing the chunks under the blob name.
+// Chunks shared between blobs, or between versions of a blob, are only
+// stored once.
+//
+// Uploads are resumable: chunks that already exist are not uploaded again,
+// so retrying a failed upload only sends the missing chunks.
+//
+// List loads the manifest of every listed blob to report its size, so this
+// is intended for a moderate number of large blobs. Blobs of the wrapped
+// backend that are not chunked manifests are not listed.
+type Backend struct {
+	st  simpleblob.Interface
+	opt Options
+
+	mu    sync.Mutex
+	known map[string]bool // digests of existing chunks, loaded lazily
+}
+
+// checkName checks that name can be used for a blob.
+func (b *Backend) checkName(name string) error {
+	if strings.HasPrefix(name, b.opt.ChunkPrefix) {
+		return fmt.Errorf("chunked: name %q uses the chunk prefix: %w", name, os.ErrPermission)
+	}
+	return nil
+}
+
+func (b *Backend) loadManifest(ctx context.Context, name string) (*manifest, error) {
+	if err := b.checkName(name); err != nil {
+		return nil, os.ErrNotExist
+	}
+	data, err := b.st.Load(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	var m manifest
+	if err := json.Unmarshal(data, &m); err != nil || m.Version != 1 {
+		return nil, fmt.Errorf("load %q: %w", name, ErrNotManifest)
+	}
+	return &m, nil
+}
+
+func (b *Backend) List(ctx context.Context, prefix string) (simpleblob.BlobList, error) {
+	blobs, err := b.st.List(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+	var res simpleblob.BlobList
+	for _, blob := range blobs {
+		if strings.HasPrefix(blob.Name, b.opt.ChunkPrefix) {
+			continue
+		}
+		m, err := b.loadManifest(ctx, blob.Name)
+		if os.IsNotExist(err) {
+			continue // deleted in the meantime
+		}
+		if errors.Is(err, ErrNotManifest) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		blob.Size = m.Size
+		res = append(res, blob)
+	}
+	return res, nil
+}
+
+func (b *Backend) Load(ctx context.Context, name string) ([]byte, error) {
+	r, err := b.NewReader(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+func (b *Backend) Store(ctx context.Context, name string, data []byte) error {
+	w, err := b.NewWriter(ctx, name)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+// Delete deletes the manifest of the blob. Its chunks are only removed by GC.
+func (b *Backend) Delete(ctx context.Context, name string) error {
+	if err := b.checkName(name); err != nil {
+		return err
+	}
+	return b.st.Delete(ctx, name)
+}
+
+// GC deletes the chunks that are not referenced by any manifest, and
+// returns the number of chunks deleted. It must not run concurrently with
+// writes, as it could delete the chunks of a blob being written.
+func (b *Backend) GC(ctx context.Context) (int, error) {
+	blobs, err := b.st.List(ctx, "")
+	if err != nil {
+		return 0, err
+	}
+	used := make(map[string]bool)
+	var chunks []string
+	for _, blob := range blobs {
+		if strings.HasPrefix(blob.Name, b.opt.ChunkPrefix) {
+			chunks = append(chunks, blob.Name)
+			continue
+		}
+		m, err := b.loadManifest(ctx, blob.Name)
+		if os.IsNotExist(err) || errors.Is(err, ErrNotManifest) {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		for _, c := range m.Chunks {
+			used[c.Digest] = true
+		}
+	}
+
+	b.mu.Lock()
+	b.known = nil // reload on next upload
+	b.mu.Unlock()
+
+	deleted := 0
+	for _, name := range chunks {
+		if used[strings.TrimPrefix(name, b.opt.ChunkPrefix)] {
+			continue
+		}
+		if err := b.st.Delete(ctx, name); err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+// storeChunk uploads a chunk unless it is known to exist.
+func (b *Backend) storeChunk(ctx context.Context, data []byte) (chunkRef, error) {
+	sum := sha256.Sum256(data)
+	ref := chunkRef{Digest: hex.EncodeToString(sum[:]), Size: int64(len(data))}
+
+	b.mu.Lock()
+	if b.known == nil {
+		b.mu.Unlock()
+		chunks, err := b.st.List(ctx, b.opt.ChunkPrefix)
+		if err != nil {
+			return ref, err
+		}
+		known := make(map[string]bool, len(chunks))
+		for _, c := range chunks {
+			known[strings.TrimPrefix(c.Name, b.opt.ChunkPrefix)] = true
+		}
+		b.mu.Lock()
+		if b.known == nil {
+			b.known = known
+		}
+	}
+	exists := b.known[ref.Digest]
+	b.mu.Unlock()
+	if exists {
+		return ref, nil
+	}
+
+	if err := b.st.Store(ctx, b.opt.ChunkPrefix+ref.Digest, data); err != nil {
+		return ref, err
+	}
+	b.mu.Lock()
+	if b.known != nil {
+		b.known[ref.Digest] = true
+	}
+	b.mu.Unlock()
+	return ref, nil
+}
+
+// NewReader satisfies StreamReader. Chunks are loaded one at a time and
+// verified against their digest.
+func (b *Backend) NewReader(ctx context.Context, name string) (io.ReadCloser, error) {
+	m, err := b.loadManifest(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return &reader{ctx: ctx, b: b, chunks: m.Chunks}, nil
+}
+
+// NewWriter satisfies StreamWriter. Chunks are uploaded as soon as they
+// are complete, and the manifest is written on Close.
+func (b *Backend) NewWriter(ctx context.Context, name string) (io.WriteCloser, error) {
+	if err := b.checkName(name); err != nil {
+		return nil, err
+	}
+	return &writer{
+		ctx:     ctx,
+		b:       b,
+		name:    name,
+		chunker: newChunker(b.opt.MinSize, b.opt.AvgSize, b.opt.MaxSize),
+	}, nil
+}
+
+type reader struct {
+	ctx    context.Context
+	b      *Backend
+	chunks []chunkRef
+	cur    bytes.Reader
+	closed bool
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	if r.closed {
+		return 0, simpleblob.ErrClosed
+	}
+	for r.cur.Len() == 0 {
+		if len(r.chunks) == 0 {
+			return 0, io.EOF
+		}
+		c := r.chunks[0]
+		data, err := r.b.st.Load(r.ctx, r.b.opt.ChunkPrefix+c.Digest)
+		if err != nil {
+			return 0, fmt.Errorf("chunked: load chunk %s: %w", c.Digest, err)
+		}
+		sum := sha256.Sum256(data)
+		if hex.EncodeToString(sum[:]) != c.Digest {
+			return 0, fmt.Errorf("chunked: chunk %s does not match its digest", c.Digest)
+		}
+		r.chunks = r.chunks[1:]
+		r.cur.Reset(data)
+	}
+	return r.cur.Read(p)
+}
+
+func (r *reader) Close() error {
+	if r.closed {
+		return simpleblob.ErrClosed
+	}
+	r.closed = true
+	return nil
+}
+
+type writer struct {
+	ctx     context.Context
+	b       *Backend
+	name    string
+	chunker *chunker
+	buf     []byte
+	m       manifest
+	closed  bool
+	err     error // first upload error, returned by all further calls
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, simpleblob.ErrClosed
+	}
+	if w.err != nil {
+		return 0, w.err
+	}
+	w.buf = append(w.buf, p...)
+	for {
+		n := w.chunker.next(w.buf)
+		if n == 0 {
+			return len(p), nil
+		}
+		if err := w.flush(n); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// flush uploads the first n bytes of the buffer as a chunk.
+func (w *writer) flush(n int) error {
+	ref, err := w.b.storeChunk(w.ctx, w.buf[:n])
+	if err != nil {
+		w.err = err
+		return err
+	}
+	w.m.Chunks = append(w.m.Chunks, ref)
+	w.m.Size += ref.Size
+	w.buf = append([]byte(nil), w.buf[n:]...)
+	return nil
+}
+
+func (w *writer) Close() error {
+	if w.closed {
+		return simpleblob.ErrClosed
+	}
+	w.closed = true
+	if w.err != nil {
+		return w.err
+	}
+	if len(w.buf) > 0 {
+		if err := w.flush(len(w.buf)); err != nil {
+			return err
+		}
+	}
+	w.m.Version = 1
+	if w.m.Chunks == nil {
+		w.m.Chunks = []chunkRef{}
+	}
+	data, err := json.Marshal(w.m)
+	if err != nil {
+		return err
+	}
+	return w.b.st.Store(w.ctx, w.name, data)
+}
+
+// New creates a new chunked wrapper around st.
+func New(st simpleblob.Interface, opt Options) (*Backend, error) {
+	if opt.ChunkPrefix == "" {
+		opt.ChunkPrefix = DefaultChunkPrefix
+	}
+	if opt.MinSize == 0 {
+		opt.MinSize = DefaultMinSize
+	}
+	if opt.AvgSize == 0 {
+		opt.AvgSize = DefaultAvgSize
+	}
+	if opt.MaxSize == 0 {
+		opt.MaxSize = DefaultMaxSize
+	}
+	if opt.MinSize <= 0 || opt.AvgSize <= opt.MinSize || opt.MaxSize <= opt.AvgSize {
+		return nil, fmt.Errorf("chunked: sizes must verify 0 < MinSize < AvgSize < MaxSize")
+	}
+	return &Backend{st: st, opt: opt}, nil
+}
@@ -0,0 +1,96 @@
+package chunked
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/PowerDNS/simpleblob"
+	"github.com/PowerDNS/simpleblob/backends/memory"
+	"github.com/PowerDNS/simpleblob/tester"
+)
+
+var testOptions = Options{MinSize: 1 << 10, AvgSize: 4 << 10, MaxSize: 16 << 10}
+
+func TestBackend(t *testing.T) {
+	b, err := New(memory.New(), testOptions)
+	require.NoError(t, err)
+	tester.DoBackendTests(t, b)
+}
+
+func TestBackend_dedup(t *testing.T) {
+	ctx := context.Background()
+	st := memory.New()
+	b, err := New(st, testOptions)
+	require.NoError(t, err)
+
+	data := make([]byte, 1<<20)
+	rand.New(rand.NewSource(1)).Read(data)
+	require.NoError(t, b.Store(ctx, "v1", data))
+	chunks1, err := st.List(ctx, DefaultChunkPrefix)
+	require.NoError(t, err)
+	assert.Greater(t, len(chunks1), 100)
+	for _, c := range chunks1 {
+		assert.LessOrEqual(t, c.Size, int64(testOptions.MaxSize))
+	}
+
+	// Inserting data only adds a few chunks
+	v2 := append(append(append([]byte(nil), data[:1000]...), []byte("inserted")...), data[1000:]...)
+	w, err := simpleblob.NewWriter(ctx, b, "v2")
+	require.NoError(t, err)
+	_, err = io.Copy(w, bytes.NewReader(v2))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	chunks2, err := st.List(ctx, DefaultChunkPrefix)
+	require.NoError(t, err)
+	assert.LessOrEqual(t, len(chunks2)-len(chunks1), 2)
+
+	loaded, err := b.Load(ctx, "v2")
+	assert.NoError(t, err)
+	assert.Equal(t, v2, loaded)
+	ls, err := b.List(ctx, "")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"v1", "v2"}, ls.Names())
+	assert.Equal(t, int64(len(v2)), ls[1].Size)
+
+	// GC removes the chunks only used by v1
+	require.NoError(t, b.Delete(ctx, "v1"))
+	n, err := b.GC(ctx)
+	assert.NoError(t, err)
+	assert.GreaterOrEqual(t, n, 1)
+	assert.LessOrEqual(t, n, 2)
+	chunks3, err := st.List(ctx, DefaultChunkPrefix)
+	require.NoError(t, err)
+	assert.Len(t, chunks3, len(chunks2)-n)
+	loaded, err = b.Load(ctx, "v2")
+	assert.NoError(t, err)
+	assert.Equal(t, v2, loaded)
+}
+
+func TestBackend_reservedPrefix(t *testing.T) {
+	b, err := New(memory.New(), testOptions)
+	require.NoError(t, err)
+	assert.Error(t, b.Store(context.Background(), DefaultChunkPrefix+"foo", nil))
+}
+
+func TestBackend_notManifest(t *testing.T) {
+	ctx := context.Background()
+	st := memory.New()
+	b, err := New(st, testOptions)
+	require.NoError(t, err)
+	require.NoError(t, b.Store(ctx, "foo", []byte("bar")))
+	require.NoError(t, st.Store(ctx, "plain", []byte("not a manifest")))
+
+	ls, err := b.List(ctx, "")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"foo"}, ls.Names())
+	_, err = b.Load(ctx, "plain")
+	assert.ErrorIs(t, err, ErrNotManifest)
+	_, err = b.GC(ctx)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,72 @@
+package chunked
+
+// gear is the table of random values used by the rolling hash. It is
+// generated with a fixed seed, because chunk boundaries, and thus
+// deduplication, depend on it.
+var gear [256]uint64
+
+func init() {
+	// splitmix64
+	seed := uint64(0x5ca1ab1e)
+	for i := range gear {
+		seed += 0x9e3779b97f4a7c15
+		z := seed
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		gear[i] = z ^ (z >> 31)
+	}
+}
+
+// chunker finds content-defined chunk boundaries using a gear rolling hash,
+// similar to FastCDC. Since boundaries depend on the content only, inserting
+// data in a blob only changes the chunks around the insertion.
+type chunker struct {
+	min, max int
+	mask     uint64
+
+	h   uint64 // hash of the current chunk
+	pos int    // number of bytes of the current chunk already hashed
+}
+
+func newChunker(minSize, avgSize, maxSize int) *chunker {
+	bits := 0
+	for 1<<(bits+1) <= avgSize {
+		bits++
+	}
+	return &chunker{
+		min: minSize,
+		max: maxSize,
+		// Use the high bits of the hash, which depend on more bytes
+		mask: ((1 << bits) - 1) << (64 - bits),
+	}
+}
+
+// next returns the length of the chunk at the start of buf, or 0 if more
+// data is needed to find the boundary. Successive calls must pass the same
+// buffer, possibly extended, until a boundary is returned.
+func (c *chunker) next(buf []byte) int {
+	if c.pos < c.min {
+		if len(buf) < c.min {
+			return 0
+		}
+		c.pos = c.min // the first bytes are never a boundary
+	}
+	for c.pos < len(buf) && c.pos < c.max {
+		c.h = (c.h << 1) + gear[buf[c.pos]]
+		c.pos++
+		if c.h&c.mask == 0 {
+			return c.reset()
+		}
+	}
+	if c.pos >= c.max {
+		return c.reset()
+	}
+	return 0
+}
+
+func (c *chunker) reset() int {
+	n := c.pos
+	c.h = 0
+	c.pos = 0
+	return n
+}
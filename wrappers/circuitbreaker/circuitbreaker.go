@@ -0,0 +1,306 @@
+package circuitbreaker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+
+	"github.com/PowerDNS/simpleblob"
+)
+
+const (
+	// DefaultWindowSize is the default value for WindowSize.
+	DefaultWindowSize = 20
+	// DefaultMinRequests is the default value for MinRequests.
+	DefaultMinRequests = 10
+	// DefaultErrorRate is the default value for ErrorRate.
+	DefaultErrorRate = 0.5
+	// DefaultCoolDown is the default value for CoolDown.
+	DefaultCoolDown = 30 * time.Second
+)
+
+// ErrCircuitOpen is returned without calling the backend while the circuit
+// is open.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// State is the state of the circuit.
+type State int
+
+const (
+	// Closed means operations are sent to the backend.
+	Closed State = iota
+	// Open means operations fail immediately with ErrCircuitOpen.
+	Open
+	// HalfOpen means a single operation is being sent to the backend to
+	// check if it recovered.
+	HalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// Options describes the options for the circuitbreaker wrapper
+type Options struct {
+	// WindowSize is the number of most recent operations used to compute
+	// the error rate. It defaults to DefaultWindowSize.
+	WindowSize int
+	// MinRequests is the number of operations needed in the window before
+	// the circuit can trip. It must not exceed WindowSize, and defaults to
+	// DefaultMinRequests, or WindowSize if that is smaller.
+	MinRequests int
+	// ErrorRate is the ratio of failed operations in the window, between 0
+	// and 1, that trips the circuit. It defaults to DefaultErrorRate.
+	ErrorRate float64
+	// CoolDown is the time the circuit stays open before a single operation
+	// is allowed through. If that operation takes longer than CoolDown,
+	// another one is allowed through. It defaults to DefaultCoolDown.
+	CoolDown time.Duration
+
+	// IsFailure decides if an error counts as a failure. It defaults to
+	// IsFailure.
+	IsFailure func(err error) bool
+
+	Logger logr.Logger
+}
+
+func (o Options) Check() error {
+	if o.MinRequests > o.WindowSize {
+		return fmt.Errorf("circuitbreaker: MinRequests (%d) must not exceed WindowSize (%d)",
+			o.MinRequests, o.WindowSize)
+	}
+	if o.ErrorRate <= 0 || o.ErrorRate > 1 {
+		return fmt.Errorf("circuitbreaker: ErrorRate must be between 0 and 1, got %v", o.ErrorRate)
+	}
+	return nil
+}
+
+// IsFailure reports whether err indicates a problem with the backend, as
+// opposed to an answer like a missing or existing blob.
+func IsFailure(err error) bool {
+	return err != nil &&
+		!errors.Is(err, os.ErrNotExist) &&
+		!errors.Is(err, os.ErrExist) &&
+		!errors.Is(err, os.ErrPermission) &&
+		!errors.Is(err, errors.ErrUnsupported) &&
+		!errors.Is(err, context.Canceled)
+}
+
+// Backend stops sending operations to a backend for a while once too many
+// of them fail, failing fast with ErrCircuitOpen instead.
+type Backend struct {
+	st  simpleblob.Interface
+	opt Options
+	log logr.Logger
+
+	mu       sync.Mutex
+	state    State
+	gen      uint64    // incremented on every state change
+	openedAt time.Time // when the circuit opened, or the last trial started
+	window   []bool    // ring buffer of results, true meaning failure
+	next     int       // next position in window
+	count    int       // number of results in window
+	failures int       // number of failures in window
+}
+
+// State returns the current state of the circuit.
+func (b *Backend) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == Open && time.Since(b.openedAt) >= b.opt.CoolDown {
+		return HalfOpen
+	}
+	return b.state
+}
+
+// allow tells if an operation can be sent to the backend. It returns the
+// generation of the circuit, to be passed to record.
+func (b *Backend) allow() (uint64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case Closed:
+		return b.gen, nil
+	case Open, HalfOpen:
+		// A new trial replaces one that did not complete within CoolDown
+		if time.Since(b.openedAt) >= b.opt.CoolDown {
+			b.setState(HalfOpen)
+			b.openedAt = time.Now()
+			return b.gen, nil
+		}
+	}
+	return 0, ErrCircuitOpen
+}
+
+// record updates the circuit with the result of an operation allowed in
+// generation gen.
+func (b *Backend) record(gen uint64, err error) {
+	failed := b.opt.IsFailure(err)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if gen != b.gen {
+		// Result of an operation started before the last state change,
+		// like a late success that must not close a half-open circuit
+		return
+	}
+	if b.state == HalfOpen {
+		if errors.Is(err, context.Canceled) {
+			// No evidence either way, wait for another trial
+			b.setState(Open)
+			b.openedAt = time.Now()
+		} else if failed {
+			b.trip(err)
+		} else {
+			b.log.Info("circuit closed")
+			b.reset()
+		}
+		return
+	}
+
+	if b.count == len(b.window) {
+		if b.window[b.next] {
+			b.failures--
+		}
+	} else {
+		b.count++
+	}
+	b.window[b.next] = failed
+	b.next = (b.next + 1) % len(b.window)
+	if failed {
+		b.failures++
+	}
+
+	if b.count >= b.opt.MinRequests &&
+		float64(b.failures)/float64(b.count) >= b.opt.ErrorRate {
+		b.trip(err)
+	}
+}
+
+func (b *Backend) trip(err error) {
+	b.log.Error(err, "circuit opened", "cool_down", b.opt.CoolDown)
+	b.setState(Open)
+	b.openedAt = time.Now()
+}
+
+func (b *Backend) reset() {
+	b.setState(Closed)
+	b.next = 0
+	b.count = 0
+	b.failures = 0
+}
+
+// setState changes the state and starts a new generation. b.mu must be held.
+func (b *Backend) setState(s State) {
+	b.state = s
+	b.gen++
+}
+
+func do[T any](b *Backend, fn func() (T, error)) (T, error) {
+	gen, err := b.allow()
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	res, err := fn()
+	b.record(gen, err)
+	return res, err
+}
+
+func (b *Backend) List(ctx context.Context, prefix string) (simpleblob.BlobList, error) {
+	return do(b, func() (simpleblob.BlobList, error) {
+		return b.st.List(ctx, prefix)
+	})
+}
+
+func (b *Backend) Load(ctx context.Context, name string) ([]byte, error) {
+	return do(b, func() ([]byte, error) {
+		return b.st.Load(ctx, name)
+	})
+}
+
+func (b *Backend) Store(ctx context.Context, name string, data []byte) error {
+	_, err := do(b, func() (struct{}, error) {
+		return struct{}{}, b.st.Store(ctx, name, data)
+	})
+	return err
+}
+
+func (b *Backend) Delete(ctx context.Context, name string) error {
+	_, err := do(b, func() (struct{}, error) {
+		return struct{}{}, b.st.Delete(ctx, name)
+	})
+	return err
+}
+
+// StoreIfAbsent satisfies AbsentStorer, using the wrapped backend's
+// implementation if it has one.
+func (b *Backend) StoreIfAbsent(ctx context.Context, name string, data []byte) error {
+	_, err := do(b, func() (struct{}, error) {
+		return struct{}{}, simpleblob.StoreIfAbsent(ctx, b.st, name, data)
+	})
+	return err
+}
+
+// NewReader satisfies StreamReader. Only errors opening the reader are
+// taken into account.
+func (b *Backend) NewReader(ctx context.Context, name string) (io.ReadCloser, error) {
+	return do(b, func() (io.ReadCloser, error) {
+		return simpleblob.NewReader(ctx, b.st, name)
+	})
+}
+
+// NewWriter satisfies StreamWriter. Only errors opening the writer are
+// taken into account.
+func (b *Backend) NewWriter(ctx context.Context, name string) (io.WriteCloser, error) {
+	return do(b, func() (io.WriteCloser, error) {
+		return simpleblob.NewWriter(ctx, b.st, name)
+	})
+}
+
+// New creates a new circuitbreaker wrapper around st.
+func New(st simpleblob.Interface, opt Options) (*Backend, error) {
+	if opt.WindowSize <= 0 {
+		opt.WindowSize = DefaultWindowSize
+	}
+	if opt.MinRequests <= 0 {
+		opt.MinRequests = min(DefaultMinRequests, opt.WindowSize)
+	}
+	if opt.ErrorRate == 0 {
+		opt.ErrorRate = DefaultErrorRate
+	}
+	if opt.CoolDown <= 0 {
+		opt.CoolDown = DefaultCoolDown
+	}
+	if opt.IsFailure == nil {
+		opt.IsFailure = IsFailure
+	}
+	if err := opt.Check(); err != nil {
+		return nil, err
+	}
+
+	log := opt.Logger
+	if log.GetSink() == nil {
+		log = logr.Discard()
+	}
+	return &Backend{
+		st:     st,
+		opt:    opt,
+		log:    log.WithName("circuitbreaker"),
+		window: make([]bool, opt.WindowSize),
+	}, nil
+}
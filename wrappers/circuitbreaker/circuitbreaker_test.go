@@ -0,0 +1,177 @@
+package circuitbreaker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/PowerDNS/simpleblob/backends/memory"
+	"github.com/PowerDNS/simpleblob/tester"
+)
+
+var errDown = errors.New("down")
+
+// flaky is a memory backend where Store fails while down is set.
+type flaky struct {
+	*memory.Backend
+	down  bool
+	calls int
+}
+
+func (f *flaky) Store(ctx context.Context, name string, data []byte) error {
+	f.calls++
+	if f.down {
+		return errDown
+	}
+	return f.Backend.Store(ctx, name, data)
+}
+
+// slow is a memory backend where Load waits for release.
+type slow struct {
+	*flaky
+	started chan struct{}
+	release chan struct{}
+}
+
+func (s *slow) Load(ctx context.Context, name string) ([]byte, error) {
+	close(s.started)
+	<-s.release
+	return nil, nil
+}
+
+func TestBackend(t *testing.T) {
+	b, err := New(memory.New(), Options{})
+	require.NoError(t, err)
+	tester.DoBackendTests(t, b)
+}
+
+func TestBackend_trip(t *testing.T) {
+	ctx := context.Background()
+	f := &flaky{Backend: memory.New(), down: true}
+	b, err := New(f, Options{
+		WindowSize:  4,
+		MinRequests: 4,
+		ErrorRate:   1,
+		CoolDown:    50 * time.Millisecond,
+	})
+	require.NoError(t, err)
+
+	// Missing blobs are not failures
+	for i := 0; i < 10; i++ {
+		_, err := b.Load(ctx, "missing")
+		assert.Error(t, err)
+	}
+	assert.Equal(t, Closed, b.State())
+
+	for i := 0; i < 4; i++ {
+		assert.ErrorIs(t, b.Store(ctx, "foo", nil), errDown)
+	}
+	assert.Equal(t, Open, b.State())
+	assert.ErrorIs(t, b.Store(ctx, "foo", nil), ErrCircuitOpen)
+	assert.Equal(t, 4, f.calls)
+
+	// Half-open, still failing
+	time.Sleep(60 * time.Millisecond)
+	assert.Equal(t, HalfOpen, b.State())
+	assert.ErrorIs(t, b.Store(ctx, "foo", nil), errDown)
+	assert.Equal(t, Open, b.State())
+
+	// Half-open, recovered
+	f.down = false
+	time.Sleep(60 * time.Millisecond)
+	assert.NoError(t, b.Store(ctx, "foo", nil))
+	assert.Equal(t, Closed, b.State())
+}
+
+func TestBackend_staleResults(t *testing.T) {
+	ctx := context.Background()
+	s := &slow{
+		flaky:   &flaky{Backend: memory.New(), down: true},
+		started: make(chan struct{}),
+		release: make(chan struct{}),
+	}
+	b, err := New(s, Options{
+		WindowSize:  2,
+		MinRequests: 2,
+		ErrorRate:   1,
+		CoolDown:    10 * time.Millisecond,
+	})
+	require.NoError(t, err)
+
+	// Started while closed, finishes once half-open
+	done := make(chan error)
+	go func() {
+		_, err := b.Load(ctx, "foo")
+		done <- err
+	}()
+	<-s.started
+	for i := 0; i < 2; i++ {
+		assert.ErrorIs(t, b.Store(ctx, "foo", nil), errDown)
+	}
+	assert.Equal(t, Open, b.State())
+	time.Sleep(20 * time.Millisecond)
+	gen, err := b.allow() // the probe
+	assert.NoError(t, err)
+
+	close(s.release)
+	assert.NoError(t, <-done)
+	assert.Equal(t, HalfOpen, b.State())
+
+	b.record(gen, errDown)
+	assert.Equal(t, Open, b.State())
+}
+
+func TestBackend_trialWithoutResult(t *testing.T) {
+	ctx := context.Background()
+	b, err := New(&flaky{Backend: memory.New(), down: true}, Options{
+		WindowSize:  2,
+		MinRequests: 2,
+		ErrorRate:   1,
+		CoolDown:    10 * time.Millisecond,
+	})
+	require.NoError(t, err)
+	for i := 0; i < 2; i++ {
+		assert.ErrorIs(t, b.Store(ctx, "foo", nil), errDown)
+	}
+
+	// A canceled trial does not close the circuit
+	time.Sleep(20 * time.Millisecond)
+	gen, err := b.allow()
+	require.NoError(t, err)
+	b.record(gen, context.Canceled)
+	assert.Equal(t, Open, b.State())
+	_, err = b.allow()
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+
+	// A hung trial is replaced after CoolDown
+	time.Sleep(20 * time.Millisecond)
+	hung, err := b.allow()
+	require.NoError(t, err)
+	_, err = b.allow()
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+	time.Sleep(20 * time.Millisecond)
+	gen, err = b.allow()
+	require.NoError(t, err)
+	b.record(hung, nil)
+	assert.Equal(t, HalfOpen, b.State())
+	b.record(gen, nil)
+	assert.Equal(t, Closed, b.State())
+}
+
+func TestNew(t *testing.T) {
+	for _, opt := range []Options{
+		{WindowSize: 20, MinRequests: 50},
+		{ErrorRate: 1.5},
+		{ErrorRate: -1},
+	} {
+		_, err := New(memory.New(), opt)
+		assert.Error(t, err, "%+v", opt)
+	}
+	b, err := New(memory.New(), Options{WindowSize: 5})
+	require.NoError(t, err)
+	assert.Equal(t, 5, b.opt.MinRequests)
+}
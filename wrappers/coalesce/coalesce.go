@@ -0,0 +1,128 @@
+package coalesce
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+
+	"github.com/PowerDNS/simpleblob"
+)
+
+// DefaultTimeout is the default value for Timeout.
+const DefaultTimeout = 5 * time.Minute
+
+// Options describes the options for the coalesce wrapper
+type Options struct {
+	// Timeout bounds the shared requests, in addition to the deadline of
+	// the caller that started them, so that a hung request does not block
+	// all later loads of the same blob. It defaults to DefaultTimeout.
+	// A negative value disables it.
+	Timeout time.Duration
+}
+
+// Backend collapses concurrent loads of the same blob into a single
+// request to the wrapped backend, sharing the result between all callers.
+//
+// The shared request is not cancelled when the context of one caller is,
+// so that the other callers still get the result. A caller whose context
+// is done stops waiting and gets the context error. The shared request
+// keeps the deadline of the caller that started it, though.
+type Backend struct {
+	st    simpleblob.Interface
+	opt   Options
+	group singleflight.Group
+}
+
+// sharedContext returns the context of a shared request started by a
+// caller with ctx.
+func (b *Backend) sharedContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	shared := context.WithoutCancel(ctx)
+	deadline, ok := ctx.Deadline()
+	if b.opt.Timeout > 0 {
+		if limit := time.Now().Add(b.opt.Timeout); !ok || limit.Before(deadline) {
+			deadline, ok = limit, true
+		}
+	}
+	if !ok {
+		return shared, func() {}
+	}
+	return context.WithDeadline(shared, deadline)
+}
+
+func (b *Backend) List(ctx context.Context, prefix string) (simpleblob.BlobList, error) {
+	return b.st.List(ctx, prefix)
+}
+
+func (b *Backend) Load(ctx context.Context, name string) ([]byte, error) {
+	ch := b.group.DoChan(name, func() (interface{}, error) {
+		ctx, cancel := b.sharedContext(ctx)
+		defer cancel()
+		return b.st.Load(ctx, name)
+	})
+	select {
+	case res := <-ch:
+		if res.Err != nil {
+			return nil, res.Err
+		}
+		data := res.Val.([]byte)
+		if res.Shared {
+			// Every caller must get its own copy
+			data = bytes.Clone(data)
+		}
+		return data, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// NewReader satisfies StreamReader. To be shared, the blob is loaded
+// completely in memory, so this is not suitable for very large blobs.
+func (b *Backend) NewReader(ctx context.Context, name string) (io.ReadCloser, error) {
+	data, err := b.Load(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+// Store stores the blob. Loads of name that started before are not shared
+// with loads started after, so that these never return stale data.
+func (b *Backend) Store(ctx context.Context, name string, data []byte) error {
+	b.group.Forget(name)
+	err := b.st.Store(ctx, name, data)
+	b.group.Forget(name)
+	return err
+}
+
+// Delete deletes the blob, with the same guarantee as Store.
+func (b *Backend) Delete(ctx context.Context, name string) error {
+	b.group.Forget(name)
+	err := b.st.Delete(ctx, name)
+	b.group.Forget(name)
+	return err
+}
+
+// StoreIfAbsent satisfies AbsentStorer, using the wrapped backend's
+// implementation if it has one, with the same guarantee as Store.
+func (b *Backend) StoreIfAbsent(ctx context.Context, name string, data []byte) error {
+	b.group.Forget(name)
+	err := simpleblob.StoreIfAbsent(ctx, b.st, name, data)
+	b.group.Forget(name)
+	return err
+}
+
+// New creates a new coalesce wrapper around st, with the default options.
+func New(st simpleblob.Interface) *Backend {
+	return NewWithOptions(st, Options{})
+}
+
+// NewWithOptions creates a new coalesce wrapper around st.
+func NewWithOptions(st simpleblob.Interface, opt Options) *Backend {
+	if opt.Timeout == 0 {
+		opt.Timeout = DefaultTimeout
+	}
+	return &Backend{st: st, opt: opt}
+}
@@ -0,0 +1,106 @@
+package coalesce
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/PowerDNS/simpleblob/backends/memory"
+	"github.com/PowerDNS/simpleblob/tester"
+)
+
+// slow is a memory backend with slow, counted loads.
+type slow struct {
+	*memory.Backend
+	loads atomic.Int32
+}
+
+func (s *slow) Load(ctx context.Context, name string) ([]byte, error) {
+	s.loads.Add(1)
+	time.Sleep(50 * time.Millisecond)
+	return s.Backend.Load(ctx, name)
+}
+
+func TestBackend(t *testing.T) {
+	tester.DoBackendTests(t, New(memory.New()))
+}
+
+func TestBackend_coalesce(t *testing.T) {
+	ctx := context.Background()
+	s := &slow{Backend: memory.New()}
+	assert.NoError(t, s.Store(ctx, "foo", []byte("bar")))
+	b := New(s)
+
+	var wg sync.WaitGroup
+	results := make([][]byte, 10)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			data, err := b.Load(ctx, "foo")
+			assert.NoError(t, err)
+			results[i] = data
+		}(i)
+	}
+	wg.Wait()
+	assert.EqualValues(t, 1, s.loads.Load())
+
+	// Results are not shared slices
+	results[0][0] = '!'
+	assert.Equal(t, []byte("bar"), results[1])
+}
+
+func TestBackend_cancel(t *testing.T) {
+	s := &slow{Backend: memory.New()}
+	assert.NoError(t, s.Store(context.Background(), "foo", []byte("bar")))
+	b := New(s)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := b.Load(ctx, "foo")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+// hung is a memory backend where Load blocks until ctx is done.
+type hung struct {
+	*memory.Backend
+	loads atomic.Int32
+}
+
+func (h *hung) Load(ctx context.Context, name string) ([]byte, error) {
+	if h.loads.Add(1) == 1 {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	return h.Backend.Load(ctx, name)
+}
+
+func TestBackend_hung(t *testing.T) {
+	h := &hung{Backend: memory.New()}
+	assert.NoError(t, h.Store(context.Background(), "foo", []byte("bar")))
+	b := NewWithOptions(h, Options{Timeout: 20 * time.Millisecond})
+
+	// The hung request is abandoned after Timeout, instead of being
+	// joined by all later loads
+	_, err := b.Load(context.Background(), "foo")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	data, err := b.Load(context.Background(), "foo")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("bar"), data)
+
+	// The deadline of the caller is kept
+	h.loads.Store(0)
+	b = New(h)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err = b.Load(ctx, "foo")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Eventually(t, func() bool { // once the shared request gave up
+		data, err := b.Load(context.Background(), "foo")
+		return err == nil && string(data) == "bar"
+	}, time.Second, 5*time.Millisecond)
+}
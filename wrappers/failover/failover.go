@@ -0,0 +1,225 @@
+package failover
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+
+	"github.com/PowerDNS/simpleblob"
+)
+
+const (
+	// DefaultProbeInterval is the default value for ProbeInterval.
+	DefaultProbeInterval = 10 * time.Second
+	// DefaultProbeTimeout is the default value for ProbeTimeout.
+	DefaultProbeTimeout = 5 * time.Second
+	// DefaultRecoveryInterval is the default value for RecoveryInterval.
+	DefaultRecoveryInterval = 30 * time.Second
+)
+
+// Options describes the options for the failover wrapper
+type Options struct {
+	// ProbeInterval is the time between two pings of the primary backend.
+	// A negative value disables probing, in which case only operation errors
+	// trigger a failover. It defaults to DefaultProbeInterval.
+	ProbeInterval time.Duration
+	// ProbeTimeout is the time allowed for a single ping.
+	// It defaults to DefaultProbeTimeout.
+	ProbeTimeout time.Duration
+	// RecoveryInterval is the time after a failover before a single
+	// operation is tried again on the primary (half-open state). If it
+	// succeeds, the primary is used again.
+	// It defaults to DefaultRecoveryInterval.
+	RecoveryInterval time.Duration
+
+	Logger logr.Logger
+}
+
+// Backend sends operations to a primary backend and fails over to a
+// secondary one when the primary errors or does not answer pings.
+//
+// Writes that happen while failed over are only sent to the secondary.
+// Combine with the mirror wrapper if both backends must hold all data.
+type Backend struct {
+	ctx       context.Context
+	primary   simpleblob.Interface
+	secondary simpleblob.Interface
+	opt       Options
+	log       logr.Logger
+
+	mu       sync.Mutex
+	down     bool      // primary is considered unavailable
+	downTime time.Time // last time primary was found to be unavailable
+	trying   bool      // an operation is testing the primary (half-open)
+}
+
+// pick returns the backend to use for the next operation, and whether
+// it is the primary.
+func (b *Backend) pick() (simpleblob.Interface, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.down {
+		return b.primary, true
+	}
+	if !b.trying && time.Since(b.downTime) >= b.opt.RecoveryInterval {
+		b.trying = true
+		return b.primary, true
+	}
+	return b.secondary, false
+}
+
+// report updates the state of the primary after an operation on it.
+func (b *Backend) report(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	wasDown := b.down
+	b.trying = false
+	if errors.Is(err, context.Canceled) {
+		return // says nothing about the primary
+	}
+	if isFailure(err) {
+		b.down = true
+		b.downTime = time.Now()
+		if !wasDown {
+			b.log.Error(err, "primary failed, failing over to secondary")
+		}
+		return
+	}
+	b.down = false
+	if wasDown {
+		b.log.Info("primary recovered")
+	}
+}
+
+// isFailure tells if err indicates that the backend is unavailable,
+// as opposed to an answer like a missing blob.
+func isFailure(err error) bool {
+	return err != nil &&
+		!errors.Is(err, os.ErrNotExist) &&
+		!errors.Is(err, os.ErrPermission) &&
+		!errors.Is(err, context.Canceled)
+}
+
+// do runs fn on the primary or the secondary backend, retrying on the
+// secondary if the primary fails.
+func do[T any](b *Backend, fn func(st simpleblob.Interface) (T, error)) (T, error) {
+	st, isPrimary := b.pick()
+	res, err := fn(st)
+	if !isPrimary {
+		return res, err
+	}
+	b.report(err)
+	if !isFailure(err) {
+		return res, err
+	}
+	return fn(b.secondary)
+}
+
+// Failed reports whether the secondary backend is currently in use.
+func (b *Backend) Failed() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.down
+}
+
+func (b *Backend) List(ctx context.Context, prefix string) (simpleblob.BlobList, error) {
+	return do(b, func(st simpleblob.Interface) (simpleblob.BlobList, error) {
+		return st.List(ctx, prefix)
+	})
+}
+
+func (b *Backend) Load(ctx context.Context, name string) ([]byte, error) {
+	return do(b, func(st simpleblob.Interface) ([]byte, error) {
+		return st.Load(ctx, name)
+	})
+}
+
+// NewReader satisfies StreamReader. Only errors returned while opening
+// the reader trigger a failover.
+func (b *Backend) NewReader(ctx context.Context, name string) (io.ReadCloser, error) {
+	return do(b, func(st simpleblob.Interface) (io.ReadCloser, error) {
+		return simpleblob.NewReader(ctx, st, name)
+	})
+}
+
+func (b *Backend) Store(ctx context.Context, name string, data []byte) error {
+	_, err := do(b, func(st simpleblob.Interface) (struct{}, error) {
+		return struct{}{}, st.Store(ctx, name, data)
+	})
+	return err
+}
+
+func (b *Backend) Delete(ctx context.Context, name string) error {
+	_, err := do(b, func(st simpleblob.Interface) (struct{}, error) {
+		return struct{}{}, st.Delete(ctx, name)
+	})
+	return err
+}
+
+// Ping satisfies Pinger and pings the backend currently in use.
+func (b *Backend) Ping(ctx context.Context) error {
+	_, err := do(b, func(st simpleblob.Interface) (struct{}, error) {
+		return struct{}{}, simpleblob.Ping(ctx, st)
+	})
+	return err
+}
+
+// probe pings the primary at every ProbeInterval, until b.ctx is done.
+func (b *Backend) probe() {
+	ticker := time.NewTicker(b.opt.ProbeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-b.ctx.Done():
+			return
+		}
+		ctx, cancel := context.WithTimeout(b.ctx, b.opt.ProbeTimeout)
+		err := simpleblob.Ping(ctx, b.primary)
+		cancel()
+		if b.ctx.Err() != nil {
+			return
+		}
+		b.report(err)
+	}
+}
+
+// New creates a new failover wrapper.
+// The lifetime of the context passed in must span the lifetime of the whole
+// backend instance, as it is used for probing.
+func New(ctx context.Context, primary, secondary simpleblob.Interface, opt Options) (*Backend, error) {
+	if primary == nil || secondary == nil {
+		return nil, fmt.Errorf("failover: primary and secondary backends are required")
+	}
+	if opt.ProbeInterval == 0 {
+		opt.ProbeInterval = DefaultProbeInterval
+	}
+	if opt.ProbeTimeout == 0 {
+		opt.ProbeTimeout = DefaultProbeTimeout
+	}
+	if opt.RecoveryInterval == 0 {
+		opt.RecoveryInterval = DefaultRecoveryInterval
+	}
+
+	log := opt.Logger
+	if log.GetSink() == nil {
+		log = logr.Discard()
+	}
+	b := &Backend{
+		ctx:       ctx,
+		primary:   primary,
+		secondary: secondary,
+		opt:       opt,
+		log:       log.WithName("failover"),
+	}
+	if opt.ProbeInterval > 0 {
+		go b.probe()
+	}
+	return b, nil
+}
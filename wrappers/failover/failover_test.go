@@ -0,0 +1,119 @@
+package failover
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/PowerDNS/simpleblob"
+	"github.com/PowerDNS/simpleblob/backends/memory"
+	"github.com/PowerDNS/simpleblob/tester"
+)
+
+var errDown = errors.New("down")
+
+// flaky is a memory backend that can be made to fail all operations.
+type flaky struct {
+	*memory.Backend
+	down atomic.Bool
+}
+
+func (f *flaky) List(ctx context.Context, prefix string) (simpleblob.BlobList, error) {
+	if f.down.Load() {
+		return nil, errDown
+	}
+	return f.Backend.List(ctx, prefix)
+}
+
+func (f *flaky) Load(ctx context.Context, name string) ([]byte, error) {
+	if f.down.Load() {
+		return nil, errDown
+	}
+	return f.Backend.Load(ctx, name)
+}
+
+func (f *flaky) Store(ctx context.Context, name string, data []byte) error {
+	if f.down.Load() {
+		return errDown
+	}
+	return f.Backend.Store(ctx, name, data)
+}
+
+func (f *flaky) Ping(ctx context.Context) error {
+	if f.down.Load() {
+		return errDown
+	}
+	return nil
+}
+
+func TestBackend(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	b, err := New(ctx, memory.New(), memory.New(), Options{})
+	require.NoError(t, err)
+	tester.DoBackendTests(t, b)
+}
+
+func TestBackend_failover(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	primary := &flaky{Backend: memory.New()}
+	secondary := memory.New()
+	b, err := New(ctx, primary, secondary, Options{
+		ProbeInterval:    -1,
+		RecoveryInterval: 50 * time.Millisecond,
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, b.Store(ctx, "foo", []byte("primary")))
+	require.NoError(t, secondary.Store(ctx, "foo", []byte("secondary")))
+
+	// Missing blobs do not trigger a failover
+	_, err = b.Load(ctx, "missing")
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	assert.False(t, b.Failed())
+
+	primary.down.Store(true)
+	data, err := b.Load(ctx, "foo")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("secondary"), data)
+	assert.True(t, b.Failed())
+
+	// Half-open: primary is tried again after RecoveryInterval
+	primary.down.Store(false)
+	data, err = b.Load(ctx, "foo")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("secondary"), data)
+	time.Sleep(60 * time.Millisecond)
+	canceled, cancelLoad := context.WithCancel(ctx)
+	cancelLoad()
+	_, err = b.Load(canceled, "foo") // the trial says nothing
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.True(t, b.Failed())
+	data, err = b.Load(ctx, "foo")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("primary"), data)
+	assert.False(t, b.Failed())
+}
+
+func TestBackend_probe(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	primary := &flaky{Backend: memory.New()}
+	b, err := New(ctx, primary, memory.New(), Options{
+		ProbeInterval:    10 * time.Millisecond,
+		RecoveryInterval: time.Hour,
+	})
+	require.NoError(t, err)
+
+	primary.down.Store(true)
+	assert.Eventually(t, b.Failed, time.Second, 10*time.Millisecond)
+	primary.down.Store(false)
+	assert.Eventually(t, func() bool { return !b.Failed() }, time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,129 @@
+package hashprefix
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/PowerDNS/simpleblob"
+)
+
+const (
+	// DefaultLevels is the default value for Levels.
+	DefaultLevels = 2
+	// DefaultWidth is the default value for Width.
+	DefaultWidth = 2
+)
+
+// Options describes the options for the hashprefix wrapper
+type Options struct {
+	// Levels is the number of hash-derived folders put in front of names.
+	// It defaults to DefaultLevels.
+	Levels int
+	// Width is the number of hex characters per level.
+	// It defaults to DefaultWidth.
+	Width int
+}
+
+// Backend stores every blob under folders derived from the hash of its
+// name, e.g. "foo" is stored as "2c/26/foo". This spreads keys evenly over
+// the key space, which avoids hot partitions on S3.
+//
+// Callers only ever see the original names. Since a prefix cannot be
+// mapped to folders, List always lists the whole wrapped backend.
+type Backend struct {
+	st  simpleblob.Interface
+	opt Options
+}
+
+// Key returns the name under which blob name is stored in the wrapped
+// backend.
+func (b *Backend) Key(name string) string {
+	sum := sha256.Sum256([]byte(name))
+	h := hex.EncodeToString(sum[:])
+	var sb strings.Builder
+	for i := 0; i < b.opt.Levels; i++ {
+		sb.WriteString(h[i*b.opt.Width : (i+1)*b.opt.Width])
+		sb.WriteByte('/')
+	}
+	sb.WriteString(name)
+	return sb.String()
+}
+
+// name returns the blob name for key, or false if key was not created by
+// this wrapper.
+func (b *Backend) name(key string) (string, bool) {
+	n := b.opt.Levels * (b.opt.Width + 1)
+	if len(key) < n {
+		return "", false
+	}
+	name := key[n:]
+	return name, b.Key(name) == key
+}
+
+func (b *Backend) List(ctx context.Context, prefix string) (simpleblob.BlobList, error) {
+	blobs, err := b.st.List(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	var res simpleblob.BlobList
+	for _, blob := range blobs {
+		name, ok := b.name(blob.Name)
+		if !ok || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		blob.Name = name
+		res = append(res, blob)
+	}
+	sort.Sort(res)
+	return res, nil
+}
+
+func (b *Backend) Load(ctx context.Context, name string) ([]byte, error) {
+	return b.st.Load(ctx, b.Key(name))
+}
+
+func (b *Backend) Store(ctx context.Context, name string, data []byte) error {
+	return b.st.Store(ctx, b.Key(name), data)
+}
+
+func (b *Backend) Delete(ctx context.Context, name string) error {
+	return b.st.Delete(ctx, b.Key(name))
+}
+
+// StoreIfAbsent satisfies AbsentStorer, using the wrapped backend's
+// implementation if it has one.
+func (b *Backend) StoreIfAbsent(ctx context.Context, name string, data []byte) error {
+	return simpleblob.StoreIfAbsent(ctx, b.st, b.Key(name), data)
+}
+
+// NewReader satisfies StreamReader, using the wrapped backend's
+// implementation if it has one.
+func (b *Backend) NewReader(ctx context.Context, name string) (io.ReadCloser, error) {
+	return simpleblob.NewReader(ctx, b.st, b.Key(name))
+}
+
+// NewWriter satisfies StreamWriter, using the wrapped backend's
+// implementation if it has one.
+func (b *Backend) NewWriter(ctx context.Context, name string) (io.WriteCloser, error) {
+	return simpleblob.NewWriter(ctx, b.st, b.Key(name))
+}
+
+// New creates a new hashprefix wrapper around st. The wrapped backend must
+// support '/' in blob names.
+func New(st simpleblob.Interface, opt Options) (*Backend, error) {
+	if opt.Levels == 0 {
+		opt.Levels = DefaultLevels
+	}
+	if opt.Width == 0 {
+		opt.Width = DefaultWidth
+	}
+	if opt.Levels < 0 || opt.Width < 0 || opt.Levels*opt.Width > 2*sha256.Size {
+		return nil, fmt.Errorf("hashprefix: invalid Levels %d or Width %d", opt.Levels, opt.Width)
+	}
+	return &Backend{st: st, opt: opt}, nil
+}
@@ -0,0 +1,41 @@
+package hashprefix
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/PowerDNS/simpleblob/backends/memory"
+	"github.com/PowerDNS/simpleblob/tester"
+)
+
+func TestBackend(t *testing.T) {
+	b, err := New(memory.New(), Options{})
+	require.NoError(t, err)
+	tester.DoBackendTests(t, b)
+}
+
+func TestBackend_keys(t *testing.T) {
+	ctx := context.Background()
+	st := memory.New()
+	assert.NoError(t, st.Store(ctx, "unrelated", nil))
+	b, err := New(st, Options{Levels: 1, Width: 3})
+	require.NoError(t, err)
+
+	assert.Equal(t, "2c2/foo", b.Key("foo"))
+	assert.NoError(t, b.Store(ctx, "foo", []byte("bar")))
+	data, err := st.Load(ctx, "2c2/foo")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("bar"), data)
+
+	ls, err := b.List(ctx, "")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"foo"}, ls.Names())
+}
+
+func TestNew_invalid(t *testing.T) {
+	_, err := New(memory.New(), Options{Levels: 10, Width: 10})
+	assert.Error(t, err)
+}
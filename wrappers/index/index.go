@@ -0,0 +1,275 @@
+package index
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+
+	"github.com/PowerDNS/simpleblob"
+)
+
+const (
+	// DefaultIndexName is the default value for IndexName.
+	DefaultIndexName = "simpleblob-index.json"
+	// DefaultReconcileInterval is the default value for ReconcileInterval.
+	DefaultReconcileInterval = 10 * time.Minute
+)
+
+// Options describes the options for the index wrapper
+type Options struct {
+	// IndexName is the name of the blob holding the index. It is hidden
+	// from List. It defaults to DefaultIndexName.
+	IndexName string
+	// ReconcileInterval is the time between two rebuilds of the index from
+	// a real listing, which corrects updates lost to concurrent writers.
+	// A negative value disables periodic reconciliation.
+	// It defaults to DefaultReconcileInterval.
+	ReconcileInterval time.Duration
+
+	Logger logr.Logger
+}
+
+// indexData is the stored format of the index.
+type indexData struct {
+	Version int              `json:"version"`
+	Blobs   map[string]int64 `json:"blobs"` // sizes by name
+}
+
+// Backend maintains an index blob listing all blobs and their sizes, and
+// serves List from it. This replaces a LIST request by a GET, which is
+// cheaper on S3 and faster on backends without efficient listing.
+//
+// Every Store and Delete loads and rewrites the whole index, which costs a
+// GET and a PUT of a size proportional to the number of blobs, so this
+// suits stores that are listed much more often than they are written.
+//
+// Updates of the index are serialized within a Backend, but concurrent
+// writers in different processes can overwrite each other's updates.
+// Periodic reconciliation corrects the index in that case.
+type Backend struct {
+	ctx context.Context
+	st  simpleblob.Interface
+	opt Options
+	log logr.Logger
+
+	mu sync.Mutex // serializes index updates
+}
+
+// load reads the index, rebuilding it if it does not exist yet. It must be
+// called with mu held.
+func (b *Backend) load(ctx context.Context) (indexData, error) {
+	idx, err := b.read(ctx)
+	if errors.Is(err, os.ErrNotExist) {
+		return b.rebuild(ctx)
+	}
+	return idx, err
+}
+
+// read reads the index, failing with os.ErrNotExist if it does not exist.
+func (b *Backend) read(ctx context.Context) (indexData, error) {
+	data, err := b.st.Load(ctx, b.opt.IndexName)
+	if err != nil {
+		return indexData{}, err
+	}
+	var idx indexData
+	if err := json.Unmarshal(data, &idx); err != nil {
+		return indexData{}, fmt.Errorf("index: decode %q: %w", b.opt.IndexName, err)
+	}
+	if idx.Version != 1 {
+		return indexData{}, fmt.Errorf("index: unsupported version %d", idx.Version)
+	}
+	if idx.Blobs == nil {
+		idx.Blobs = make(map[string]int64)
+	}
+	return idx, nil
+}
+
+func (b *Backend) save(ctx context.Context, idx indexData) error {
+	data, err := json.Marshal(idx)
+	if err != nil {
+		return err
+	}
+	return b.st.Store(ctx, b.opt.IndexName, data)
+}
+
+// rebuild creates the index from a real listing and stores it.
+func (b *Backend) rebuild(ctx context.Context) (indexData, error) {
+	blobs, err := b.st.List(ctx, "")
+	if err != nil {
+		return indexData{}, err
+	}
+	idx := indexData{Version: 1, Blobs: make(map[string]int64, len(blobs))}
+	for _, blob := range blobs {
+		if blob.Name == b.opt.IndexName {
+			continue
+		}
+		idx.Blobs[blob.Name] = blob.Size
+	}
+	return idx, b.save(ctx, idx)
+}
+
+// update applies fn to the index and stores it.
+func (b *Backend) update(ctx context.Context, fn func(idx indexData)) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	idx, err := b.load(ctx)
+	if err != nil {
+		return err
+	}
+	fn(idx)
+	return b.save(ctx, idx)
+}
+
+// Reconcile rebuilds the index from a real listing.
+func (b *Backend) Reconcile(ctx context.Context) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	_, err := b.rebuild(ctx)
+	return err
+}
+
+func (b *Backend) reconcileLoop() {
+	ticker := time.NewTicker(b.opt.ReconcileInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := b.Reconcile(b.ctx); err != nil && b.ctx.Err() == nil {
+				b.log.Error(err, "reconcile index")
+			}
+		case <-b.ctx.Done():
+			return
+		}
+	}
+}
+
+func (b *Backend) List(ctx context.Context, prefix string) (simpleblob.BlobList, error) {
+	idx, err := b.read(ctx)
+	if errors.Is(err, os.ErrNotExist) {
+		// The rebuilt index is stored, like an update
+		b.mu.Lock()
+		idx, err = b.load(ctx)
+		b.mu.Unlock()
+	}
+	if err != nil {
+		return nil, err
+	}
+	var blobs simpleblob.BlobList
+	for name, size := range idx.Blobs {
+		if strings.HasPrefix(name, prefix) {
+			blobs = append(blobs, simpleblob.Blob{Name: name, Size: size})
+		}
+	}
+	sort.Sort(blobs)
+	return blobs, nil
+}
+
+func (b *Backend) Load(ctx context.Context, name string) ([]byte, error) {
+	if name == b.opt.IndexName {
+		return nil, os.ErrNotExist
+	}
+	return b.st.Load(ctx, name)
+}
+
+func (b *Backend) Store(ctx context.Context, name string, data []byte) error {
+	if name == b.opt.IndexName {
+		return os.ErrPermission
+	}
+	if err := b.st.Store(ctx, name, data); err != nil {
+		return err
+	}
+	return b.update(ctx, func(idx indexData) {
+		idx.Blobs[name] = int64(len(data))
+	})
+}
+
+func (b *Backend) Delete(ctx context.Context, name string) error {
+	if name == b.opt.IndexName {
+		return os.ErrPermission
+	}
+	if err := b.st.Delete(ctx, name); err != nil {
+		return err
+	}
+	return b.update(ctx, func(idx indexData) {
+		delete(idx.Blobs, name)
+	})
+}
+
+// NewReader satisfies StreamReader, using the wrapped backend's
+// implementation if it has one.
+func (b *Backend) NewReader(ctx context.Context, name string) (io.ReadCloser, error) {
+	if name == b.opt.IndexName {
+		return nil, os.ErrNotExist
+	}
+	return simpleblob.NewReader(ctx, b.st, name)
+}
+
+// NewWriter satisfies StreamWriter. The index is updated on Close.
+func (b *Backend) NewWriter(ctx context.Context, name string) (io.WriteCloser, error) {
+	if name == b.opt.IndexName {
+		return nil, os.ErrPermission
+	}
+	w, err := simpleblob.NewWriter(ctx, b.st, name)
+	if err != nil {
+		return nil, err
+	}
+	return &writer{WriteCloser: w, ctx: ctx, b: b, name: name}, nil
+}
+
+type writer struct {
+	io.WriteCloser
+	ctx  context.Context
+	b    *Backend
+	name string
+	size int64
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	n, err := w.WriteCloser.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+func (w *writer) Close() error {
+	if err := w.WriteCloser.Close(); err != nil {
+		return err
+	}
+	return w.b.update(w.ctx, func(idx indexData) {
+		idx.Blobs[w.name] = w.size
+	})
+}
+
+// New creates a new index wrapper around st.
+// The lifetime of the context passed in must span the lifetime of the whole
+// backend instance, as it is used for periodic reconciliation.
+func New(ctx context.Context, st simpleblob.Interface, opt Options) *Backend {
+	if opt.IndexName == "" {
+		opt.IndexName = DefaultIndexName
+	}
+	if opt.ReconcileInterval == 0 {
+		opt.ReconcileInterval = DefaultReconcileInterval
+	}
+	log := opt.Logger
+	if log.GetSink() == nil {
+		log = logr.Discard()
+	}
+	b := &Backend{
+		ctx: ctx,
+		st:  st,
+		opt: opt,
+		log: log.WithName("index"),
+	}
+	if opt.ReconcileInterval > 0 {
+		go b.reconcileLoop()
+	}
+	return b
+}
@@ -0,0 +1,84 @@
+package index
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/PowerDNS/simpleblob"
+	"github.com/PowerDNS/simpleblob/backends/memory"
+	"github.com/PowerDNS/simpleblob/tester"
+)
+
+func TestBackend(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	tester.DoBackendTests(t, New(ctx, memory.New(), Options{}))
+}
+
+func TestBackend_index(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	st := memory.New()
+	assert.NoError(t, st.Store(ctx, "existing", []byte("1")))
+	b := New(ctx, st, Options{ReconcileInterval: 20 * time.Millisecond})
+
+	// Index is built from existing blobs
+	ls, err := b.List(ctx, "")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"existing"}, ls.Names())
+	_, err = st.Load(ctx, DefaultIndexName)
+	assert.NoError(t, err)
+
+	// Changes bypassing the index are not seen until reconciliation
+	assert.NoError(t, st.Store(ctx, "bypass", []byte("22")))
+	ls, err = b.List(ctx, "")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"existing"}, ls.Names())
+	assert.Eventually(t, func() bool {
+		ls, err := b.List(ctx, "")
+		return err == nil && len(ls) == 2
+	}, time.Second, 10*time.Millisecond)
+}
+
+// slowList is a memory backend calling a hook after its first listing.
+type slowList struct {
+	*memory.Backend
+	calls atomic.Int32
+	after func()
+}
+
+func (s *slowList) List(ctx context.Context, prefix string) (simpleblob.BlobList, error) {
+	ls, err := s.Backend.List(ctx, prefix)
+	if s.calls.Add(1) == 1 {
+		s.after()
+	}
+	return ls, err
+}
+
+func TestBackend_concurrentRebuild(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	st := &slowList{Backend: memory.New()}
+	b := New(ctx, st, Options{ReconcileInterval: -1})
+
+	// A Store happens while the first List rebuilds the index
+	stored := make(chan struct{})
+	st.after = func() {
+		go func() {
+			defer close(stored)
+			assert.NoError(t, b.Store(ctx, "concurrent", []byte("1")))
+		}()
+		time.Sleep(50 * time.Millisecond)
+	}
+	_, err := b.List(ctx, "")
+	assert.NoError(t, err)
+	<-stored
+
+	ls, err := b.List(ctx, "")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"concurrent"}, ls.Names())
+}
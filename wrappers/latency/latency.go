@@ -0,0 +1,134 @@
+package latency
+
+import (
+	"context"
+	"io"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/PowerDNS/simpleblob"
+)
+
+// Delay describes the delay added to one type of operation.
+type Delay struct {
+	// Fixed is always added.
+	Fixed time.Duration
+	// Jitter is the maximum of a random delay added to Fixed.
+	Jitter time.Duration
+}
+
+// Options describes the options for the latency wrapper. The delay of an
+// operation type is used if set, else Default applies.
+type Options struct {
+	Default Delay
+	List    Delay
+	Load    Delay // also used by NewReader
+	Store   Delay // also used by NewWriter and StoreIfAbsent
+	Delete  Delay
+
+	// Seed makes the jitter reproducible. If zero, the current time is used.
+	Seed int64
+}
+
+// Backend delays the operations on a backend, to reproduce slow storage
+// in tests.
+type Backend struct {
+	st  simpleblob.Interface
+	opt Options
+
+	mu  sync.Mutex
+	rnd *rand.Rand
+}
+
+// wait sleeps for the delay d, or the default one if d is not set.
+// It returns early with the context error if ctx is done.
+func (b *Backend) wait(ctx context.Context, d Delay) error {
+	if d == (Delay{}) {
+		d = b.opt.Default
+	}
+	delay := d.Fixed
+	if d.Jitter > 0 {
+		b.mu.Lock()
+		delay += time.Duration(b.rnd.Int63n(int64(d.Jitter)))
+		b.mu.Unlock()
+	}
+	if delay <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(delay)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (b *Backend) List(ctx context.Context, prefix string) (simpleblob.BlobList, error) {
+	if err := b.wait(ctx, b.opt.List); err != nil {
+		return nil, err
+	}
+	return b.st.List(ctx, prefix)
+}
+
+func (b *Backend) Load(ctx context.Context, name string) ([]byte, error) {
+	if err := b.wait(ctx, b.opt.Load); err != nil {
+		return nil, err
+	}
+	return b.st.Load(ctx, name)
+}
+
+func (b *Backend) Store(ctx context.Context, name string, data []byte) error {
+	if err := b.wait(ctx, b.opt.Store); err != nil {
+		return err
+	}
+	return b.st.Store(ctx, name, data)
+}
+
+func (b *Backend) Delete(ctx context.Context, name string) error {
+	if err := b.wait(ctx, b.opt.Delete); err != nil {
+		return err
+	}
+	return b.st.Delete(ctx, name)
+}
+
+// StoreIfAbsent satisfies AbsentStorer, using the wrapped backend's
+// implementation if it has one. It has the delay of Store.
+func (b *Backend) StoreIfAbsent(ctx context.Context, name string, data []byte) error {
+	if err := b.wait(ctx, b.opt.Store); err != nil {
+		return err
+	}
+	return simpleblob.StoreIfAbsent(ctx, b.st, name, data)
+}
+
+// NewReader satisfies StreamReader. The delay is added when opening the
+// reader.
+func (b *Backend) NewReader(ctx context.Context, name string) (io.ReadCloser, error) {
+	if err := b.wait(ctx, b.opt.Load); err != nil {
+		return nil, err
+	}
+	return simpleblob.NewReader(ctx, b.st, name)
+}
+
+// NewWriter satisfies StreamWriter. The delay is added when opening the
+// writer.
+func (b *Backend) NewWriter(ctx context.Context, name string) (io.WriteCloser, error) {
+	if err := b.wait(ctx, b.opt.Store); err != nil {
+		return nil, err
+	}
+	return simpleblob.NewWriter(ctx, b.st, name)
+}
+
+// New creates a new latency wrapper around st.
+func New(st simpleblob.Interface, opt Options) *Backend {
+	if opt.Seed == 0 {
+		opt.Seed = time.Now().UnixNano()
+	}
+	return &Backend{
+		st:  st,
+		opt: opt,
+		rnd: rand.New(rand.NewSource(opt.Seed)),
+	}
+}
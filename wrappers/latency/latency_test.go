@@ -0,0 +1,39 @@
+package latency
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/PowerDNS/simpleblob/backends/memory"
+	"github.com/PowerDNS/simpleblob/tester"
+)
+
+func TestBackend(t *testing.T) {
+	tester.DoBackendTests(t, New(memory.New(), Options{
+		Default: Delay{Jitter: time.Millisecond},
+	}))
+}
+
+func TestBackend_delay(t *testing.T) {
+	ctx := context.Background()
+	b := New(memory.New(), Options{
+		Default: Delay{Fixed: 20 * time.Millisecond},
+		List:    Delay{Fixed: time.Nanosecond},
+	})
+
+	start := time.Now()
+	_, err := b.List(ctx, "")
+	assert.NoError(t, err)
+	assert.Less(t, time.Since(start), 20*time.Millisecond)
+
+	start = time.Now()
+	assert.NoError(t, b.Delete(ctx, "foo"))
+	assert.GreaterOrEqual(t, time.Since(start), 20*time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(ctx, time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, b.Delete(ctx, "foo"), context.DeadlineExceeded)
+}
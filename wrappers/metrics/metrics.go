@@ -0,0 +1,244 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/PowerDNS/simpleblob"
+)
+
+// DefaultNamespace is the default value for Namespace.
+const DefaultNamespace = "storage"
+
+// Options describes the options for the metrics wrapper
+type Options struct {
+	// Namespace is prepended to the metric names, e.g. "storage_call_total".
+	// It defaults to DefaultNamespace.
+	Namespace string
+	// Subsystem is added after the namespace, e.g. "cache" for
+	// "storage_cache_call_total".
+	Subsystem string
+	// Instance, if set, is added as a "storage_instance" label to all
+	// metrics, allowing several wrapped backends to share the same metric
+	// names. The "instance" label is not used, as Prometheus sets it to the
+	// scraped target.
+	Instance string
+	// Registerer is used to register the metrics. It defaults to
+	// prometheus.DefaultRegisterer.
+	Registerer prometheus.Registerer
+}
+
+// Backend records Prometheus metrics for all operations on a backend,
+// like the ones the s3 backend provides natively.
+type Backend struct {
+	st simpleblob.Interface
+
+	lastCallTimestamp *prometheus.GaugeVec
+	calls             *prometheus.CounterVec
+	callErrors        *prometheus.CounterVec
+	callDuration      *prometheus.HistogramVec
+	bytes             *prometheus.CounterVec
+}
+
+// observe records a call to method that started at start.
+func (b *Backend) observe(method string, start time.Time, err error) {
+	b.calls.WithLabelValues(method).Inc()
+	b.lastCallTimestamp.WithLabelValues(method).SetToCurrentTime()
+	b.callDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+	if err != nil {
+		b.callErrors.WithLabelValues(method).Inc()
+	}
+}
+
+func (b *Backend) List(ctx context.Context, prefix string) (simpleblob.BlobList, error) {
+	start := time.Now()
+	blobs, err := b.st.List(ctx, prefix)
+	b.observe("list", start, err)
+	return blobs, err
+}
+
+func (b *Backend) Load(ctx context.Context, name string) ([]byte, error) {
+	start := time.Now()
+	data, err := b.st.Load(ctx, name)
+	b.observe("load", start, err)
+	b.bytes.WithLabelValues("load").Add(float64(len(data)))
+	return data, err
+}
+
+func (b *Backend) Store(ctx context.Context, name string, data []byte) error {
+	start := time.Now()
+	err := b.st.Store(ctx, name, data)
+	b.observe("store", start, err)
+	if err == nil {
+		b.bytes.WithLabelValues("store").Add(float64(len(data)))
+	}
+	return err
+}
+
+func (b *Backend) Delete(ctx context.Context, name string) error {
+	start := time.Now()
+	err := b.st.Delete(ctx, name)
+	b.observe("delete", start, err)
+	return err
+}
+
+// StoreIfAbsent satisfies AbsentStorer, using the wrapped backend's
+// implementation if it has one.
+func (b *Backend) StoreIfAbsent(ctx context.Context, name string, data []byte) error {
+	start := time.Now()
+	err := simpleblob.StoreIfAbsent(ctx, b.st, name, data)
+	b.observe("store_if_absent", start, err)
+	if err == nil {
+		b.bytes.WithLabelValues("store").Add(float64(len(data)))
+	}
+	return err
+}
+
+// NewReader satisfies StreamReader. The call duration only covers opening
+// the reader, bytes are counted as they are read.
+func (b *Backend) NewReader(ctx context.Context, name string) (io.ReadCloser, error) {
+	start := time.Now()
+	r, err := simpleblob.NewReader(ctx, b.st, name)
+	b.observe("load", start, err)
+	if err != nil {
+		return nil, err
+	}
+	return &reader{ReadCloser: r, bytes: b.bytes.WithLabelValues("load")}, nil
+}
+
+// NewWriter satisfies StreamWriter. The call duration only covers opening
+// the writer, bytes are counted as they are written.
+func (b *Backend) NewWriter(ctx context.Context, name string) (io.WriteCloser, error) {
+	start := time.Now()
+	w, err := simpleblob.NewWriter(ctx, b.st, name)
+	b.observe("store", start, err)
+	if err != nil {
+		return nil, err
+	}
+	return &writer{WriteCloser: w, bytes: b.bytes.WithLabelValues("store")}, nil
+}
+
+type reader struct {
+	io.ReadCloser
+	bytes prometheus.Counter
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.bytes.Add(float64(n))
+	return n, err
+}
+
+type writer struct {
+	io.WriteCloser
+	bytes prometheus.Counter
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	n, err := w.WriteCloser.Write(p)
+	w.bytes.Add(float64(n))
+	return n, err
+}
+
+// register registers c, or returns the existing collector if an identical
+// one was already registered, e.g. by a previous instance with the same
+// options.
+func register[T prometheus.Collector](r prometheus.Registerer, c T) (T, error) {
+	err := r.Register(c)
+	var are prometheus.AlreadyRegisteredError
+	if errors.As(err, &are) {
+		if existing, ok := are.ExistingCollector.(T); ok {
+			return existing, nil
+		}
+	}
+	return c, err
+}
+
+// New creates a new metrics wrapper around st and registers its metrics.
+func New(st simpleblob.Interface, opt Options) (*Backend, error) {
+	if opt.Namespace == "" {
+		opt.Namespace = DefaultNamespace
+	}
+	if opt.Registerer == nil {
+		opt.Registerer = prometheus.DefaultRegisterer
+	}
+	var constLabels prometheus.Labels
+	if opt.Instance != "" {
+		constLabels = prometheus.Labels{"storage_instance": opt.Instance}
+	}
+	labels := []string{"method"}
+
+	b := &Backend{st: st}
+	var err error
+	b.lastCallTimestamp, err = register(opt.Registerer, prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace:   opt.Namespace,
+			Subsystem:   opt.Subsystem,
+			Name:        "call_timestamp_seconds",
+			Help:        "UNIX timestamp of last storage call by method",
+			ConstLabels: constLabels,
+		},
+		labels,
+	))
+	if err != nil {
+		return nil, err
+	}
+	b.calls, err = register(opt.Registerer, prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace:   opt.Namespace,
+			Subsystem:   opt.Subsystem,
+			Name:        "call_total",
+			Help:        "Storage calls by method",
+			ConstLabels: constLabels,
+		},
+		labels,
+	))
+	if err != nil {
+		return nil, err
+	}
+	b.callErrors, err = register(opt.Registerer, prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace:   opt.Namespace,
+			Subsystem:   opt.Subsystem,
+			Name:        "call_error_total",
+			Help:        "Storage call errors by method",
+			ConstLabels: constLabels,
+		},
+		labels,
+	))
+	if err != nil {
+		return nil, err
+	}
+	b.callDuration, err = register(opt.Registerer, prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace:   opt.Namespace,
+			Subsystem:   opt.Subsystem,
+			Name:        "call_duration_seconds",
+			Help:        "Storage call duration by method",
+			ConstLabels: constLabels,
+			Buckets:     prometheus.ExponentialBuckets(0.001, 4, 8), // 1ms to 16s
+		},
+		labels,
+	))
+	if err != nil {
+		return nil, err
+	}
+	b.bytes, err = register(opt.Registerer, prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace:   opt.Namespace,
+			Subsystem:   opt.Subsystem,
+			Name:        "bytes_total",
+			Help:        "Bytes loaded and stored by method",
+			ConstLabels: constLabels,
+		},
+		labels,
+	))
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
@@ -0,0 +1,55 @@
+package metrics
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/PowerDNS/simpleblob/backends/memory"
+	"github.com/PowerDNS/simpleblob/tester"
+)
+
+func TestBackend(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	b, err := New(memory.New(), Options{Registerer: reg})
+	require.NoError(t, err)
+	tester.DoBackendTests(t, b)
+
+	assert.Equal(t, 3.0, testutil.ToFloat64(b.callErrors.WithLabelValues("load")))
+	assert.Equal(t, 2.0, testutil.ToFloat64(b.calls.WithLabelValues("delete")))
+	assert.Equal(t, float64(len("foo"+"bar2"+"bar"+"bar1"+"buzz")), testutil.ToFloat64(b.bytes.WithLabelValues("store")))
+}
+
+func TestNew_instances(t *testing.T) {
+	ctx := context.Background()
+	reg := prometheus.NewRegistry()
+	a, err := New(memory.New(), Options{Registerer: reg, Instance: "a"})
+	require.NoError(t, err)
+	b, err := New(memory.New(), Options{Registerer: reg, Instance: "b"})
+	require.NoError(t, err)
+	// Same options share the same metrics
+	a2, err := New(memory.New(), Options{Registerer: reg, Instance: "a"})
+	require.NoError(t, err)
+
+	assert.NoError(t, a.Store(ctx, "foo", []byte("bar")))
+	assert.NoError(t, a2.Store(ctx, "foo", []byte("bar")))
+	assert.NoError(t, b.Delete(ctx, "foo"))
+
+	n, err := testutil.GatherAndCount(reg, "storage_call_total")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, 2.0, testutil.ToFloat64(a.calls.WithLabelValues("store")))
+
+	expected := `
+# HELP storage_call_total Storage calls by method
+# TYPE storage_call_total counter
+storage_call_total{method="delete",storage_instance="b"} 1
+storage_call_total{method="store",storage_instance="a"} 2
+`
+	assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(expected), "storage_call_total"))
+}
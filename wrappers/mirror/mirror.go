@@ -0,0 +1,157 @@
+package mirror
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/go-logr/logr"
+
+	"github.com/PowerDNS/simpleblob"
+)
+
+// Target is one of the backends written to by the mirror.
+type Target struct {
+	Backend simpleblob.Interface
+	// Name identifies the target in logs and errors, e.g. the region.
+	Name string
+	// Optional targets do not cause Store and Delete to fail. Their errors
+	// are only logged.
+	Optional bool
+}
+
+// Options describes the options for the mirror wrapper
+type Options struct {
+	// Concurrent makes Store and Delete write to all targets at once,
+	// instead of one after the other in the order they were given.
+	Concurrent bool
+
+	Logger logr.Logger
+}
+
+// Backend writes to all targets and reads from the first one that
+// answers without error.
+type Backend struct {
+	targets []Target
+	opt     Options
+	log     logr.Logger
+}
+
+func (b *Backend) List(ctx context.Context, prefix string) (simpleblob.BlobList, error) {
+	var errs []error
+	for _, t := range b.targets {
+		blobs, err := t.Backend.List(ctx, prefix)
+		if err == nil {
+			return blobs, nil
+		}
+		b.log.V(1).Info("list failed, trying next target", "target", t.Name, "error", err)
+		errs = append(errs, fmt.Errorf("%s: %w", t.Name, err))
+	}
+	return nil, errors.Join(errs...)
+}
+
+func (b *Backend) Load(ctx context.Context, name string) ([]byte, error) {
+	var errs []error
+	for _, t := range b.targets {
+		data, err := t.Backend.Load(ctx, name)
+		if err == nil || errors.Is(err, os.ErrNotExist) {
+			// A healthy target that does not have the blob is an answer
+			return data, err
+		}
+		b.log.V(1).Info("load failed, trying next target", "target", t.Name, "error", err)
+		errs = append(errs, fmt.Errorf("%s: %w", t.Name, err))
+	}
+	return nil, errors.Join(errs...)
+}
+
+// NewReader satisfies StreamReader, with the same fallback behaviour as Load.
+func (b *Backend) NewReader(ctx context.Context, name string) (io.ReadCloser, error) {
+	var errs []error
+	for _, t := range b.targets {
+		r, err := simpleblob.NewReader(ctx, t.Backend, name)
+		if err == nil || errors.Is(err, os.ErrNotExist) {
+			return r, err
+		}
+		b.log.V(1).Info("reader failed, trying next target", "target", t.Name, "error", err)
+		errs = append(errs, fmt.Errorf("%s: %w", t.Name, err))
+	}
+	return nil, errors.Join(errs...)
+}
+
+func (b *Backend) Store(ctx context.Context, name string, data []byte) error {
+	return b.each(func(t Target) error {
+		return t.Backend.Store(ctx, name, data)
+	})
+}
+
+func (b *Backend) Delete(ctx context.Context, name string) error {
+	return b.each(func(t Target) error {
+		return t.Backend.Delete(ctx, name)
+	})
+}
+
+// each calls fn for every target, sequentially or concurrently depending on
+// the options. Errors of optional targets are logged and discarded.
+func (b *Backend) each(fn func(t Target) error) error {
+	errs := make([]error, len(b.targets))
+	call := func(i int) {
+		t := b.targets[i]
+		err := fn(t)
+		if err == nil {
+			return
+		}
+		if t.Optional {
+			b.log.Error(err, "optional target failed", "target", t.Name)
+			return
+		}
+		errs[i] = fmt.Errorf("%s: %w", t.Name, err)
+	}
+
+	if !b.opt.Concurrent {
+		for i := range b.targets {
+			call(i)
+		}
+		return errors.Join(errs...)
+	}
+
+	var wg sync.WaitGroup
+	for i := range b.targets {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			call(i)
+		}(i)
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// New creates a new mirror over the given targets. Reads are served by
+// the targets in the order given.
+func New(targets []Target, opt Options) (*Backend, error) {
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("mirror: at least one target is required")
+	}
+	targets = append([]Target(nil), targets...)
+	for i := range targets {
+		if targets[i].Backend == nil {
+			return nil, fmt.Errorf("mirror: target %d has no backend", i)
+		}
+		if targets[i].Name == "" {
+			targets[i].Name = fmt.Sprintf("target-%d", i)
+		}
+	}
+
+	log := opt.Logger
+	if log.GetSink() == nil {
+		log = logr.Discard()
+	}
+	return &Backend{
+		targets: targets,
+		opt:     opt,
+		log:     log.WithName("mirror"),
+	}, nil
+}
@@ -0,0 +1,90 @@
+package mirror
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/PowerDNS/simpleblob"
+	"github.com/PowerDNS/simpleblob/backends/memory"
+	"github.com/PowerDNS/simpleblob/tester"
+)
+
+var errBroken = errors.New("broken")
+
+// broken is a backend where every operation fails.
+type broken struct{}
+
+func (broken) List(ctx context.Context, prefix string) (simpleblob.BlobList, error) {
+	return nil, errBroken
+}
+
+func (broken) Load(ctx context.Context, name string) ([]byte, error) {
+	return nil, errBroken
+}
+
+func (broken) Store(ctx context.Context, name string, data []byte) error {
+	return errBroken
+}
+
+func (broken) Delete(ctx context.Context, name string) error {
+	return errBroken
+}
+
+func TestBackend(t *testing.T) {
+	for _, concurrent := range []bool{false, true} {
+		b, err := New([]Target{
+			{Backend: memory.New()},
+			{Backend: memory.New()},
+		}, Options{Concurrent: concurrent})
+		require.NoError(t, err)
+		tester.DoBackendTests(t, b)
+	}
+}
+
+func TestBackend_mirrored(t *testing.T) {
+	ctx := context.Background()
+	m1, m2 := memory.New(), memory.New()
+	b, err := New([]Target{{Backend: m1}, {Backend: m2}}, Options{Concurrent: true})
+	require.NoError(t, err)
+
+	require.NoError(t, b.Store(ctx, "foo", []byte("bar")))
+	for _, m := range []*memory.Backend{m1, m2} {
+		data, err := m.Load(ctx, "foo")
+		assert.NoError(t, err)
+		assert.Equal(t, []byte("bar"), data)
+	}
+}
+
+func TestBackend_errorPolicy(t *testing.T) {
+	ctx := context.Background()
+	m := memory.New()
+
+	b, err := New([]Target{
+		{Backend: broken{}, Name: "eu", Optional: true},
+		{Backend: m, Name: "us"},
+	}, Options{})
+	require.NoError(t, err)
+
+	// Optional target failures are not reported, reads fall through
+	assert.NoError(t, b.Store(ctx, "foo", []byte("bar")))
+	data, err := b.Load(ctx, "foo")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("bar"), data)
+	ls, err := b.List(ctx, "")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"foo"}, ls.Names())
+
+	// Required target failures are
+	b, err = New([]Target{
+		{Backend: m, Name: "us"},
+		{Backend: broken{}, Name: "eu"},
+	}, Options{})
+	require.NoError(t, err)
+	err = b.Store(ctx, "foo", []byte("bar"))
+	assert.ErrorIs(t, err, errBroken)
+	assert.ErrorContains(t, err, "eu")
+}
@@ -0,0 +1,116 @@
+package namepolicy
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/PowerDNS/simpleblob"
+)
+
+// Options describes the options for the namepolicy wrapper
+type Options struct {
+	// MaxLength, if set, is the maximum length of a name in bytes. It can
+	// only lower the limit of simpleblob.MaxNameLength.
+	MaxLength int
+	// AllowedRune, if set, must return true for every rune of a name.
+	AllowedRune func(r rune) bool
+	// Check, if set, is called for every name that passed the other rules.
+	// It should return a *simpleblob.NameError if the name is rejected.
+	Check func(name string) error
+}
+
+// Backend checks blob names with simpleblob.CheckName and the extra rules
+// in Options before passing operations to the wrapped backend.
+// Invalid names are rejected with a *simpleblob.NameError.
+//
+// List prefixes are not checked, since a partial name may legitimately
+// fail the checks.
+type Backend struct {
+	st  simpleblob.Interface
+	opt Options
+}
+
+// CheckName returns a *simpleblob.NameError if name is not allowed.
+func (b *Backend) CheckName(name string) error {
+	if err := simpleblob.CheckName(name); err != nil {
+		return err
+	}
+	if b.opt.MaxLength > 0 && len(name) > b.opt.MaxLength {
+		return &simpleblob.NameError{
+			Name:   name,
+			Reason: fmt.Sprintf("longer than %d bytes", b.opt.MaxLength),
+		}
+	}
+	if b.opt.AllowedRune != nil {
+		for _, r := range name {
+			if !b.opt.AllowedRune(r) {
+				return &simpleblob.NameError{
+					Name:   name,
+					Reason: fmt.Sprintf("rune %q not allowed", r),
+				}
+			}
+		}
+	}
+	if b.opt.Check != nil {
+		return b.opt.Check(name)
+	}
+	return nil
+}
+
+func (b *Backend) List(ctx context.Context, prefix string) (simpleblob.BlobList, error) {
+	return b.st.List(ctx, prefix)
+}
+
+func (b *Backend) Load(ctx context.Context, name string) ([]byte, error) {
+	if err := b.CheckName(name); err != nil {
+		return nil, err
+	}
+	return b.st.Load(ctx, name)
+}
+
+func (b *Backend) Store(ctx context.Context, name string, data []byte) error {
+	if err := b.CheckName(name); err != nil {
+		return err
+	}
+	return b.st.Store(ctx, name, data)
+}
+
+func (b *Backend) Delete(ctx context.Context, name string) error {
+	if err := b.CheckName(name); err != nil {
+		return err
+	}
+	return b.st.Delete(ctx, name)
+}
+
+// StoreIfAbsent satisfies AbsentStorer, using the wrapped backend's
+// implementation if it has one.
+func (b *Backend) StoreIfAbsent(ctx context.Context, name string, data []byte) error {
+	if err := b.CheckName(name); err != nil {
+		return err
+	}
+	return simpleblob.StoreIfAbsent(ctx, b.st, name, data)
+}
+
+// NewReader satisfies StreamReader, using the wrapped backend's
+// implementation if it has one.
+func (b *Backend) NewReader(ctx context.Context, name string) (io.ReadCloser, error) {
+	if err := b.CheckName(name); err != nil {
+		return nil, err
+	}
+	return simpleblob.NewReader(ctx, b.st, name)
+}
+
+// NewWriter satisfies StreamWriter, using the wrapped backend's
+// implementation if it has one.
+func (b *Backend) NewWriter(ctx context.Context, name string) (io.WriteCloser, error) {
+	if err := b.CheckName(name); err != nil {
+		return nil, err
+	}
+	return simpleblob.NewWriter(ctx, b.st, name)
+}
+
+// New creates a new namepolicy wrapper around st.
+func New(st simpleblob.Interface, opt Options) *Backend {
+	return &Backend{st: st, opt: opt}
+}
@@ -0,0 +1,46 @@
+package namepolicy
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"unicode"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/PowerDNS/simpleblob"
+	"github.com/PowerDNS/simpleblob/backends/memory"
+	"github.com/PowerDNS/simpleblob/tester"
+)
+
+func TestBackend(t *testing.T) {
+	tester.DoBackendTests(t, New(memory.New(), Options{}))
+}
+
+func TestBackend_noFolders(t *testing.T) {
+	b := New(memory.New(), Options{
+		AllowedRune: func(r rune) bool {
+			return r != '/'
+		},
+	})
+	tester.DoBackendTestsWith(t, b, tester.Capabilities{NoFolders: true})
+}
+
+func TestBackend_rules(t *testing.T) {
+	ctx := context.Background()
+	b := New(memory.New(), Options{
+		MaxLength: 10,
+		AllowedRune: func(r rune) bool {
+			return r < unicode.MaxASCII
+		},
+	})
+
+	assert.NoError(t, b.Store(ctx, "foo/bar", nil))
+	for _, name := range []string{"../foo", "0123456789a", "ünicode"} {
+		err := b.Store(ctx, name, nil)
+		var nameErr *simpleblob.NameError
+		assert.True(t, errors.As(err, &nameErr), name)
+		_, err = b.Load(ctx, name)
+		assert.True(t, errors.As(err, &nameErr), name)
+	}
+}
@@ -0,0 +1,201 @@
+package ratelimit
+
+import (
+	"context"
+	"io"
+	"math"
+
+	"golang.org/x/time/rate"
+
+	"github.com/PowerDNS/simpleblob"
+)
+
+// Limit describes the rate limits for one direction. A zero rate means
+// no limit.
+type Limit struct {
+	// OpsPerSecond is the number of operations allowed per second.
+	OpsPerSecond float64
+	// OpsBurst is the number of operations allowed at once.
+	// It defaults to one second worth of operations.
+	OpsBurst int
+	// BytesPerSecond is the number of payload bytes allowed per second.
+	BytesPerSecond float64
+	// BytesBurst is the number of bytes allowed at once.
+	// It defaults to one second worth of bytes.
+	BytesBurst int
+}
+
+// Options describes the options for the ratelimit wrapper
+type Options struct {
+	// Read applies to List, Load and NewReader.
+	Read Limit
+	// Write applies to Store, StoreIfAbsent, Delete and NewWriter.
+	Write Limit
+}
+
+// limiters holds the token buckets for one direction.
+type limiters struct {
+	ops   *rate.Limiter
+	bytes *rate.Limiter
+}
+
+func newLimiters(l Limit) limiters {
+	return limiters{
+		ops:   newLimiter(l.OpsPerSecond, l.OpsBurst),
+		bytes: newLimiter(l.BytesPerSecond, l.BytesBurst),
+	}
+}
+
+// newLimiter returns a limiter for r events per second, or nil if r is zero.
+func newLimiter(r float64, burst int) *rate.Limiter {
+	if r <= 0 {
+		return nil
+	}
+	if burst <= 0 {
+		burst = int(math.Max(1, math.Ceil(r)))
+	}
+	return rate.NewLimiter(rate.Limit(r), burst)
+}
+
+func (l limiters) waitOp(ctx context.Context) error {
+	if l.ops == nil {
+		return nil
+	}
+	return l.ops.Wait(ctx)
+}
+
+// waitBytes waits until n bytes are allowed. Amounts larger than the burst
+// size are waited for in multiple steps.
+func (l limiters) waitBytes(ctx context.Context, n int) error {
+	if l.bytes == nil {
+		return nil
+	}
+	for n > 0 {
+		chunk := min(n, l.bytes.Burst())
+		if err := l.bytes.WaitN(ctx, chunk); err != nil {
+			return err
+		}
+		n -= chunk
+	}
+	return nil
+}
+
+// Backend applies token bucket rate limits to the operations on a backend.
+type Backend struct {
+	st    simpleblob.Interface
+	read  limiters
+	write limiters
+}
+
+func (b *Backend) List(ctx context.Context, prefix string) (simpleblob.BlobList, error) {
+	if err := b.read.waitOp(ctx); err != nil {
+		return nil, err
+	}
+	return b.st.List(ctx, prefix)
+}
+
+// Load loads a blob. As its size is not known in advance, the bytes are
+// accounted for after loading, delaying the return of Load.
+func (b *Backend) Load(ctx context.Context, name string) ([]byte, error) {
+	if err := b.read.waitOp(ctx); err != nil {
+		return nil, err
+	}
+	data, err := b.st.Load(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if err := b.read.waitBytes(ctx, len(data)); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func (b *Backend) Store(ctx context.Context, name string, data []byte) error {
+	if err := b.write.waitOp(ctx); err != nil {
+		return err
+	}
+	if err := b.write.waitBytes(ctx, len(data)); err != nil {
+		return err
+	}
+	return b.st.Store(ctx, name, data)
+}
+
+func (b *Backend) Delete(ctx context.Context, name string) error {
+	if err := b.write.waitOp(ctx); err != nil {
+		return err
+	}
+	return b.st.Delete(ctx, name)
+}
+
+// StoreIfAbsent satisfies AbsentStorer, using the wrapped backend's
+// implementation if it has one.
+func (b *Backend) StoreIfAbsent(ctx context.Context, name string, data []byte) error {
+	if err := b.write.waitOp(ctx); err != nil {
+		return err
+	}
+	if err := b.write.waitBytes(ctx, len(data)); err != nil {
+		return err
+	}
+	return simpleblob.StoreIfAbsent(ctx, b.st, name, data)
+}
+
+// NewReader satisfies StreamReader. Bytes are rate limited as they are read.
+func (b *Backend) NewReader(ctx context.Context, name string) (io.ReadCloser, error) {
+	if err := b.read.waitOp(ctx); err != nil {
+		return nil, err
+	}
+	r, err := simpleblob.NewReader(ctx, b.st, name)
+	if err != nil {
+		return nil, err
+	}
+	return &reader{ReadCloser: r, ctx: ctx, lim: b.read}, nil
+}
+
+// NewWriter satisfies StreamWriter. Bytes are rate limited as they are
+// written.
+func (b *Backend) NewWriter(ctx context.Context, name string) (io.WriteCloser, error) {
+	if err := b.write.waitOp(ctx); err != nil {
+		return nil, err
+	}
+	w, err := simpleblob.NewWriter(ctx, b.st, name)
+	if err != nil {
+		return nil, err
+	}
+	return &writer{WriteCloser: w, ctx: ctx, lim: b.write}, nil
+}
+
+type reader struct {
+	io.ReadCloser
+	ctx context.Context
+	lim limiters
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if werr := r.lim.waitBytes(r.ctx, n); werr != nil && err == nil {
+		err = werr
+	}
+	return n, err
+}
+
+type writer struct {
+	io.WriteCloser
+	ctx context.Context
+	lim limiters
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	if err := w.lim.waitBytes(w.ctx, len(p)); err != nil {
+		return 0, err
+	}
+	return w.WriteCloser.Write(p)
+}
+
+// New creates a new ratelimit wrapper around st.
+func New(st simpleblob.Interface, opt Options) *Backend {
+	return &Backend{
+		st:    st,
+		read:  newLimiters(opt.Read),
+		write: newLimiters(opt.Write),
+	}
+}
@@ -0,0 +1,59 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/PowerDNS/simpleblob/backends/memory"
+	"github.com/PowerDNS/simpleblob/tester"
+)
+
+func TestBackend(t *testing.T) {
+	b := New(memory.New(), Options{
+		Read:  Limit{OpsPerSecond: 1000, BytesPerSecond: 1e6},
+		Write: Limit{OpsPerSecond: 1000, BytesPerSecond: 1e6},
+	})
+	tester.DoBackendTests(t, b)
+}
+
+func TestBackend_ops(t *testing.T) {
+	ctx := context.Background()
+	b := New(memory.New(), Options{
+		Write: Limit{OpsPerSecond: 100, OpsBurst: 1},
+	})
+
+	// Reads are not limited
+	start := time.Now()
+	for i := 0; i < 20; i++ {
+		_, err := b.List(ctx, "")
+		require.NoError(t, err)
+	}
+	assert.Less(t, time.Since(start), 50*time.Millisecond)
+
+	start = time.Now()
+	for i := 0; i < 11; i++ {
+		require.NoError(t, b.Delete(ctx, "foo"))
+	}
+	assert.GreaterOrEqual(t, time.Since(start), 90*time.Millisecond)
+}
+
+func TestBackend_bytes(t *testing.T) {
+	ctx := context.Background()
+	b := New(memory.New(), Options{
+		Write: Limit{BytesPerSecond: 1000, BytesBurst: 100},
+	})
+
+	// Payloads larger than the burst are allowed, but take longer
+	start := time.Now()
+	require.NoError(t, b.Store(ctx, "foo", make([]byte, 200)))
+	assert.GreaterOrEqual(t, time.Since(start), 90*time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	err := b.Store(ctx, "foo", make([]byte, 200))
+	assert.Error(t, err)
+}
@@ -0,0 +1,70 @@
+package readonly
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/PowerDNS/simpleblob"
+)
+
+// ErrReadOnly is returned by all write operations. It wraps os.ErrPermission,
+// which the fs backend also returns for names it refuses to write.
+var ErrReadOnly = fmt.Errorf("read-only backend: %w", os.ErrPermission)
+
+// Backend rejects all operations that would modify the wrapped backend.
+type Backend struct {
+	st simpleblob.Interface
+}
+
+func (b *Backend) List(ctx context.Context, prefix string) (simpleblob.BlobList, error) {
+	return b.st.List(ctx, prefix)
+}
+
+func (b *Backend) Load(ctx context.Context, name string) ([]byte, error) {
+	return b.st.Load(ctx, name)
+}
+
+// Store always returns ErrReadOnly.
+func (b *Backend) Store(ctx context.Context, name string, data []byte) error {
+	return fmt.Errorf("store %q: %w", name, ErrReadOnly)
+}
+
+// Delete always returns ErrReadOnly.
+func (b *Backend) Delete(ctx context.Context, name string) error {
+	return fmt.Errorf("delete %q: %w", name, ErrReadOnly)
+}
+
+// StoreIfAbsent always returns ErrReadOnly. It is implemented so that
+// simpleblob.StoreIfAbsent does not report it as unsupported.
+func (b *Backend) StoreIfAbsent(ctx context.Context, name string, data []byte) error {
+	return fmt.Errorf("store %q: %w", name, ErrReadOnly)
+}
+
+// StoreReader always returns ErrReadOnly, without reading r.
+func (b *Backend) StoreReader(ctx context.Context, name string, r io.Reader, size int64) error {
+	return fmt.Errorf("store %q: %w", name, ErrReadOnly)
+}
+
+// Copy always returns ErrReadOnly, without loading src.
+func (b *Backend) Copy(ctx context.Context, src, dst string) error {
+	return fmt.Errorf("copy %q: %w", dst, ErrReadOnly)
+}
+
+// NewReader satisfies StreamReader, using the wrapped backend's
+// implementation if it has one.
+func (b *Backend) NewReader(ctx context.Context, name string) (io.ReadCloser, error) {
+	return simpleblob.NewReader(ctx, b.st, name)
+}
+
+// NewWriter always returns ErrReadOnly. It is implemented so that
+// simpleblob.NewWriter fails immediately instead of on Close.
+func (b *Backend) NewWriter(ctx context.Context, name string) (io.WriteCloser, error) {
+	return nil, fmt.Errorf("write %q: %w", name, ErrReadOnly)
+}
+
+// New returns a read-only view of st.
+func New(st simpleblob.Interface) *Backend {
+	return &Backend{st: st}
+}
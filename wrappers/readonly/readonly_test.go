@@ -0,0 +1,51 @@
+package readonly
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/PowerDNS/simpleblob"
+	"github.com/PowerDNS/simpleblob/backends/memory"
+)
+
+func TestBackend(t *testing.T) {
+	ctx := context.Background()
+	st := memory.New()
+	assert.NoError(t, st.Store(ctx, "foo", []byte("bar")))
+	b := New(st)
+
+	data, err := b.Load(ctx, "foo")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("bar"), data)
+	ls, err := b.List(ctx, "")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"foo"}, ls.Names())
+	r, err := simpleblob.NewReader(ctx, b, "foo")
+	assert.NoError(t, err)
+	assert.NoError(t, r.Close())
+
+	err = b.Store(ctx, "foo", []byte("baz"))
+	assert.ErrorIs(t, err, ErrReadOnly)
+	assert.ErrorIs(t, err, os.ErrPermission)
+	assert.ErrorIs(t, b.Delete(ctx, "foo"), ErrReadOnly)
+	w, err := simpleblob.NewWriter(ctx, b, "foo")
+	assert.ErrorIs(t, err, ErrReadOnly)
+	assert.Nil(t, w)
+	assert.ErrorIs(t, simpleblob.StoreIfAbsent(ctx, b, "new", nil), ErrReadOnly)
+	r2 := strings.NewReader("baz")
+	assert.ErrorIs(t, simpleblob.StoreReader(ctx, b, "foo", r2, -1), ErrReadOnly)
+	assert.Equal(t, 3, r2.Len()) // not read
+	assert.ErrorIs(t, simpleblob.Copy(ctx, b, "foo", "new"), ErrReadOnly)
+
+	// Nothing changed
+	data, err = st.Load(ctx, "foo")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("bar"), data)
+	ls, err = st.List(ctx, "")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"foo"}, ls.Names())
+}
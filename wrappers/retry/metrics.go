@@ -0,0 +1,35 @@
+package retry
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	metricRetries = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "storage_retry_total",
+			Help: "Retried storage operations by method",
+		},
+		[]string{"method"},
+	)
+	metricExhausted = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "storage_retry_exhausted_total",
+			Help: "Storage operations that failed after all attempts by method",
+		},
+		[]string{"method"},
+	)
+	metricBudgetExceeded = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "storage_retry_budget_exceeded_total",
+			Help: "Storage operations not retried because the retry budget was exhausted by method",
+		},
+		[]string{"method"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(metricRetries)
+	prometheus.MustRegister(metricExhausted)
+	prometheus.MustRegister(metricBudgetExceeded)
+}
@@ -0,0 +1,238 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math"
+	"math/rand"
+	"net"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/minio/minio-go/v7"
+
+	"github.com/PowerDNS/simpleblob"
+)
+
+const (
+	// DefaultMaxAttempts is the default value for MaxAttempts.
+	DefaultMaxAttempts = 3
+	// DefaultInitialBackoff is the default value for InitialBackoff.
+	DefaultInitialBackoff = 100 * time.Millisecond
+	// DefaultMaxBackoff is the default value for MaxBackoff.
+	DefaultMaxBackoff = 5 * time.Second
+	// DefaultJitter is the default value for Jitter.
+	DefaultJitter = 0.2
+	// DefaultBudgetRatio is the default value for BudgetRatio.
+	DefaultBudgetRatio = 0.1
+	// DefaultBudgetMax is the default value for BudgetMax.
+	DefaultBudgetMax = 10
+)
+
+// Options describes the options for the retry wrapper
+type Options struct {
+	// MaxAttempts is the maximum number of attempts per operation, including
+	// the first one. It defaults to DefaultMaxAttempts.
+	MaxAttempts int
+	// InitialBackoff is the delay before the first retry. It doubles after
+	// every attempt, up to MaxBackoff.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// Jitter is the fraction of the backoff that is randomized, between 0
+	// and 1. A negative value disables jitter.
+	Jitter float64
+
+	// The retry budget limits the number of retries to a ratio of the
+	// operations, to avoid making an outage worse by multiplying the load.
+	// Every operation adds BudgetRatio to the budget, up to BudgetMax, and
+	// every retry takes 1 from it.
+	// A negative BudgetRatio disables the budget.
+	BudgetRatio float64
+	BudgetMax   float64
+
+	// IsTransient decides if an error is worth retrying.
+	// It defaults to IsTransient.
+	IsTransient func(err error) bool
+
+	Logger logr.Logger
+}
+
+// IsTransient reports whether err is likely to be temporary: timeouts,
+// connection errors and HTTP 5xx responses.
+func IsTransient(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	if errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	var errRes minio.ErrorResponse
+	if errors.As(err, &errRes) && errRes.StatusCode >= 500 {
+		return true
+	}
+	return false
+}
+
+// Backend retries the operations of a backend that fail with a transient
+// error. All operations of Interface are idempotent, so they can safely be
+// retried. Streams returned by NewWriter cannot be retried.
+type Backend struct {
+	st  simpleblob.Interface
+	opt Options
+	log logr.Logger
+
+	mu     sync.Mutex
+	budget float64
+}
+
+// withdraw adds the budget earned by an operation and, if retry is set,
+// takes a retry from it. It returns false if no retry is allowed.
+func (b *Backend) withdraw(retry bool) bool {
+	if b.opt.BudgetRatio < 0 {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !retry {
+		b.budget = math.Min(b.budget+b.opt.BudgetRatio, b.opt.BudgetMax)
+		return true
+	}
+	if b.budget < 1 {
+		return false
+	}
+	b.budget--
+	return true
+}
+
+// backoff returns the delay before the given retry, starting at 1.
+func (b *Backend) backoff(retry int) time.Duration {
+	d := float64(b.opt.InitialBackoff) * math.Pow(2, float64(retry-1))
+	d = math.Min(d, float64(b.opt.MaxBackoff))
+	if b.opt.Jitter > 0 {
+		d += d * b.opt.Jitter * (2*rand.Float64() - 1)
+	}
+	return time.Duration(d)
+}
+
+// do calls fn until it succeeds, fails with a permanent error or runs out
+// of attempts.
+func do[T any](ctx context.Context, b *Backend, method string, fn func() (T, error)) (T, error) {
+	b.withdraw(false)
+	for attempt := 1; ; attempt++ {
+		res, err := fn()
+		if err == nil || !b.opt.IsTransient(err) || ctx.Err() != nil {
+			return res, err
+		}
+		if attempt >= b.opt.MaxAttempts {
+			metricExhausted.WithLabelValues(method).Inc()
+			return res, err
+		}
+		if !b.withdraw(true) {
+			metricBudgetExceeded.WithLabelValues(method).Inc()
+			return res, err
+		}
+		metricRetries.WithLabelValues(method).Inc()
+		delay := b.backoff(attempt)
+		b.log.V(1).Info("retrying", "method", method, "attempt", attempt, "delay", delay, "error", err)
+		t := time.NewTimer(delay)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return res, err
+		}
+	}
+}
+
+func (b *Backend) List(ctx context.Context, prefix string) (simpleblob.BlobList, error) {
+	return do(ctx, b, "list", func() (simpleblob.BlobList, error) {
+		return b.st.List(ctx, prefix)
+	})
+}
+
+func (b *Backend) Load(ctx context.Context, name string) ([]byte, error) {
+	return do(ctx, b, "load", func() ([]byte, error) {
+		return b.st.Load(ctx, name)
+	})
+}
+
+func (b *Backend) Store(ctx context.Context, name string, data []byte) error {
+	_, err := do(ctx, b, "store", func() (struct{}, error) {
+		return struct{}{}, b.st.Store(ctx, name, data)
+	})
+	return err
+}
+
+func (b *Backend) Delete(ctx context.Context, name string) error {
+	_, err := do(ctx, b, "delete", func() (struct{}, error) {
+		return struct{}{}, b.st.Delete(ctx, name)
+	})
+	return err
+}
+
+// StoreIfAbsent satisfies AbsentStorer, using the wrapped backend's
+// implementation if it has one. If an attempt stored the blob but failed
+// anyway, the next attempt returns an error wrapping os.ErrExist.
+func (b *Backend) StoreIfAbsent(ctx context.Context, name string, data []byte) error {
+	_, err := do(ctx, b, "store_if_absent", func() (struct{}, error) {
+		return struct{}{}, simpleblob.StoreIfAbsent(ctx, b.st, name, data)
+	})
+	return err
+}
+
+// NewReader satisfies StreamReader. Only opening the reader is retried,
+// not the reads themselves.
+func (b *Backend) NewReader(ctx context.Context, name string) (io.ReadCloser, error) {
+	return do(ctx, b, "load", func() (io.ReadCloser, error) {
+		return simpleblob.NewReader(ctx, b.st, name)
+	})
+}
+
+// New creates a new retry wrapper around st.
+func New(st simpleblob.Interface, opt Options) *Backend {
+	if opt.MaxAttempts == 0 {
+		opt.MaxAttempts = DefaultMaxAttempts
+	}
+	if opt.InitialBackoff == 0 {
+		opt.InitialBackoff = DefaultInitialBackoff
+	}
+	if opt.MaxBackoff == 0 {
+		opt.MaxBackoff = DefaultMaxBackoff
+	}
+	if opt.Jitter == 0 {
+		opt.Jitter = DefaultJitter
+	}
+	if opt.BudgetRatio == 0 {
+		opt.BudgetRatio = DefaultBudgetRatio
+	}
+	if opt.BudgetMax == 0 {
+		opt.BudgetMax = DefaultBudgetMax
+	}
+	if opt.IsTransient == nil {
+		opt.IsTransient = IsTransient
+	}
+
+	log := opt.Logger
+	if log.GetSink() == nil {
+		log = logr.Discard()
+	}
+	return &Backend{
+		st:     st,
+		opt:    opt,
+		log:    log.WithName("retry"),
+		budget: opt.BudgetMax,
+	}
+}
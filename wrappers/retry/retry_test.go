@@ -0,0 +1,84 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/PowerDNS/simpleblob/backends/memory"
+	"github.com/PowerDNS/simpleblob/tester"
+)
+
+// flaky is a memory backend where Load fails a number of times.
+type flaky struct {
+	*memory.Backend
+	failures int
+	calls    int
+	err      error
+}
+
+func (f *flaky) Load(ctx context.Context, name string) ([]byte, error) {
+	f.calls++
+	if f.calls <= f.failures {
+		return nil, f.err
+	}
+	return f.Backend.Load(ctx, name)
+}
+
+func TestBackend(t *testing.T) {
+	tester.DoBackendTests(t, New(memory.New(), Options{}))
+}
+
+func TestBackend_retry(t *testing.T) {
+	ctx := context.Background()
+	opt := Options{InitialBackoff: time.Millisecond}
+
+	f := &flaky{Backend: memory.New(), failures: 2, err: syscall.ECONNRESET}
+	assert.NoError(t, f.Store(ctx, "foo", []byte("bar")))
+	data, err := New(f, opt).Load(ctx, "foo")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("bar"), data)
+	assert.Equal(t, 3, f.calls)
+
+	// Out of attempts
+	f = &flaky{Backend: memory.New(), failures: 3, err: syscall.ECONNRESET}
+	_, err = New(f, opt).Load(ctx, "foo")
+	assert.ErrorIs(t, err, syscall.ECONNRESET)
+	assert.Equal(t, 3, f.calls)
+
+	// Permanent errors are not retried
+	f = &flaky{Backend: memory.New()}
+	_, err = New(f, opt).Load(ctx, "foo")
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	assert.Equal(t, 1, f.calls)
+}
+
+func TestBackend_budget(t *testing.T) {
+	ctx := context.Background()
+	f := &flaky{Backend: memory.New(), failures: 100, err: syscall.ECONNRESET}
+	b := New(f, Options{
+		InitialBackoff: time.Millisecond,
+		MaxAttempts:    100,
+		BudgetMax:      5,
+	})
+	_, err := b.Load(ctx, "foo")
+	assert.Error(t, err)
+	assert.Equal(t, 6, f.calls) // first attempt and 5 retries
+}
+
+func TestIsTransient(t *testing.T) {
+	assert.True(t, IsTransient(fmt.Errorf("wrapped: %w", syscall.ECONNRESET)))
+	assert.True(t, IsTransient(minio.ErrorResponse{StatusCode: 503, Code: "SlowDown"}))
+	assert.True(t, IsTransient(context.DeadlineExceeded))
+	assert.False(t, IsTransient(minio.ErrorResponse{StatusCode: 403}))
+	assert.False(t, IsTransient(context.Canceled))
+	assert.False(t, IsTransient(os.ErrNotExist))
+	assert.False(t, IsTransient(errors.New("other")))
+}
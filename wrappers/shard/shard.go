@@ -0,0 +1,175 @@
+package shard
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/PowerDNS/simpleblob"
+)
+
+// DefaultVirtualNodes is the default value for VirtualNodes.
+const DefaultVirtualNodes = 128
+
+// Shard is one of the backends keys are distributed over.
+type Shard struct {
+	Backend simpleblob.Interface
+	// Name places the shard on the hash ring. It must be unique and must
+	// not change, or keys will move to other shards. It defaults to the
+	// position of the shard, which means that shards must then always be
+	// passed in the same order.
+	Name string
+}
+
+// Options describes the options for the shard wrapper
+type Options struct {
+	// VirtualNodes is the number of points each shard has on the hash ring.
+	// More points spread keys more evenly. It defaults to DefaultVirtualNodes.
+	VirtualNodes int
+}
+
+// point is a position on the hash ring, owned by a shard.
+type point struct {
+	hash  uint64
+	shard int
+}
+
+// Backend distributes blobs over several backends using consistent
+// hashing, so that adding or removing a shard only moves the keys of
+// that shard.
+//
+// Keys are not moved between shards automatically. List only returns
+// the blobs located on the shard that owns their name, so that every
+// listed blob can be loaded.
+type Backend struct {
+	shards []Shard
+	ring   []point
+}
+
+// ShardFor returns the name of the shard owning key name.
+func (b *Backend) ShardFor(name string) string {
+	return b.shards[b.owner(name)].Name
+}
+
+func (b *Backend) owner(name string) int {
+	h := hash(name)
+	i := sort.Search(len(b.ring), func(i int) bool {
+		return b.ring[i].hash >= h
+	})
+	if i == len(b.ring) {
+		i = 0 // wrap around the ring
+	}
+	return b.ring[i].shard
+}
+
+func (b *Backend) backend(name string) simpleblob.Interface {
+	return b.shards[b.owner(name)].Backend
+}
+
+func (b *Backend) List(ctx context.Context, prefix string) (simpleblob.BlobList, error) {
+	lists := make([]simpleblob.BlobList, len(b.shards))
+	errs := make([]error, len(b.shards))
+	var wg sync.WaitGroup
+	for i, s := range b.shards {
+		wg.Add(1)
+		go func(i int, s Shard) {
+			defer wg.Done()
+			lists[i], errs[i] = s.Backend.List(ctx, prefix)
+		}(i, s)
+	}
+	wg.Wait()
+
+	var blobs simpleblob.BlobList
+	for i, ls := range lists {
+		if errs[i] != nil {
+			return nil, fmt.Errorf("shard %s: %w", b.shards[i].Name, errs[i])
+		}
+		for _, blob := range ls {
+			if b.owner(blob.Name) == i {
+				blobs = append(blobs, blob)
+			}
+		}
+	}
+	sort.Sort(blobs)
+	return blobs, nil
+}
+
+func (b *Backend) Load(ctx context.Context, name string) ([]byte, error) {
+	return b.backend(name).Load(ctx, name)
+}
+
+func (b *Backend) Store(ctx context.Context, name string, data []byte) error {
+	return b.backend(name).Store(ctx, name, data)
+}
+
+func (b *Backend) Delete(ctx context.Context, name string) error {
+	return b.backend(name).Delete(ctx, name)
+}
+
+// NewReader satisfies StreamReader, using the owning shard's
+// implementation if it has one.
+func (b *Backend) NewReader(ctx context.Context, name string) (io.ReadCloser, error) {
+	return simpleblob.NewReader(ctx, b.backend(name), name)
+}
+
+// NewWriter satisfies StreamWriter, using the owning shard's
+// implementation if it has one.
+func (b *Backend) NewWriter(ctx context.Context, name string) (io.WriteCloser, error) {
+	return simpleblob.NewWriter(ctx, b.backend(name), name)
+}
+
+// hash returns the position of s on the ring. SHA-256 spreads short and
+// similar keys evenly, unlike FNV.
+func hash(s string) uint64 {
+	sum := sha256.Sum256([]byte(s))
+	return binary.BigEndian.Uint64(sum[:8])
+}
+
+// New creates a new shard wrapper over the given shards.
+func New(shards []Shard, opt Options) (*Backend, error) {
+	if len(shards) == 0 {
+		return nil, fmt.Errorf("shard: at least one shard is required")
+	}
+	if opt.VirtualNodes == 0 {
+		opt.VirtualNodes = DefaultVirtualNodes
+	}
+	if opt.VirtualNodes < 0 {
+		return nil, fmt.Errorf("shard: VirtualNodes must not be negative")
+	}
+
+	shards = append([]Shard(nil), shards...)
+	seen := make(map[string]bool, len(shards))
+	ring := make([]point, 0, len(shards)*opt.VirtualNodes)
+	for i := range shards {
+		if shards[i].Backend == nil {
+			return nil, fmt.Errorf("shard: shard %d has no backend", i)
+		}
+		if shards[i].Name == "" {
+			shards[i].Name = strconv.Itoa(i)
+		}
+		name := shards[i].Name
+		if seen[name] {
+			return nil, fmt.Errorf("shard: duplicate shard name %q", name)
+		}
+		seen[name] = true
+		for v := 0; v < opt.VirtualNodes; v++ {
+			ring = append(ring, point{
+				hash:  hash(name + "#" + strconv.Itoa(v)),
+				shard: i,
+			})
+		}
+	}
+	sort.Slice(ring, func(i, j int) bool {
+		return ring[i].hash < ring[j].hash
+	})
+
+	return &Backend{
+		shards: shards,
+		ring:   ring,
+	}, nil
+}
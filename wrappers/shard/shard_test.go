@@ -0,0 +1,72 @@
+package shard
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/PowerDNS/simpleblob/backends/memory"
+	"github.com/PowerDNS/simpleblob/tester"
+)
+
+func newShards(names ...string) []Shard {
+	var shards []Shard
+	for _, name := range names {
+		shards = append(shards, Shard{Backend: memory.New(), Name: name})
+	}
+	return shards
+}
+
+func TestBackend(t *testing.T) {
+	b, err := New(newShards("a", "b", "c"), Options{})
+	require.NoError(t, err)
+	tester.DoBackendTests(t, b)
+}
+
+func TestBackend_distribution(t *testing.T) {
+	ctx := context.Background()
+	shards := newShards("a", "b", "c")
+	b, err := New(shards, Options{})
+	require.NoError(t, err)
+
+	const n = 3000
+	for i := 0; i < n; i++ {
+		require.NoError(t, b.Store(ctx, fmt.Sprintf("key-%d", i), nil))
+	}
+	ls, err := b.List(ctx, "")
+	assert.NoError(t, err)
+	assert.Len(t, ls, n)
+
+	for _, s := range shards {
+		ls, err := s.Backend.List(ctx, "")
+		assert.NoError(t, err)
+		assert.InDelta(t, n/len(shards), len(ls), n/10, "shard %s", s.Name)
+	}
+}
+
+func TestBackend_addShard(t *testing.T) {
+	b3, err := New(newShards("a", "b", "c"), Options{})
+	require.NoError(t, err)
+	b4, err := New(newShards("a", "b", "c", "d"), Options{})
+	require.NoError(t, err)
+
+	// Only keys moved to the new shard change owner
+	const n = 1000
+	moved := 0
+	for i := 0; i < n; i++ {
+		name := fmt.Sprintf("key-%d", i)
+		if b3.ShardFor(name) != b4.ShardFor(name) {
+			assert.Equal(t, "d", b4.ShardFor(name))
+			moved++
+		}
+	}
+	assert.InDelta(t, n/4, moved, n/10)
+}
+
+func TestNew_duplicate(t *testing.T) {
+	_, err := New(newShards("a", "a"), Options{})
+	assert.Error(t, err)
+}
@@ -0,0 +1,260 @@
+package versioned
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PowerDNS/simpleblob"
+)
+
+const (
+	// DefaultPrefix is the default value for Prefix.
+	DefaultPrefix = "versions/"
+	// DefaultMaxVersions is the default value for MaxVersions.
+	DefaultMaxVersions = 5
+
+	manifestName = "manifest.json"
+)
+
+// ErrReservedName is returned by Store and Delete for names that would
+// collide with the layout of the stored versions: names under Prefix, and
+// names with a path component that is "manifest.json" or a version id.
+var ErrReservedName = fmt.Errorf("versioned: name is reserved: %w", os.ErrPermission)
+
+// Options describes the options for the versioned wrapper
+type Options struct {
+	// Prefix is where previous versions are stored, as
+	// "<prefix><name>/<id>". It is hidden from List.
+	// It defaults to DefaultPrefix.
+	Prefix string
+	// MaxVersions is the number of previous versions kept per blob.
+	// It defaults to DefaultMaxVersions.
+	MaxVersions int
+}
+
+// entry is a version in the manifest of a blob.
+type entry struct {
+	ID      uint64    `json:"id"`
+	Size    int64     `json:"size"`
+	Time    time.Time `json:"time"`
+	Deleted bool      `json:"deleted,omitempty"`
+}
+
+// manifest lists the versions of a blob, oldest first.
+type manifest struct {
+	NextID   uint64  `json:"next_id"`
+	Versions []entry `json:"versions"`
+}
+
+// Backend keeps previous versions of blobs when they are overwritten or
+// deleted, for backends without native versioning. It implements
+// simpleblob.Versioner.
+//
+// The manifests are read and written without locking across processes, so
+// only one process should write to the blobs at a time.
+type Backend struct {
+	st  simpleblob.Interface
+	opt Options
+
+	mu sync.Mutex // serializes writes
+}
+
+var _ simpleblob.Versioner = (*Backend)(nil)
+
+func (b *Backend) versionName(name string, id uint64) string {
+	return fmt.Sprintf("%s%s/%020d", b.opt.Prefix, name, id)
+}
+
+func (b *Backend) manifestName(name string) string {
+	return b.opt.Prefix + name + "/" + manifestName
+}
+
+// reserved returns whether name collides with the layout of the stored
+// versions, as in "a/manifest.json", whose versions would be stored under
+// the manifest of "a".
+func (b *Backend) reserved(name string) bool {
+	if strings.HasPrefix(name, b.opt.Prefix) {
+		return true
+	}
+	for _, part := range strings.Split(name, "/") {
+		if part == manifestName || isVersionID(part) {
+			return true
+		}
+	}
+	return false
+}
+
+// isVersionID returns whether s has the format of a version in versionName.
+func isVersionID(s string) bool {
+	if len(s) != 20 {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func (b *Backend) loadManifest(ctx context.Context, name string) (manifest, error) {
+	var m manifest
+	data, err := b.st.Load(ctx, b.manifestName(name))
+	if errors.Is(err, os.ErrNotExist) {
+		return m, nil
+	}
+	if err != nil {
+		return m, err
+	}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return m, fmt.Errorf("versioned: decode manifest of %q: %w", name, err)
+	}
+	return m, nil
+}
+
+// archive saves the current content of name as a version, and prunes the
+// oldest versions. b.mu must be held.
+func (b *Backend) archive(ctx context.Context, name string, deleted bool) error {
+	data, err := b.st.Load(ctx, name)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil // nothing to keep
+	}
+	if err != nil {
+		return err
+	}
+	m, err := b.loadManifest(ctx, name)
+	if err != nil {
+		return err
+	}
+	e := entry{ID: m.NextID, Size: int64(len(data)), Time: time.Now().UTC(), Deleted: deleted}
+	if err := b.st.Store(ctx, b.versionName(name, e.ID), data); err != nil {
+		return err
+	}
+	m.NextID++
+	m.Versions = append(m.Versions, e)
+	var pruned []entry
+	if len(m.Versions) > b.opt.MaxVersions {
+		n := len(m.Versions) - b.opt.MaxVersions
+		pruned = m.Versions[:n]
+		m.Versions = append([]entry(nil), m.Versions[n:]...)
+	}
+	mdata, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	if err := b.st.Store(ctx, b.manifestName(name), mdata); err != nil {
+		return err
+	}
+	for _, e := range pruned {
+		if err := b.st.Delete(ctx, b.versionName(name, e.ID)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// List lists the current blobs, hiding the stored versions.
+func (b *Backend) List(ctx context.Context, prefix string) (simpleblob.BlobList, error) {
+	blobs, err := b.st.List(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+	var res simpleblob.BlobList
+	for _, blob := range blobs {
+		if !strings.HasPrefix(blob.Name, b.opt.Prefix) {
+			res = append(res, blob)
+		}
+	}
+	return res, nil
+}
+
+func (b *Backend) Load(ctx context.Context, name string) ([]byte, error) {
+	if strings.HasPrefix(name, b.opt.Prefix) {
+		return nil, os.ErrNotExist
+	}
+	return b.st.Load(ctx, name)
+}
+
+// Store keeps the current content of name as a version, then stores data.
+func (b *Backend) Store(ctx context.Context, name string, data []byte) error {
+	if b.reserved(name) {
+		return fmt.Errorf("store %q: %w", name, ErrReservedName)
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.archive(ctx, name, false); err != nil {
+		return err
+	}
+	return b.st.Store(ctx, name, data)
+}
+
+// Delete keeps the current content of name as a version, then deletes it.
+func (b *Backend) Delete(ctx context.Context, name string) error {
+	if b.reserved(name) {
+		return fmt.Errorf("delete %q: %w", name, ErrReservedName)
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.archive(ctx, name, true); err != nil {
+		return err
+	}
+	return b.st.Delete(ctx, name)
+}
+
+// ListVersions returns the previous versions of name, oldest first.
+// A version marked as Deleted holds the content the blob had when it was
+// deleted.
+func (b *Backend) ListVersions(ctx context.Context, name string) ([]simpleblob.Version, error) {
+	m, err := b.loadManifest(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	var versions []simpleblob.Version
+	for _, e := range m.Versions {
+		versions = append(versions, simpleblob.Version{
+			ID:      strconv.FormatUint(e.ID, 10),
+			Size:    e.Size,
+			Time:    e.Time,
+			Deleted: e.Deleted,
+		})
+	}
+	return versions, nil
+}
+
+// LoadVersion loads a previous version of name.
+func (b *Backend) LoadVersion(ctx context.Context, name, id string) ([]byte, error) {
+	n, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("versioned: invalid version id %q: %w", id, os.ErrNotExist)
+	}
+	return b.st.Load(ctx, b.versionName(name, n))
+}
+
+// Restore makes a previous version of name current again. The content
+// being replaced is kept as a version, like with Store.
+func (b *Backend) Restore(ctx context.Context, name, id string) error {
+	data, err := b.LoadVersion(ctx, name, id)
+	if err != nil {
+		return err
+	}
+	return b.Store(ctx, name, data)
+}
+
+// New creates a new versioned wrapper around st. The wrapped backend must
+// support '/' in blob names.
+func New(st simpleblob.Interface, opt Options) *Backend {
+	if opt.Prefix == "" {
+		opt.Prefix = DefaultPrefix
+	}
+	if opt.MaxVersions <= 0 {
+		opt.MaxVersions = DefaultMaxVersions
+	}
+	return &Backend{st: st, opt: opt}
+}
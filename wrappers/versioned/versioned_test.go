@@ -0,0 +1,80 @@
+package versioned
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/PowerDNS/simpleblob/backends/memory"
+	"github.com/PowerDNS/simpleblob/tester"
+)
+
+func TestBackend(t *testing.T) {
+	tester.DoBackendTests(t, New(memory.New(), Options{}))
+}
+
+func TestBackend_versions(t *testing.T) {
+	ctx := context.Background()
+	st := memory.New()
+	b := New(st, Options{MaxVersions: 3})
+
+	for i := 1; i <= 5; i++ {
+		require.NoError(t, b.Store(ctx, "foo", []byte(fmt.Sprintf("v%d", i))))
+	}
+	versions, err := b.ListVersions(ctx, "foo")
+	require.NoError(t, err)
+	require.Len(t, versions, 3)
+	assert.Equal(t, "1", versions[0].ID)
+	data, err := b.LoadVersion(ctx, "foo", versions[0].ID)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("v2"), data)
+
+	// Pruned versions are gone
+	_, err = b.LoadVersion(ctx, "foo", "0")
+	assert.Error(t, err)
+
+	// Recover a deleted blob
+	require.NoError(t, b.Delete(ctx, "foo"))
+	versions, err = b.ListVersions(ctx, "foo")
+	require.NoError(t, err)
+	last := versions[len(versions)-1]
+	assert.True(t, last.Deleted)
+	require.NoError(t, b.Restore(ctx, "foo", last.ID))
+	data, err = b.Load(ctx, "foo")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("v5"), data)
+
+	ls, err := b.List(ctx, "")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"foo"}, ls.Names())
+}
+
+func TestBackend_reservedNames(t *testing.T) {
+	ctx := context.Background()
+	b := New(memory.New(), Options{})
+
+	require.NoError(t, b.Store(ctx, "a", []byte("v1")))
+	require.NoError(t, b.Store(ctx, "a", []byte("v2")))
+	for _, name := range []string{
+		"a/manifest.json",
+		"a/00000000000000000000",
+		"manifest.json/b",
+		DefaultPrefix + "a/manifest.json",
+	} {
+		assert.ErrorIs(t, b.Store(ctx, name, []byte("x")), ErrReservedName, name)
+		assert.ErrorIs(t, b.Delete(ctx, name), os.ErrPermission, name)
+	}
+	assert.NoError(t, b.Store(ctx, "a/0", []byte("x")))
+
+	// The versions of "a" are intact
+	versions, err := b.ListVersions(ctx, "a")
+	require.NoError(t, err)
+	require.Len(t, versions, 1)
+	data, err := b.LoadVersion(ctx, "a", versions[0].ID)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("v1"), data)
+}